@@ -0,0 +1,95 @@
+// Package armazenamento trata da gravação de arquivos enviados pelos
+// usuários, como os documentos da verificação de identidade, através da
+// interface Armazenamento. O servidor grava os arquivos no diretório local
+// REDCOINS_AR_DIRETORIO ("documentos", por padrão); outros meios de
+// armazenamento podem ser utilizados com DefinePadrao.
+package armazenamento
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Lista de possíveis erros do módulo
+var (
+	ErrChaveInvalida = errors.New("armazenamento: chave inválida")
+	ErrNaoExiste     = errors.New("armazenamento: arquivo não existente")
+)
+
+// Armazenamento é a interface dos meios de armazenamento de arquivos. Cada
+// arquivo é identificado por uma chave, que pode conter apenas letras, dígitos,
+// '.', '-' e '_'.
+type Armazenamento interface {
+	Grava(chave string, conteudo io.Reader) error
+	Abre(chave string) (io.ReadCloser, error)
+	Remove(chave string) error
+}
+
+// padrao é o Armazenamento utilizado por Grava, Abre e Remove
+var padrao Armazenamento
+
+// mutexPadrao protege 'padrao', que pode ser substituído em testes
+var mutexPadrao sync.RWMutex
+
+func init() {
+	// Inicializa as configurações da package com as variáveis de ambiente
+	diretorio := os.Getenv("REDCOINS_AR_DIRETORIO")
+	if diretorio == "" {
+		diretorio = "documentos"
+	}
+	padrao = Local{Diretorio: diretorio}
+}
+
+// Grava grava o conteúdo com a chave passada no Armazenamento padrão
+func Grava(chave string, conteudo io.Reader) error {
+	mutexPadrao.RLock()
+	defer mutexPadrao.RUnlock()
+	return padrao.Grava(chave, conteudo)
+}
+
+// Abre abre o arquivo com a chave passada no Armazenamento padrão
+func Abre(chave string) (io.ReadCloser, error) {
+	mutexPadrao.RLock()
+	defer mutexPadrao.RUnlock()
+	return padrao.Abre(chave)
+}
+
+// Remove remove o arquivo com a chave passada do Armazenamento padrão
+func Remove(chave string) error {
+	mutexPadrao.RLock()
+	defer mutexPadrao.RUnlock()
+	return padrao.Remove(chave)
+}
+
+// Padrao retorna o Armazenamento padrão
+func Padrao() Armazenamento {
+	mutexPadrao.RLock()
+	defer mutexPadrao.RUnlock()
+	return padrao
+}
+
+// DefinePadrao substitui o Armazenamento padrão
+func DefinePadrao(a Armazenamento) {
+	mutexPadrao.Lock()
+	defer mutexPadrao.Unlock()
+	padrao = a
+}
+
+// chaveValida verifica se a chave contém apenas letras, dígitos, '.', '-' e
+// '_' e não é composta apenas por pontos, de forma que não possa referenciar
+// arquivos fora do armazenamento
+func chaveValida(chave string) bool {
+	pontos := 0
+	for _, c := range chave {
+		switch {
+		case c == '.':
+			pontos++
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return chave != "" && pontos != len(chave)
+}
@@ -0,0 +1,27 @@
+package armazenamento
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestChaveValida(t *testing.T) {
+	for _, chave := range []string{"aa11.png", "documento_1-a.PDF", ".oculto"} {
+		if !chaveValida(chave) {
+			t.Errorf("Chave deveria ser válida: %q", chave)
+		}
+	}
+	for _, chave := range []string{"", ".", "..", "../senha", "a/b", `a\b`, "a b", "ç.png"} {
+		if chaveValida(chave) {
+			t.Errorf("Chave deveria ser inválida: %q", chave)
+		}
+	}
+	l := Local{Diretorio: os.TempDir()}
+	if err := l.Grava("../aa11", strings.NewReader("")); err != ErrChaveInvalida {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if _, err := l.Abre(".."); err != ErrChaveInvalida {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
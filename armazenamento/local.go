@@ -0,0 +1,72 @@
+package armazenamento
+
+// Esse arquivo define o armazenamento local, que grava os arquivos em um
+// diretório do servidor
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Local grava cada arquivo no diretório 'Diretorio', com a chave como nome.
+// O diretório é criado na primeira gravação, se não existir.
+type Local struct {
+	Diretorio string
+}
+
+// Grava grava o conteúdo no arquivo da chave, substituindo-o se já existe. O
+// conteúdo é gravado em um arquivo temporário e renomeado ao final, de forma
+// que um arquivo incompleto nunca seja aberto.
+func (l Local) Grava(chave string, conteudo io.Reader) error {
+	if !chaveValida(chave) {
+		return ErrChaveInvalida
+	}
+	if err := os.MkdirAll(l.Diretorio, 0700); err != nil {
+		return err
+	}
+	temp, err := ioutil.TempFile(l.Diretorio, ".temp-")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(temp, conteudo); err != nil {
+		temp.Close()
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	if err := os.Rename(temp.Name(), filepath.Join(l.Diretorio, chave)); err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+	return nil
+}
+
+// Abre abre o arquivo da chave para leitura. Retorna ErrNaoExiste se o
+// arquivo não existe.
+func (l Local) Abre(chave string) (io.ReadCloser, error) {
+	if !chaveValida(chave) {
+		return nil, ErrChaveInvalida
+	}
+	f, err := os.Open(filepath.Join(l.Diretorio, chave))
+	if os.IsNotExist(err) {
+		return nil, ErrNaoExiste
+	}
+	return f, err
+}
+
+// Remove remove o arquivo da chave. Remover um arquivo inexistente não gera
+// erros.
+func (l Local) Remove(chave string) error {
+	if !chaveValida(chave) {
+		return ErrChaveInvalida
+	}
+	if err := os.Remove(filepath.Join(l.Diretorio, chave)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
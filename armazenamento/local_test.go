@@ -0,0 +1,50 @@
+package armazenamento
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	diretorio, err := ioutil.TempDir("", "armazenamento")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(diretorio)
+
+	// O diretório é criado na primeira gravação
+	l := Local{Diretorio: filepath.Join(diretorio, "documentos")}
+	if err := l.Grava("aa11.png", strings.NewReader("conteudo")); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if err := l.Grava("aa11.png", strings.NewReader("substituido")); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	f, err := l.Abre("aa11.png")
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	conteudo, err := ioutil.ReadAll(f)
+	f.Close()
+	if err != nil || string(conteudo) != "substituido" {
+		t.Errorf("Conteúdo inesperado: %s (%v)", conteudo, err)
+	}
+	// Nenhum arquivo temporário permanece no diretório
+	if arquivos, err := ioutil.ReadDir(l.Diretorio); err != nil || len(arquivos) != 1 {
+		t.Errorf("Arquivos inesperados: %v (%v)", arquivos, err)
+	}
+
+	// Remoção
+	if err := l.Remove("aa11.png"); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if _, err := l.Abre("aa11.png"); err != ErrNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := l.Remove("aa11.png"); err != nil {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
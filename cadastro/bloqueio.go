@@ -0,0 +1,192 @@
+package cadastro
+
+// Esse arquivo define a proteção contra tentativas de login por força bruta.
+// As falhas são registradas em memória por conta e por IP de origem: após
+// algumas falhas consecutivas, cada nova tentativa da conta só é aceita após um
+// atraso que dobra a cada falha e, ao atingir o limite configurado, a conta ou
+// o IP é bloqueado temporariamente. As falhas dos códigos de autenticação em
+// dois fatores são registradas separadamente por conta, pois cada senha
+// correta esquece as falhas de login da conta.
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/erros"
+)
+
+// Lista de possíveis erros da proteção contra força bruta
+var (
+	ErrContaBloqueada = erros.Cria(false, 429, "conta_bloqueada")
+)
+
+// tentativasSemAtraso é a quantidade de falhas consecutivas de uma conta
+// aceitas sem atraso entre as tentativas
+const tentativasSemAtraso = 2
+
+// Configurações da proteção contra força bruta
+var (
+	// duracaoBloqueio é a duração do bloqueio de uma conta ou IP e o tempo
+	// após o qual as falhas registradas são esquecidas
+	duracaoBloqueio time.Duration
+	// contas registra as falhas por conta
+	contas *tentativasLogin
+	// ips registra as falhas por IP de origem
+	ips *tentativasLogin
+	// codigos registra as falhas dos códigos de autenticação em dois fatores
+	// por conta
+	codigos *tentativasLogin
+)
+
+func init() {
+	// Inicializa as configurações da proteção com as variáveis de ambiente. Por
+	// padrão, uma conta é bloqueada após 5 falhas consecutivas de senha ou de
+	// código de autenticação em dois fatores e um IP, após 20, por 15 minutos.
+	duracaoBloqueio = 15 * time.Minute
+	if d, err := time.ParseDuration(os.Getenv("REDCOINS_CA_BLOQUEIO")); err == nil && d > 0 {
+		duracaoBloqueio = d
+	}
+	contas = novasTentativasLogin(inteiroVariavel("REDCOINS_CA_TENTATIVAS", 5), true)
+	ips = novasTentativasLogin(inteiroVariavel("REDCOINS_CA_TENTATIVASIP", 20), false)
+	codigos = novasTentativasLogin(inteiroVariavel("REDCOINS_CA_TENTATIVAS", 5), false)
+}
+
+// inteiroVariavel retorna o inteiro positivo da variável de ambiente passada
+// ou 'padrao' se a variável não está definida ou é inválida
+func inteiroVariavel(variavel string, padrao int) int {
+	if n, err := strconv.Atoi(os.Getenv(variavel)); err == nil && n > 0 {
+		return n
+	}
+	return padrao
+}
+
+// falhasLogin são as falhas consecutivas registradas para uma conta ou IP.
+// 'ultima' é o momento da última falha e 'bloqueadoAte', o momento a partir do
+// qual uma nova tentativa é aceita.
+type falhasLogin struct {
+	qtd          int
+	ultima       time.Time
+	bloqueadoAte time.Time
+}
+
+// tentativasLogin registra as falhas de login por chave (conta ou IP).
+// 'limite' é a quantidade de falhas que bloqueia a chave e 'progressivo'
+// indica se as tentativas após tentativasSemAtraso falhas sofrem atraso.
+type tentativasLogin struct {
+	sync.Mutex
+	falhas      map[string]falhasLogin
+	limite      int
+	progressivo bool
+}
+
+// novasTentativasLogin cria um registro de falhas de login vazio
+func novasTentativasLogin(limite int, progressivo bool) *tentativasLogin {
+	return &tentativasLogin{
+		falhas:      make(map[string]falhasLogin),
+		limite:      limite,
+		progressivo: progressivo,
+	}
+}
+
+// bloqueio retorna por quanto tempo, a partir de 'agora', novas tentativas da
+// chave são recusadas
+func (t *tentativasLogin) bloqueio(chave string, agora time.Time) time.Duration {
+	t.Lock()
+	defer t.Unlock()
+	if f, ok := t.falhas[chave]; ok && agora.Before(f.bloqueadoAte) {
+		return f.bloqueadoAte.Sub(agora)
+	}
+	return 0
+}
+
+// registraFalha registra uma falha de login da chave em 'agora'. As falhas
+// sem atividade há mais de duracaoBloqueio são esquecidas.
+func (t *tentativasLogin) registraFalha(chave string, agora time.Time) {
+	t.Lock()
+	defer t.Unlock()
+	for outra, f := range t.falhas {
+		if agora.Sub(f.ultima) > duracaoBloqueio && !agora.Before(f.bloqueadoAte) {
+			delete(t.falhas, outra)
+		}
+	}
+
+	f := t.falhas[chave]
+	f.qtd++
+	f.ultima = agora
+	if f.qtd >= t.limite {
+		f.qtd = 0
+		f.bloqueadoAte = agora.Add(duracaoBloqueio)
+	} else if t.progressivo && f.qtd > tentativasSemAtraso {
+		f.bloqueadoAte = agora.Add(time.Second << uint(f.qtd-tentativasSemAtraso-1))
+	}
+	t.falhas[chave] = f
+}
+
+// remove esquece as falhas registradas para a chave, desbloqueando-a
+func (t *tentativasLogin) remove(chave string) {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.falhas, chave)
+}
+
+// VerificaLoginOrigem verifica os credenciais como VerificaLogin, aplicando a
+// proteção contra força bruta para a conta e para o IP de origem 'ip'.
+// Retorna ErrContaBloqueada se a conta ou o IP está bloqueado, inclusive por
+// falhas de códigos de autenticação em dois fatores, sem verificar os
+// credenciais. Um login bem-sucedido esquece as falhas de senha da conta, mas
+// não as do IP nem as dos códigos, que só são esquecidas com o tempo ou com um
+// código correto.
+func VerificaLoginOrigem(email string, senha string, ip string) (bool, erros.Erros) {
+	agora := time.Now()
+	conta := strings.ToLower(email)
+	if contas.bloqueio(conta, agora) > 0 || codigos.bloqueio(conta, agora) > 0 || ips.bloqueio(ip, agora) > 0 {
+		return false, ErrContaBloqueada
+	}
+	logado, err := VerificaLogin(email, senha)
+	if !erros.Vazio(err) {
+		return false, err
+	}
+	if !logado {
+		contas.registraFalha(conta, agora)
+		ips.registraFalha(ip, agora)
+		return false, erros.CriaVazio()
+	}
+	contas.remove(conta)
+	return true, erros.CriaVazio()
+}
+
+// TempoBloqueio retorna por quanto tempo as tentativas de login da conta a
+// partir do IP passado ainda serão recusadas
+func TempoBloqueio(email string, ip string) time.Duration {
+	agora := time.Now()
+	conta := contas.bloqueio(strings.ToLower(email), agora)
+	if codigo := codigos.bloqueio(strings.ToLower(email), agora); codigo > conta {
+		conta = codigo
+	}
+	if origem := ips.bloqueio(ip, agora); origem > conta {
+		return origem
+	}
+	return conta
+}
+
+// DesbloqueiaRequestHTTP esquece as falhas de login registradas para a conta
+// do campo "email" e para o IP do campo "ip" do request, desbloqueando-os.
+// Campos vazios são ignorados.
+func DesbloqueiaRequestHTTP(r *http.Request) erros.Erros {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	if email := r.FormValue("email"); email != "" {
+		contas.remove(NormalizaEmail(email))
+		codigos.remove(NormalizaEmail(email))
+	}
+	if ip := r.FormValue("ip"); ip != "" {
+		ips.remove(ip)
+	}
+	return erros.CriaVazio()
+}
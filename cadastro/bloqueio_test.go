@@ -0,0 +1,88 @@
+package cadastro
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loteny/redcoins/erros"
+)
+
+func TestTentativasLogin(t *testing.T) {
+	tentativas := novasTentativasLogin(5, true)
+	agora := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	// As primeiras falhas não sofrem atraso
+	for i := 0; i < tentativasSemAtraso; i++ {
+		tentativas.registraFalha("conta", agora)
+		if b := tentativas.bloqueio("conta", agora); b != 0 {
+			t.Errorf("Bloqueio inesperado após %d falhas: %v", i+1, b)
+		}
+	}
+
+	// O atraso dobra a cada falha até o bloqueio
+	for _, esperado := range []time.Duration{time.Second, 2 * time.Second} {
+		tentativas.registraFalha("conta", agora)
+		if b := tentativas.bloqueio("conta", agora); b != esperado {
+			t.Errorf("Atraso inesperado: %v (esperado %v)", b, esperado)
+		}
+		agora = agora.Add(esperado)
+	}
+	tentativas.registraFalha("conta", agora)
+	if b := tentativas.bloqueio("conta", agora); b != duracaoBloqueio {
+		t.Errorf("Bloqueio inesperado: %v", b)
+	}
+	if b := tentativas.bloqueio("outra", agora); b != 0 {
+		t.Errorf("Bloqueio inesperado de outra chave: %v", b)
+	}
+
+	// O bloqueio expira e pode ser removido
+	if b := tentativas.bloqueio("conta", agora.Add(duracaoBloqueio)); b != 0 {
+		t.Errorf("Bloqueio inesperado após a expiração: %v", b)
+	}
+	tentativas.remove("conta")
+	if b := tentativas.bloqueio("conta", agora); b != 0 {
+		t.Errorf("Bloqueio inesperado após a remoção: %v", b)
+	}
+
+	// Sem atraso progressivo, apenas o limite bloqueia
+	tentativas = novasTentativasLogin(3, false)
+	tentativas.registraFalha("ip", agora)
+	tentativas.registraFalha("ip", agora)
+	if b := tentativas.bloqueio("ip", agora); b != 0 {
+		t.Errorf("Bloqueio inesperado: %v", b)
+	}
+	tentativas.registraFalha("ip", agora)
+	if b := tentativas.bloqueio("ip", agora); b != duracaoBloqueio {
+		t.Errorf("Bloqueio inesperado: %v", b)
+	}
+}
+
+func TestVerificaLoginOrigem(t *testing.T) {
+	ip := "198.51.100.7"
+	for i := 0; i <= tentativasSemAtraso; i++ {
+		if logado, err := VerificaLoginOrigem("valido1@gmail.com", "senhaincorreta", ip); logado || !erros.Vazio(err) {
+			t.Fatalf("Retorno inesperado: %v (%v)", logado, err)
+		}
+	}
+
+	// Mesmo a senha correta é recusada durante o atraso
+	if _, err := VerificaLoginOrigem("VALIDO1@gmail.com", "senhavalido1", ip); err.Error() != ErrContaBloqueada.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if b := TempoBloqueio("valido1@gmail.com", "203.0.113.1"); b <= 0 || b > time.Second {
+		t.Errorf("Tempo de bloqueio inesperado: %v", b)
+	}
+
+	// Um login bem-sucedido esquece as falhas da conta
+	contas.remove("valido1@gmail.com")
+	if logado, err := VerificaLoginOrigem("valido1@gmail.com", "senhavalido1", ip); !logado || !erros.Vazio(err) {
+		t.Errorf("Retorno inesperado: %v (%v)", logado, err)
+	}
+	if _, ok := contas.falhas["valido1@gmail.com"]; ok {
+		t.Errorf("Falhas da conta não esquecidas")
+	}
+	if f := ips.falhas[ip]; f.qtd != tentativasSemAtraso+1 {
+		t.Errorf("Falhas do IP inesperadas: %v", f)
+	}
+	ips.remove(ip)
+}
@@ -5,6 +5,7 @@
 package cadastro
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/loteny/redcoins/comunicacao"
@@ -19,21 +20,33 @@ var (
 	ErrEmailInvalido      = erros.Cria(false, 400, "email_invalido")
 	ErrSenhaInvalida      = erros.Cria(false, 400, "senha_invalida")
 	ErrSenhaMuitoLonga    = erros.Cria(false, 400, "senha_longa")
+	ErrSenhaComum         = erros.Cria(false, 400, "senha_comum")
+	ErrEmailDescartavel   = erros.Cria(false, 400, "email_descartavel")
+	ErrIdadeMinima        = erros.Cria(false, 400, "idade_minima")
 	ErrNomeInvalido       = erros.Cria(false, 400, "nome_invalido")
 	ErrNascimentoInvalido = erros.Cria(false, 400, "nascimento_invalido")
+	ErrTokenEmailInvalido = erros.Cria(false, 400, "token_email_invalido")
+	ErrEmailJaVerificado  = erros.Cria(false, 400, "email_ja_verificado")
+	ErrCPFInvalido        = erros.Cria(false, 400, "cpf_invalido")
+	ErrCPFDuplicado       = erros.Cria(false, 400, "cpf_ja_cadastrado")
 )
 
-// Estrutura que contém todos os dados cadastrais de um usuário
+// Estrutura que contém todos os dados cadastrais de um usuário. O CPF é
+// opcional no cadastro e, se presente, contém apenas os dígitos após a
+// validação.
 type dadosCadastrais struct {
 	email      string
 	senha      string
 	nome       string
 	nascimento string
+	cpf        string
 }
 
 // RealizaCadastroRequestHTTP realiza o cadastro de um usuário a partir de um
 // request HTTP. O request e os dados do usuário serão validados com a função
-// ValidaDadosCadastroRequestHTTP.
+// ValidaDadosCadastroRequestHTTP. O usuário é criado com o e-mail não
+// verificado e um link de verificação é enviado ao e-mail; uma falha no envio
+// não impede o cadastro, já que o link pode ser reenviado.
 func RealizaCadastroRequestHTTP(r *http.Request) erros.Erros {
 	// Valida o usuário
 	dados, err := validaDadosCadastroRequestHTTP(r)
@@ -51,27 +64,44 @@ func RealizaCadastroRequestHTTP(r *http.Request) erros.Erros {
 		Senha:      senhaHashed,
 		Nome:       dados.nome,
 		Nascimento: dados.nascimento,
+		CPF:        dados.cpf,
 	}
 	if err := database.InsereUsuario(&usr); err == database.ErrUsuarioDuplicado {
 		return ErrUsuarioDuplicado
+	} else if err == database.ErrCPFDuplicado {
+		return ErrCPFDuplicado
 	} else if err != nil {
 		return erros.CriaInternoPadrao(err)
 	}
+	if err := enviaVerificacao(usr); !erros.Vazio(err) {
+		log.Printf("cadastro: erro ao enviar verificação para %s: %s", usr.Email, err)
+	}
 	return erros.CriaVazio()
 }
 
 // VerificaLoginRequestHTTP verifica se o usuário existe e a senha está correta
 // a partir de um request HTTP por Basic Authentication. Retorna se o usuário
-// foi corretamente autenticado, o seu e-mail e erros.
+// foi corretamente autenticado, o seu e-mail e erros. Usuários com a
+// autenticação em dois fatores ativa não podem utilizar Basic Authentication,
+// já que a senha sozinha não é suficiente para autenticá-los.
 func VerificaLoginRequestHTTP(r *http.Request) (bool, string, erros.Erros) {
 	// Adquire os dados do request
 	email, senha, ok := r.BasicAuth()
 	if !ok {
 		return false, "", erros.CriaVazio()
 	}
+	email = NormalizaEmail(email)
 
-	logado, err := verificaLogin(email, senha)
-	return logado, email, err
+	logado, err := VerificaLoginOrigem(email, senha, comunicacao.IPRequest(r))
+	if !logado || !erros.Vazio(err) {
+		return logado, email, err
+	}
+	if ativo, err := DoisFatoresAtivo(email); !erros.Vazio(err) {
+		return false, email, err
+	} else if ativo {
+		return false, email, ErrDoisFatoresSessao
+	}
+	return true, email, erros.CriaVazio()
 }
 
 // ValidaDadosCadastroRequestHTTP valida os dados cadastrais apropriados
@@ -88,6 +118,7 @@ func validaDadosCadastroRequestHTTP(r *http.Request) (dadosCadastrais, erros.Err
 	dados.senha = r.PostFormValue("senha")
 	dados.nome = r.PostFormValue("nome")
 	dados.nascimento = r.PostFormValue("nascimento")
+	dados.cpf = r.PostFormValue("cpf")
 	// Validação e retorno
 	err := validaDadosCadastro(&dados)
 	return dados, err
@@ -99,16 +130,26 @@ func validaDadosCadastroRequestHTTP(r *http.Request) (dadosCadastrais, erros.Err
 // mensagem de erros apropriados.
 func validaDadosCadastro(dados *dadosCadastrais) erros.Erros {
 	err := erros.CriaVazio()
-	err = erros.JuntaErros(err, email(dados.email))
+	var errEmail, errNome erros.Erros
+	dados.email, errEmail = email(dados.email)
+	err = erros.JuntaErros(err, errEmail)
 	err = erros.JuntaErros(err, senha(dados.senha))
-	err = erros.JuntaErros(err, nome(dados.nome))
+	dados.nome, errNome = nome(dados.nome)
+	err = erros.JuntaErros(err, errNome)
 	err = erros.JuntaErros(err, nascimento(dados.nascimento))
+	if dados.cpf != "" {
+		var errCPF erros.Erros
+		dados.cpf, errCPF = cpf(dados.cpf)
+		err = erros.JuntaErros(err, errCPF)
+	}
 	return err
 }
 
-// verificaLogin verifica se os credenciais existem e estão corretos no banco
-// de dados utilizando encriptação de senhas
-func verificaLogin(email string, senha string) (bool, erros.Erros) {
+// VerificaLogin verifica se os credenciais existem e estão corretos no banco
+// de dados utilizando encriptação de senhas. Se a senha está correta, mas foi
+// encriptada com um algoritmo ou parâmetros antigos, ela é encriptada novamente
+// com os parâmetros atuais; uma falha nessa atualização não impede o login.
+func VerificaLogin(email string, senha string) (bool, erros.Erros) {
 	// Adquire a senha hashed do banco de dados
 	senhaDB, err := database.AdquireSenhaHashed(email)
 	if err == database.ErrUsuarioNaoExiste {
@@ -122,5 +163,19 @@ func verificaLogin(email string, senha string) (bool, erros.Erros) {
 	if err != nil {
 		return false, erros.CriaInternoPadrao(err)
 	}
+	if sucesso && passenc.PrecisaRehash(senhaDB) {
+		if err := atualizaHash(email, senha); err != nil {
+			log.Printf("cadastro: erro ao atualizar a senha hashed de %s: %s", email, err)
+		}
+	}
 	return sucesso, erros.CriaVazio()
 }
+
+// atualizaHash encripta novamente a senha do usuário com os parâmetros atuais
+func atualizaHash(email string, senha string) error {
+	senhaHashed, err := passenc.GeraHashed([]byte(senha))
+	if err != nil {
+		return err
+	}
+	return database.AlteraSenha(email, senhaHashed)
+}
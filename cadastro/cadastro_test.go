@@ -7,6 +7,7 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/loteny/redcoins/database"
 	"github.com/loteny/redcoins/erros"
@@ -31,7 +32,7 @@ func TestRealizaCadastroRequestHTTP(t *testing.T) {
 	// Formulário válido
 	form := url.Values{}
 	form.Set("email", "teste@gmail.com")
-	form.Set("senha", "123456")
+	form.Set("senha", "senhateste1")
 	form.Set("nome", "Ronnie James Dio")
 	form.Set("nascimento", "1942-07-10")
 	// Função que vai chamar a função a ser testada e tratar seu retorno
@@ -46,7 +47,7 @@ func TestRealizaCadastroRequestHTTP(t *testing.T) {
 		if err2 != nil {
 			t.Errorf("Erro inesperado na verificação de cadastro: %v", err2)
 		}
-		if sucesso, err2 := passenc.VerificaSenha([]byte("123456"), senha); err2 != nil {
+		if sucesso, err2 := passenc.VerificaSenha([]byte("senhateste1"), senha); err2 != nil {
 			t.Errorf("Erro inesperado na verificação de cadastro: %v", err2)
 		} else if !sucesso {
 			t.Errorf("Usuário não foi cadastrado corretamente. Senha hash recebida: %v", senha)
@@ -80,6 +81,70 @@ func TestRealizaCadastroRequestHTTP(t *testing.T) {
 	testRealizaRequestHTTPPostForm(t, form, rotaHTTP)
 }
 
+func TestRealizaCadastroCPF(t *testing.T) {
+	form := url.Values{}
+	form.Set("email", "testecadastrocpf@gmail.com")
+	form.Set("senha", "senhateste1")
+	form.Set("nome", "Teste CPF")
+	form.Set("nascimento", "1942-07-10")
+
+	// CPF inválido
+	form.Set("cpf", "123.456.789-00")
+	if err := RealizaCadastroRequestHTTP(testRequestForm("POST", form)); err.Error() != ErrCPFInvalido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	// CPF válido é armazenado sem a pontuação
+	form.Set("cpf", "935.411.347-80")
+	if err := RealizaCadastroRequestHTTP(testRequestForm("POST", form)); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if usr, err := database.AdquireUsuario("testecadastrocpf@gmail.com"); err != nil || usr.CPF != "93541134780" {
+		t.Errorf("Usuário inesperado: %v (%v)", usr, err)
+	}
+	// CPF já cadastrado
+	form.Set("email", "testecadastrocpf2@gmail.com")
+	if err := RealizaCadastroRequestHTTP(testRequestForm("POST", form)); err.Error() != ErrCPFDuplicado.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+func TestRealizaCadastroNormalizacao(t *testing.T) {
+	form := url.Values{}
+	form.Set("email", " TesteNormalizacao@Gmail.com ")
+	form.Set("senha", "senhateste1")
+	form.Set("nome", " Jose\u0301 da Silva ")
+	form.Set("nascimento", "1942-07-10")
+
+	// O e-mail e o nome são armazenados normalizados
+	if err := RealizaCadastroRequestHTTP(testRequestForm("POST", form)); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if usr, err := database.AdquireUsuario("testenormalizacao@gmail.com"); err != nil ||
+		usr.Email != "testenormalizacao@gmail.com" || usr.Nome != "José da Silva" {
+		t.Errorf("Usuário inesperado: %v (%v)", usr, err)
+	}
+	// O mesmo e-mail com letras maiúsculas diferentes já está cadastrado
+	form.Set("email", "TESTENORMALIZACAO@gmail.com")
+	if err := RealizaCadastroRequestHTTP(testRequestForm("POST", form)); err.Error() != ErrUsuarioDuplicado.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	// O login aceita o e-mail com letras maiúsculas
+	r := testRequestForm("POST", url.Values{})
+	r.SetBasicAuth("TesteNormalizacao@gmail.com", "senhateste1")
+	if logado, email, err := VerificaLoginRequestHTTP(r); !erros.Vazio(err) || !logado || email != "testenormalizacao@gmail.com" {
+		t.Errorf("Login inesperado: %v %s (%v)", logado, email, err)
+	}
+	// Domínio descartável, senha comum e idade mínima
+	form.Set("email", "teste@mailinator.com")
+	form.Set("senha", "senha123")
+	form.Set("nascimento", time.Now().AddDate(-17, 0, 0).Format("2006-01-02"))
+	erroEsperado := erros.JuntaErros(ErrEmailDescartavel, ErrSenhaComum)
+	erroEsperado = erros.JuntaErros(erroEsperado, ErrIdadeMinima)
+	if err := RealizaCadastroRequestHTTP(testRequestForm("POST", form)); err.Error() != erroEsperado.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
 func TestVerificaLoginRequestHTTP(t *testing.T) {
 	// Usuário e senhas corretos - autenticação bem-sucedida
 	form := url.Values{}
@@ -114,7 +179,7 @@ func TestVerificaLoginRequestHTTP(t *testing.T) {
 			t.Errorf("Usuário foi logado quando não deveria ter sido (conta inexistente).")
 		}
 	}
-	testRealizaRequestHTTPPostFormAuth(t, form, rotaHTTP, "email-nao-cadastrado@gmail.com", "123456")
+	testRealizaRequestHTTPPostFormAuth(t, form, rotaHTTP, "email-nao-cadastrado@gmail.com", "senhateste1")
 
 	// Senha incorreta
 	rotaHTTP = func(w http.ResponseWriter, r *http.Request) {
@@ -128,6 +193,44 @@ func TestVerificaLoginRequestHTTP(t *testing.T) {
 	testRealizaRequestHTTPPostFormAuth(t, form, rotaHTTP, "valido1@gmail.com", "senhaincorreta")
 }
 
+func TestVerificaLoginRehash(t *testing.T) {
+	// Usuário com a senha encriptada com parâmetros antigos
+	antiga, err := passenc.GeraHashedParametros([]byte("senharehash"),
+		passenc.Parametros{Algoritmo: passenc.Bcrypt, Custo: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	usr := database.Usuario{
+		Email:      "testerehash@gmail.com",
+		Senha:      antiga,
+		Nome:       "Teste Rehash",
+		Nascimento: "1994-03-07",
+	}
+	if err := database.InsereUsuario(&usr); err != nil {
+		t.Fatal(err)
+	}
+
+	// Uma senha incorreta não altera a senha hashed
+	if logado, err := VerificaLogin(usr.Email, "senhaincorreta"); logado || !erros.Vazio(err) {
+		t.Errorf("Retorno inesperado: %v (%v)", logado, err)
+	}
+	if senha, _ := database.AdquireSenhaHashed(usr.Email); string(senha) != string(antiga) {
+		t.Errorf("Senha hashed alterada: %s", senha)
+	}
+
+	// O login bem-sucedido atualiza a senha hashed
+	if logado, err := VerificaLogin(usr.Email, "senharehash"); !logado || !erros.Vazio(err) {
+		t.Errorf("Retorno inesperado: %v (%v)", logado, err)
+	}
+	senha, err := database.AdquireSenhaHashed(usr.Email)
+	if err != nil || passenc.PrecisaRehash(senha) {
+		t.Errorf("Senha hashed não atualizada: %s (%v)", senha, err)
+	}
+	if logado, err := VerificaLogin(usr.Email, "senharehash"); !logado || !erros.Vazio(err) {
+		t.Errorf("Retorno inesperado após a atualização: %v (%v)", logado, err)
+	}
+}
+
 // testRealizaRequestHTTPPostForm é uma função auxiliar para geração de requests
 // HTTP com formulário POST. A função 'f' vai receber e processar o request
 // HTTP.
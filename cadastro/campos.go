@@ -1,41 +1,94 @@
 package cadastro
 
 import (
+	"net/mail"
 	"regexp"
+	"strings"
 	"time"
+	"unicode"
 	"unicode/utf8"
 
 	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/passenc"
+	"golang.org/x/text/unicode/norm"
 )
 
-// email verifica se o e-mail é válido (formato regex /.+@.+/) e possui no
-// máximo 128 caracteres
-func email(email string) erros.Erros {
-	if utf8.RuneCountInString(email) > 128 {
-		return ErrEmailInvalido
+// NormalizaEmail remove os espaços ao redor do e-mail e converte suas letras
+// para minúsculas, de forma que o mesmo endereço escrito de formas diferentes
+// identifique a mesma conta
+func NormalizaEmail(e string) string {
+	return strings.ToLower(strings.TrimSpace(e))
+}
+
+// email verifica se o e-mail é um endereço simples válido ("usuario@dominio",
+// sem nome de exibição), se o domínio possui pelo menos um ponto, se possui no
+// máximo 128 caracteres e se o domínio não está bloqueado pela política de
+// cadastro. Retorna o e-mail normalizado.
+func email(e string) (string, erros.Erros) {
+	e = NormalizaEmail(e)
+	if utf8.RuneCountInString(e) > 128 {
+		return "", ErrEmailInvalido
+	}
+	endereco, err := mail.ParseAddress(e)
+	if err != nil || endereco.Name != "" || endereco.Address != e {
+		return "", ErrEmailInvalido
+	}
+	dominio := e[strings.LastIndex(e, "@")+1:]
+	if !strings.Contains(dominio, ".") {
+		return "", ErrEmailInvalido
+	}
+	for _, parte := range strings.Split(dominio, ".") {
+		if parte == "" {
+			return "", ErrEmailInvalido
+		}
 	}
-	return validacaoMatchSimples(email, "^.+@.+$", ErrEmailInvalido)
+	if PoliticaPadrao().DominioBloqueado(dominio) {
+		return "", ErrEmailDescartavel
+	}
+	return e, erros.CriaVazio()
 }
 
-// senha verifica se a senha possui pelo menos 6 caracteres e no máximo 50 bytes
+// senha verifica se a senha possui pelo menos o tamanho mínimo da política de
+// cadastro, no máximo o tamanho aceito pelo algoritmo de encriptação
+// configurado (72 bytes para o bcrypt e 256 bytes para o Argon2id) e se não
+// está na lista de senhas comuns
 func senha(senha string) erros.Erros {
-	if len([]byte(senha)) > 50 {
+	p := PoliticaPadrao()
+	if len([]byte(senha)) > passenc.TamanhoMaximo() {
 		return ErrSenhaMuitoLonga
 	}
-	return validacaoMatchSimples(senha, "^.{6,}$", ErrSenhaInvalida)
+	if utf8.RuneCountInString(senha) < p.TamanhoMinimoSenha {
+		return ErrSenhaInvalida
+	}
+	if p.SenhaComum(senha) {
+		return ErrSenhaComum
+	}
+	return erros.CriaVazio()
 }
 
-// nome verifica se o campo não está vazio e se não excede 128 caracteres
-func nome(nome string) erros.Erros {
-	if utf8.RuneCountInString(nome) <= 0 || utf8.RuneCountInString(nome) > 128 {
-		return ErrNomeInvalido
+// nome normaliza o nome na forma NFC, remove os espaços ao redor e verifica
+// se o resultado não está vazio, não excede 128 caracteres e não possui
+// caracteres de controle. Retorna o nome normalizado.
+func nome(n string) (string, erros.Erros) {
+	if !utf8.ValidString(n) {
+		return "", ErrNomeInvalido
 	}
-	return erros.CriaVazio()
+	n = strings.TrimSpace(norm.NFC.String(n))
+	if utf8.RuneCountInString(n) <= 0 || utf8.RuneCountInString(n) > 128 {
+		return "", ErrNomeInvalido
+	}
+	for _, c := range n {
+		if unicode.IsControl(c) {
+			return "", ErrNomeInvalido
+		}
+	}
+	return n, erros.CriaVazio()
 }
 
-// nascimento verifica se a data está no formato válido (YYYY-MM-DD) e se a data
-// é passada. Problemas com fuso horário não são importantes, visto que só
-// seriam possivelmente bloqueados datas de nascimentos de recém-nascidos por
+// nascimento verifica se a data está no formato válido (YYYY-MM-DD), se a data
+// é passada e se o usuário possui a idade mínima da política de cadastro.
+// Problemas com fuso horário não são importantes, visto que só seriam
+// possivelmente bloqueados datas de nascimentos de recém-nascidos por
 // problemas de fuso horário. Além disso, o 'Time' resultante da data de entrada
 // estará no início do dia (00h00m00...), portanto, há uma "margem de erro"
 // nessa função, mas essa margem é pequena (algumas horas, possivelmente alguns
@@ -50,9 +103,38 @@ func nascimento(data string) erros.Erros {
 	if dataTime.After(agora) {
 		return ErrNascimentoInvalido
 	}
+	if dataTime.AddDate(PoliticaPadrao().IdadeMinima, 0, 0).After(agora) {
+		return ErrIdadeMinima
+	}
 	return erros.CriaVazio()
 }
 
+// cpf verifica se o CPF, com ou sem a pontuação ("000.000.000-00"), possui 11
+// dígitos que não são todos iguais e se seus dois dígitos verificadores estão
+// corretos. Retorna o CPF apenas com os dígitos.
+func cpf(c string) (string, erros.Erros) {
+	c = strings.NewReplacer(".", "", "-", "").Replace(strings.TrimSpace(c))
+	if err := validacaoMatchSimples(c, "^[0-9]{11}$", ErrCPFInvalido); !erros.Vazio(err) {
+		return "", err
+	}
+	if strings.Count(c, c[:1]) == len(c) {
+		return "", ErrCPFInvalido
+	}
+	// Cada dígito verificador é calculado a partir dos dígitos anteriores,
+	// com pesos decrescentes de n+1 até 2
+	for n := 9; n <= 10; n++ {
+		soma := 0
+		for i := 0; i < n; i++ {
+			soma += int(c[i]-'0') * (n + 1 - i)
+		}
+		digito := soma * 10 % 11 % 10
+		if int(c[n]-'0') != digito {
+			return "", ErrCPFInvalido
+		}
+	}
+	return c, erros.CriaVazio()
+}
+
 // validacaoMatchSimples executa uma validação básica com um regex passado como
 // argumento. Retorna o erro gerado pela função do regex, caso houve algum, ou o
 // erro passado por argumento para essa função no caso de o regex não bater com
@@ -3,49 +3,81 @@ package cadastro
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/passenc"
 )
 
 func TestEmailInvalido(t *testing.T) {
-	// E-mail válido
-	if err := email("teste@gmail.com"); !erros.Vazio(err) {
-		t.Errorf("E-mail deveria ser válido e retornou o seguinte erro: %v", err)
+	// E-mails válidos são retornados normalizados
+	validos := map[string]string{
+		"teste@gmail.com":          "teste@gmail.com",
+		" Teste.Nome@Gmail.COM ":   "teste.nome@gmail.com",
+		"teste+redcoins@gmail.com": "teste+redcoins@gmail.com",
+	}
+	for entrada, esperado := range validos {
+		if e, err := email(entrada); !erros.Vazio(err) || e != esperado {
+			t.Errorf("Retorno inesperado para %q: %v (%v)", entrada, e, err)
+		}
+	}
+
+	// Formato inválido, nome de exibição e domínio sem ponto
+	invalidos := []string{"", "emailinvalido.com", "teste@", "@gmail.com", "Teste <teste@gmail.com>",
+		"teste@localhost", "teste@gmail..com", "teste@gmail.com.", "a b@gmail.com"}
+	for _, entrada := range invalidos {
+		if _, err := email(entrada); err.Error() != ErrEmailInvalido.Error() {
+			t.Errorf("Erro inesperado para %q: %v", entrada, err)
+		}
 	}
 
-	// Formato inválido
-	if err := email("emailinvalido.com"); err.Error() != ErrEmailInvalido.Error() {
-		t.Errorf("E-mail deveria ser inválido e retornou o seguinte erro: %v", err)
+	// Domínios descartáveis e seus subdomínios
+	for _, entrada := range []string{"teste@mailinator.com", "teste@MAILINATOR.com", "teste@abc.yopmail.com"} {
+		if _, err := email(entrada); err.Error() != ErrEmailDescartavel.Error() {
+			t.Errorf("Erro inesperado para %q: %v", entrada, err)
+		}
 	}
 }
 
 func TestSenha(t *testing.T) {
 	// Número abaixo do mínimo de caracteres
-	if err := senha("abc"); err.Error() != ErrSenhaInvalida.Error() {
+	if err := senha("abcdefg"); err.Error() != ErrSenhaInvalida.Error() {
 		t.Errorf("Erro retornado: %v", err)
 	}
-	// Número mínimo de caracteres
-	if err := senha("abcdef"); !erros.Vazio(err) {
+	// Número mínimo de caracteres, contados em caracteres e não em bytes
+	if err := senha("abcdefgh"); !erros.Vazio(err) {
 		t.Errorf("Erro retornado: %v", err)
 	}
-	// Número normal de caracteres
-	if err := senha("abcdefgh"); !erros.Vazio(err) {
+	if err := senha("çãõéíóúà"); !erros.Vazio(err) {
+		t.Errorf("Erro retornado: %v", err)
+	}
+	// Senhas comuns, independentemente de letras maiúsculas
+	if err := senha("12345678"); err.Error() != ErrSenhaComum.Error() {
+		t.Errorf("Erro retornado: %v", err)
+	}
+	if err := senha("PassWord"); err.Error() != ErrSenhaComum.Error() {
 		t.Errorf("Erro retornado: %v", err)
 	}
 	// Número acima do máximo de caracteres
-	if err := senha(strings.Repeat("a", 65)); err.Error() != ErrSenhaMuitoLonga.Error() {
+	if err := senha(strings.Repeat("a", passenc.TamanhoMaximo()+1)); err.Error() != ErrSenhaMuitoLonga.Error() {
 		t.Errorf("Erro retornado: %v", err)
 	}
 }
 
 func TestNome(t *testing.T) {
-	// Nome vazio
-	if err := nome(""); err.Error() != ErrNomeInvalido.Error() {
-		t.Errorf("Erro retornado: %v", err)
+	// Nome vazio, apenas espaços, com caracteres de controle e UTF-8 inválido
+	for _, entrada := range []string{"", "   ", "Ronnie\nDio", "Ronnie\x00Dio", "Ronnie \xff"} {
+		if _, err := nome(entrada); err.Error() != ErrNomeInvalido.Error() {
+			t.Errorf("Erro inesperado para %q: %v", entrada, err)
+		}
 	}
 	// Nome válido
-	if err := nome("Ronnie James Dio"); !erros.Vazio(err) {
-		t.Errorf("Erro retornado: %v", err)
+	if n, err := nome(" Ronnie James Dio "); !erros.Vazio(err) || n != "Ronnie James Dio" {
+		t.Errorf("Retorno inesperado: %q (%v)", n, err)
+	}
+	// Nome na forma decomposta é normalizado na forma composta (NFC)
+	if n, err := nome("Jose\u0301 Conceic\u0327a\u0303o"); !erros.Vazio(err) || n != "José Conceição" {
+		t.Errorf("Retorno inesperado: %q (%v)", n, err)
 	}
 }
 
@@ -65,8 +97,35 @@ func TestNascimento(t *testing.T) {
 	if err := nascimento("5012-01-25"); err.Error() != ErrNascimentoInvalido.Error() {
 		t.Errorf("Erro retornado: %v", err)
 	}
-	// Datas passadas
-	if err := nascimento("2015-03-07"); !erros.Vazio(err) {
+	// Datas passadas, abaixo e acima da idade mínima
+	if err := nascimento(time.Now().AddDate(-18, 0, 1).Format("2006-01-02")); err.Error() != ErrIdadeMinima.Error() {
+		t.Errorf("Erro retornado: %v", err)
+	}
+	if err := nascimento(time.Now().AddDate(-18, 0, -1).Format("2006-01-02")); !erros.Vazio(err) {
+		t.Errorf("Erro retornado: %v", err)
+	}
+	if err := nascimento("1994-03-07"); !erros.Vazio(err) {
 		t.Errorf("Erro retornado: %v", err)
 	}
 }
+
+func TestCPF(t *testing.T) {
+	// CPFs válidos, com e sem pontuação
+	validos := map[string]string{
+		"529.982.247-25":  "52998224725",
+		"11144477735":     "11144477735",
+		" 390.533.447-05": "39053344705",
+	}
+	for entrada, esperado := range validos {
+		if c, err := cpf(entrada); !erros.Vazio(err) || c != esperado {
+			t.Errorf("Retorno inesperado para %q: %v (%v)", entrada, c, err)
+		}
+	}
+	// Formatação incorreta, dígitos repetidos e dígitos verificadores errados
+	invalidos := []string{"", "5299822472", "529982247251", "529.982.247-2a", "111.111.111-11", "52998224726", "52998224735"}
+	for _, entrada := range invalidos {
+		if _, err := cpf(entrada); err.Error() != ErrCPFInvalido.Error() {
+			t.Errorf("Erro inesperado para %q: %v", entrada, err)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package cadastro
+
+// Esse arquivo define a autenticação em dois fatores: o cadastro do segredo
+// TOTP, sua confirmação, os códigos de recuperação e a verificação do segundo
+// fator nas operações que o exigem
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+// Lista de possíveis erros da autenticação em dois fatores
+var (
+	ErrDoisFatoresAtivo   = erros.Cria(false, 400, "dois_fatores_ja_ativo")
+	ErrDoisFatoresInativo = erros.Cria(false, 400, "dois_fatores_inativo")
+	ErrCodigoObrigatorio  = erros.Cria(false, 401, "codigo_2fa_obrigatorio")
+	ErrCodigoInvalido     = erros.Cria(false, 401, "codigo_2fa_invalido")
+	ErrDoisFatoresSessao  = erros.Cria(false, 403, "dois_fatores_exige_sessao")
+)
+
+// qtdCodigosRecuperacao é a quantidade de códigos de recuperação gerados na
+// ativação da autenticação em dois fatores
+const qtdCodigosRecuperacao = 10
+
+// formatoData é o formato das colunas DATETIME do banco de dados
+const formatoData = "2006-01-02 15:04:05"
+
+// IniciaDoisFatoresHTTP gera um novo segredo TOTP para o usuário e retorna os
+// bytes da string JSON com o segredo e a URI de provisionamento, que pode ser
+// exibida como QR code. A autenticação em dois fatores só passa a ser exigida
+// após a confirmação com ConfirmaDoisFatoresHTTP.
+func IniciaDoisFatoresHTTP(email string) ([]byte, erros.Erros) {
+	if ativo, err := DoisFatoresAtivo(email); !erros.Vazio(err) {
+		return nil, err
+	} else if ativo {
+		return nil, ErrDoisFatoresAtivo
+	}
+	segredo, err := geraSegredoTOTP()
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	if err := database.DefineSegredoTOTP(email, segredo); err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+
+	resposta, err := json.Marshal(map[string]string{
+		"segredo": segredo,
+		"uri":     uriTOTP(segredo, email),
+	})
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	return resposta, erros.CriaVazio()
+}
+
+// ConfirmaDoisFatoresHTTP ativa a autenticação em dois fatores do usuário se
+// o campo "codigo" do request corresponde ao segredo gerado por
+// IniciaDoisFatoresHTTP. Retorna os bytes da string JSON com os códigos de
+// recuperação, que não podem ser consultados novamente.
+func ConfirmaDoisFatoresHTTP(r *http.Request, email string) ([]byte, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	totp, err := database.AdquireTOTP(email)
+	if err == database.ErrTOTPNaoExiste {
+		return nil, ErrDoisFatoresInativo
+	} else if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	} else if totp.Ativo {
+		return nil, ErrDoisFatoresAtivo
+	}
+	passo, ok := verificaCodigoTOTP(totp.Segredo, r.PostFormValue("codigo"), time.Now())
+	if !ok {
+		return nil, ErrCodigoInvalido
+	}
+
+	codigos := make([]string, 0, qtdCodigosRecuperacao)
+	hashes := make([]string, 0, qtdCodigosRecuperacao)
+	for i := 0; i < qtdCodigosRecuperacao; i++ {
+		codigo, err := geraCodigoRecuperacao()
+		if err != nil {
+			return nil, erros.CriaInternoPadrao(err)
+		}
+		codigos = append(codigos, codigo)
+		hashes = append(hashes, hashCodigoRecuperacao(codigo))
+	}
+	if ativado, err := database.AtivaTOTP(email, passo, hashes); err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	} else if !ativado {
+		return nil, ErrCodigoInvalido
+	}
+
+	resposta, err := json.Marshal(map[string][]string{"codigosRecuperacao": codigos})
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	return resposta, erros.CriaVazio()
+}
+
+// DesativaDoisFatoresHTTP desativa a autenticação em dois fatores do usuário.
+// O campo "codigo" do request deve conter um código TOTP ou de recuperação
+// válido.
+func DesativaDoisFatoresHTTP(r *http.Request, email string) erros.Erros {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	if ativo, err := DoisFatoresAtivo(email); !erros.Vazio(err) {
+		return err
+	} else if !ativo {
+		return ErrDoisFatoresInativo
+	}
+	if err := VerificaSegundoFator(email, r.FormValue("codigo")); !erros.Vazio(err) {
+		return err
+	}
+	if err := database.RemoveTOTP(email); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	return erros.CriaVazio()
+}
+
+// DoisFatoresAtivo retorna se o usuário possui a autenticação em dois fatores
+// ativa
+func DoisFatoresAtivo(email string) (bool, erros.Erros) {
+	totp, err := database.AdquireTOTP(email)
+	if err == database.ErrTOTPNaoExiste {
+		return false, erros.CriaVazio()
+	} else if err != nil {
+		return false, erros.CriaInternoPadrao(err)
+	}
+	return totp.Ativo, erros.CriaVazio()
+}
+
+// VerificaSegundoFator verifica o segundo fator de uma operação do usuário. Se
+// o usuário não possui a autenticação em dois fatores ativa, qualquer código é
+// aceito. Se possui, o código deve ser um código TOTP ainda não utilizado ou um
+// código de recuperação ainda não utilizado. Os códigos incorretos são
+// registrados pela proteção contra força bruta: após o limite de falhas, a
+// conta é bloqueada e ErrContaBloqueada é retornado, sem verificar o código.
+func VerificaSegundoFator(email string, codigo string) erros.Erros {
+	totp, err := database.AdquireTOTP(email)
+	if err == database.ErrTOTPNaoExiste || (err == nil && !totp.Ativo) {
+		return erros.CriaVazio()
+	} else if err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	codigo = strings.TrimSpace(codigo)
+	if codigo == "" {
+		return ErrCodigoObrigatorio
+	}
+
+	agora := time.Now()
+	conta := strings.ToLower(email)
+	if codigos.bloqueio(conta, agora) > 0 {
+		return ErrContaBloqueada
+	}
+	errs := verificaCodigo(email, totp.Segredo, codigo, agora)
+	if !erros.Vazio(errs) && errs.Error() == ErrCodigoInvalido.Error() {
+		codigos.registraFalha(conta, agora)
+	} else if erros.Vazio(errs) {
+		codigos.remove(conta)
+	}
+	return errs
+}
+
+// verificaCodigo verifica se o código é um código TOTP do segredo ou um código
+// de recuperação do usuário, ainda não utilizados, e os marca como utilizados
+func verificaCodigo(email string, segredo string, codigo string, agora time.Time) erros.Erros {
+	if passo, ok := verificaCodigoTOTP(segredo, codigo, agora); ok {
+		registrado, err := database.RegistraPassoTOTP(email, passo)
+		if err != nil {
+			return erros.CriaInternoPadrao(err)
+		} else if !registrado {
+			return ErrCodigoInvalido
+		}
+		return erros.CriaVazio()
+	}
+	usado, err := database.UsaCodigoRecuperacao(email, hashCodigoRecuperacao(codigo), agora.Format(formatoData))
+	if err != nil {
+		return erros.CriaInternoPadrao(err)
+	} else if !usado {
+		return ErrCodigoInvalido
+	}
+	return erros.CriaVazio()
+}
+
+// geraCodigoRecuperacao gera um código de recuperação aleatório no formato
+// "xxxxx-xxxxx", com dígitos hexadecimais
+func geraCodigoRecuperacao() (string, error) {
+	b := make([]byte, 5)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	codigo := hex.EncodeToString(b)
+	return codigo[:5] + "-" + codigo[5:], nil
+}
+
+// hashCodigoRecuperacao calcula o hash SHA-256 (em hexadecimal) de um código
+// de recuperação, ignorando hífens e maiúsculas
+func hashCodigoRecuperacao(codigo string) string {
+	normalizado := strings.ToLower(strings.Replace(codigo, "-", "", -1))
+	soma := sha256.Sum256([]byte(normalizado))
+	return hex.EncodeToString(soma[:])
+}
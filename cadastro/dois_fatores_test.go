@@ -0,0 +1,149 @@
+package cadastro
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+func TestDoisFatores(t *testing.T) {
+	email := "valido1@gmail.com"
+
+	// Sem a autenticação em dois fatores ativa, nenhum código é exigido
+	if err := VerificaSegundoFator(email, ""); !erros.Vazio(err) {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Cadastro do segredo
+	resposta, err := IniciaDoisFatoresHTTP(email)
+	if !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	segredo := map[string]string{}
+	if err := json.Unmarshal(resposta, &segredo); err != nil || !strings.HasPrefix(segredo["uri"], "otpauth://totp/") {
+		t.Fatalf("Resposta inesperada: %s (%v)", resposta, err)
+	}
+	if err := VerificaSegundoFator(email, ""); !erros.Vazio(err) {
+		t.Errorf("Segundo fator exigido antes da confirmação: %v", err)
+	}
+
+	// Confirmação
+	if _, err := ConfirmaDoisFatoresHTTP(testRequestCodigo(t, "000000x"), email); err.Error() != ErrCodigoInvalido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	passo := passoTOTP(time.Now())
+	codigo, _ := codigoTOTP(segredo["segredo"], passo)
+	resposta, err = ConfirmaDoisFatoresHTTP(testRequestCodigo(t, codigo), email)
+	if !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	recuperacao := map[string][]string{}
+	if err := json.Unmarshal(resposta, &recuperacao); err != nil || len(recuperacao["codigosRecuperacao"]) != qtdCodigosRecuperacao {
+		t.Fatalf("Resposta inesperada: %s (%v)", resposta, err)
+	}
+	if _, err := IniciaDoisFatoresHTTP(email); err.Error() != ErrDoisFatoresAtivo.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Basic Authentication deixa de ser aceito
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.SetBasicAuth(email, "senhavalido1")
+	if logado, _, err := VerificaLoginRequestHTTP(r); logado || err.Error() != ErrDoisFatoresSessao.Error() {
+		t.Errorf("Login inesperado: %v (%v)", logado, err)
+	}
+
+	// Códigos TOTP não podem ser repetidos
+	if err := VerificaSegundoFator(email, ""); err.Error() != ErrCodigoObrigatorio.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := VerificaSegundoFator(email, codigo); err.Error() != ErrCodigoInvalido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	codigo, _ = codigoTOTP(segredo["segredo"], passo+1)
+	if err := VerificaSegundoFator(email, codigo); !erros.Vazio(err) {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Códigos de recuperação só podem ser utilizados uma vez
+	codigo = strings.ToUpper(recuperacao["codigosRecuperacao"][0])
+	if err := VerificaSegundoFator(email, codigo); !erros.Vazio(err) {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := VerificaSegundoFator(email, codigo); err.Error() != ErrCodigoInvalido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Desativação
+	codigo = recuperacao["codigosRecuperacao"][1]
+	if err := DesativaDoisFatoresHTTP(testRequestCodigo(t, codigo), email); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if logado, _, err := VerificaLoginRequestHTTP(r); !logado || !erros.Vazio(err) {
+		t.Errorf("Login inesperado: %v (%v)", logado, err)
+	}
+}
+
+func TestDoisFatoresBloqueio(t *testing.T) {
+	email := "valido1@gmail.com"
+	segredo := "JBSWY3DPEHPK3PXP"
+	if err := database.DefineSegredoTOTP(email, segredo); err != nil {
+		t.Fatal(err)
+	}
+	passo := passoTOTP(time.Now())
+	if ativo, err := database.AtivaTOTP(email, passo, []string{}); err != nil || !ativo {
+		t.Fatalf("Erro inesperado ao ativar TOTP: %v (%v)", ativo, err)
+	}
+	defer database.RemoveTOTP(email)
+	defer codigos.remove(email)
+
+	// Códigos incorretos bloqueiam a conta após o limite de falhas, mesmo que a
+	// senha correta seja informada entre as tentativas
+	for i := 0; i < codigos.limite; i++ {
+		if logado, err := VerificaLoginOrigem(email, "senhavalido1", "198.51.100.9"); !logado || !erros.Vazio(err) {
+			t.Fatalf("Retorno inesperado: %v (%v)", logado, err)
+		}
+		if err := VerificaSegundoFator(email, "000000x"); err.Error() != ErrCodigoInvalido.Error() {
+			t.Fatalf("Erro inesperado: %v", err)
+		}
+	}
+	codigo, _ := codigoTOTP(segredo, passo+1)
+	if err := VerificaSegundoFator(email, codigo); err.Error() != ErrContaBloqueada.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if _, err := VerificaLoginOrigem(email, "senhavalido1", "198.51.100.9"); err.Error() != ErrContaBloqueada.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if b := TempoBloqueio(email, "203.0.113.1"); b <= 0 {
+		t.Errorf("Tempo de bloqueio inesperado: %v", b)
+	}
+
+	// O desbloqueio pela equipe esquece as falhas dos códigos
+	form := url.Values{}
+	form.Set("email", email)
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if err := DesbloqueiaRequestHTTP(r); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if err := VerificaSegundoFator(email, codigo); !erros.Vazio(err) {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+// testRequestCodigo cria um request POST com o campo "codigo"
+func testRequestCodigo(t *testing.T, codigo string) *http.Request {
+	form := url.Values{}
+	form.Set("codigo", codigo)
+	r, err := http.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
@@ -0,0 +1,46 @@
+package cadastro
+
+// Esse arquivo define a consulta e a alteração dos papéis dos usuários
+
+import (
+	"net/http"
+
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+// Lista de possíveis erros dos papéis
+var (
+	ErrPapelInvalido    = erros.Cria(false, 400, "papel_invalido")
+	ErrUsuarioNaoExiste = erros.Cria(false, 400, "usuario_nao_existente")
+)
+
+// PapelUsuario retorna o papel do usuário do e-mail passado
+func PapelUsuario(email string) (string, erros.Erros) {
+	usr, err := database.AdquireUsuario(email)
+	if err == database.ErrUsuarioNaoExiste {
+		return "", ErrUsuarioNaoExiste
+	} else if err != nil {
+		return "", erros.CriaInternoPadrao(err)
+	}
+	return usr.Papel, erros.CriaVazio()
+}
+
+// AlteraPapelRequestHTTP altera o papel do usuário do campo "email" para o
+// papel do campo "papel" ("cliente", "suporte" ou "admin")
+func AlteraPapelRequestHTTP(r *http.Request) erros.Erros {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	err := database.AlteraPapelUsuario(r.FormValue("email"), r.FormValue("papel"))
+	switch err {
+	case nil:
+		return erros.CriaVazio()
+	case database.ErrPapelInvalido:
+		return ErrPapelInvalido
+	case database.ErrUsuarioNaoExiste:
+		return ErrUsuarioNaoExiste
+	}
+	return erros.CriaInternoPadrao(err)
+}
@@ -0,0 +1,47 @@
+package cadastro
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+func TestAlteraPapelRequestHTTP(t *testing.T) {
+	casos := []struct {
+		email    string
+		papel    string
+		esperado erros.Erros
+	}{
+		{"valido1@gmail.com", "gerente", ErrPapelInvalido},
+		{"naoexistente@gmail.com", database.PapelAdmin, ErrUsuarioNaoExiste},
+		{"valido1@gmail.com", database.PapelSuporte, erros.CriaVazio()},
+	}
+	for _, c := range casos {
+		form := url.Values{}
+		form.Set("email", c.email)
+		form.Set("papel", c.papel)
+		r, err := http.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		if err := AlteraPapelRequestHTTP(r); err.Error() != c.esperado.Error() {
+			t.Errorf("Erro inesperado para %v: %v (esperado %v)", c, err, c.esperado)
+		}
+	}
+
+	// O papel alterado é retornado na consulta
+	if papel, err := PapelUsuario("valido1@gmail.com"); !erros.Vazio(err) || papel != database.PapelSuporte {
+		t.Errorf("Papel inesperado: %v (%v)", papel, err)
+	}
+	if _, err := PapelUsuario("naoexistente@gmail.com"); err.Error() != ErrUsuarioNaoExiste.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := database.AlteraPapelUsuario("valido1@gmail.com", database.PapelCliente); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+}
@@ -0,0 +1,246 @@
+package cadastro
+
+// Esse arquivo define a consulta e a alteração do perfil dos usuários: nome,
+// data de nascimento, CPF, senha e e-mail
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/correio"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/passenc"
+)
+
+// Lista de possíveis erros do perfil
+var (
+	ErrSenhaAtualIncorreta = erros.Cria(false, 403, "senha_atual_incorreta")
+	ErrCPFJaDefinido       = erros.Cria(false, 400, "cpf_ja_definido")
+)
+
+// validadeAlteracaoEmail é a validade do link de confirmação do novo e-mail
+const validadeAlteracaoEmail = 24 * time.Hour
+
+// perfilResposta é a estrutura JSON com o perfil do usuário enviada ao
+// cliente. O CPF é omitido enquanto não informado.
+type perfilResposta struct {
+	Email           string `json:"email"`
+	Nome            string `json:"nome"`
+	Nascimento      string `json:"nascimento"`
+	Nivel           int    `json:"nivel"`
+	Papel           string `json:"papel"`
+	EmailVerificado bool   `json:"emailVerificado"`
+	CPF             string `json:"cpf,omitempty"`
+}
+
+// PerfilHTTP retorna os bytes da string JSON com o perfil do usuário
+func PerfilHTTP(email string) ([]byte, erros.Erros) {
+	usr, err := database.AdquireUsuario(email)
+	if err == database.ErrUsuarioNaoExiste {
+		return nil, ErrUsuarioNaoExiste
+	} else if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	resposta, err := json.Marshal(perfilResposta{
+		Email:           usr.Email,
+		Nome:            usr.Nome,
+		Nascimento:      usr.Nascimento,
+		Nivel:           usr.Nivel,
+		Papel:           usr.Papel,
+		EmailVerificado: usr.EmailVerificado,
+		CPF:             usr.CPF,
+	})
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	return resposta, erros.CriaVazio()
+}
+
+// AlteraPerfilHTTP altera o nome e a data de nascimento do usuário com os
+// campos "nome" e "nascimento" do request, validados como no cadastro. Campos
+// ausentes não são alterados. O campo "cpf" define o CPF do usuário apenas se
+// ele ainda não foi informado; um CPF definido não pode ser alterado. Retorna
+// os bytes da string JSON com o perfil atualizado.
+func AlteraPerfilHTTP(r *http.Request, email string) ([]byte, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	usr, err := database.AdquireUsuario(email)
+	if err == database.ErrUsuarioNaoExiste {
+		return nil, ErrUsuarioNaoExiste
+	} else if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+
+	errs := erros.CriaVazio()
+	if _, ok := r.PostForm["nome"]; ok {
+		var errNome erros.Erros
+		usr.Nome, errNome = nome(r.PostFormValue("nome"))
+		errs = erros.JuntaErros(errs, errNome)
+	}
+	if _, ok := r.PostForm["nascimento"]; ok {
+		usr.Nascimento = r.PostFormValue("nascimento")
+		errs = erros.JuntaErros(errs, nascimento(usr.Nascimento))
+	}
+	novoCPF := ""
+	if _, ok := r.PostForm["cpf"]; ok {
+		var errCPF erros.Erros
+		novoCPF, errCPF = cpf(r.PostFormValue("cpf"))
+		if erros.Vazio(errCPF) && usr.CPF != "" {
+			errCPF = ErrCPFJaDefinido
+		}
+		errs = erros.JuntaErros(errs, errCPF)
+	}
+	if !erros.Vazio(errs) {
+		return nil, errs
+	}
+	if novoCPF != "" {
+		if err := database.DefineCPF(email, novoCPF); err == database.ErrCPFDuplicado {
+			return nil, ErrCPFDuplicado
+		} else if err == database.ErrCPFJaDefinido {
+			return nil, ErrCPFJaDefinido
+		} else if err != nil {
+			return nil, erros.CriaInternoPadrao(err)
+		}
+	}
+	if err := database.AlteraPerfil(email, usr.Nome, usr.Nascimento); err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	return PerfilHTTP(email)
+}
+
+// AlteraSenhaHTTP substitui a senha do usuário pela senha do campo "senha" do
+// request, que segue as mesmas regras do cadastro. O campo "senhaAtual" deve
+// conter a senha atual e, se o usuário possui a autenticação em dois fatores
+// ativa, o campo "codigo" deve conter um código TOTP ou de recuperação válido.
+func AlteraSenhaHTTP(r *http.Request, email string) erros.Erros {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	if err := verificaSenhaAtual(email, r.PostFormValue("senhaAtual"), comunicacao.IPRequest(r)); !erros.Vazio(err) {
+		return err
+	}
+	novaSenha := r.PostFormValue("senha")
+	if err := senha(novaSenha); !erros.Vazio(err) {
+		return err
+	}
+	if err := VerificaSegundoFator(email, r.PostFormValue("codigo")); !erros.Vazio(err) {
+		return err
+	}
+
+	senhaHashed, err := passenc.GeraHashed([]byte(novaSenha))
+	if err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	if err := database.AlteraSenha(email, senhaHashed); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	return erros.CriaVazio()
+}
+
+// SolicitaAlteracaoEmailHTTP envia ao e-mail do campo "email" do request um
+// link de confirmação da alteração do e-mail do usuário. O e-mail só é
+// alterado após a confirmação com ConfirmaAlteracaoEmailHTTP, de forma que o
+// novo endereço seja verificado. O campo "senha" deve conter a senha atual e,
+// se o usuário possui a autenticação em dois fatores ativa, o campo "codigo"
+// deve conter um código TOTP ou de recuperação válido.
+func SolicitaAlteracaoEmailHTTP(r *http.Request, email string) erros.Erros {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	if err := verificaSenhaAtual(email, r.PostFormValue("senha"), comunicacao.IPRequest(r)); !erros.Vazio(err) {
+		return err
+	}
+	novoEmail, errs := emailDisponivel(r.PostFormValue("email"))
+	if !erros.Vazio(errs) {
+		return errs
+	}
+	if err := VerificaSegundoFator(email, r.PostFormValue("codigo")); !erros.Vazio(err) {
+		return err
+	}
+
+	usr, err := database.AdquireUsuario(email)
+	if err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	token, errs := emiteToken(email, database.TokenAlteracaoEmail, novoEmail, validadeAlteracaoEmail)
+	if !erros.Vazio(errs) {
+		return errs
+	}
+	m := correio.Mensagem{
+		Para:    novoEmail,
+		Assunto: "Confirme seu novo e-mail na RedCoins",
+		Corpo: "Olá, " + usr.Nome + ".\n\n" +
+			"Para passar a utilizar este e-mail na sua conta da RedCoins, acesse o " +
+			"link abaixo em até 24 horas:\n\n" +
+			urlServidor + "/perfil/email?token=" + url.QueryEscape(token) + "\n\n" +
+			"Se você não fez esse pedido, ignore esta mensagem.\n",
+	}
+	if err := correio.Envia(m); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	return erros.CriaVazio()
+}
+
+// ConfirmaAlteracaoEmailHTTP substitui o e-mail do usuário do token do campo
+// "token" do request pelo novo e-mail associado ao token, que passa a ser
+// considerado verificado. O e-mail anterior é avisado da alteração. Retorna o
+// novo e-mail do usuário, cujas sessões devem ser encerradas.
+func ConfirmaAlteracaoEmailHTTP(r *http.Request) (string, erros.Erros) {
+	t, err := consomeToken(r.URL.Query().Get("token"), database.TokenAlteracaoEmail)
+	if !erros.Vazio(err) {
+		return "", err
+	}
+	if err := database.AlteraEmail(t.Usuario, t.Dado); err == database.ErrUsuarioDuplicado {
+		return "", ErrUsuarioDuplicado
+	} else if err == database.ErrUsuarioNaoExiste {
+		return "", ErrTokenEmailInvalido
+	} else if err != nil {
+		return "", erros.CriaInternoPadrao(err)
+	}
+
+	m := correio.Mensagem{
+		Para:    t.Usuario,
+		Assunto: "Seu e-mail na RedCoins foi alterado",
+		Corpo: "Olá.\n\n" +
+			"O e-mail da sua conta na RedCoins foi alterado para " + t.Dado + ". " +
+			"Se você não fez essa alteração, entre em contato com o suporte.\n",
+	}
+	if err := correio.Envia(m); err != nil {
+		log.Printf("cadastro: erro ao avisar %s da alteração do e-mail: %s", t.Usuario, err)
+	}
+	return t.Dado, erros.CriaVazio()
+}
+
+// verificaSenhaAtual verifica se 'senha' é a senha atual do usuário, com a
+// proteção contra força bruta para o IP de origem 'ip'. Retorna
+// ErrSenhaAtualIncorreta se não é.
+func verificaSenhaAtual(email string, senha string, ip string) erros.Erros {
+	logado, err := VerificaLoginOrigem(email, senha, ip)
+	if !erros.Vazio(err) {
+		return err
+	} else if !logado {
+		return ErrSenhaAtualIncorreta
+	}
+	return erros.CriaVazio()
+}
+
+// emailDisponivel verifica se o e-mail é válido e se não pertence a nenhum
+// usuário. Retorna o e-mail normalizado.
+func emailDisponivel(novoEmail string) (string, erros.Erros) {
+	novoEmail, errs := email(novoEmail)
+	if !erros.Vazio(errs) {
+		return "", errs
+	}
+	if _, err := database.AdquireUsuario(novoEmail); err == nil {
+		return "", ErrUsuarioDuplicado
+	} else if err != database.ErrUsuarioNaoExiste {
+		return "", erros.CriaInternoPadrao(err)
+	}
+	return novoEmail, erros.CriaVazio()
+}
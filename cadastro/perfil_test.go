@@ -0,0 +1,205 @@
+package cadastro
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/loteny/redcoins/correio"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/passenc"
+)
+
+func TestPerfil(t *testing.T) {
+	testInsereUsuarioPerfil(t, "testeperfil@gmail.com")
+
+	resposta, err := PerfilHTTP("testeperfil@gmail.com")
+	if !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	esperado := `{"email":"testeperfil@gmail.com","nome":"Teste Perfil","nascimento":"1994-03-07",` +
+		`"nivel":0,"papel":"cliente","emailVerificado":false}`
+	if string(resposta) != esperado {
+		t.Errorf("Perfil inesperado: %s", resposta)
+	}
+	if _, err := PerfilHTTP("naoexistente@gmail.com"); err.Error() != ErrUsuarioNaoExiste.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+func TestAlteraPerfilHTTP(t *testing.T) {
+	testInsereUsuarioPerfil(t, "testealteraperfil@gmail.com")
+
+	// Campos inválidos não alteram o perfil
+	form := url.Values{}
+	form.Set("nome", "")
+	form.Set("nascimento", "3000-01-01")
+	_, err := AlteraPerfilHTTP(testRequestForm("PATCH", form), "testealteraperfil@gmail.com")
+	if !reflect.DeepEqual(erros.Lista(err), []string{"nome_invalido", "nascimento_invalido"}) {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Apenas os campos presentes são alterados
+	form = url.Values{}
+	form.Set("nome", "Nome Alterado")
+	resposta, err := AlteraPerfilHTTP(testRequestForm("PATCH", form), "testealteraperfil@gmail.com")
+	if !erros.Vazio(err) || !strings.Contains(string(resposta), `"nome":"Nome Alterado","nascimento":"1994-03-07"`) {
+		t.Errorf("Resposta inesperada: %s (%v)", resposta, err)
+	}
+	form = url.Values{}
+	form.Set("nascimento", "1980-12-31")
+	resposta, err = AlteraPerfilHTTP(testRequestForm("PATCH", form), "testealteraperfil@gmail.com")
+	if !erros.Vazio(err) || !strings.Contains(string(resposta), `"nome":"Nome Alterado","nascimento":"1980-12-31"`) {
+		t.Errorf("Resposta inesperada: %s (%v)", resposta, err)
+	}
+}
+
+func TestAlteraPerfilCPF(t *testing.T) {
+	testInsereUsuarioPerfil(t, "testeperfilcpf@gmail.com")
+
+	form := url.Values{}
+	form.Set("cpf", "111.444.777-36")
+	if _, err := AlteraPerfilHTTP(testRequestForm("PATCH", form), "testeperfilcpf@gmail.com"); err.Error() != ErrCPFInvalido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	form.Set("cpf", "111.444.777-35")
+	resposta, err := AlteraPerfilHTTP(testRequestForm("PATCH", form), "testeperfilcpf@gmail.com")
+	if !erros.Vazio(err) || !strings.Contains(string(resposta), `"cpf":"11144477735"`) {
+		t.Errorf("Resposta inesperada: %s (%v)", resposta, err)
+	}
+	// O CPF não pode ser alterado
+	form.Set("cpf", "529.982.247-25")
+	if _, err := AlteraPerfilHTTP(testRequestForm("PATCH", form), "testeperfilcpf@gmail.com"); err.Error() != ErrCPFJaDefinido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	// Nem definido com o CPF de outro usuário
+	testInsereUsuarioPerfil(t, "testeperfilcpf2@gmail.com")
+	form.Set("cpf", "111.444.777-35")
+	if _, err := AlteraPerfilHTTP(testRequestForm("PATCH", form), "testeperfilcpf2@gmail.com"); err.Error() != ErrCPFDuplicado.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+func TestAlteraSenhaHTTP(t *testing.T) {
+	testInsereUsuarioPerfil(t, "testealterasenha@gmail.com")
+
+	// Senha atual incorreta
+	form := url.Values{}
+	form.Set("senhaAtual", "senhaincorreta")
+	form.Set("senha", "senhanova")
+	if err := AlteraSenhaHTTP(testRequestForm("POST", form), "testealterasenha@gmail.com"); err.Error() != ErrSenhaAtualIncorreta.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Nova senha inválida
+	form.Set("senhaAtual", "senhaperfil")
+	form.Set("senha", "123")
+	if err := AlteraSenhaHTTP(testRequestForm("POST", form), "testealterasenha@gmail.com"); err.Error() != ErrSenhaInvalida.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Alteração
+	form.Set("senha", "senhanova")
+	if err := AlteraSenhaHTTP(testRequestForm("POST", form), "testealterasenha@gmail.com"); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if logado, _ := VerificaLogin("testealterasenha@gmail.com", "senhanova"); !logado {
+		t.Errorf("Login com a nova senha falhou")
+	}
+	if logado, _ := VerificaLogin("testealterasenha@gmail.com", "senhaperfil"); logado {
+		t.Errorf("Login com a senha antiga aceito")
+	}
+}
+
+func TestAlteracaoEmail(t *testing.T) {
+	caixa := correio.NovaCaixaSaida("")
+	anterior := correio.Padrao()
+	correio.DefinePadrao(caixa)
+	defer correio.DefinePadrao(anterior)
+	testInsereUsuarioPerfil(t, "testeemailantigo@gmail.com")
+
+	// Senha incorreta, e-mail inválido ou já cadastrado
+	casos := []struct {
+		email string
+		senha string
+		erro  erros.Erros
+	}{
+		{"testeemailnovo@gmail.com", "senhaincorreta", ErrSenhaAtualIncorreta},
+		{"invalido", "senhaperfil", ErrEmailInvalido},
+		{"teste@mailinator.com", "senhaperfil", ErrEmailDescartavel},
+		{"valido1@gmail.com", "senhaperfil", ErrUsuarioDuplicado},
+	}
+	for _, c := range casos {
+		form := url.Values{}
+		form.Set("email", c.email)
+		form.Set("senha", c.senha)
+		if err := SolicitaAlteracaoEmailHTTP(testRequestForm("POST", form), "testeemailantigo@gmail.com"); err.Error() != c.erro.Error() {
+			t.Errorf("Erro inesperado para %v: %v", c, err)
+		}
+	}
+
+	// O link de confirmação é enviado ao novo e-mail
+	form := url.Values{}
+	form.Set("email", "testeemailnovo@gmail.com")
+	form.Set("senha", "senhaperfil")
+	if err := SolicitaAlteracaoEmailHTTP(testRequestForm("POST", form), "testeemailantigo@gmail.com"); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if _, err := database.AdquireUsuario("testeemailantigo@gmail.com"); err != nil {
+		t.Errorf("E-mail alterado antes da confirmação: %v", err)
+	}
+	m, ok := caixa.Ultima("testeemailnovo@gmail.com")
+	prefixo := urlServidor + "/perfil/email?token="
+	i := strings.Index(m.Corpo, prefixo)
+	if !ok || i < 0 {
+		t.Fatalf("Mensagem inesperada: %v", m)
+	}
+	token, _ := url.QueryUnescape(strings.Fields(m.Corpo[i+len(prefixo):])[0])
+
+	// Confirmação, apenas uma vez
+	novo, err := ConfirmaAlteracaoEmailHTTP(testRequestToken(token))
+	if !erros.Vazio(err) || novo != "testeemailnovo@gmail.com" {
+		t.Fatalf("Retorno inesperado: %v (%v)", novo, err)
+	}
+	if usr, err := database.AdquireUsuario("testeemailnovo@gmail.com"); err != nil || !usr.EmailVerificado {
+		t.Errorf("Usuário inesperado: %v (%v)", usr, err)
+	}
+	if _, err := database.AdquireUsuario("testeemailantigo@gmail.com"); err != database.ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if _, ok := caixa.Ultima("testeemailantigo@gmail.com"); !ok {
+		t.Errorf("E-mail antigo não avisado da alteração")
+	}
+	if _, err := ConfirmaAlteracaoEmailHTTP(testRequestToken(token)); err.Error() != ErrTokenEmailInvalido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+// testInsereUsuarioPerfil insere um usuário com o e-mail passado e a senha
+// "senhaperfil"
+func testInsereUsuarioPerfil(t *testing.T, email string) {
+	senhaHashed, err := passenc.GeraHashed([]byte("senhaperfil"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	usr := database.Usuario{
+		Email:      email,
+		Senha:      senhaHashed,
+		Nome:       "Teste Perfil",
+		Nascimento: "1994-03-07",
+	}
+	if err := database.InsereUsuario(&usr); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testRequestForm cria um request com o método passado e os campos de 'form'
+// no corpo
+func testRequestForm(metodo string, form url.Values) *http.Request {
+	r, _ := http.NewRequest(metodo, "/", strings.NewReader(form.Encode()))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
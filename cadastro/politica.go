@@ -0,0 +1,137 @@
+package cadastro
+
+// Esse arquivo define a política de cadastro, que contém as regras de
+// validação dos campos cadastrais: idade mínima, tamanho mínimo da senha,
+// domínios de e-mail descartáveis bloqueados e senhas comuns proibidas.
+
+import (
+	"bufio"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Politica contém as regras de validação dos dados cadastrais. As chaves de
+// 'DominiosBloqueados' e 'SenhasComuns' estão em letras minúsculas.
+type Politica struct {
+	// IdadeMinima é a idade mínima, em anos, para o cadastro
+	IdadeMinima int
+	// TamanhoMinimoSenha é a quantidade mínima de caracteres da senha
+	TamanhoMinimoSenha int
+	// DominiosBloqueados são os domínios de e-mail não aceitos; seus
+	// subdomínios também são bloqueados
+	DominiosBloqueados map[string]bool
+	// SenhasComuns são as senhas não aceitas por serem facilmente adivinhadas
+	SenhasComuns map[string]bool
+}
+
+// dominiosDescartaveis são os domínios de e-mails descartáveis bloqueados por
+// padrão
+var dominiosDescartaveis = []string{
+	"10minutemail.com", "dispostable.com", "emailondeck.com", "fakeinbox.com",
+	"getnada.com", "guerrillamail.com", "mailinator.com", "maildrop.cc",
+	"mintemail.com", "sharklasers.com", "temp-mail.org", "tempmail.com",
+	"throwawaymail.com", "trashmail.com", "yopmail.com",
+}
+
+// senhasComuns são as senhas proibidas por padrão
+var senhasComuns = []string{
+	"000000", "00000000", "111111", "11111111", "123123", "12345678",
+	"123456789", "1234567890", "123mudar", "abc12345", "abcd1234", "admin123",
+	"brasil123", "iloveyou", "mudar123", "password", "password1", "qwerty",
+	"qwerty123", "qwertyuiop", "senha123", "senha1234", "senhasenha",
+}
+
+// politicaPadrao é a Politica utilizada na validação dos campos
+var politicaPadrao Politica
+
+// mutexPolitica protege 'politicaPadrao', que pode ser substituída em testes
+var mutexPolitica sync.RWMutex
+
+func init() {
+	// Inicializa a política com as variáveis de ambiente. Por padrão, a idade
+	// mínima é de 18 anos e a senha deve ter pelo menos 8 caracteres. As
+	// listas de domínios bloqueados e de senhas comuns podem ser complementadas
+	// com arquivos contendo um item por linha.
+	p := Politica{
+		IdadeMinima:        inteiroVariavel("REDCOINS_CA_IDADEMINIMA", 18),
+		TamanhoMinimoSenha: inteiroVariavel("REDCOINS_CA_SENHAMINIMA", 8),
+		DominiosBloqueados: conjunto(dominiosDescartaveis),
+		SenhasComuns:       conjunto(senhasComuns),
+	}
+	if err := carregaLista(os.Getenv("REDCOINS_CA_DOMINIOSBLOQUEADOS"), p.DominiosBloqueados); err != nil {
+		log.Fatalf("cadastro: erro ao carregar domínios bloqueados: %s", err)
+	}
+	if err := carregaLista(os.Getenv("REDCOINS_CA_SENHASCOMUNS"), p.SenhasComuns); err != nil {
+		log.Fatalf("cadastro: erro ao carregar senhas comuns: %s", err)
+	}
+	politicaPadrao = p
+}
+
+// PoliticaPadrao retorna a Politica utilizada na validação dos campos
+func PoliticaPadrao() Politica {
+	mutexPolitica.RLock()
+	defer mutexPolitica.RUnlock()
+	return politicaPadrao
+}
+
+// DefinePoliticaPadrao substitui a Politica utilizada na validação dos campos
+func DefinePoliticaPadrao(p Politica) {
+	mutexPolitica.Lock()
+	defer mutexPolitica.Unlock()
+	politicaPadrao = p
+}
+
+// DominioBloqueado verifica se o domínio ou algum domínio pai está bloqueado
+func (p Politica) DominioBloqueado(dominio string) bool {
+	dominio = strings.ToLower(dominio)
+	for {
+		if p.DominiosBloqueados[dominio] {
+			return true
+		}
+		i := strings.Index(dominio, ".")
+		if i < 0 {
+			return false
+		}
+		dominio = dominio[i+1:]
+	}
+}
+
+// SenhaComum verifica se a senha está na lista de senhas comuns,
+// desconsiderando letras maiúsculas
+func (p Politica) SenhaComum(senha string) bool {
+	return p.SenhasComuns[strings.ToLower(senha)]
+}
+
+// conjunto cria um mapa com os itens da lista em letras minúsculas
+func conjunto(lista []string) map[string]bool {
+	m := make(map[string]bool, len(lista))
+	for _, item := range lista {
+		m[strings.ToLower(item)] = true
+	}
+	return m
+}
+
+// carregaLista adiciona a 'm' os itens do arquivo, um por linha, em letras
+// minúsculas. Linhas vazias e iniciadas por '#' são ignoradas. Não faz nada se
+// 'arquivo' está vazio.
+func carregaLista(arquivo string, m map[string]bool) error {
+	if arquivo == "" {
+		return nil
+	}
+	f, err := os.Open(arquivo)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		linha := strings.TrimSpace(scanner.Text())
+		if linha == "" || strings.HasPrefix(linha, "#") {
+			continue
+		}
+		m[strings.ToLower(linha)] = true
+	}
+	return scanner.Err()
+}
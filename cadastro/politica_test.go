@@ -0,0 +1,79 @@
+package cadastro
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/loteny/redcoins/erros"
+)
+
+func TestPoliticaPadrao(t *testing.T) {
+	p := PoliticaPadrao()
+	if p.IdadeMinima != 18 || p.TamanhoMinimoSenha != 8 {
+		t.Errorf("Política inesperada: %v", p)
+	}
+	if !p.DominioBloqueado("mailinator.com") || !p.DominioBloqueado("a.b.Mailinator.com") ||
+		p.DominioBloqueado("gmail.com") || p.DominioBloqueado("notmailinator.com") {
+		t.Errorf("Domínios bloqueados inesperados: %v", p.DominiosBloqueados)
+	}
+	if !p.SenhaComum("Senha123") || p.SenhaComum("senha123456789") {
+		t.Errorf("Senhas comuns inesperadas: %v", p.SenhasComuns)
+	}
+}
+
+func TestDefinePoliticaPadrao(t *testing.T) {
+	original := PoliticaPadrao()
+	defer DefinePoliticaPadrao(original)
+
+	DefinePoliticaPadrao(Politica{
+		IdadeMinima:        21,
+		TamanhoMinimoSenha: 10,
+		DominiosBloqueados: conjunto([]string{"exemplo.com"}),
+		SenhasComuns:       conjunto([]string{"senhasecreta"}),
+	})
+	if _, err := email("teste@exemplo.com"); err.Error() != ErrEmailDescartavel.Error() {
+		t.Errorf("Erro retornado: %v", err)
+	}
+	if _, err := email("teste@mailinator.com"); !erros.Vazio(err) {
+		t.Errorf("Erro retornado: %v", err)
+	}
+	if err := senha("abcdefghi"); err.Error() != ErrSenhaInvalida.Error() {
+		t.Errorf("Erro retornado: %v", err)
+	}
+	if err := senha("SenhaSecreta"); err.Error() != ErrSenhaComum.Error() {
+		t.Errorf("Erro retornado: %v", err)
+	}
+	if err := senha("12345678901"); !erros.Vazio(err) {
+		t.Errorf("Erro retornado: %v", err)
+	}
+	if err := nascimento(time.Now().AddDate(-20, 0, 0).Format("2006-01-02")); err.Error() != ErrIdadeMinima.Error() {
+		t.Errorf("Erro retornado: %v", err)
+	}
+}
+
+func TestCarregaLista(t *testing.T) {
+	f, err := ioutil.TempFile("", "lista")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# domínios da empresa\nExemplo.com\n\n  teste.org  \n")
+	f.Close()
+
+	m := conjunto([]string{"mailinator.com"})
+	if err := carregaLista(f.Name(), m); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if len(m) != 3 || !m["mailinator.com"] || !m["exemplo.com"] || !m["teste.org"] {
+		t.Errorf("Lista inesperada: %v", m)
+	}
+	// Arquivo não informado não altera a lista; arquivo inexistente gera erro
+	if err := carregaLista("", m); err != nil || len(m) != 3 {
+		t.Errorf("Retorno inesperado: %v (%v)", m, err)
+	}
+	if err := carregaLista(f.Name()+"inexistente", m); err == nil {
+		t.Errorf("Arquivo inexistente não gerou erro")
+	}
+}
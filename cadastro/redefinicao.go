@@ -0,0 +1,111 @@
+package cadastro
+
+// Esse arquivo define a redefinição da senha dos usuários que a esqueceram: o
+// envio do link de redefinição e a troca da senha a partir do link
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/correio"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/passenc"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// Parâmetros da redefinição da senha
+const (
+	// validadeRedefinicao é a validade do link de redefinição da senha
+	validadeRedefinicao = 30 * time.Minute
+	// limiteRedefinicoes é a quantidade máxima de links de redefinição
+	// enviados a um usuário em janelaRedefinicoes
+	limiteRedefinicoes = 3
+	// janelaRedefinicoes é o período considerado em limiteRedefinicoes
+	janelaRedefinicoes = time.Hour
+)
+
+// SolicitaRedefinicaoSenhaHTTP envia um link de redefinição da senha ao e-mail
+// do campo "email" do request. Para não revelar quais e-mails estão
+// cadastrados, nenhum erro é retornado se o usuário não existe, se sua conta
+// foi encerrada ou se o limite de links enviados ao usuário foi atingido;
+// nesses casos, nada é enviado.
+func SolicitaRedefinicaoSenhaHTTP(r *http.Request) erros.Erros {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	usr, err := database.AdquireUsuario(NormalizaEmail(r.PostFormValue("email")))
+	if err == database.ErrUsuarioNaoExiste || (err == nil && usr.Encerrado) {
+		return erros.CriaVazio()
+	} else if err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+
+	desde := transacao.Agora().Add(-janelaRedefinicoes).Format(formatoData)
+	qtd, err := database.ContaTokensUsuario(usr.Email, database.TokenRedefinicaoSenha, desde)
+	if err != nil {
+		return erros.CriaInternoPadrao(err)
+	} else if qtd >= limiteRedefinicoes {
+		log.Printf("cadastro: limite de redefinições de senha atingido para %s", usr.Email)
+		return erros.CriaVazio()
+	}
+	return enviaRedefinicao(usr)
+}
+
+// RedefineSenhaHTTP substitui a senha do usuário do token do campo "token" do
+// request pela senha do campo "senha", que segue as mesmas regras do cadastro.
+// Os demais links de redefinição enviados ao usuário deixam de ser válidos.
+// Retorna o e-mail do usuário, cujas sessões devem ser encerradas.
+func RedefineSenhaHTTP(r *http.Request) (string, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return "", erros.CriaInternoPadrao(err)
+	}
+	novaSenha := r.PostFormValue("senha")
+	if err := senha(novaSenha); !erros.Vazio(err) {
+		return "", err
+	}
+	t, err := consomeToken(r.PostFormValue("token"), database.TokenRedefinicaoSenha)
+	if !erros.Vazio(err) {
+		return "", err
+	}
+
+	senhaHashed, err2 := passenc.GeraHashed([]byte(novaSenha))
+	if err2 != nil {
+		return "", erros.CriaInternoPadrao(err2)
+	}
+	if err := database.AlteraSenha(t.Usuario, senhaHashed); err != nil {
+		return "", erros.CriaInternoPadrao(err)
+	}
+	agora := transacao.Agora().Format(formatoData)
+	if err := database.InvalidaTokensUsuario(t.Usuario, database.TokenRedefinicaoSenha, agora); err != nil {
+		return "", erros.CriaInternoPadrao(err)
+	}
+	return t.Usuario, erros.CriaVazio()
+}
+
+// enviaRedefinicao emite um token de redefinição da senha do usuário e envia o
+// link de redefinição por e-mail
+func enviaRedefinicao(usr database.Usuario) erros.Erros {
+	token, err := emiteToken(usr.Email, database.TokenRedefinicaoSenha, "", validadeRedefinicao)
+	if !erros.Vazio(err) {
+		return err
+	}
+	m := correio.Mensagem{
+		Para:    usr.Email,
+		Assunto: "Redefinição de senha na RedCoins",
+		Corpo: "Olá, " + usr.Nome + ".\n\n" +
+			"Recebemos um pedido para redefinir a senha da sua conta. Para escolher " +
+			"uma nova senha, acesse o link abaixo em até 30 minutos:\n\n" +
+			urlServidor + "/senha/redefinir?token=" + url.QueryEscape(token) + "\n\n" +
+			"Ao redefinir a senha, todas as sessões abertas serão encerradas. Se " +
+			"você não fez esse pedido, ignore esta mensagem; sua senha não será " +
+			"alterada.\n",
+	}
+	if err := correio.Envia(m); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	return erros.CriaVazio()
+}
@@ -0,0 +1,110 @@
+package cadastro
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/loteny/redcoins/correio"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/passenc"
+)
+
+func TestRedefinicaoSenha(t *testing.T) {
+	caixa := correio.NovaCaixaSaida("")
+	anterior := correio.Padrao()
+	correio.DefinePadrao(caixa)
+	defer correio.DefinePadrao(anterior)
+
+	senhaHashed, err := passenc.GeraHashed([]byte("senhaantiga"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	usr := database.Usuario{
+		Email:      "testeredefinicao@gmail.com",
+		Senha:      senhaHashed,
+		Nome:       "Teste Redefinição",
+		Nascimento: "1994-03-07",
+	}
+	if err := database.InsereUsuario(&usr); err != nil {
+		t.Fatal(err)
+	}
+
+	// E-mails não cadastrados recebem a mesma resposta e nada é enviado
+	if err := SolicitaRedefinicaoSenhaHTTP(testRequestEmail("naoexistente@gmail.com")); !erros.Vazio(err) {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if len(caixa.Mensagens()) != 0 {
+		t.Errorf("Mensagens inesperadas: %v", caixa.Mensagens())
+	}
+
+	// Apenas limiteRedefinicoes links são enviados por janela
+	for i := 0; i < limiteRedefinicoes+1; i++ {
+		if err := SolicitaRedefinicaoSenhaHTTP(testRequestEmail(usr.Email)); !erros.Vazio(err) {
+			t.Fatalf("Erro inesperado: %v", err)
+		}
+	}
+	if len(caixa.Mensagens()) != limiteRedefinicoes {
+		t.Errorf("Quantidade de mensagens inesperada: %v", len(caixa.Mensagens()))
+	}
+	m, _ := caixa.Ultima(usr.Email)
+	prefixo := urlServidor + "/senha/redefinir?token="
+	i := strings.Index(m.Corpo, prefixo)
+	if i < 0 {
+		t.Fatalf("Mensagem inesperada: %v", m)
+	}
+	token, _ := url.QueryUnescape(strings.Fields(m.Corpo[i+len(prefixo):])[0])
+
+	// Senhas inválidas não consomem o token
+	if _, err := RedefineSenhaHTTP(testRequestRedefinicao(token, "123")); err.Error() != ErrSenhaInvalida.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if _, err := RedefineSenhaHTTP(testRequestRedefinicao("abc.def", "senhanova")); err.Error() != ErrTokenEmailInvalido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Redefinição, apenas uma vez
+	email, err2 := RedefineSenhaHTTP(testRequestRedefinicao(token, "senhanova"))
+	if !erros.Vazio(err2) || email != usr.Email {
+		t.Fatalf("Retorno inesperado: %v (%v)", email, err2)
+	}
+	if logado, _ := VerificaLogin(usr.Email, "senhanova"); !logado {
+		t.Errorf("Login com a nova senha falhou")
+	}
+	if logado, _ := VerificaLogin(usr.Email, "senhaantiga"); logado {
+		t.Errorf("Login com a senha antiga aceito")
+	}
+	if _, err := RedefineSenhaHTTP(testRequestRedefinicao(token, "outrasenha")); err.Error() != ErrTokenEmailInvalido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Os demais links enviados deixam de ser válidos
+	for _, m := range caixa.Mensagens() {
+		i := strings.Index(m.Corpo, prefixo)
+		outro, _ := url.QueryUnescape(strings.Fields(m.Corpo[i+len(prefixo):])[0])
+		if _, err := RedefineSenhaHTTP(testRequestRedefinicao(outro, "outrasenha")); err.Error() != ErrTokenEmailInvalido.Error() {
+			t.Errorf("Erro inesperado: %v", err)
+		}
+	}
+}
+
+// testRequestEmail cria um request POST com o campo "email"
+func testRequestEmail(email string) *http.Request {
+	form := url.Values{}
+	form.Set("email", email)
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// testRequestRedefinicao cria um request POST com os campos "token" e "senha"
+func testRequestRedefinicao(token string, senha string) *http.Request {
+	form := url.Values{}
+	form.Set("token", token)
+	form.Set("senha", senha)
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
@@ -0,0 +1,108 @@
+package cadastro
+
+// Esse arquivo define os tokens de uso único enviados por e-mail aos usuários.
+// Cada token é assinado com HMAC-SHA256 para sua finalidade, de forma que
+// tokens forjados ou de outra finalidade sejam recusados sem consultar o banco
+// de dados, e apenas o hash do token é armazenado.
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// Configurações dos tokens enviados por e-mail
+var (
+	// chaveTokens é a chave HMAC dos tokens
+	chaveTokens []byte
+	// urlServidor é o endereço público do servidor, utilizado nos links
+	// enviados por e-mail
+	urlServidor string
+)
+
+func init() {
+	// Inicializa as configurações da package com as variáveis de ambiente. Sem
+	// a chave configurada, uma chave aleatória é gerada e os tokens emitidos
+	// deixam de ser válidos quando o servidor é reiniciado.
+	chaveTokens = []byte(os.Getenv("REDCOINS_CA_CHAVE"))
+	if len(chaveTokens) == 0 {
+		log.Printf("cadastro: REDCOINS_CA_CHAVE não definida, utilizando chave aleatória")
+		chaveTokens = make([]byte, 32)
+		if _, err := rand.Read(chaveTokens); err != nil {
+			log.Fatalf("cadastro: %s", err)
+		}
+	}
+	urlServidor = strings.TrimSuffix(os.Getenv("REDCOINS_CA_URL"), "/")
+	if urlServidor == "" {
+		urlServidor = "https://localhost"
+	}
+}
+
+// emiteToken gera e registra um token de uso único do usuário para a
+// finalidade passada, válido por 'validade'. 'dado' é um valor associado à
+// operação autorizada pelo token.
+func emiteToken(email string, finalidade string, dado string, validade time.Duration) (string, erros.Erros) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", erros.CriaInternoPadrao(err)
+	}
+	id := hex.EncodeToString(b)
+	token := id + "." + assinaturaToken(finalidade, id)
+
+	agora := transacao.Agora()
+	t := database.TokenUsuario{
+		Hash:       hashToken(token),
+		Usuario:    email,
+		Finalidade: finalidade,
+		Dado:       dado,
+		Criado:     agora.Format(formatoData),
+		Expira:     agora.Add(validade).Format(formatoData),
+	}
+	if err := database.InsereTokenUsuario(t); err == database.ErrUsuarioNaoExiste {
+		return "", ErrUsuarioNaoExiste
+	} else if err != nil {
+		return "", erros.CriaInternoPadrao(err)
+	}
+	return token, erros.CriaVazio()
+}
+
+// consomeToken verifica a assinatura do token para a finalidade passada e o
+// marca como utilizado. Retorna ErrTokenEmailInvalido se o token é inválido,
+// já foi utilizado ou expirou.
+func consomeToken(token string, finalidade string) (database.TokenUsuario, erros.Erros) {
+	partes := strings.Split(token, ".")
+	if len(partes) != 2 || !hmac.Equal([]byte(partes[1]), []byte(assinaturaToken(finalidade, partes[0]))) {
+		return database.TokenUsuario{}, ErrTokenEmailInvalido
+	}
+	t, err := database.ConsomeTokenUsuario(hashToken(token), finalidade, transacao.Agora().Format(formatoData))
+	if err == database.ErrTokenInvalido {
+		return database.TokenUsuario{}, ErrTokenEmailInvalido
+	} else if err != nil {
+		return database.TokenUsuario{}, erros.CriaInternoPadrao(err)
+	}
+	return t, erros.CriaVazio()
+}
+
+// assinaturaToken calcula o HMAC-SHA256 da finalidade e do identificador de
+// um token, em base64 sem padding
+func assinaturaToken(finalidade string, id string) string {
+	mac := hmac.New(sha256.New, chaveTokens)
+	mac.Write([]byte(finalidade + ":" + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// hashToken calcula o hash SHA-256 (em hexadecimal) de um token
+func hashToken(token string) string {
+	soma := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(soma[:])
+}
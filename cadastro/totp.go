@@ -0,0 +1,100 @@
+package cadastro
+
+// Esse arquivo define o algoritmo TOTP (RFC 6238) da autenticação em dois
+// fatores: códigos de 6 dígitos gerados com HMAC-SHA1 a cada 30 segundos, como
+// esperado pelos aplicativos autenticadores
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Parâmetros do TOTP
+const (
+	// periodoTOTP é a duração, em segundos, de cada passo de tempo
+	periodoTOTP = 30
+	// digitosTOTP é a quantidade de dígitos de cada código
+	digitosTOTP = 6
+	// toleranciaTOTP é a quantidade de passos antes e depois do atual cujos
+	// códigos também são aceitos, compensando diferenças de relógio
+	toleranciaTOTP = 1
+	// emissorTOTP é o emissor exibido nos aplicativos autenticadores
+	emissorTOTP = "RedCoins"
+)
+
+// codificacaoTOTP é a codificação base32 sem padding dos segredos TOTP
+var codificacaoTOTP = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// geraSegredoTOTP gera um segredo TOTP aleatório de 160 bits em base32
+func geraSegredoTOTP() (string, error) {
+	segredo := make([]byte, 20)
+	if _, err := rand.Read(segredo); err != nil {
+		return "", err
+	}
+	return codificacaoTOTP.EncodeToString(segredo), nil
+}
+
+// passoTOTP retorna o passo de tempo do momento 't'
+func passoTOTP(t time.Time) int64 {
+	return t.Unix() / periodoTOTP
+}
+
+// codigoTOTP calcula o código do segredo (em base32) no passo de tempo
+// passado, segundo o algoritmo HOTP (RFC 4226)
+func codigoTOTP(segredo string, passo int64) (string, error) {
+	chave, err := codificacaoTOTP.DecodeString(strings.ToUpper(segredo))
+	if err != nil {
+		return "", err
+	}
+	mensagem := make([]byte, 8)
+	binary.BigEndian.PutUint64(mensagem, uint64(passo))
+	mac := hmac.New(sha1.New, chave)
+	mac.Write(mensagem)
+	soma := mac.Sum(nil)
+
+	// Truncamento dinâmico
+	deslocamento := soma[len(soma)-1] & 0x0f
+	valor := binary.BigEndian.Uint32(soma[deslocamento:deslocamento+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for i := 0; i < digitosTOTP; i++ {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", digitosTOTP, valor%modulo), nil
+}
+
+// verificaCodigoTOTP verifica se o código corresponde ao segredo no momento
+// 'agora', considerando a tolerância de passos. Retorna o passo do código e se
+// ele é válido.
+func verificaCodigoTOTP(segredo string, codigo string, agora time.Time) (int64, bool) {
+	atual := passoTOTP(agora)
+	for passo := atual - toleranciaTOTP; passo <= atual+toleranciaTOTP; passo++ {
+		esperado, err := codigoTOTP(segredo, passo)
+		if err != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(codigo), []byte(esperado)) {
+			return passo, true
+		}
+	}
+	return 0, false
+}
+
+// uriTOTP monta a URI de provisionamento ("otpauth://") do segredo, lida pelos
+// aplicativos autenticadores normalmente através de um QR code
+func uriTOTP(segredo string, email string) string {
+	parametros := url.Values{}
+	parametros.Set("secret", segredo)
+	parametros.Set("issuer", emissorTOTP)
+	parametros.Set("algorithm", "SHA1")
+	parametros.Set("digits", fmt.Sprint(digitosTOTP))
+	parametros.Set("period", fmt.Sprint(periodoTOTP))
+	rotulo := url.PathEscape(emissorTOTP + ":" + email)
+	return "otpauth://totp/" + rotulo + "?" + parametros.Encode()
+}
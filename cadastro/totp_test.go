@@ -0,0 +1,64 @@
+package cadastro
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// segredoRFC é o segredo dos vetores de teste da RFC 6238 ("12345678901234567890")
+// em base32
+const segredoRFC = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodigoTOTP(t *testing.T) {
+	// Vetores de teste da RFC 6238, truncados para 6 dígitos
+	testes := []struct {
+		unix     int64
+		esperado string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, teste := range testes {
+		codigo, err := codigoTOTP(segredoRFC, passoTOTP(time.Unix(teste.unix, 0)))
+		if err != nil || codigo != teste.esperado {
+			t.Errorf("Código inesperado para %v: %v (%v)", teste.unix, codigo, err)
+		}
+	}
+	if _, err := codigoTOTP("1!", 1); err == nil {
+		t.Errorf("Segredo inválido aceito")
+	}
+}
+
+func TestVerificaCodigoTOTP(t *testing.T) {
+	agora := time.Unix(1111111111, 0)
+	passo := passoTOTP(agora)
+	for _, deslocamento := range []int64{-1, 0, 1} {
+		codigo, _ := codigoTOTP(segredoRFC, passo+deslocamento)
+		if p, ok := verificaCodigoTOTP(segredoRFC, codigo, agora); !ok || p != passo+deslocamento {
+			t.Errorf("Código do passo %v recusado", deslocamento)
+		}
+	}
+	codigo, _ := codigoTOTP(segredoRFC, passo+2)
+	if _, ok := verificaCodigoTOTP(segredoRFC, codigo, agora); ok {
+		t.Errorf("Código fora da tolerância aceito")
+	}
+}
+
+func TestSegredoTOTP(t *testing.T) {
+	segredo, err := geraSegredoTOTP()
+	if err != nil || len(segredo) != 32 {
+		t.Fatalf("Segredo inesperado: %v (%v)", segredo, err)
+	}
+	if _, err := codigoTOTP(segredo, 1); err != nil {
+		t.Errorf("Segredo gerado inválido: %v", err)
+	}
+	uri := uriTOTP("ABC", "teste@gmail.com")
+	if !strings.HasPrefix(uri, "otpauth://totp/RedCoins:teste@gmail.com?") ||
+		!strings.Contains(uri, "secret=ABC") || !strings.Contains(uri, "issuer=RedCoins") {
+		t.Errorf("URI inesperada: %v", uri)
+	}
+}
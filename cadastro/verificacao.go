@@ -0,0 +1,64 @@
+package cadastro
+
+// Esse arquivo define a verificação do e-mail dos usuários: o envio do link de
+// verificação após o cadastro e a confirmação do e-mail a partir do link
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/loteny/redcoins/correio"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+// validadeVerificacao é a validade do link de verificação do e-mail
+const validadeVerificacao = 24 * time.Hour
+
+// VerificaEmailHTTP marca como verificado o e-mail do usuário do token do
+// campo "token" do request, enviado por e-mail após o cadastro
+func VerificaEmailHTTP(r *http.Request) erros.Erros {
+	t, err := consomeToken(r.URL.Query().Get("token"), database.TokenVerificacaoEmail)
+	if !erros.Vazio(err) {
+		return err
+	}
+	if err := database.MarcaEmailVerificado(t.Usuario); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	return erros.CriaVazio()
+}
+
+// ReenviaVerificacaoHTTP envia um novo link de verificação ao e-mail do
+// usuário. Os links enviados anteriormente continuam válidos até expirarem.
+func ReenviaVerificacaoHTTP(email string) erros.Erros {
+	usr, err := database.AdquireUsuario(email)
+	if err != nil {
+		return erros.CriaInternoPadrao(err)
+	} else if usr.EmailVerificado {
+		return ErrEmailJaVerificado
+	}
+	return enviaVerificacao(usr)
+}
+
+// enviaVerificacao emite um token de verificação do e-mail do usuário e envia
+// o link de verificação por e-mail
+func enviaVerificacao(usr database.Usuario) erros.Erros {
+	token, err := emiteToken(usr.Email, database.TokenVerificacaoEmail, "", validadeVerificacao)
+	if !erros.Vazio(err) {
+		return err
+	}
+	m := correio.Mensagem{
+		Para:    usr.Email,
+		Assunto: "Confirme seu e-mail na RedCoins",
+		Corpo: "Olá, " + usr.Nome + ".\n\n" +
+			"Para confirmar seu e-mail e liberar as compras e vendas de bitcoins, " +
+			"acesse o link abaixo em até 24 horas:\n\n" +
+			urlServidor + "/cadastro/verificar?token=" + url.QueryEscape(token) + "\n\n" +
+			"Se você não criou uma conta na RedCoins, ignore esta mensagem.\n",
+	}
+	if err := correio.Envia(m); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	return erros.CriaVazio()
+}
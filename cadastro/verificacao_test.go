@@ -0,0 +1,76 @@
+package cadastro
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/loteny/redcoins/correio"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+func TestVerificacaoEmail(t *testing.T) {
+	caixa := correio.NovaCaixaSaida("")
+	anterior := correio.Padrao()
+	correio.DefinePadrao(caixa)
+	defer correio.DefinePadrao(anterior)
+
+	// O cadastro envia o link de verificação
+	form := url.Values{}
+	form.Set("email", "testeverificacao@gmail.com")
+	form.Set("senha", "senhateste1")
+	form.Set("nome", "Teste Verificação")
+	form.Set("nascimento", "1994-03-07")
+	r, _ := http.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if err := RealizaCadastroRequestHTTP(r); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if usr, err := database.AdquireUsuario("testeverificacao@gmail.com"); err != nil || usr.EmailVerificado {
+		t.Errorf("Usuário inesperado: %v (%v)", usr, err)
+	}
+	m, ok := caixa.Ultima("testeverificacao@gmail.com")
+	prefixo := urlServidor + "/cadastro/verificar?token="
+	i := strings.Index(m.Corpo, prefixo)
+	if !ok || i < 0 {
+		t.Fatalf("Mensagem inesperada: %v", m)
+	}
+	token, _ := url.QueryUnescape(strings.Fields(m.Corpo[i+len(prefixo):])[0])
+
+	// Tokens forjados ou de outra finalidade são recusados
+	partes := strings.Split(token, ".")
+	alterado := "0" + token[1:]
+	if token[0] == '0' {
+		alterado = "1" + token[1:]
+	}
+	for _, invalido := range []string{"", partes[0], partes[0] + ".abc", alterado} {
+		if err := VerificaEmailHTTP(testRequestToken(invalido)); err.Error() != ErrTokenEmailInvalido.Error() {
+			t.Errorf("Erro inesperado para %q: %v", invalido, err)
+		}
+	}
+	if _, err := consomeToken(token, "outra"); err.Error() != ErrTokenEmailInvalido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Verificação, apenas uma vez
+	if err := VerificaEmailHTTP(testRequestToken(token)); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if usr, err := database.AdquireUsuario("testeverificacao@gmail.com"); err != nil || !usr.EmailVerificado {
+		t.Errorf("Usuário inesperado: %v (%v)", usr, err)
+	}
+	if err := VerificaEmailHTTP(testRequestToken(token)); err.Error() != ErrTokenEmailInvalido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := ReenviaVerificacaoHTTP("testeverificacao@gmail.com"); err.Error() != ErrEmailJaVerificado.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+// testRequestToken cria um request GET com o campo "token" na query string
+func testRequestToken(token string) *http.Request {
+	r, _ := http.NewRequest("GET", "/?token="+url.QueryEscape(token), nil)
+	return r
+}
@@ -0,0 +1,80 @@
+// Package carteira calcula a posição em Bitcoins dos usuários a partir do seu
+// histórico de transações: quantidade, custo de aquisição, valor de mercado e
+// lucros realizado e não realizado.
+// Esse package usa exclusivamente a estrutura de erros 'erros.Erros'.
+package carteira
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/precobtc"
+)
+
+// Lista de possíveis erros do módulo
+var (
+	ErrPrecoIndisponivel = erros.Cria(false, 503, "preco_indisponivel")
+)
+
+// metodoCusto é o método de custo de aquisição utilizado ("medio" ou "fifo")
+var metodoCusto string
+
+func init() {
+	// Inicializa as configurações da package com as variáveis de ambiente. Por
+	// padrão, é utilizado o custo médio ponderado.
+	metodoCusto = NovaPosicao(os.Getenv("REDCOINS_CT_METODOCUSTO")).Metodo()
+}
+
+// portfolioResposta é a estrutura JSON do portfólio de um usuário enviada ao
+// cliente
+type portfolioResposta struct {
+	Posicao
+	MetodoCusto       string  `json:"metodoCusto"`
+	PrecoAtual        float64 `json:"precoAtual"`
+	ValorMercado      float64 `json:"valorMercado"`
+	LucroNaoRealizado float64 `json:"lucroNaoRealizado"`
+}
+
+// PosicaoUsuario calcula a posição atual do usuário do e-mail passado com o
+// método de custo de aquisição configurado
+func PosicaoUsuario(email string) (*Posicao, erros.Erros) {
+	transacoes, err := database.AdquireHistoricoUsuario(email)
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	posicao := NovaPosicao(metodoCusto)
+	for _, tr := range transacoes {
+		posicao.Registra(tr)
+	}
+	return posicao, erros.CriaVazio()
+}
+
+// PortfolioHTTP retorna os bytes da string JSON com a posição do usuário, seu
+// valor de mercado segundo o preço atual da Bitcoin e os lucros realizado e não
+// realizado. Se o preço da Bitcoin não pode ser adquirido, retorna
+// ErrPrecoIndisponivel.
+func PortfolioHTTP(email string) ([]byte, erros.Erros) {
+	posicao, err := PosicaoUsuario(email)
+	if !erros.Vazio(err) {
+		return nil, err
+	}
+	preco, err2 := precobtc.PrecoUnidade()
+	if err2 != nil || preco <= 0 {
+		return nil, ErrPrecoIndisponivel
+	}
+
+	resposta := portfolioResposta{
+		Posicao:      *posicao,
+		MetodoCusto:  posicao.Metodo(),
+		PrecoAtual:   preco,
+		ValorMercado: posicao.Bitcoins * preco,
+	}
+	resposta.LucroNaoRealizado = resposta.ValorMercado - posicao.CustoTotal
+	respostaBytes, err2 := json.Marshal(resposta)
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	return respostaBytes, erros.CriaVazio()
+}
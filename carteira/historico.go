@@ -0,0 +1,139 @@
+package carteira
+
+// Esse arquivo define o histórico diário dos saldos dos usuários: o registro
+// dos saldos de todos os usuários ao fim de cada dia, a consulta dos saldos em
+// uma data e a verificação da consistência do histórico
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// Lista de possíveis erros do histórico
+var (
+	ErrDataInvalida = erros.Cria(false, 400, "data_invalida")
+)
+
+// carteiraResposta é a estrutura JSON dos saldos de um usuário em uma data
+// enviada ao cliente. 'Registro' é o dia do registro do histórico utilizado no
+// cálculo e é omitido se não havia registro anterior à data.
+type carteiraResposta struct {
+	Em       string  `json:"em"`
+	Bitcoins float64 `json:"bitcoins"`
+	Reais    float64 `json:"reais"`
+	Registro string  `json:"registro,omitempty"`
+}
+
+// CarteiraHTTP retorna os bytes da string JSON com os saldos do usuário do
+// e-mail passado ao fim do dia do campo "em" ("YYYY-MM-DD", padrão é o dia
+// atual)
+func CarteiraHTTP(r *http.Request, email string) ([]byte, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	em := r.FormValue("em")
+	if em == "" {
+		em = transacao.Agora().Format("2006-01-02")
+	} else if _, err := time.Parse("2006-01-02", em); err != nil {
+		return nil, ErrDataInvalida
+	}
+
+	saldo, registro, err := database.AdquireSaldosEm(email, em)
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	resposta := carteiraResposta{
+		Em:       em,
+		Bitcoins: saldo.Bitcoins,
+		Reais:    saldo.Reais,
+		Registro: registro,
+	}
+	respostaBytes, err := json.Marshal(resposta)
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	return respostaBytes, erros.CriaVazio()
+}
+
+// VerificaHistoricoHTTP retorna os bytes da string JSON com os registros do
+// histórico de saldos que divergem dos saldos calculados a partir de todas as
+// transações
+func VerificaHistoricoHTTP() ([]byte, erros.Erros) {
+	divergencias, err := database.VerificaSaldosHistorico()
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	respostaBytes, err := json.Marshal(divergencias)
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	return respostaBytes, erros.CriaVazio()
+}
+
+// IniciaRegistroSaldos inicia, em uma nova goroutine, o registro diário dos
+// saldos. Os dias pendentes desde o último registro são registrados
+// imediatamente e, em seguida, uma vez por dia. Um dia só é registrado após o
+// fim da janela de datas das transações, para incluir as transações com data
+// enviada pelo cliente que cheguem após o fim do dia.
+func IniciaRegistroSaldos() {
+	go func() {
+		for {
+			agora := transacao.Agora()
+			registraSaldosPendentes(agora, transacao.Janela())
+			time.Sleep(proximoRegistro(agora, transacao.Janela()).Sub(agora))
+		}
+	}()
+}
+
+// registraSaldosPendentes registra os saldos de todos os dias encerrados desde
+// o último registro do histórico
+func registraSaldosPendentes(agora time.Time, janela time.Duration) {
+	ultimo, err := database.AdquireUltimoDiaSaldos()
+	if err != nil {
+		log.Printf("carteira: registraSaldosPendentes: %s", err)
+		return
+	}
+	for _, dia := range diasPendentes(ultimo, agora, janela) {
+		if err := database.RegistraSaldosDia(dia); err != nil {
+			log.Printf("carteira: registraSaldosPendentes: %s: %s", dia, err)
+			return
+		}
+	}
+}
+
+// diasPendentes retorna os dias encerrados há mais tempo do que 'janela' até
+// 'agora' que ainda não foram registrados, sendo 'ultimo' o último dia
+// registrado. Se o histórico está vazio, apenas o último desses dias é
+// registrado, pois o primeiro registro já considera todas as transações
+// anteriores.
+func diasPendentes(ultimo string, agora time.Time, janela time.Duration) []string {
+	limite := agora.Add(-janela)
+	ontem := time.Date(limite.Year(), limite.Month(), limite.Day()-1, 0, 0, 0, 0, time.UTC)
+	inicio := ontem
+	if ultimo != "" {
+		dia, err := time.Parse("2006-01-02", ultimo)
+		if err == nil {
+			inicio = dia.AddDate(0, 0, 1)
+		}
+	}
+	dias := make([]string, 0)
+	for dia := inicio; !dia.After(ontem); dia = dia.AddDate(0, 0, 1) {
+		dias = append(dias, dia.Format("2006-01-02"))
+	}
+	return dias
+}
+
+// proximoRegistro retorna o momento do próximo registro diário dos saldos
+// após 'agora', que ocorre quando a janela de datas do fim do dia se encerra
+func proximoRegistro(agora time.Time, janela time.Duration) time.Time {
+	limite := agora.Add(-janela)
+	meiaNoite := time.Date(limite.Year(), limite.Month(), limite.Day()+1, 0, 0, 0, 0, limite.Location())
+	return meiaNoite.Add(janela)
+}
@@ -0,0 +1,41 @@
+package carteira
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDiasPendentes(t *testing.T) {
+	agora := time.Date(2018, 3, 2, 1, 0, 0, 0, time.UTC)
+	casos := map[string]string{
+		"":           "[2018-03-01]",
+		"2018-02-26": "[2018-02-27 2018-02-28 2018-03-01]",
+		"2018-03-01": "[]",
+	}
+	for ultimo, esperado := range casos {
+		if dias := diasPendentes(ultimo, agora, 10*time.Minute); fmt.Sprintf("%v", dias) != esperado {
+			t.Errorf("Dias pendentes inesperados após %q: %v (esperado %v)", ultimo, dias, esperado)
+		}
+	}
+
+	// O dia anterior ainda está na janela de datas e não é registrado
+	agora = time.Date(2018, 3, 2, 0, 5, 0, 0, time.UTC)
+	if dias := diasPendentes("2018-02-26", agora, 10*time.Minute); fmt.Sprintf("%v", dias) != "[2018-02-27 2018-02-28]" {
+		t.Errorf("Dias pendentes inesperados dentro da janela: %v", dias)
+	}
+}
+
+func TestProximoRegistro(t *testing.T) {
+	fuso := time.FixedZone("BRT", -3*60*60)
+	casos := map[time.Time]time.Time{
+		time.Date(2018, 3, 2, 0, 5, 0, 0, fuso):    time.Date(2018, 3, 2, 0, 10, 0, 0, fuso),
+		time.Date(2018, 3, 2, 0, 10, 0, 0, fuso):   time.Date(2018, 3, 3, 0, 10, 0, 0, fuso),
+		time.Date(2018, 12, 31, 15, 0, 0, 0, fuso): time.Date(2019, 1, 1, 0, 10, 0, 0, fuso),
+	}
+	for agora, esperado := range casos {
+		if proximo := proximoRegistro(agora, 10*time.Minute); !proximo.Equal(esperado) {
+			t.Errorf("Próximo registro inesperado após %v: %v (esperado %v)", agora, proximo, esperado)
+		}
+	}
+}
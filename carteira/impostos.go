@@ -0,0 +1,188 @@
+package carteira
+
+// Esse arquivo define o relatório anual de ganhos de capital para a declaração
+// à Receita Federal. O custo de aquisição é sempre o custo médio ponderado,
+// método exigido pela Receita Federal, independentemente do método configurado
+// para o portfólio.
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// Lista de possíveis erros do relatório de impostos
+var (
+	ErrAnoInvalido     = erros.Cria(false, 400, "ano_invalido")
+	ErrFormatoInvalido = erros.Cria(false, 400, "formato_invalido")
+)
+
+// limiteIsencao é o volume mensal de vendas em reais até o qual os ganhos de
+// capital são isentos de imposto de renda
+const limiteIsencao = 35000
+
+// MesImposto é o resultado das vendas de um mês. 'LucroTributavel' é o lucro
+// realizado do mês quando positivo e sem isenção, e zero caso contrário.
+type MesImposto struct {
+	Mes             int     `json:"mes"`
+	VolumeVendas    float64 `json:"volumeVendas"`
+	LucroRealizado  float64 `json:"lucroRealizado"`
+	Isento          bool    `json:"isento"`
+	LucroTributavel float64 `json:"lucroTributavel"`
+}
+
+// PosicaoAnual é a posição de um usuário no último dia de um ano, a ser
+// informada na declaração anual de bens e direitos
+type PosicaoAnual struct {
+	Data       string  `json:"data"`
+	Bitcoins   float64 `json:"bitcoins"`
+	CustoTotal float64 `json:"custoTotal"`
+}
+
+// RelatorioImpostos é o relatório anual de ganhos de capital de um usuário
+type RelatorioImpostos struct {
+	Ano             int          `json:"ano"`
+	Meses           []MesImposto `json:"meses"`
+	VolumeVendas    float64      `json:"volumeVendas"`
+	LucroRealizado  float64      `json:"lucroRealizado"`
+	LucroTributavel float64      `json:"lucroTributavel"`
+	PosicaoAnterior PosicaoAnual `json:"posicaoAnterior"`
+	PosicaoFinal    PosicaoAnual `json:"posicaoFinal"`
+}
+
+// RelatorioImpostosHTTP gera o relatório de ganhos de capital do ano do campo
+// "ano" do request para o usuário do e-mail passado. O ano não pode ser
+// posterior ao ano atual no fuso horário das transações. O campo opcional
+// "formato" define o formato da resposta: "json" (padrão) ou "csv". Retorna os
+// bytes do relatório e seu Content-Type.
+func RelatorioImpostosHTTP(r *http.Request, email string) ([]byte, string, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return nil, "", erros.CriaInternoPadrao(err)
+	}
+	ano, err := strconv.Atoi(r.FormValue("ano"))
+	if err != nil || ano < 2009 || ano > transacao.Agora().Year() {
+		return nil, "", ErrAnoInvalido
+	}
+	formato := r.FormValue("formato")
+	if formato != "" && formato != "json" && formato != "csv" {
+		return nil, "", ErrFormatoInvalido
+	}
+
+	transacoes, err := database.AdquireHistoricoUsuario(email)
+	if err != nil {
+		return nil, "", erros.CriaInternoPadrao(err)
+	}
+	relatorio := calculaImpostos(transacoes, ano)
+
+	if formato == "csv" {
+		relatorioBytes, err := relatorio.csv()
+		if err != nil {
+			return nil, "", erros.CriaInternoPadrao(err)
+		}
+		return relatorioBytes, "text/csv; charset=utf-8", erros.CriaVazio()
+	}
+	relatorioBytes, err := json.Marshal(relatorio)
+	if err != nil {
+		return nil, "", erros.CriaInternoPadrao(err)
+	}
+	return relatorioBytes, "application/json", erros.CriaVazio()
+}
+
+// calculaImpostos calcula o relatório de ganhos de capital do ano 'ano' a partir
+// do histórico completo de transações do usuário em ordem cronológica. As
+// transações de anos anteriores são necessárias para o custo médio.
+func calculaImpostos(transacoes []database.Transacao, ano int) RelatorioImpostos {
+	relatorio := RelatorioImpostos{
+		Ano:             ano,
+		Meses:           make([]MesImposto, 12),
+		PosicaoAnterior: PosicaoAnual{Data: strconv.Itoa(ano-1) + "-12-31"},
+		PosicaoFinal:    PosicaoAnual{Data: strconv.Itoa(ano) + "-12-31"},
+	}
+	for i := range relatorio.Meses {
+		relatorio.Meses[i].Mes = i + 1
+	}
+
+	// A posição anterior é registrada antes da primeira transação do ano
+	posicao := NovaPosicao(MetodoMedio)
+	anteriorRegistrada := false
+	registraPosicao := func(p *PosicaoAnual) {
+		p.Bitcoins = posicao.Bitcoins
+		p.CustoTotal = posicao.CustoTotal
+	}
+	for _, tr := range transacoes {
+		dia, err := time.Parse("2006-01-02 15:04:05", tr.Dia)
+		if err != nil || dia.Year() > ano {
+			break
+		}
+		if dia.Year() == ano && !anteriorRegistrada {
+			registraPosicao(&relatorio.PosicaoAnterior)
+			anteriorRegistrada = true
+		}
+		lucro := posicao.Registra(tr)
+		if dia.Year() == ano && !tr.Compra {
+			mes := &relatorio.Meses[dia.Month()-1]
+			mes.VolumeVendas += tr.Creditos
+			mes.LucroRealizado += lucro
+		}
+	}
+	if !anteriorRegistrada {
+		registraPosicao(&relatorio.PosicaoAnterior)
+	}
+	registraPosicao(&relatorio.PosicaoFinal)
+
+	for i := range relatorio.Meses {
+		mes := &relatorio.Meses[i]
+		mes.Isento = mes.VolumeVendas <= limiteIsencao
+		if !mes.Isento && mes.LucroRealizado > 0 {
+			mes.LucroTributavel = mes.LucroRealizado
+		}
+		relatorio.VolumeVendas += mes.VolumeVendas
+		relatorio.LucroRealizado += mes.LucroRealizado
+		relatorio.LucroTributavel += mes.LucroTributavel
+	}
+	return relatorio
+}
+
+// csv retorna o relatório no formato CSV. As linhas dos meses são seguidas de
+// uma linha com os totais do ano e, após uma linha em branco, das posições no
+// fim do ano anterior e no fim do ano do relatório.
+func (relatorio RelatorioImpostos) csv() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	linhas := [][]string{{"mes", "volume_vendas", "lucro_realizado", "isento", "lucro_tributavel"}}
+	for _, mes := range relatorio.Meses {
+		linhas = append(linhas, []string{
+			strconv.Itoa(mes.Mes),
+			formataReais(mes.VolumeVendas),
+			formataReais(mes.LucroRealizado),
+			strconv.FormatBool(mes.Isento),
+			formataReais(mes.LucroTributavel),
+		})
+	}
+	linhas = append(linhas,
+		[]string{"total", formataReais(relatorio.VolumeVendas),
+			formataReais(relatorio.LucroRealizado), "", formataReais(relatorio.LucroTributavel)},
+		[]string{},
+		[]string{"data", "bitcoins", "custo_total"})
+	for _, p := range []PosicaoAnual{relatorio.PosicaoAnterior, relatorio.PosicaoFinal} {
+		linhas = append(linhas, []string{p.Data,
+			strconv.FormatFloat(p.Bitcoins, 'f', 8, 64), formataReais(p.CustoTotal)})
+	}
+	if err := w.WriteAll(linhas); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// formataReais formata um valor em reais com duas casas decimais
+func formataReais(valor float64) string {
+	return strconv.FormatFloat(valor, 'f', 2, 64)
+}
@@ -0,0 +1,64 @@
+package carteira
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/loteny/redcoins/database"
+)
+
+func TestCalculaImpostos(t *testing.T) {
+	transacoes := []database.Transacao{
+		// Compra em 2017, antes do ano do relatório
+		{Compra: true, Bitcoins: 2, Creditos: 40000, Dia: "2017-06-01 10:00:00"},
+		// Venda isenta em janeiro: volume de 30000 com custo de 20000
+		{Compra: false, Bitcoins: 1, Creditos: 30000, Dia: "2018-01-10 10:00:00"},
+		// Compra e venda tributável em março: custo médio de 30000
+		{Compra: true, Bitcoins: 1, Creditos: 40000, Dia: "2018-03-01 10:00:00"},
+		{Compra: false, Bitcoins: 1, Creditos: 50000, Dia: "2018-03-20 10:00:00"},
+		// Transação posterior ao ano do relatório
+		{Compra: true, Bitcoins: 1, Creditos: 1000, Dia: "2019-01-01 10:00:00"},
+	}
+	relatorio := calculaImpostos(transacoes, 2018)
+
+	janeiro, marco := relatorio.Meses[0], relatorio.Meses[2]
+	testComparaValores(t, "volume de janeiro", janeiro.VolumeVendas, 30000)
+	testComparaValores(t, "lucro de janeiro", janeiro.LucroRealizado, 10000)
+	testComparaValores(t, "lucro tributável de janeiro", janeiro.LucroTributavel, 0)
+	if !janeiro.Isento {
+		t.Errorf("Janeiro deveria ser isento")
+	}
+	testComparaValores(t, "lucro de março", marco.LucroRealizado, 20000)
+	testComparaValores(t, "lucro tributável de março", marco.LucroTributavel, 20000)
+	if marco.Isento {
+		t.Errorf("Março não deveria ser isento")
+	}
+	testComparaValores(t, "lucro do ano", relatorio.LucroRealizado, 30000)
+	testComparaValores(t, "lucro tributável do ano", relatorio.LucroTributavel, 20000)
+
+	// Posições no fim de 2017 e de 2018
+	testComparaValores(t, "bitcoins em 2017", relatorio.PosicaoAnterior.Bitcoins, 2)
+	testComparaValores(t, "custo em 2017", relatorio.PosicaoAnterior.CustoTotal, 40000)
+	testComparaValores(t, "bitcoins em 2018", relatorio.PosicaoFinal.Bitcoins, 1)
+	testComparaValores(t, "custo em 2018", relatorio.PosicaoFinal.CustoTotal, 30000)
+	if relatorio.PosicaoFinal.Data != "2018-12-31" {
+		t.Errorf("Data da posição final inesperada: %v", relatorio.PosicaoFinal.Data)
+	}
+}
+
+func TestRelatorioImpostosCSV(t *testing.T) {
+	relatorio := calculaImpostos([]database.Transacao{
+		{Compra: true, Bitcoins: 1, Creditos: 100, Dia: "2018-01-01 10:00:00"},
+	}, 2018)
+	relatorioBytes, err := relatorio.csv()
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	linhas := strings.Split(string(relatorioBytes), "\n")
+	if linhas[0] != "mes,volume_vendas,lucro_realizado,isento,lucro_tributavel" ||
+		linhas[1] != "1,0.00,0.00,true,0.00" ||
+		linhas[13] != "total,0.00,0.00,,0.00" ||
+		linhas[17] != "2018-12-31,1.00000000,100.00" {
+		t.Errorf("CSV inesperado:\n%s", relatorioBytes)
+	}
+}
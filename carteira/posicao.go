@@ -0,0 +1,117 @@
+package carteira
+
+// Esse arquivo define o cálculo da posição em Bitcoins de um usuário a partir
+// do seu histórico de transações, segundo um método de custo de aquisição
+
+import (
+	"math"
+
+	"github.com/loteny/redcoins/database"
+)
+
+// Métodos possíveis de cálculo do custo de aquisição
+const (
+	// MetodoMedio utiliza o custo médio ponderado de todas as Bitcoins em
+	// posse do usuário
+	MetodoMedio = "medio"
+	// MetodoFIFO considera que as Bitcoins vendidas são sempre as compradas há
+	// mais tempo
+	MetodoFIFO = "fifo"
+)
+
+// satoshisPorBitcoin é a quantidade de unidades indivisíveis em uma Bitcoin. As
+// quantidades da posição são armazenadas nessa unidade para evitar erros de
+// arredondamento nas somas e subtrações sucessivas.
+const satoshisPorBitcoin = 1e8
+
+// Posicao é a posição em Bitcoins de um usuário. 'CustoTotal' é o custo de
+// aquisição em reais das Bitcoins em posse do usuário e 'LucroRealizado' é o
+// lucro (ou prejuízo, se negativo) somado de todas as vendas.
+type Posicao struct {
+	Bitcoins       float64 `json:"bitcoins"`
+	CustoTotal     float64 `json:"custoTotal"`
+	CustoMedio     float64 `json:"custoMedio"`
+	LucroRealizado float64 `json:"lucroRealizado"`
+
+	metodo string
+	lotes  []lote
+}
+
+// lote é um conjunto de Bitcoins adquiridas com o mesmo custo. No método do
+// custo médio, a posição possui no máximo um lote.
+type lote struct {
+	satoshis int64
+	custo    float64
+}
+
+// NovaPosicao cria uma posição vazia que utiliza o método de custo de
+// aquisição passado. Métodos desconhecidos são tratados como MetodoMedio.
+func NovaPosicao(metodo string) *Posicao {
+	if metodo != MetodoFIFO {
+		metodo = MetodoMedio
+	}
+	return &Posicao{metodo: metodo}
+}
+
+// Metodo retorna o método de custo de aquisição da posição
+func (p *Posicao) Metodo() string {
+	return p.metodo
+}
+
+// Registra atualiza a posição com uma transação. As transações devem ser
+// registradas em ordem cronológica. Retorna o lucro realizado pela transação,
+// que é sempre zero para compras.
+func (p *Posicao) Registra(tr database.Transacao) float64 {
+	satoshis := int64(math.Round(tr.Bitcoins * satoshisPorBitcoin))
+	lucro := 0.0
+	if tr.Compra {
+		if p.metodo == MetodoMedio && len(p.lotes) > 0 {
+			p.lotes[0].satoshis += satoshis
+			p.lotes[0].custo += tr.Creditos
+		} else {
+			p.lotes = append(p.lotes, lote{satoshis: satoshis, custo: tr.Creditos})
+		}
+	} else {
+		lucro = tr.Creditos - p.retira(satoshis)
+		p.LucroRealizado += lucro
+	}
+	p.atualiza()
+	return lucro
+}
+
+// retira remove da posição a quantidade de satoshis vendida, começando pelos
+// lotes mais antigos, e retorna o custo de aquisição da quantidade removida.
+// Uma quantidade maior que a posição (o que não deve ocorrer, pois vendas sem
+// saldo são recusadas) tem custo zero no excedente.
+func (p *Posicao) retira(satoshis int64) float64 {
+	custo := 0.0
+	for satoshis > 0 && len(p.lotes) > 0 {
+		l := &p.lotes[0]
+		if satoshis < l.satoshis {
+			parcial := l.custo * float64(satoshis) / float64(l.satoshis)
+			l.custo -= parcial
+			l.satoshis -= satoshis
+			return custo + parcial
+		}
+		custo += l.custo
+		satoshis -= l.satoshis
+		p.lotes = p.lotes[1:]
+	}
+	return custo
+}
+
+// atualiza recalcula os campos exportados da posição a partir dos lotes
+func (p *Posicao) atualiza() {
+	var satoshis int64
+	custo := 0.0
+	for _, l := range p.lotes {
+		satoshis += l.satoshis
+		custo += l.custo
+	}
+	p.Bitcoins = float64(satoshis) / satoshisPorBitcoin
+	p.CustoTotal = custo
+	p.CustoMedio = 0
+	if satoshis > 0 {
+		p.CustoMedio = custo / p.Bitcoins
+	}
+}
@@ -0,0 +1,64 @@
+package carteira
+
+import (
+	"math"
+	"testing"
+
+	"github.com/loteny/redcoins/database"
+)
+
+// testHistorico é um histórico de transações com duas compras a preços
+// diferentes seguidas de uma venda parcial
+var testHistorico = []database.Transacao{
+	{Compra: true, Bitcoins: 1, Creditos: 100},
+	{Compra: true, Bitcoins: 1, Creditos: 300},
+	{Compra: false, Bitcoins: 1.5, Creditos: 450},
+}
+
+func TestPosicaoMedio(t *testing.T) {
+	p := NovaPosicao(MetodoMedio)
+	lucros := make([]float64, 0)
+	for _, tr := range testHistorico {
+		lucros = append(lucros, p.Registra(tr))
+	}
+	// Custo médio de 200 por Bitcoin: a venda de 1.5 custou 300
+	testComparaValores(t, "lucro da compra", lucros[0], 0)
+	testComparaValores(t, "lucro da venda", lucros[2], 150)
+	testComparaValores(t, "bitcoins", p.Bitcoins, 0.5)
+	testComparaValores(t, "custo total", p.CustoTotal, 100)
+	testComparaValores(t, "custo médio", p.CustoMedio, 200)
+	testComparaValores(t, "lucro realizado", p.LucroRealizado, 150)
+}
+
+func TestPosicaoFIFO(t *testing.T) {
+	p := NovaPosicao(MetodoFIFO)
+	for _, tr := range testHistorico {
+		p.Registra(tr)
+	}
+	// A venda consome o primeiro lote (100) e metade do segundo (150)
+	testComparaValores(t, "bitcoins", p.Bitcoins, 0.5)
+	testComparaValores(t, "custo total", p.CustoTotal, 150)
+	testComparaValores(t, "custo médio", p.CustoMedio, 300)
+	testComparaValores(t, "lucro realizado", p.LucroRealizado, 200)
+
+	// Vender o restante zera a posição
+	p.Registra(database.Transacao{Compra: false, Bitcoins: 0.5, Creditos: 100})
+	testComparaValores(t, "bitcoins", p.Bitcoins, 0)
+	testComparaValores(t, "custo total", p.CustoTotal, 0)
+	testComparaValores(t, "custo médio", p.CustoMedio, 0)
+	testComparaValores(t, "lucro realizado", p.LucroRealizado, 150)
+}
+
+func TestNovaPosicaoMetodoDesconhecido(t *testing.T) {
+	if metodo := NovaPosicao("lifo").Metodo(); metodo != MetodoMedio {
+		t.Errorf("Método inesperado: %v", metodo)
+	}
+}
+
+// testComparaValores compara dois números com tolerância para erros de ponto
+// flutuante
+func testComparaValores(t *testing.T, nome string, valor float64, esperado float64) {
+	if math.Abs(valor-esperado) > 1e-9 {
+		t.Errorf("Valor inesperado de %s: %v (esperado %v)", nome, valor, esperado)
+	}
+}
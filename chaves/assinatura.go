@@ -0,0 +1,110 @@
+package chaves
+
+// Esse arquivo define a assinatura HMAC-SHA256 dos pedidos feitos com chaves
+// de API, a verificação dos IPs permitidos e o registro em memória das
+// assinaturas já utilizadas, que impede que um pedido seja repetido
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// mensagemAssinatura monta o conteúdo assinado de um pedido: o método, o path
+// (incluindo a query string), o timestamp e o corpo, separados por quebras de
+// linha
+func mensagemAssinatura(metodo string, path string, timestamp string, corpo []byte) []byte {
+	mensagem := metodo + "\n" + path + "\n" + timestamp + "\n"
+	return append([]byte(mensagem), corpo...)
+}
+
+// assinatura calcula o HMAC-SHA256 da mensagem com o segredo (em hexadecimal)
+// de uma chave de API e o retorna em hexadecimal
+func assinatura(segredo string, mensagem []byte) (string, error) {
+	chave, err := hex.DecodeString(segredo)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, chave)
+	mac.Write(mensagem)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// assinaturaConfere compara em tempo constante a assinatura recebida com a
+// esperada
+func assinaturaConfere(recebida string, esperada string) bool {
+	return hmac.Equal([]byte(strings.ToLower(recebida)), []byte(esperada))
+}
+
+// ipPermitido retorna se o IP está na lista de IPs e redes CIDR permitidos.
+// Uma lista vazia permite todos os IPs.
+func ipPermitido(permitidos []string, endereco string) bool {
+	if len(permitidos) == 0 {
+		return true
+	}
+	ip := net.ParseIP(endereco)
+	if ip == nil {
+		return false
+	}
+	for _, permitido := range permitidos {
+		if _, rede, err := net.ParseCIDR(permitido); err == nil {
+			if rede.Contains(ip) {
+				return true
+			}
+		} else if p := net.ParseIP(permitido); p != nil && p.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ipValido retorna se a string é um IP ou uma rede CIDR
+func ipValido(ip string) bool {
+	if _, _, err := net.ParseCIDR(ip); err == nil {
+		return true
+	}
+	return net.ParseIP(ip) != nil
+}
+
+// aleatorio gera 'n' bytes aleatórios codificados em hexadecimal
+func aleatorio(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// assinaturasUsadas registra as assinaturas já utilizadas até o momento em
+// que seus timestamps saem da janela de aceitação, quando os pedidos seriam
+// recusados de qualquer forma
+type assinaturasUsadas struct {
+	sync.Mutex
+	ate map[string]time.Time
+}
+
+// usadas são as assinaturas utilizadas conhecidas pelo servidor
+var usadas = &assinaturasUsadas{ate: make(map[string]time.Time)}
+
+// registra registra a assinatura como utilizada até 'ate' e retorna se ela
+// ainda não havia sido utilizada em 'agora'. As assinaturas cujo registro já
+// expirou são removidas.
+func (a *assinaturasUsadas) registra(assinatura string, ate time.Time, agora time.Time) bool {
+	a.Lock()
+	defer a.Unlock()
+	for usada, expira := range a.ate {
+		if !expira.After(agora) {
+			delete(a.ate, usada)
+		}
+	}
+	if _, ok := a.ate[assinatura]; ok {
+		return false
+	}
+	a.ate[assinatura] = ate
+	return true
+}
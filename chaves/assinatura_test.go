@@ -0,0 +1,68 @@
+package chaves
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAssinatura(t *testing.T) {
+	mensagem := mensagemAssinatura("POST", "/transacoes/compra?x=1", "1514800800", []byte("qtd=0.1"))
+	if string(mensagem) != "POST\n/transacoes/compra?x=1\n1514800800\nqtd=0.1" {
+		t.Errorf("Mensagem inesperada: %q", mensagem)
+	}
+	a, err := assinatura("00ff", mensagem)
+	if err != nil || len(a) != 64 {
+		t.Fatalf("Assinatura inesperada: %v (%v)", a, err)
+	}
+	if outra, _ := assinatura("ff00", mensagem); outra == a {
+		t.Errorf("Assinaturas iguais com segredos diferentes")
+	}
+	if _, err := assinatura("xyz", mensagem); err == nil {
+		t.Errorf("Segredo inválido aceito")
+	}
+}
+
+func TestIPPermitido(t *testing.T) {
+	permitidos := []string{"10.0.0.1", "192.168.0.0/24", "2001:db8::/32"}
+	testes := []struct {
+		ip       string
+		esperado bool
+	}{
+		{"10.0.0.1", true},
+		{"10.0.0.2", false},
+		{"192.168.0.200", true},
+		{"192.168.1.1", false},
+		{"2001:db8::1", true},
+		{"invalido", false},
+	}
+	for _, teste := range testes {
+		if ipPermitido(permitidos, teste.ip) != teste.esperado {
+			t.Errorf("Resultado inesperado para %v", teste.ip)
+		}
+	}
+	if !ipPermitido([]string{}, "10.0.0.2") {
+		t.Errorf("Lista vazia deve permitir todos os IPs")
+	}
+	if ipValido("10.0.0.0/33") || !ipValido("10.0.0.0/8") || !ipValido("::1") {
+		t.Errorf("Validação de IP inesperada")
+	}
+}
+
+func TestAssinaturasUsadas(t *testing.T) {
+	a := &assinaturasUsadas{ate: make(map[string]time.Time)}
+	agora := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	if !a.registra("a", agora.Add(time.Minute), agora) {
+		t.Errorf("Primeiro uso recusado")
+	}
+	if a.registra("a", agora.Add(time.Minute), agora.Add(time.Second)) {
+		t.Errorf("Assinatura repetida aceita")
+	}
+
+	// Registros expirados são removidos
+	if !a.registra("b", agora.Add(3*time.Minute), agora.Add(2*time.Minute)) {
+		t.Errorf("Primeiro uso recusado")
+	}
+	if _, ok := a.ate["a"]; ok {
+		t.Errorf("Assinaturas inesperadas: %v", a.ate)
+	}
+}
@@ -0,0 +1,316 @@
+// Package chaves trata das chaves de API dos usuários: a criação, listagem e
+// revogação das chaves e a autenticação dos pedidos assinados com elas. Cada
+// chave possui escopos, que definem as rotas que ela pode acessar, uma lista
+// opcional de IPs permitidos e uma expiração opcional.
+// Esse package usa exclusivamente erros.Erros como estrutura de erros.
+package chaves
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/loteny/redcoins/cadastro"
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// Lista de possíveis erros do módulo
+var (
+	ErrNomeInvalido       = erros.Cria(false, 400, "nome_invalido")
+	ErrEscopoInvalido     = erros.Cria(false, 400, "escopo_invalido")
+	ErrIPInvalido         = erros.Cria(false, 400, "ip_invalido")
+	ErrExpiracaoInvalida  = erros.Cria(false, 400, "expiracao_invalida")
+	ErrChaveNaoExiste     = erros.Cria(false, 404, "chave_nao_existente")
+	ErrChaveInvalida      = erros.Cria(false, 401, "chave_invalida")
+	ErrAssinaturaInvalida = erros.Cria(false, 401, "assinatura_invalida")
+	ErrTimestampInvalido  = erros.Cria(false, 401, "timestamp_invalido")
+	ErrPedidoRepetido     = erros.Cria(false, 401, "pedido_repetido")
+	ErrIPNaoPermitido     = erros.Cria(false, 403, "ip_nao_permitido")
+	ErrEscopoInsuficiente = erros.Cria(false, 403, "escopo_insuficiente")
+	ErrCorpoMuitoGrande   = erros.Cria(false, 413, "corpo_muito_grande")
+)
+
+// Escopos das chaves de API
+const (
+	// EscopoRelatorios permite consultar relatórios, extratos, limites e a
+	// carteira do usuário
+	EscopoRelatorios = "relatorios"
+	// EscopoNegociacao permite comprar e vender bitcoins e gerenciar os planos
+	// de compra recorrente
+	EscopoNegociacao = "negociacao"
+	// EscopoTransferencia permite transferências de bitcoins
+	EscopoTransferencia = "transferencia"
+)
+
+// Headers dos pedidos assinados com chaves de API
+const (
+	HeaderChave      = "X-RedCoins-Chave"
+	HeaderTimestamp  = "X-RedCoins-Timestamp"
+	HeaderAssinatura = "X-RedCoins-Assinatura"
+)
+
+// formatoData é o formato das colunas DATETIME do banco de dados
+const formatoData = "2006-01-02 15:04:05"
+
+// tamanhoMaximoNome é o tamanho máximo, em caracteres, do nome de uma chave
+const tamanhoMaximoNome = 64
+
+// tamanhoMaximoCorpo é o tamanho máximo, em bytes, do corpo de um pedido
+// assinado com uma chave de API, que é lido inteiro para a verificação da
+// assinatura
+const tamanhoMaximoCorpo = 1 << 16
+
+// janela é a diferença máxima entre o timestamp de um pedido assinado e o
+// horário do servidor
+var janela time.Duration
+
+func init() {
+	// Inicializa as configurações da package com as variáveis de ambiente. Por
+	// padrão, a janela é de 5 minutos.
+	janela = 5 * time.Minute
+	if d, err := time.ParseDuration(os.Getenv("REDCOINS_CH_JANELA")); err == nil && d > 0 {
+		janela = d
+	}
+}
+
+// chaveResposta é a estrutura JSON de uma chave de API enviada ao cliente. O
+// segredo só é enviado na criação da chave.
+type chaveResposta struct {
+	ID         string   `json:"id"`
+	Nome       string   `json:"nome"`
+	Segredo    string   `json:"segredo,omitempty"`
+	Escopos    []string `json:"escopos"`
+	IPs        []string `json:"ips"`
+	Criada     string   `json:"criada"`
+	Expira     string   `json:"expira,omitempty"`
+	RevogadaEm string   `json:"revogadaEm,omitempty"`
+}
+
+// CriaChaveHTTP cria uma chave de API para o usuário a partir dos campos
+// "nome", "escopos" (separados por vírgulas), "ips" (opcional, IPs ou redes
+// CIDR separados por vírgulas) e "expira" (opcional, no formato
+// "YYYY-MM-DD HH:MM:SS") do request. Se o usuário possui a autenticação em
+// dois fatores ativa, o campo "codigo" deve conter um código válido. Retorna os
+// bytes da string JSON com a chave criada, incluindo seu segredo, que não pode
+// ser consultado novamente.
+func CriaChaveHTTP(r *http.Request, email string) ([]byte, erros.Erros) {
+	agora := transacao.Agora()
+	c, err := validaDadosChave(r, agora)
+	if !erros.Vazio(err) {
+		return nil, err
+	}
+	if err := cadastro.VerificaSegundoFator(email, r.PostFormValue("codigo")); !erros.Vazio(err) {
+		return nil, err
+	}
+	id, err2 := aleatorio(16)
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	segredo, err2 := aleatorio(32)
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	c.ID, c.Segredo, c.Usuario = id, segredo, email
+	c.Criada = agora.Format(formatoData)
+	if err := database.InsereChaveAPI(c); err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+
+	resposta := converteChave(c)
+	resposta.Segredo = c.Segredo
+	respostaBytes, err2 := json.Marshal(resposta)
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	return respostaBytes, erros.CriaVazio()
+}
+
+// ChavesUsuarioHTTP retorna os bytes da string JSON com as chaves de API do
+// usuário, sem seus segredos
+func ChavesUsuarioHTTP(email string) ([]byte, erros.Erros) {
+	chaves, err := database.AdquireChavesAPIUsuario(email)
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	resposta := make([]chaveResposta, 0, len(chaves))
+	for _, c := range chaves {
+		resposta = append(resposta, converteChave(c))
+	}
+	respostaBytes, err := json.Marshal(map[string][]chaveResposta{"chaves": resposta})
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	return respostaBytes, erros.CriaVazio()
+}
+
+// RevogaChaveHTTP revoga a chave de API do usuário identificada pelo campo
+// "id" do request. Pedidos assinados com a chave deixam de ser aceitos
+// imediatamente.
+func RevogaChaveHTTP(r *http.Request, email string) erros.Erros {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	err := database.RevogaChaveAPI(r.FormValue("id"), email, transacao.Agora().Format(formatoData))
+	if err == database.ErrChaveNaoExiste {
+		return ErrChaveNaoExiste
+	} else if err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	return erros.CriaVazio()
+}
+
+// RequestAssinado retorna se o request foi feito com uma chave de API
+func RequestAssinado(r *http.Request) bool {
+	return r.Header.Get(HeaderChave) != ""
+}
+
+// AutenticaRequest verifica a assinatura de um request feito com uma chave de
+// API e retorna o e-mail do dono da chave. A assinatura é o HMAC-SHA256, em
+// hexadecimal, do método, do path (incluindo a query string), do timestamp
+// (em segundos desde a época Unix) e do corpo do request, separados por
+// quebras de linha. O timestamp deve estar dentro da janela configurada e cada
+// assinatura só é aceita uma vez. A chave deve possuir o escopo passado; um
+// escopo vazio indica que a rota não aceita chaves de API.
+func AutenticaRequest(r *http.Request, escopo string) (string, erros.Erros) {
+	agora := transacao.Agora()
+	timestamp := r.Header.Get(HeaderTimestamp)
+	segundos, err := strconv.ParseInt(timestamp, 10, 64)
+	momento := time.Unix(segundos, 0)
+	if err != nil || momento.Before(agora.Add(-janela)) || momento.After(agora.Add(janela)) {
+		return "", ErrTimestampInvalido
+	}
+
+	c, err := database.AdquireChaveAPI(r.Header.Get(HeaderChave))
+	if err == database.ErrChaveNaoExiste {
+		return "", ErrChaveInvalida
+	} else if err != nil {
+		return "", erros.CriaInternoPadrao(err)
+	}
+	if c.RevogadaEm != "" || (c.Expira != "" && c.Expira <= agora.Format(formatoData)) {
+		return "", ErrChaveInvalida
+	}
+
+	// O corpo é lido para a assinatura e restaurado para as rotas
+	corpo := []byte{}
+	if r.Body != nil {
+		if corpo, err = ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, tamanhoMaximoCorpo)); err != nil {
+			if len(corpo) >= tamanhoMaximoCorpo {
+				return "", ErrCorpoMuitoGrande
+			}
+			return "", erros.CriaInternoPadrao(err)
+		}
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(corpo))
+	}
+	esperada, err := assinatura(c.Segredo, mensagemAssinatura(r.Method, r.URL.RequestURI(), timestamp, corpo))
+	if err != nil {
+		return "", erros.CriaInternoPadrao(err)
+	}
+	recebida := r.Header.Get(HeaderAssinatura)
+	if !assinaturaConfere(recebida, esperada) {
+		return "", ErrAssinaturaInvalida
+	}
+
+	if !ipPermitido(c.IPs, comunicacao.IPRequest(r)) {
+		return "", ErrIPNaoPermitido
+	}
+	if escopo == "" || !contem(c.Escopos, escopo) {
+		return "", ErrEscopoInsuficiente
+	}
+	if !usadas.registra(c.ID+":"+esperada, momento.Add(janela), agora) {
+		return "", ErrPedidoRepetido
+	}
+	return c.Usuario, erros.CriaVazio()
+}
+
+// validaDadosChave valida os campos de criação de uma chave de API. 'agora' é
+// o momento da criação.
+func validaDadosChave(r *http.Request, agora time.Time) (database.ChaveAPI, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return database.ChaveAPI{}, erros.CriaInternoPadrao(err)
+	}
+	c := database.ChaveAPI{
+		Nome:    strings.TrimSpace(r.PostFormValue("nome")),
+		Escopos: make([]string, 0),
+		IPs:     separaLista(r.PostFormValue("ips")),
+	}
+
+	err := erros.CriaVazio()
+	if c.Nome == "" || utf8.RuneCountInString(c.Nome) > tamanhoMaximoNome {
+		err = erros.JuntaErros(err, ErrNomeInvalido)
+	}
+
+	// Os escopos são armazenados na ordem em que são definidos
+	escopos := separaLista(r.PostFormValue("escopos"))
+	for _, escopo := range []string{EscopoRelatorios, EscopoNegociacao, EscopoTransferencia} {
+		if contem(escopos, escopo) {
+			c.Escopos = append(c.Escopos, escopo)
+		}
+	}
+	if len(escopos) == 0 || len(c.Escopos) != len(escopos) {
+		err = erros.JuntaErros(err, ErrEscopoInvalido)
+	}
+	for _, ip := range c.IPs {
+		if !ipValido(ip) {
+			err = erros.JuntaErros(err, ErrIPInvalido)
+			break
+		}
+	}
+	if len(strings.Join(c.IPs, ",")) > 512 {
+		err = erros.JuntaErros(err, ErrIPInvalido)
+	}
+	if expira := r.PostFormValue("expira"); expira != "" {
+		t, err2 := time.ParseInLocation(formatoData, expira, agora.Location())
+		if err2 != nil || !t.After(agora) {
+			err = erros.JuntaErros(err, ErrExpiracaoInvalida)
+		}
+		c.Expira = expira
+	}
+	return c, err
+}
+
+// converteChave converte uma chave de API do banco de dados para a estrutura
+// enviada ao cliente, sem o segredo
+func converteChave(c database.ChaveAPI) chaveResposta {
+	return chaveResposta{
+		ID:         c.ID,
+		Nome:       c.Nome,
+		Escopos:    c.Escopos,
+		IPs:        c.IPs,
+		Criada:     c.Criada,
+		Expira:     c.Expira,
+		RevogadaEm: c.RevogadaEm,
+	}
+}
+
+// separaLista separa uma lista separada por vírgulas, ignorando espaços e
+// itens vazios e removendo itens repetidos
+func separaLista(lista string) []string {
+	itens := make([]string, 0)
+	for _, item := range strings.Split(lista, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" && !contem(itens, item) {
+			itens = append(itens, item)
+		}
+	}
+	return itens
+}
+
+// contem retorna se a lista contém o item
+func contem(lista []string, item string) bool {
+	for _, i := range lista {
+		if i == item {
+			return true
+		}
+	}
+	return false
+}
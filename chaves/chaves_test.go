@@ -0,0 +1,160 @@
+package chaves
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/passenc"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// init deleta o banco de dados e cria um novo apenas com um usuário para
+// testes
+func init() {
+	if err := database.DeletaDatabaseTeste(); err != nil {
+		log.Fatalf("erro ao deletar database: %s", err)
+	}
+	if err := database.CriaDatabase(); err != nil {
+		log.Fatalf("erro ao criar database: %s", err)
+	}
+	if err := testPopulaDatabase(); err != nil {
+		log.Fatalf("erro ao popular banco de dados: %s", err)
+	}
+}
+
+func TestChaves(t *testing.T) {
+	// Dados inválidos
+	form := url.Values{
+		"nome":    {""},
+		"escopos": {"relatorios,saque"},
+		"ips":     {"10.0.0.300"},
+		"expira":  {"2000-01-01 00:00:00"},
+	}
+	_, err := CriaChaveHTTP(testRequest(t, "POST", "/", form.Encode()), "valido1@gmail.com")
+	esperado := []string{"nome_invalido", "escopo_invalido", "ip_invalido", "expiracao_invalida"}
+	if lista := erros.Lista(err); !reflect.DeepEqual(lista, esperado) {
+		t.Errorf("Erro inesperado: %v", lista)
+	}
+
+	// Criação de uma chave apenas com o escopo de relatórios
+	form = url.Values{"nome": {"robô"}, "escopos": {"relatorios"}, "ips": {"192.0.2.0/24"}}
+	resposta, err := CriaChaveHTTP(testRequest(t, "POST", "/", form.Encode()), "valido1@gmail.com")
+	if !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	chave := chaveResposta{}
+	if err := json.Unmarshal(resposta, &chave); err != nil || chave.Segredo == "" {
+		t.Fatalf("Resposta inesperada: %s (%v)", resposta, err)
+	}
+
+	// Pedido assinado válido
+	r := testRequestAssinado(t, chave, "GET", "/relatorios/usuario?de=2018-01-01", "", 0)
+	if email, err := AutenticaRequest(r, EscopoRelatorios); !erros.Vazio(err) || email != "valido1@gmail.com" {
+		t.Errorf("Autenticação inesperada: %v (%v)", email, err)
+	}
+
+	// O mesmo pedido não pode ser repetido
+	if _, err := AutenticaRequest(r, EscopoRelatorios); err.Error() != ErrPedidoRepetido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// O corpo faz parte da assinatura e continua disponível após a verificação
+	r = testRequestAssinado(t, chave, "POST", "/", "qtd=0.1", 0)
+	r.Body = testRequest(t, "POST", "/", "qtd=0.2").Body
+	if _, err := AutenticaRequest(r, EscopoRelatorios); err.Error() != ErrAssinaturaInvalida.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	r = testRequestAssinado(t, chave, "POST", "/", "qtd=0.1", 0)
+	if _, err := AutenticaRequest(r, EscopoRelatorios); !erros.Vazio(err) || r.FormValue("qtd") != "0.1" {
+		t.Errorf("Autenticação inesperada: %v (%v)", r.FormValue("qtd"), err)
+	}
+	r = testRequestAssinado(t, chave, "POST", "/", "qtd="+strings.Repeat("1", tamanhoMaximoCorpo), 0)
+	if _, err := AutenticaRequest(r, EscopoRelatorios); err.Error() != ErrCorpoMuitoGrande.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Escopo, timestamp e IP
+	r = testRequestAssinado(t, chave, "POST", "/transacoes/compra", "", 0)
+	if _, err := AutenticaRequest(r, EscopoNegociacao); err.Error() != ErrEscopoInsuficiente.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	r = testRequestAssinado(t, chave, "GET", "/", "", -2*janela)
+	if _, err := AutenticaRequest(r, EscopoRelatorios); err.Error() != ErrTimestampInvalido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	r = testRequestAssinado(t, chave, "GET", "/limites", "", 0)
+	r.RemoteAddr = "198.51.100.1:1234"
+	if _, err := AutenticaRequest(r, EscopoRelatorios); err.Error() != ErrIPNaoPermitido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Listagem sem os segredos
+	resposta, err = ChavesUsuarioHTTP("valido1@gmail.com")
+	if !erros.Vazio(err) || strings.Contains(string(resposta), chave.Segredo) ||
+		!strings.Contains(string(resposta), `"id":"`+chave.ID+`","nome":"robô","escopos":["relatorios"],"ips":["192.0.2.0/24"]`) {
+		t.Errorf("Resposta inesperada: %s (%v)", resposta, err)
+	}
+
+	// Revogação
+	form = url.Values{"id": {chave.ID}}
+	if err := RevogaChaveHTTP(testRequest(t, "DELETE", "/?"+form.Encode(), ""), "valido1@gmail.com"); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if err := RevogaChaveHTTP(testRequest(t, "DELETE", "/?"+form.Encode(), ""), "valido1@gmail.com"); err.Error() != ErrChaveNaoExiste.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	r = testRequestAssinado(t, chave, "GET", "/limites", "", 0)
+	if _, err := AutenticaRequest(r, EscopoRelatorios); err.Error() != ErrChaveInvalida.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+// testRequestAssinado cria um request assinado com a chave passada, com o
+// timestamp deslocado em 'deslocamento' do momento atual
+func testRequestAssinado(t *testing.T, chave chaveResposta, metodo string, path string,
+	corpo string, deslocamento time.Duration) *http.Request {
+	r := testRequest(t, metodo, path, corpo)
+	timestamp := strconv.FormatInt(transacao.Agora().Add(deslocamento).Unix(), 10)
+	a, err := assinatura(chave.Segredo, mensagemAssinatura(metodo, path, timestamp, []byte(corpo)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set(HeaderChave, chave.ID)
+	r.Header.Set(HeaderTimestamp, timestamp)
+	r.Header.Set(HeaderAssinatura, a)
+	r.RemoteAddr = "192.0.2.1:1234"
+	return r
+}
+
+// testRequest cria um request com o corpo passado como formulário
+func testRequest(t *testing.T, metodo string, path string, corpo string) *http.Request {
+	r, err := http.NewRequest(metodo, path, strings.NewReader(corpo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func testPopulaDatabase() error {
+	senha, err := passenc.GeraHashed([]byte("senhavalido1"))
+	if err != nil {
+		return err
+	}
+	usr := database.Usuario{
+		Email:      "valido1@gmail.com",
+		Senha:      senha,
+		Nome:       "Conta Válida 1",
+		Nascimento: "1994-03-07",
+	}
+	return database.InsereUsuario(&usr)
+}
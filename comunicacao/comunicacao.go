@@ -5,6 +5,7 @@ package comunicacao
 import (
 	"encoding/json"
 	"log"
+	"net"
 	"net/http"
 
 	"github.com/loteny/redcoins/erros"
@@ -13,11 +14,17 @@ import (
 // Responde envia uma resposta HTTP com status code 's' no formato JSON com o
 // conteúdo 'r'
 func Responde(w http.ResponseWriter, s int, r []byte) error {
-	w.Header().Set("Content-Type", "application/json")
+	return RespondeTipo(w, s, "application/json", r)
+}
+
+// RespondeTipo envia uma resposta HTTP com status code 's' e conteúdo 'r' do
+// tipo 'tipo' (por exemplo, "text/csv")
+func RespondeTipo(w http.ResponseWriter, s int, tipo string, r []byte) error {
+	w.Header().Set("Content-Type", tipo)
 	w.WriteHeader(s)
 	_, err := w.Write(r)
 	if err != nil {
-		log.Printf("comunicacao: Responde: %s", err)
+		log.Printf("comunicacao: RespondeTipo: %s", err)
 	}
 	return err
 }
@@ -40,3 +47,11 @@ func RealizaParseForm(r *http.Request) (err error) {
 	}
 	return
 }
+
+// IPRequest retorna o IP do cliente a partir do endereço remoto do pedido
+func IPRequest(r *http.Request) string {
+	if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return ip
+	}
+	return r.RemoteAddr
+}
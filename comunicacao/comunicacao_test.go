@@ -55,6 +55,26 @@ func TestResponde(t *testing.T) {
 	}
 }
 
+// TestRespondeTipo verifica se o Content-Type passado é utilizado na resposta
+func TestRespondeTipo(t *testing.T) {
+	request, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RespondeTipo(w, http.StatusOK, "text/csv", []byte("a,b\n"))
+	})
+	handler.ServeHTTP(recorder, request)
+
+	if tipo := recorder.Header().Get("Content-Type"); tipo != "text/csv" {
+		t.Errorf("Content-Type incorreto: %v", tipo)
+	}
+	if recorder.Body.String() != "a,b\n" {
+		t.Errorf("Corpo da mensagem incorreto: %v", recorder.Body.String())
+	}
+}
+
 func TestRespondeErro(t *testing.T) {
 	// Criação do request HTTP
 	request, err := http.NewRequest("GET", "/", nil)
@@ -111,3 +131,17 @@ func TestRealizaParseForm(t *testing.T) {
 	})
 	handler.ServeHTTP(recorder, request)
 }
+
+func TestIPRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	for remoto, esperado := range map[string]string{
+		"192.0.2.1:1234": "192.0.2.1",
+		"[::1]:80":       "::1",
+		"192.0.2.2":      "192.0.2.2",
+	} {
+		r.RemoteAddr = remoto
+		if ip := IPRequest(r); ip != esperado {
+			t.Errorf("IP inesperado para %v: %v", remoto, ip)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package correio
+
+// Esse arquivo define a caixa de saída local, que guarda as mensagens em vez
+// de enviá-las
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CaixaSaida guarda as mensagens enviadas em memória e, se 'diretorio' não
+// estiver vazio, grava cada mensagem em um arquivo .eml no diretório
+type CaixaSaida struct {
+	sync.Mutex
+	diretorio string
+	mensagens []Mensagem
+}
+
+// NovaCaixaSaida cria uma caixa de saída. Se 'diretorio' estiver vazio, as
+// mensagens são guardadas apenas em memória.
+func NovaCaixaSaida(diretorio string) *CaixaSaida {
+	return &CaixaSaida{diretorio: diretorio}
+}
+
+// Envia guarda a mensagem na caixa de saída
+func (c *CaixaSaida) Envia(m Mensagem) error {
+	c.Lock()
+	defer c.Unlock()
+	c.mensagens = append(c.mensagens, m)
+	if c.diretorio == "" {
+		return nil
+	}
+	nome := fmt.Sprintf("%s-%03d.eml", time.Now().Format("20060102-150405"), len(c.mensagens))
+	return ioutil.WriteFile(filepath.Join(c.diretorio, nome), formataMensagem("redcoins@localhost", m), 0600)
+}
+
+// Mensagens retorna as mensagens guardadas, em ordem de envio
+func (c *CaixaSaida) Mensagens() []Mensagem {
+	c.Lock()
+	defer c.Unlock()
+	return append([]Mensagem(nil), c.mensagens...)
+}
+
+// Ultima retorna a última mensagem enviada ao destinatário e se ela existe
+func (c *CaixaSaida) Ultima(para string) (Mensagem, bool) {
+	c.Lock()
+	defer c.Unlock()
+	for i := len(c.mensagens) - 1; i >= 0; i-- {
+		if c.mensagens[i].Para == para {
+			return c.mensagens[i], true
+		}
+	}
+	return Mensagem{}, false
+}
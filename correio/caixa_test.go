@@ -0,0 +1,52 @@
+package correio
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCaixaSaida(t *testing.T) {
+	diretorio, err := ioutil.TempDir("", "correio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(diretorio)
+
+	c := NovaCaixaSaida(diretorio)
+	for _, para := range []string{"a@gmail.com", "b@gmail.com", "a@gmail.com"} {
+		if err := c.Envia(Mensagem{Para: para, Assunto: "Teste", Corpo: "Mensagem para " + para}); err != nil {
+			t.Fatalf("Erro inesperado: %v", err)
+		}
+	}
+	if len(c.Mensagens()) != 3 {
+		t.Errorf("Mensagens inesperadas: %v", c.Mensagens())
+	}
+	if m, ok := c.Ultima("b@gmail.com"); !ok || m.Corpo != "Mensagem para b@gmail.com" {
+		t.Errorf("Mensagem inesperada: %v", m)
+	}
+	if _, ok := c.Ultima("c@gmail.com"); ok {
+		t.Errorf("Mensagem inesperada para destinatário sem mensagens")
+	}
+
+	arquivos, err := ioutil.ReadDir(diretorio)
+	if err != nil || len(arquivos) != 3 {
+		t.Fatalf("Arquivos inesperados: %v (%v)", arquivos, err)
+	}
+	conteudo, err := ioutil.ReadFile(diretorio + "/" + arquivos[0].Name())
+	if err != nil || !strings.Contains(string(conteudo), "To: a@gmail.com\r\nSubject: Teste\r\n") {
+		t.Errorf("Arquivo inesperado: %s (%v)", conteudo, err)
+	}
+}
+
+func TestDefinePadrao(t *testing.T) {
+	anterior := Padrao()
+	defer DefinePadrao(anterior)
+
+	c := NovaCaixaSaida("")
+	DefinePadrao(c)
+	if err := Envia(Mensagem{Para: "a@gmail.com"}); err != nil || len(c.Mensagens()) != 1 {
+		t.Errorf("Envio inesperado: %v (%v)", c.Mensagens(), err)
+	}
+}
@@ -0,0 +1,66 @@
+// Package correio trata do envio de e-mails aos usuários através da interface
+// Mailer. O servidor utiliza SMTP se REDCOINS_CR_SMTP estiver definida; caso
+// contrário, as mensagens são guardadas em uma caixa de saída em memória e,
+// se REDCOINS_CR_DIRETORIO estiver definida, gravadas em arquivos, o que é
+// útil em testes e em desenvolvimento local.
+package correio
+
+import (
+	"log"
+	"os"
+	"sync"
+)
+
+// Mensagem é um e-mail em texto simples
+type Mensagem struct {
+	Para    string
+	Assunto string
+	Corpo   string
+}
+
+// Mailer é a interface dos meios de envio de e-mails
+type Mailer interface {
+	Envia(m Mensagem) error
+}
+
+// padrao é o Mailer utilizado por Envia
+var padrao Mailer
+
+// mutexPadrao protege 'padrao', que pode ser substituído em testes
+var mutexPadrao sync.RWMutex
+
+func init() {
+	// Inicializa as configurações da package com as variáveis de ambiente
+	if endereco := os.Getenv("REDCOINS_CR_SMTP"); endereco != "" {
+		padrao = SMTP{
+			Endereco:  endereco,
+			Usuario:   os.Getenv("REDCOINS_CR_USUARIO"),
+			Senha:     os.Getenv("REDCOINS_CR_SENHA"),
+			Remetente: os.Getenv("REDCOINS_CR_REMETENTE"),
+		}
+		return
+	}
+	log.Printf("correio: REDCOINS_CR_SMTP não definida, utilizando caixa de saída local")
+	padrao = NovaCaixaSaida(os.Getenv("REDCOINS_CR_DIRETORIO"))
+}
+
+// Envia envia a mensagem através do Mailer padrão
+func Envia(m Mensagem) error {
+	mutexPadrao.RLock()
+	defer mutexPadrao.RUnlock()
+	return padrao.Envia(m)
+}
+
+// Padrao retorna o Mailer padrão
+func Padrao() Mailer {
+	mutexPadrao.RLock()
+	defer mutexPadrao.RUnlock()
+	return padrao
+}
+
+// DefinePadrao substitui o Mailer padrão
+func DefinePadrao(m Mailer) {
+	mutexPadrao.Lock()
+	defer mutexPadrao.Unlock()
+	padrao = m
+}
@@ -0,0 +1,52 @@
+package correio
+
+// Esse arquivo define o envio de e-mails por SMTP
+
+import (
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// SMTP envia e-mails através de um servidor SMTP. 'Endereco' está no formato
+// "host:porta". Se 'Usuario' estiver vazio, a mensagem é enviada sem
+// autenticação.
+type SMTP struct {
+	Endereco  string
+	Usuario   string
+	Senha     string
+	Remetente string
+}
+
+// Envia envia a mensagem ao servidor SMTP
+func (s SMTP) Envia(m Mensagem) error {
+	var auth smtp.Auth
+	if s.Usuario != "" {
+		host, _, err := net.SplitHostPort(s.Endereco)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", s.Usuario, s.Senha, host)
+	}
+	return smtp.SendMail(s.Endereco, auth, s.Remetente, []string{m.Para}, formataMensagem(s.Remetente, m))
+}
+
+// cabecalho remove quebras de linha de um valor de cabeçalho, impedindo a
+// injeção de novos cabeçalhos
+func cabecalho(valor string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(valor)
+}
+
+// formataMensagem formata a mensagem no formato RFC 5322, com o corpo em
+// UTF-8
+func formataMensagem(remetente string, m Mensagem) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + cabecalho(remetente) + "\r\n")
+	b.WriteString("To: " + cabecalho(m.Para) + "\r\n")
+	b.WriteString("Subject: " + cabecalho(m.Assunto) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.Replace(m.Corpo, "\n", "\r\n", -1))
+	return []byte(b.String())
+}
@@ -0,0 +1,17 @@
+package correio
+
+import "testing"
+
+func TestFormataMensagem(t *testing.T) {
+	m := Mensagem{Para: "a@gmail.com\r\nBcc: b@gmail.com", Assunto: "Olá", Corpo: "linha 1\nlinha 2"}
+	esperado := "From: redcoins@localhost\r\n" +
+		"To: a@gmail.comBcc: b@gmail.com\r\n" +
+		"Subject: Olá\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" +
+		"linha 1\r\nlinha 2"
+	if formatada := string(formataMensagem("redcoins@localhost", m)); formatada != esperado {
+		t.Errorf("Mensagem inesperada: %q", formatada)
+	}
+}
@@ -0,0 +1,171 @@
+package database
+
+// Esse arquivo define as chaves de API dos usuários, com as quais programas
+// de terceiros assinam os pedidos feitos em nome do usuário
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// Lista de possíveis erros das chaves de API
+var (
+	ErrChaveNaoExiste = errors.New("chave_nao_existente")
+)
+
+// ChaveAPI é a estrutura para a tabela 'chave_api'. 'Segredo' é a chave HMAC
+// da chave de API, em hexadecimal. 'IPs' vazio significa que todos os IPs são
+// permitidos. As datas estão no formato "YYYY-MM-DD HH:MM:SS"; 'Expira' é
+// vazio se a chave não expira e 'RevogadaEm' é vazio se a chave não foi
+// revogada.
+type ChaveAPI struct {
+	ID         string
+	Usuario    string
+	Nome       string
+	Segredo    string
+	Escopos    []string
+	IPs        []string
+	Criada     string
+	Expira     string
+	RevogadaEm string
+}
+
+// InsereChaveAPI cria uma nova chave de API para o usuário do e-mail
+// 'Usuario' da chave passada. Retorna ErrUsuarioNaoExiste se o usuário não
+// existe.
+func InsereChaveAPI(c ChaveAPI) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, c.Usuario)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	var expira interface{}
+	if c.Expira != "" {
+		expira = c.Expira
+	}
+	sqlCode := `INSERT INTO chave_api
+		(id, usuario_id, nome, segredo, escopos, ips, criada, expira)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+	if _, err := tx.Exec(sqlCode, c.ID, usrID, c.Nome, c.Segredo,
+		strings.Join(c.Escopos, ","), strings.Join(c.IPs, ","), c.Criada, expira); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// AdquireChaveAPI adquire a chave de API 'id'. Retorna ErrChaveNaoExiste se a
+// chave não existe.
+func AdquireChaveAPI(id string) (ChaveAPI, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return ChaveAPI{}, err
+	}
+
+	sqlCode := `SELECT c.id, u.email, c.nome, c.segredo, c.escopos, c.ips, c.criada, c.expira, c.revogada_em
+		FROM chave_api AS c
+		INNER JOIN usuario AS u ON u.id = c.usuario_id
+		WHERE c.id = ?;`
+	c, err := scanChaveAPI(db.QueryRow(sqlCode, id))
+	if err == sql.ErrNoRows {
+		return ChaveAPI{}, ErrChaveNaoExiste
+	}
+	return c, err
+}
+
+// AdquireChavesAPIUsuario adquire todas as chaves de API do usuário, incluindo
+// as expiradas e revogadas, em ordem de criação
+func AdquireChavesAPIUsuario(email string) ([]ChaveAPI, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlCode := `SELECT c.id, u.email, c.nome, c.segredo, c.escopos, c.ips, c.criada, c.expira, c.revogada_em
+		FROM chave_api AS c
+		INNER JOIN usuario AS u ON u.id = c.usuario_id
+		WHERE u.email = ?
+		ORDER BY c.criada, c.id;`
+	rows, err := db.Query(sqlCode, email)
+	if err != nil {
+		return nil, err
+	}
+
+	chaves := make([]ChaveAPI, 0)
+	defer rows.Close()
+	for rows.Next() {
+		c, err := scanChaveAPI(rows)
+		if err != nil {
+			return nil, err
+		}
+		chaves = append(chaves, c)
+	}
+	return chaves, rows.Err()
+}
+
+// RevogaChaveAPI revoga a chave de API 'id' do usuário no momento 'em'
+// ("YYYY-MM-DD HH:MM:SS"). Retorna ErrChaveNaoExiste se o usuário não possui a
+// chave ou se ela já foi revogada.
+func RevogaChaveAPI(id string, email string, em string) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+
+	sqlCode := `UPDATE chave_api AS c
+		INNER JOIN usuario AS u ON u.id = c.usuario_id
+		SET c.revogada_em = ?
+		WHERE c.id = ? AND u.email = ? AND c.revogada_em IS NULL;`
+	res, err := db.Exec(sqlCode, em, id, email)
+	if err != nil {
+		return err
+	}
+	if linhas, err := res.RowsAffected(); err != nil {
+		return err
+	} else if linhas == 0 {
+		return ErrChaveNaoExiste
+	}
+	return nil
+}
+
+// scanChaveAPI lê uma chave de API de uma linha com as colunas id, email,
+// nome, segredo, escopos, ips, criada, expira e revogada_em
+func scanChaveAPI(row interface {
+	Scan(dest ...interface{}) error
+}) (ChaveAPI, error) {
+	c := ChaveAPI{}
+	var escopos, ips string
+	var expira, revogadaEm sql.NullString
+	if err := row.Scan(&c.ID, &c.Usuario, &c.Nome, &c.Segredo, &escopos, &ips,
+		&c.Criada, &expira, &revogadaEm); err != nil {
+		return ChaveAPI{}, err
+	}
+	c.Escopos = separaLista(escopos)
+	c.IPs = separaLista(ips)
+	c.Expira = expira.String
+	c.RevogadaEm = revogadaEm.String
+	return c, nil
+}
+
+// separaLista separa uma lista separada por vírgulas; uma string vazia
+// resulta em uma lista vazia
+func separaLista(lista string) []string {
+	if lista == "" {
+		return []string{}
+	}
+	return strings.Split(lista, ",")
+}
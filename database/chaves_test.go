@@ -0,0 +1,64 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChavesAPI(t *testing.T) {
+	c := ChaveAPI{
+		ID:      "0123456789abcdef0123456789abcdef",
+		Usuario: "valido1@gmail.com",
+		Nome:    "robô",
+		Segredo: "aa",
+		Escopos: []string{"relatorios", "negociacao"},
+		IPs:     []string{"10.0.0.1", "192.168.0.0/24"},
+		Criada:  "2018-01-01 10:00:00",
+		Expira:  "2018-02-01 10:00:00",
+	}
+	if err := InsereChaveAPI(c); err != nil {
+		t.Fatalf("Erro inesperado ao inserir chave: %v", err)
+	}
+	sem := ChaveAPI{
+		ID:      "fedcba9876543210fedcba9876543210",
+		Usuario: "valido1@gmail.com",
+		Nome:    "relatórios",
+		Segredo: "bb",
+		Escopos: []string{"relatorios"},
+		IPs:     []string{},
+		Criada:  "2018-01-02 10:00:00",
+	}
+	if err := InsereChaveAPI(sem); err != nil {
+		t.Fatalf("Erro inesperado ao inserir chave: %v", err)
+	}
+	if adquirida, err := AdquireChaveAPI(c.ID); err != nil || !reflect.DeepEqual(adquirida, c) {
+		t.Errorf("Chave inesperada: %v (%v)", adquirida, err)
+	}
+	if chaves, err := AdquireChavesAPIUsuario("valido1@gmail.com"); err != nil ||
+		!reflect.DeepEqual(chaves, []ChaveAPI{c, sem}) {
+		t.Errorf("Chaves inesperadas: %v (%v)", chaves, err)
+	}
+
+	// Revogação: apenas o dono pode revogar a chave, e apenas uma vez
+	if err := RevogaChaveAPI(c.ID, "valido2@gmail.com", "2018-01-03 10:00:00"); err != ErrChaveNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := RevogaChaveAPI(c.ID, "valido1@gmail.com", "2018-01-03 10:00:00"); err != nil {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := RevogaChaveAPI(c.ID, "valido1@gmail.com", "2018-01-04 10:00:00"); err != ErrChaveNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if adquirida, err := AdquireChaveAPI(c.ID); err != nil || adquirida.RevogadaEm != "2018-01-03 10:00:00" {
+		t.Errorf("Chave inesperada: %v (%v)", adquirida, err)
+	}
+
+	// Chave e usuário inexistentes
+	if _, err := AdquireChaveAPI("00000000000000000000000000000000"); err != ErrChaveNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	sem.ID, sem.Usuario = "00000000000000000000000000000000", "naoexistente@gmail.com"
+	if err := InsereChaveAPI(sem); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
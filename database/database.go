@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
 
 	// Driver MySQL
 	_ "github.com/go-sql-driver/mysql"
@@ -34,18 +35,35 @@ var (
 	ErrUsuarioDuplicado  = errors.New("email_ja_cadastrado")
 	ErrUsuarioNaoExiste  = errors.New("usuario_nao_existente")
 	ErrSaldoInsuficiente = errors.New("saldo_insuficiente")
+	ErrLimiteExcedido    = errors.New("limite_excedido")
+	ErrCPFDuplicado      = errors.New("cpf_ja_cadastrado")
+	ErrCPFJaDefinido     = errors.New("cpf_ja_definido")
 )
 
 // Usuario é a estrutura para a tabela 'usuario'.
-// O campo 'senha' deve conter até 60 bytes
+// O campo 'senha' deve conter até 255 bytes. O campo 'Nivel' é o nível de
+// verificação do usuário, que determina seus limites de transação. O campo
+// 'Papel' é o papel do usuário no sistema (PapelCliente, PapelSuporte ou
+// PapelAdmin); se vazio na inserção, o usuário é cadastrado como cliente. O
+// campo 'CPF' contém apenas os 11 dígitos do CPF, ou é vazio se o usuário
+// ainda não o informou. 'Encerrado' indica se a conta foi encerrada.
 type Usuario struct {
-	Email      string
-	Senha      []byte
-	Nome       string
-	Nascimento string
+	Email           string
+	Senha           []byte
+	Nome            string
+	Nascimento      string
+	Nivel           int
+	Papel           string
+	EmailVerificado bool
+	CPF             string
+	Encerrado       bool
 }
 
-// Transacao é a estrutura com dados de uma transação
+// formatoDatetime é o formato das colunas DATETIME do banco de dados
+const formatoDatetime = "2006-01-02 15:04:05"
+
+// Transacao é a estrutura com dados de uma transação. 'Dia' é o momento em que
+// a transação foi realizada, no formato "YYYY-MM-DD HH:MM:SS".
 type Transacao struct {
 	Usuario  string  `json:"usuario"`
 	Compra   bool    `json:"compra"`
@@ -83,7 +101,8 @@ func init() {
 }
 
 // InsereUsuario cria uma nova linha na tabela 'usuario'. Retorna
-// ErrUsuarioDuplicado se o usuário é repetido (mesmo e-mail)
+// ErrUsuarioDuplicado se o usuário é repetido (mesmo e-mail) e ErrCPFDuplicado
+// se o CPF já está cadastrado para outro usuário.
 func InsereUsuario(usr *Usuario) error {
 	db, err := sql.Open("mysql", dsn)
 	defer db.Close()
@@ -95,17 +114,29 @@ func InsereUsuario(usr *Usuario) error {
 	if err := verificaUsuarioDuplicado(db, usr.Email); err != nil {
 		return err
 	}
+	if usr.CPF != "" {
+		if err := verificaCPFDuplicado(db, usr.CPF); err != nil {
+			return err
+		}
+	}
 
 	// Insere usuário no banco de dados
+	if usr.Papel == "" {
+		usr.Papel = PapelCliente
+	}
 	sqlCode := `INSERT INTO usuario
-		(email, senha, nome, nascimento)
-		VALUES (?, ?, ?, ?);`
+		(email, senha, nome, nascimento, nivel, papel, email_verificado, cpf)
+		VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''));`
 	if _, err := db.Exec(
 		sqlCode,
 		usr.Email,
 		usr.Senha,
 		usr.Nome,
-		usr.Nascimento); err != nil {
+		usr.Nascimento,
+		usr.Nivel,
+		usr.Papel,
+		usr.EmailVerificado,
+		usr.CPF); err != nil {
 		return err
 	}
 
@@ -113,7 +144,8 @@ func InsereUsuario(usr *Usuario) error {
 }
 
 // AdquireSenhaHashed retorna o campo 'senha' do usuário (salvada hashed) a
-// partir de seu email. Se o usuário não existe, retorna ErrUsuarioNaoExiste.
+// partir de seu email. Se o usuário não existe ou sua conta foi encerrada,
+// retorna ErrUsuarioNaoExiste.
 func AdquireSenhaHashed(email string) ([]byte, error) {
 	db, err := sql.Open("mysql", dsn)
 	defer db.Close()
@@ -121,9 +153,9 @@ func AdquireSenhaHashed(email string) ([]byte, error) {
 		return []byte{}, err
 	}
 
-	senha := make([]byte, 60)
+	var senha []byte
 	// Adquire os dados do banco de dados
-	sqlCode := `SELECT senha FROM usuario WHERE email=?;`
+	sqlCode := `SELECT senha FROM usuario WHERE email=? AND encerrado_em IS NULL;`
 	row := db.QueryRow(sqlCode, email)
 	err = row.Scan(&senha)
 	// Se o usuário não existe, retorna ErrUsuarioNaoExiste
@@ -136,13 +168,158 @@ func AdquireSenhaHashed(email string) ([]byte, error) {
 	return senha, nil
 }
 
+// AlteraSenha substitui a senha hashed do usuário. Retorna ErrUsuarioNaoExiste
+// se o usuário não existe.
+func AlteraSenha(email string, senha []byte) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, email)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE usuario SET senha = ? WHERE id = ?;`, senha, usrID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// AlteraPerfil substitui o nome e a data de nascimento ("YYYY-MM-DD") do
+// usuário. Retorna ErrUsuarioNaoExiste se o usuário não existe.
+func AlteraPerfil(email string, nome string, nascimento string) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, email)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	sqlCode := `UPDATE usuario SET nome = ?, nascimento = ? WHERE id = ?;`
+	if _, err := tx.Exec(sqlCode, nome, nascimento, usrID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// AlteraEmail substitui o e-mail do usuário por 'novoEmail', que é marcado
+// como verificado. Retorna ErrUsuarioNaoExiste se o usuário não existe e
+// ErrUsuarioDuplicado se já existe um usuário com o novo e-mail.
+func AlteraEmail(email string, novoEmail string) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	if err := verificaUsuarioDuplicado(db, novoEmail); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, email)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	sqlCode := `UPDATE usuario SET email = ?, email_verificado = TRUE WHERE id = ?;`
+	if _, err := tx.Exec(sqlCode, novoEmail, usrID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// DefineCPF define o CPF (apenas os 11 dígitos) do usuário que ainda não o
+// possui. Retorna ErrUsuarioNaoExiste se o usuário não existe,
+// ErrCPFJaDefinido se o usuário já possui um CPF e ErrCPFDuplicado se o CPF já
+// está cadastrado para outro usuário.
+func DefineCPF(email string, cpf string) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	if err := verificaCPFDuplicado(db, cpf); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, email)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	var atual sql.NullString
+	if err := tx.QueryRow(`SELECT cpf FROM usuario WHERE id = ? FOR UPDATE;`, usrID).Scan(&atual); err != nil {
+		tx.Rollback()
+		return err
+	} else if atual.Valid {
+		tx.Rollback()
+		return ErrCPFJaDefinido
+	}
+	if _, err := tx.Exec(`UPDATE usuario SET cpf = ? WHERE id = ?;`, cpf, usrID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// AdquireUsuario retorna os dados do usuário a partir de seu e-mail. A data de
+// nascimento está no formato "YYYY-MM-DD". Se o usuário não existe, retorna
+// ErrUsuarioNaoExiste.
+func AdquireUsuario(email string) (Usuario, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return Usuario{}, err
+	}
+
+	usr := Usuario{}
+	sqlCode := `SELECT email, senha, nome, nascimento, nivel, papel, email_verificado, IFNULL(cpf, ''),
+		encerrado_em IS NOT NULL
+		FROM usuario WHERE email=?;`
+	err = db.QueryRow(sqlCode, email).Scan(&usr.Email, &usr.Senha, &usr.Nome, &usr.Nascimento, &usr.Nivel, &usr.Papel, &usr.EmailVerificado, &usr.CPF, &usr.Encerrado)
+	if err == sql.ErrNoRows {
+		return Usuario{}, ErrUsuarioNaoExiste
+	} else if err != nil {
+		return Usuario{}, err
+	}
+
+	return usr, nil
+}
+
 // InsereTransacao cria uma nova transação no banco de dados a partir do e-mail
 // de um usuário, do tipo da transação (compra ou venda), a quantidade de
 // BitCoins a ser comprada ou vendida, o valor pago ou recebido em reais pela
 // transação e a data da transação. A quantidade de BitCoins e o valor em reais
 // devem ser números inteiros: os 10 primeiros dígitos do valor em reais e os 8
 // primeiro dígitos. da quantidade de BitCoins formam as partes decimais de seus
-// valores reais A data deve estar no formato "YYYY-MM-DD".
+// valores reais A data deve estar no formato "YYYY-MM-DD HH:MM:SS".
+// Retorna ErrLimiteExcedido se a transação ultrapassa algum dos limites do
+// nível de verificação do usuário.
 func InsereTransacao(email string, compra bool, bitcoins float64, preco float64, data string) error {
 	db, err := sql.Open("mysql", dsn)
 	defer db.Close()
@@ -156,19 +333,30 @@ func InsereTransacao(email string, compra bool, bitcoins float64, preco float64,
 	// Adquire o ID do usuário para buscas mais simples
 	usrID, err := adquireUsuarioIDDeEmail(tx, email)
 	if err != nil {
+		tx.Rollback()
 		return err
 	}
 	// Trava as linhas associadas às transações do usuário para verificação
 	// de saldo e verifica se possui saldo suficiente para a transação
 	saldoBitcoins, err := adquireSaldosUsuario(tx, usrID)
 	if err != nil {
+		tx.Rollback()
 		return err
 	} else if !compra && saldoBitcoins < bitcoins {
+		tx.Rollback()
 		return ErrSaldoInsuficiente
 	}
+	// Verifica os limites de volume em reais do usuário. As linhas do usuário
+	// já estão travadas, portanto transações simultâneas não podem ultrapassar
+	// os limites.
+	if err := verificaLimitesUsuario(tx, usrID, preco, data); err != nil {
+		tx.Rollback()
+		return err
+	}
 
 	// Insere a transação no banco de dados
 	if err := insereLinhaTransacao(tx, usrID, compra, preco, bitcoins, data); err != nil {
+		tx.Rollback()
 		return err
 	}
 	if err := tx.Commit(); err != nil {
@@ -216,6 +404,45 @@ func AdquireTransacoesDeUsuario(email string) ([]Transacao, error) {
 	return transacoes, nil
 }
 
+// AdquireHistoricoUsuario adquire todas as transações de um usuário
+// identificado pelo seu e-mail em ordem cronológica. Transações no mesmo
+// horário são ordenadas pela ordem em que foram inseridas.
+func AdquireHistoricoUsuario(email string) ([]Transacao, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlCode := `SELECT
+		t.compra, t.creditos, t.bitcoins, t.dia
+		FROM usuario AS u
+		INNER JOIN transacao AS t ON t.usuario_id = u.id
+		WHERE u.email=?
+		ORDER BY t.dia, t.id;`
+	rows, err := db.Query(sqlCode, email)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	transacoes := make([]Transacao, 0)
+	for rows.Next() {
+		tr := Transacao{Usuario: email}
+		compra := make([]uint8, 1)
+		if err := rows.Scan(&compra, &tr.Creditos, &tr.Bitcoins, &tr.Dia); err != nil {
+			return nil, err
+		}
+		tr.Compra = compra[0] == 1
+		transacoes = append(transacoes, tr)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return transacoes, nil
+}
+
 // AdquireTransacoesEmDia adquire todas as transações feitas em um determinado
 // dia no formato "YYYY-MM-DD" e retorna uma lista de Transacao
 func AdquireTransacoesEmDia(dia string) ([]Transacao, error) {
@@ -229,8 +456,13 @@ func AdquireTransacoesEmDia(dia string) ([]Transacao, error) {
 		u.email, t.compra, t.creditos, t.bitcoins, t.dia
 		FROM transacao AS t
 		INNER JOIN usuario AS u ON u.id = t.usuario_id
-		WHERE t.dia=?;`
-	rows, err := db.Query(sqlCode, dia)
+		WHERE t.dia >= ? AND t.dia < ?;`
+	inicio, err := time.Parse("2006-01-02", dia)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(sqlCode, inicio.Format(formatoDatetime),
+		inicio.AddDate(0, 0, 1).Format(formatoDatetime))
 	if err != nil {
 		return nil, err
 	}
@@ -270,6 +502,19 @@ func verificaUsuarioDuplicado(db *sql.DB, email string) error {
 	return nil
 }
 
+// verificaCPFDuplicado verifica se já existe um usuário com o CPF passado.
+// Retorna ErrCPFDuplicado se existe.
+func verificaCPFDuplicado(db *sql.DB, cpf string) error {
+	var qtd int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM usuario WHERE cpf=?;`, cpf).Scan(&qtd); err != nil {
+		return err
+	}
+	if qtd > 0 {
+		return ErrCPFDuplicado
+	}
+	return nil
+}
+
 // adquireUsuarioIDDeEmail adquire o ID da tabela 'usuario' a partir de seu
 // e-mail. Pode retornar ErrUsuarioNaoExiste.
 func adquireUsuarioIDDeEmail(tx *sql.Tx, email string) (uint, error) {
@@ -87,21 +87,128 @@ func TestAdquireSenhaHashed(t *testing.T) {
 	}
 }
 
+func TestAlteraSenha(t *testing.T) {
+	if err := AlteraSenha("valido3@gmail.com", []byte("novasenha3")); err != nil {
+		t.Fatalf("Erro inesperado ao alterar senha: %v", err)
+	}
+	if senha, err := AdquireSenhaHashed("valido3@gmail.com"); err != nil || string(senha) != "novasenha3" {
+		t.Errorf("Senha inesperada: %s (%v)", senha, err)
+	}
+	if err := AlteraSenha("naoexistente@gmail.com", []byte("senha")); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+func TestAlteraPerfil(t *testing.T) {
+	if err := AlteraPerfil("valido3@gmail.com", "Conta Alterada 3", "1990-01-02"); err != nil {
+		t.Fatalf("Erro inesperado ao alterar perfil: %v", err)
+	}
+	if usr, err := AdquireUsuario("valido3@gmail.com"); err != nil || usr.Nome != "Conta Alterada 3" || usr.Nascimento != "1990-01-02" {
+		t.Errorf("Usuário inesperado: %v (%v)", usr, err)
+	}
+	if err := AlteraPerfil("naoexistente@gmail.com", "Nome", "1990-01-02"); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+func TestAlteraEmail(t *testing.T) {
+	usr := Usuario{
+		Email:      "antigo@gmail.com",
+		Senha:      []byte("senhaantigo"),
+		Nome:       "Conta Antiga",
+		Nascimento: "1994-03-07",
+	}
+	if err := InsereUsuario(&usr); err != nil {
+		t.Fatalf("Erro inesperado ao inserir usuário: %v", err)
+	}
+	if err := AlteraEmail("antigo@gmail.com", "valido1@gmail.com"); err != ErrUsuarioDuplicado {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := AlteraEmail("naoexistente@gmail.com", "outro@gmail.com"); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := AlteraEmail("antigo@gmail.com", "novo@gmail.com"); err != nil {
+		t.Fatalf("Erro inesperado ao alterar e-mail: %v", err)
+	}
+	if _, err := AdquireUsuario("antigo@gmail.com"); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if usr, err := AdquireUsuario("novo@gmail.com"); err != nil || usr.Nome != "Conta Antiga" || !usr.EmailVerificado {
+		t.Errorf("Usuário inesperado: %v (%v)", usr, err)
+	}
+}
+
+func TestDefineCPF(t *testing.T) {
+	usr := Usuario{
+		Email:      "testecpf@gmail.com",
+		Senha:      []byte("senhacpf"),
+		Nome:       "Conta CPF",
+		Nascimento: "1994-03-07",
+		CPF:        "52998224725",
+	}
+	if err := InsereUsuario(&usr); err != nil {
+		t.Fatalf("Erro inesperado ao inserir usuário: %v", err)
+	}
+	if usr, err := AdquireUsuario("testecpf@gmail.com"); err != nil || usr.CPF != "52998224725" {
+		t.Errorf("Usuário inesperado: %v (%v)", usr, err)
+	}
+	// CPF repetido na inserção
+	usr.Email = "testecpf2@gmail.com"
+	if err := InsereUsuario(&usr); err != ErrCPFDuplicado {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Definição do CPF de um usuário sem CPF
+	if err := DefineCPF("valido2@gmail.com", "52998224725"); err != ErrCPFDuplicado {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := DefineCPF("naoexistente@gmail.com", "11144477735"); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := DefineCPF("valido2@gmail.com", "11144477735"); err != nil {
+		t.Fatalf("Erro inesperado ao definir CPF: %v", err)
+	}
+	if usr, err := AdquireUsuario("valido2@gmail.com"); err != nil || usr.CPF != "11144477735" {
+		t.Errorf("Usuário inesperado: %v (%v)", usr, err)
+	}
+	// O CPF não pode ser alterado
+	if err := DefineCPF("valido2@gmail.com", "12345678909"); err != ErrCPFJaDefinido {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+func TestAdquireUsuario(t *testing.T) {
+	// Usuário existente
+	usr, err := AdquireUsuario("valido1@gmail.com")
+	if err != nil {
+		t.Fatalf("Erro inesperado ao adquirir usuário: %v", err)
+	}
+	if usr.Email != "valido1@gmail.com" || usr.Nome != "Conta Válida 1" ||
+		usr.Nascimento != "1994-03-07" || usr.Nivel != 0 || usr.Papel != PapelCliente || usr.EmailVerificado || usr.CPF != "" {
+		t.Errorf("Usuário retornado incorretamente: %v", usr)
+	}
+
+	// Usuário não existente
+	if _, err := AdquireUsuario("naoexistente@gmail.com"); err != ErrUsuarioNaoExiste {
+		t.Errorf("Retorno inesperado para usuário inexistente: %v", err)
+	}
+}
+
 func TestInsereTransacao(t *testing.T) {
 	// Compra inicial que não deve dar erros
-	err := InsereTransacao("valido3@gmail.com", true, 0.00001, 0.00001, "2012-01-01")
+	err := InsereTransacao("valido3@gmail.com", true, 0.00001, 0.00001, "2012-01-01 10:00:00")
 	if err != nil {
 		t.Fatalf("Erro inesperado na transação: %v", err)
 	}
 
 	// Venda que deve ocorrer corretamente
-	err = InsereTransacao("valido3@gmail.com", false, 0.000005, 0.00001, "2012-01-01")
+	err = InsereTransacao("valido3@gmail.com", false, 0.000005, 0.00001, "2012-01-01 10:00:00")
 	if err != nil {
 		t.Fatalf("Erro inesperado na transação: %v", err)
 	}
 
 	// Venda que deve acarretar em saldo insuficiente
-	err = InsereTransacao("valido3@gmail.com", false, 0.00000501, 0.00001, "2012-01-01")
+	err = InsereTransacao("valido3@gmail.com", false, 0.00000501, 0.00001, "2012-01-01 10:00:00")
 	if err != ErrSaldoInsuficiente {
 		t.Fatalf("Erro inesperado na transação: %v", err)
 	}
@@ -114,8 +221,22 @@ func TestAdquireTransacoesDeUsuario(t *testing.T) {
 		t.Errorf("Erro inesperado ao adquirir transações: %v", err)
 	}
 
-	valorEsperado := `[{valido1@gmail.com true 10 0.004 2018-01-01} ` +
-		`{valido1@gmail.com false 30 0.002 2018-01-02}]`
+	valorEsperado := `[{valido1@gmail.com true 10 0.004 2018-01-01 00:00:00} ` +
+		`{valido1@gmail.com false 30 0.002 2018-01-02 00:00:00}]`
+	if valorEsperado != fmt.Sprintf("%v", transacoes) {
+		t.Errorf("Lista de transações possui valor inesperado: %v", transacoes)
+	}
+}
+
+func TestAdquireHistoricoUsuario(t *testing.T) {
+	// Utiliza a conta valido2@gmail.com, que comprou antes de vender
+	transacoes, err := AdquireHistoricoUsuario("valido2@gmail.com")
+	if err != nil {
+		t.Errorf("Erro inesperado ao adquirir transações: %v", err)
+	}
+
+	valorEsperado := `[{valido2@gmail.com true 20 0.003 2018-01-02 00:00:00} ` +
+		`{valido2@gmail.com false 40 0.001 2018-01-03 00:00:00}]`
 	if valorEsperado != fmt.Sprintf("%v", transacoes) {
 		t.Errorf("Lista de transações possui valor inesperado: %v", transacoes)
 	}
@@ -128,8 +249,8 @@ func TestAdquireTransacoesEmDia(t *testing.T) {
 		t.Errorf("Erro inesperado ao adquirir transações: %v", err)
 	}
 
-	valorEsperado := `[{valido2@gmail.com true 20 0.003 2018-01-02} ` +
-		`{valido1@gmail.com false 30 0.002 2018-01-02}]`
+	valorEsperado := `[{valido2@gmail.com true 20 0.003 2018-01-02 00:00:00} ` +
+		`{valido1@gmail.com false 30 0.002 2018-01-02 00:00:00}]`
 	if valorEsperado != fmt.Sprintf("%v", transacoes) {
 		t.Errorf("Lista de transações possui valor inesperado: %v", transacoes)
 	}
@@ -0,0 +1,129 @@
+package database
+
+// Esse arquivo define o encerramento das contas dos usuários. Os dados
+// pessoais são anonimizados, mas as transações, que devem ser mantidas por
+// obrigação legal, continuam associadas à conta encerrada.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Lista de possíveis erros do encerramento de contas
+var (
+	ErrSaldoNaoZerado = errors.New("saldo_nao_zerado")
+)
+
+// MotivoContaEncerrada é o motivo registrado nas solicitações de verificação
+// pendentes rejeitadas no encerramento da conta
+const MotivoContaEncerrada = "conta_encerrada"
+
+// EncerraUsuario encerra no momento 'em' ("YYYY-MM-DD HH:MM:SS") a conta do
+// usuário. Se 'precoLiquidacao' é positivo, todo o saldo de Bitcoins é vendido
+// por esse preço unitário em reais, na mesma transação do banco de dados e sem
+// a verificação dos limites do usuário; caso contrário, o saldo deve estar
+// zerado. O e-mail do usuário é substituído por um e-mail anônimo, que é
+// retornado, e o nome, a data de nascimento, o CPF e a senha são apagados. As
+// chaves de API são revogadas, os planos de compra recorrente são removidos, as
+// solicitações de verificação pendentes são rejeitadas e a autenticação em dois
+// fatores, os tokens enviados por e-mail e os registros dos documentos de
+// verificação são apagados; as chaves dos documentos no armazenamento são
+// retornadas para que os arquivos sejam removidos. As sessões não são
+// revogadas. Retorna ErrSaldoNaoZerado se o usuário possui Bitcoins que não
+// foram vendidos e ErrUsuarioNaoExiste se o usuário não existe.
+func EncerraUsuario(email string, em string, precoLiquidacao float64) (string, []string, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return "", nil, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return "", nil, err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, email)
+	if err != nil {
+		tx.Rollback()
+		return "", nil, err
+	}
+	// As transações do usuário ficam travadas até o fim do encerramento, de
+	// forma que o saldo não possa ser alterado entre a venda e o encerramento
+	bitcoins, err := adquireSaldosUsuario(tx, usrID)
+	if err != nil {
+		tx.Rollback()
+		return "", nil, err
+	}
+	if bitcoins > 0 && precoLiquidacao > 0 {
+		if err := insereLinhaTransacao(tx, usrID, false, bitcoins*precoLiquidacao, bitcoins, em); err != nil {
+			tx.Rollback()
+			return "", nil, err
+		}
+	} else if bitcoins != 0 {
+		tx.Rollback()
+		return "", nil, ErrSaldoNaoZerado
+	}
+
+	arquivos, err := adquireArquivosKYCUsuario(tx, usrID)
+	if err != nil {
+		tx.Rollback()
+		return "", nil, err
+	}
+	comandos := []struct {
+		sqlCode string
+		args    []interface{}
+	}{
+		{`UPDATE chave_api SET revogada_em = ? WHERE usuario_id = ? AND revogada_em IS NULL;`, []interface{}{em, usrID}},
+		{`UPDATE plano SET estado = ? WHERE usuario_id = ?;`, []interface{}{PlanoRemovido, usrID}},
+		{`UPDATE solicitacao_kyc SET estado = ?, analisada_em = ?, motivo = ?
+			WHERE usuario_id = ? AND estado = ?;`, []interface{}{KYCRejeitada, em, MotivoContaEncerrada, usrID, KYCPendente}},
+		{`DELETE d FROM documento_kyc AS d
+			INNER JOIN solicitacao_kyc AS s ON s.id = d.solicitacao_id
+			WHERE s.usuario_id = ?;`, []interface{}{usrID}},
+		{`DELETE FROM codigo_recuperacao WHERE usuario_id = ?;`, []interface{}{usrID}},
+		{`DELETE FROM totp WHERE usuario_id = ?;`, []interface{}{usrID}},
+		{`DELETE FROM token_usuario WHERE usuario_id = ?;`, []interface{}{usrID}},
+	}
+	for _, c := range comandos {
+		if _, err := tx.Exec(c.sqlCode, c.args...); err != nil {
+			tx.Rollback()
+			return "", nil, err
+		}
+	}
+
+	anonimo := fmt.Sprintf("removido-%d@redcoins.invalid", usrID)
+	sqlCode := `UPDATE usuario
+		SET email = ?, senha = '', nome = '', nascimento = '1000-01-01', cpf = NULL,
+			email_verificado = FALSE, encerrado_em = ?
+		WHERE id = ?;`
+	if _, err := tx.Exec(sqlCode, anonimo, em, usrID); err != nil {
+		tx.Rollback()
+		return "", nil, err
+	}
+	return anonimo, arquivos, tx.Commit()
+}
+
+// adquireArquivosKYCUsuario adquire as chaves no armazenamento de todos os
+// documentos de verificação enviados pelo usuário
+func adquireArquivosKYCUsuario(tx *sql.Tx, usrID uint) ([]string, error) {
+	sqlCode := `SELECT d.arquivo
+		FROM documento_kyc AS d
+		INNER JOIN solicitacao_kyc AS s ON s.id = d.solicitacao_id
+		WHERE s.usuario_id = ?
+		ORDER BY d.id;`
+	rows, err := tx.Query(sqlCode, usrID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	arquivos := make([]string, 0)
+	for rows.Next() {
+		var arquivo string
+		if err := rows.Scan(&arquivo); err != nil {
+			return nil, err
+		}
+		arquivos = append(arquivos, arquivo)
+	}
+	return arquivos, rows.Err()
+}
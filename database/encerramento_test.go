@@ -0,0 +1,124 @@
+package database
+
+import "testing"
+
+func TestEncerraUsuario(t *testing.T) {
+	email := "testeencerramento@gmail.com"
+	usr := Usuario{
+		Email:      email,
+		Senha:      []byte("senhaencerramento"),
+		Nome:       "Conta Encerrada",
+		Nascimento: "1990-05-10",
+		CPF:        "93541134780",
+	}
+	if err := InsereUsuario(&usr); err != nil {
+		t.Fatalf("Erro inesperado ao inserir usuário: %v", err)
+	}
+	if err := InsereTransacao(email, true, 0.5, 100, "2018-01-01 10:00:00"); err != nil {
+		t.Fatalf("Erro inesperado ao inserir transação: %v", err)
+	}
+
+	// A conta só pode ser encerrada com o saldo zerado
+	if _, _, err := EncerraUsuario(email, "2018-01-05 10:00:00", 0); err != ErrSaldoNaoZerado {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if _, _, err := EncerraUsuario("naoexistente@gmail.com", "2018-01-05 10:00:00", 0); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := InsereTransacao(email, false, 0.5, 120, "2018-01-02 10:00:00"); err != nil {
+		t.Fatalf("Erro inesperado ao inserir transação: %v", err)
+	}
+
+	// Dados associados à conta
+	chave := ChaveAPI{ID: "encerramento0123456789abcdef0123", Usuario: email, Nome: "robô",
+		Segredo: "cc", Escopos: []string{"relatorios"}, IPs: []string{}, Criada: "2018-01-03 10:00:00"}
+	if err := InsereChaveAPI(chave); err != nil {
+		t.Fatalf("Erro inesperado ao inserir chave: %v", err)
+	}
+	if err := DefineSegredoTOTP(email, "JBSWY3DPEHPK3PXP"); err != nil {
+		t.Fatalf("Erro inesperado ao definir TOTP: %v", err)
+	}
+	token := TokenUsuario{Hash: "ee11", Usuario: email, Finalidade: TokenVerificacaoEmail,
+		Criado: "2018-01-03 10:00:00", Expira: "2018-01-04 10:00:00"}
+	if err := InsereTokenUsuario(token); err != nil {
+		t.Fatalf("Erro inesperado ao inserir token: %v", err)
+	}
+	s := SolicitacaoKYC{Usuario: email, Nivel: 1, Criada: "2018-01-03 10:00:00",
+		Documentos: []DocumentoKYC{{Tipo: "identidade", Arquivo: "ee11.png", TipoConteudo: "image/png", Tamanho: 10}}}
+	if _, err := InsereSolicitacaoKYC(s); err != nil {
+		t.Fatalf("Erro inesperado ao inserir solicitação: %v", err)
+	}
+
+	anonimo, arquivos, err := EncerraUsuario(email, "2018-01-05 10:00:00", 0)
+	if err != nil {
+		t.Fatalf("Erro inesperado ao encerrar conta: %v", err)
+	}
+	if len(arquivos) != 1 || arquivos[0] != "ee11.png" {
+		t.Errorf("Arquivos inesperados: %v", arquivos)
+	}
+
+	// Os dados pessoais são anonimizados e o login não é mais possível
+	if _, err := AdquireUsuario(email); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if usr, err := AdquireUsuario(anonimo); err != nil || !usr.Encerrado || usr.Nome != "" ||
+		usr.CPF != "" || usr.EmailVerificado || len(usr.Senha) != 0 {
+		t.Errorf("Usuário inesperado: %v (%v)", usr, err)
+	}
+	if _, err := AdquireSenhaHashed(anonimo); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// As transações são mantidas; os demais dados são revogados ou removidos
+	if transacoes, err := AdquireTransacoesDeUsuario(anonimo); err != nil || len(transacoes) != 2 {
+		t.Errorf("Transações inesperadas: %v (%v)", transacoes, err)
+	}
+	if chaves, err := AdquireChavesAPIUsuario(anonimo); err != nil || len(chaves) != 1 || chaves[0].RevogadaEm != "2018-01-05 10:00:00" {
+		t.Errorf("Chaves inesperadas: %v (%v)", chaves, err)
+	}
+	if _, err := AdquireTOTP(anonimo); err != ErrTOTPNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if qtd, err := ContaTokensUsuario(anonimo, TokenVerificacaoEmail, "2018-01-01 00:00:00"); err != nil || qtd != 0 {
+		t.Errorf("Tokens inesperados: %v (%v)", qtd, err)
+	}
+	solicitacoes, err := AdquireSolicitacoesKYCUsuario(anonimo)
+	if err != nil || len(solicitacoes) != 1 || solicitacoes[0].Estado != KYCRejeitada ||
+		solicitacoes[0].Motivo != MotivoContaEncerrada || len(solicitacoes[0].Documentos) != 0 {
+		t.Errorf("Solicitações inesperadas: %v (%v)", solicitacoes, err)
+	}
+
+	// O e-mail e o CPF podem ser utilizados em um novo cadastro
+	usr.Email = email
+	if err := InsereUsuario(&usr); err != nil {
+		t.Errorf("Erro inesperado ao inserir usuário: %v", err)
+	}
+}
+
+func TestEncerraUsuarioLiquidacao(t *testing.T) {
+	// O saldo é vendido mesmo ultrapassando os limites do nível 0
+	email := "testeliquidacao@gmail.com"
+	usr := Usuario{Email: email, Senha: []byte("senhaliquidacao"), Nome: "Conta Liquidada", Nascimento: "1990-05-10"}
+	if err := InsereUsuario(&usr); err != nil {
+		t.Fatalf("Erro inesperado ao inserir usuário: %v", err)
+	}
+	for _, dia := range []string{"2018-01-01 10:00:00", "2018-01-02 10:00:00", "2018-01-03 10:00:00"} {
+		if err := InsereTransacao(email, true, 0.1, 900, dia); err != nil {
+			t.Fatalf("Erro inesperado ao inserir transação: %v", err)
+		}
+	}
+
+	anonimo, _, err := EncerraUsuario(email, "2018-01-05 10:00:00", 20000)
+	if err != nil {
+		t.Fatalf("Erro inesperado ao encerrar conta: %v", err)
+	}
+	transacoes, err := AdquireTransacoesDeUsuario(anonimo)
+	if err != nil || len(transacoes) != 4 {
+		t.Fatalf("Transações inesperadas: %v (%v)", transacoes, err)
+	}
+	for _, tr := range transacoes {
+		if !tr.Compra && (tr.Bitcoins != 0.3 || tr.Creditos != 6000 || tr.Dia != "2018-01-05 10:00:00") {
+			t.Errorf("Venda inesperada: %v", tr)
+		}
+	}
+}
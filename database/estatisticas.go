@@ -0,0 +1,84 @@
+package database
+
+// Esse arquivo define as estatísticas agregadas das transações do mercado
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Lista de possíveis erros das estatísticas
+var (
+	ErrIntervaloInvalido = errors.New("intervalo inválido")
+)
+
+// Intervalos de agregação das estatísticas e o formato do início de cada
+// período no MySQL
+const (
+	IntervaloDia  = "dia"
+	IntervaloHora = "hora"
+)
+
+var formatosIntervalo = map[string]string{
+	IntervaloDia:  "%Y-%m-%d",
+	IntervaloHora: "%Y-%m-%d %H:00:00",
+}
+
+// Estatisticas são os agregados das transações de um período. 'Periodo' é o
+// início do período ("YYYY-MM-DD" para dias e "YYYY-MM-DD HH:00:00" para
+// horas) e 'PrecoMedio' é o preço médio do bitcoin ponderado pelo volume
+// (VWAP).
+type Estatisticas struct {
+	Periodo        string  `json:"periodo"`
+	Compras        int     `json:"compras"`
+	Vendas         int     `json:"vendas"`
+	VolumeBitcoins float64 `json:"volumeBitcoins"`
+	VolumeReais    float64 `json:"volumeReais"`
+	PrecoMedio     float64 `json:"precoMedio"`
+	Usuarios       int     `json:"usuarios"`
+	MaiorTransacao float64 `json:"maiorTransacao"`
+}
+
+// AdquireEstatisticas adquire as estatísticas das transações entre 'inicio'
+// (inclusivo) e 'fim' (exclusivo), no formato "YYYY-MM-DD HH:MM:SS", agregadas
+// por 'intervalo' (IntervaloDia ou IntervaloHora). Períodos sem transações não
+// são retornados.
+func AdquireEstatisticas(inicio, fim, intervalo string) ([]Estatisticas, error) {
+	formato, ok := formatosIntervalo[intervalo]
+	if !ok {
+		return nil, ErrIntervaloInvalido
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// A maior transação é a de maior valor em reais
+	sqlCode := `SELECT
+		DATE_FORMAT(dia, ?) AS periodo,
+		SUM(compra = 1), SUM(compra = 0),
+		SUM(bitcoins), SUM(creditos), IFNULL(SUM(creditos) / NULLIF(SUM(bitcoins), 0), 0),
+		COUNT(DISTINCT usuario_id), MAX(creditos)
+		FROM transacao
+		WHERE dia >= ? AND dia < ?
+		GROUP BY periodo
+		ORDER BY periodo;`
+	rows, err := db.Query(sqlCode, formato, inicio, fim)
+	if err != nil {
+		return nil, err
+	}
+
+	estatisticas := make([]Estatisticas, 0)
+	defer rows.Close()
+	for rows.Next() {
+		e := Estatisticas{}
+		if err := rows.Scan(&e.Periodo, &e.Compras, &e.Vendas, &e.VolumeBitcoins,
+			&e.VolumeReais, &e.PrecoMedio, &e.Usuarios, &e.MaiorTransacao); err != nil {
+			return nil, err
+		}
+		estatisticas = append(estatisticas, e)
+	}
+	return estatisticas, rows.Err()
+}
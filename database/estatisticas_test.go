@@ -0,0 +1,34 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAdquireEstatisticas(t *testing.T) {
+	// Em 2018-01-02, valido2@gmail.com comprou 0.003 Bitcoins por 20 reais e
+	// valido1@gmail.com vendeu 0.002 Bitcoins por 30 reais
+	estatisticas, err := AdquireEstatisticas("2018-01-02 00:00:00", "2018-01-04 00:00:00", IntervaloDia)
+	if err != nil {
+		t.Fatalf("Erro inesperado ao adquirir estatísticas: %v", err)
+	}
+	valorEsperado := `[{2018-01-02 1 1 0.005 50 10000 2 30} {2018-01-03 0 1 0.001 40 40000 1 40}]`
+	if valorEsperado != fmt.Sprintf("%v", estatisticas) {
+		t.Errorf("Estatísticas inesperadas: %v", estatisticas)
+	}
+
+	// Por hora, todas as transações do dia estão no mesmo período
+	estatisticas, err = AdquireEstatisticas("2018-01-01 00:00:00", "2018-01-02 00:00:00", IntervaloHora)
+	if err != nil {
+		t.Fatalf("Erro inesperado ao adquirir estatísticas: %v", err)
+	}
+	valorEsperado = `[{2018-01-01 00:00:00 1 0 0.004 10 2500 1 10}]`
+	if valorEsperado != fmt.Sprintf("%v", estatisticas) {
+		t.Errorf("Estatísticas inesperadas: %v", estatisticas)
+	}
+
+	// Intervalo inválido
+	if _, err := AdquireEstatisticas("2018-01-01 00:00:00", "2018-01-02 00:00:00", "semana"); err != ErrIntervaloInvalido {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package database
+
+// Esse arquivo define funções para o extrato das movimentações dos usuários
+
+import (
+	"database/sql"
+)
+
+// AdquireMovimentacoesUsuario adquire as transações de um usuário identificado
+// pelo seu e-mail feitas a partir de 'inicio' e antes de 'fim' (ambos no
+// formato "YYYY-MM-DD HH:MM:SS"), em ordem cronológica, e os IDs dessas
+// transações na mesma ordem. Transações no mesmo horário são ordenadas pela
+// ordem em que foram inseridas.
+func AdquireMovimentacoesUsuario(email string, inicio string, fim string) ([]Transacao, []int64, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sqlCode := `SELECT
+		t.id, t.compra, t.creditos, t.bitcoins, t.dia
+		FROM usuario AS u
+		INNER JOIN transacao AS t ON t.usuario_id = u.id
+		WHERE u.email=? AND t.dia >= ? AND t.dia < ?
+		ORDER BY t.dia, t.id;`
+	rows, err := db.Query(sqlCode, email, inicio, fim)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	defer rows.Close()
+	transacoes := make([]Transacao, 0)
+	ids := make([]int64, 0)
+	for rows.Next() {
+		var id int64
+		tr := Transacao{Usuario: email}
+		compra := make([]uint8, 1)
+		if err := rows.Scan(&id, &compra, &tr.Creditos, &tr.Bitcoins, &tr.Dia); err != nil {
+			return nil, nil, err
+		}
+		tr.Compra = compra[0] == 1
+		transacoes = append(transacoes, tr)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return transacoes, ids, nil
+}
+
+// AdquireSaldosUsuario adquire os saldos de um usuário identificado pelo seu
+// e-mail considerando apenas as transações anteriores a 'antes' ("YYYY-MM-DD
+// HH:MM:SS"). O saldo em reais é o valor líquido das transações: vendas somam
+// e compras subtraem.
+func AdquireSaldosUsuario(email string, antes string) (float64, float64, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	sqlCode := `SELECT
+		IFNULL(SUM(IF(t.compra = 1, t.bitcoins, -t.bitcoins)), 0),
+		IFNULL(SUM(IF(t.compra = 1, -t.creditos, t.creditos)), 0)
+		FROM usuario AS u
+		INNER JOIN transacao AS t ON t.usuario_id = u.id
+		WHERE u.email=? AND t.dia < ?;`
+	var bitcoins, reais float64
+	err = db.QueryRow(sqlCode, email, antes).Scan(&bitcoins, &reais)
+	return bitcoins, reais, err
+}
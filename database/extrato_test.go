@@ -0,0 +1,40 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAdquireMovimentacoesUsuario(t *testing.T) {
+	// Apenas a venda de 2018-01-02 de valido1@gmail.com está no período
+	transacoes, ids, err := AdquireMovimentacoesUsuario("valido1@gmail.com", "2018-01-02 00:00:00", "2018-01-03 00:00:00")
+	if err != nil {
+		t.Fatalf("Erro inesperado ao adquirir transações: %v", err)
+	}
+	valorEsperado := `[{valido1@gmail.com false 30 0.002 2018-01-02 00:00:00}]`
+	if valorEsperado != fmt.Sprintf("%v", transacoes) {
+		t.Errorf("Lista de transações possui valor inesperado: %v", transacoes)
+	}
+	// A venda é a terceira transação inserida
+	if fmt.Sprintf("%v", ids) != "[3]" {
+		t.Errorf("IDs inesperados: %v", ids)
+	}
+}
+
+func TestAdquireSaldosUsuario(t *testing.T) {
+	// Antes de 2018-01-02, valido1@gmail.com só havia comprado 0.004 Bitcoins
+	// por 10 reais
+	bitcoins, reais, err := AdquireSaldosUsuario("valido1@gmail.com", "2018-01-02 00:00:00")
+	if err != nil {
+		t.Fatalf("Erro inesperado ao adquirir saldos: %v", err)
+	}
+	if bitcoins != 0.004 || reais != -10 {
+		t.Errorf("Saldos inesperados: %v %v", bitcoins, reais)
+	}
+
+	// Usuário sem transações
+	bitcoins, reais, err = AdquireSaldosUsuario("valido3@gmail.com", "2000-01-01 00:00:00")
+	if err != nil || bitcoins != 0 || reais != 0 {
+		t.Errorf("Saldos inesperados: %v %v (%v)", bitcoins, reais, err)
+	}
+}
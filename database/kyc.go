@@ -0,0 +1,265 @@
+package database
+
+// Esse arquivo define as solicitações de verificação de identidade (KYC) dos
+// usuários. Cada solicitação pede um nível de verificação e contém os
+// documentos enviados pelo usuário; quando aprovada pela equipe, o nível do
+// usuário é elevado ao nível solicitado.
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Lista de possíveis erros das solicitações de verificação
+var (
+	ErrSolicitacaoPendente  = errors.New("solicitacao_kyc_pendente")
+	ErrSolicitacaoNaoExiste = errors.New("solicitacao_kyc_nao_existente")
+	ErrDocumentoNaoExiste   = errors.New("documento_kyc_nao_existente")
+	ErrAnalisePropria       = errors.New("analise_propria")
+)
+
+// Estados das solicitações de verificação
+const (
+	KYCPendente  = "pendente"
+	KYCAprovada  = "aprovada"
+	KYCRejeitada = "rejeitada"
+)
+
+// DocumentoKYC é a estrutura para a tabela 'documento_kyc'. 'Arquivo' é a
+// chave do documento no armazenamento.
+type DocumentoKYC struct {
+	ID            int64  `json:"id"`
+	SolicitacaoID int64  `json:"-"`
+	Tipo          string `json:"tipo"`
+	Arquivo       string `json:"-"`
+	TipoConteudo  string `json:"tipoConteudo"`
+	Tamanho       int64  `json:"tamanho"`
+}
+
+// SolicitacaoKYC é a estrutura para a tabela 'solicitacao_kyc'. As datas
+// estão no formato "YYYY-MM-DD HH:MM:SS"; 'Analista' e 'AnalisadaEm' são
+// vazios enquanto a solicitação não foi analisada.
+type SolicitacaoKYC struct {
+	ID          int64          `json:"id"`
+	Usuario     string         `json:"usuario"`
+	Nivel       int            `json:"nivel"`
+	Estado      string         `json:"estado"`
+	Criada      string         `json:"criada"`
+	Analista    string         `json:"analista,omitempty"`
+	AnalisadaEm string         `json:"analisadaEm,omitempty"`
+	Motivo      string         `json:"motivo,omitempty"`
+	Documentos  []DocumentoKYC `json:"documentos"`
+}
+
+// InsereSolicitacaoKYC cria uma nova solicitação pendente, com seus
+// documentos, para o usuário do e-mail 'Usuario' da solicitação passada e
+// retorna seu ID. Retorna ErrUsuarioNaoExiste se o usuário não existe e
+// ErrSolicitacaoPendente se o usuário já possui uma solicitação pendente.
+func InsereSolicitacaoKYC(s SolicitacaoKYC) (int64, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return 0, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, s.Usuario)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	// Trava a linha do usuário para que solicitações simultâneas não sejam
+	// inseridas
+	if err := tx.QueryRow(`SELECT id FROM usuario WHERE id = ? FOR UPDATE;`, usrID).Scan(&usrID); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	var qtd int
+	sqlCode := `SELECT COUNT(*) FROM solicitacao_kyc WHERE usuario_id = ? AND estado = ?;`
+	if err := tx.QueryRow(sqlCode, usrID, KYCPendente).Scan(&qtd); err != nil {
+		tx.Rollback()
+		return 0, err
+	} else if qtd > 0 {
+		tx.Rollback()
+		return 0, ErrSolicitacaoPendente
+	}
+
+	sqlCode = `INSERT INTO solicitacao_kyc (usuario_id, nivel, estado, criada) VALUES (?, ?, ?, ?);`
+	res, err := tx.Exec(sqlCode, usrID, s.Nivel, KYCPendente, s.Criada)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	sqlCode = `INSERT INTO documento_kyc
+		(solicitacao_id, tipo, arquivo, tipo_conteudo, tamanho)
+		VALUES (?, ?, ?, ?, ?);`
+	for _, d := range s.Documentos {
+		if _, err := tx.Exec(sqlCode, id, d.Tipo, d.Arquivo, d.TipoConteudo, d.Tamanho); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// AdquireSolicitacoesKYCUsuario adquire todas as solicitações de verificação
+// do usuário, com seus documentos, em ordem de criação
+func AdquireSolicitacoesKYCUsuario(email string) ([]SolicitacaoKYC, error) {
+	return adquireSolicitacoesKYC(`WHERE u.email = ?`, email)
+}
+
+// AdquireSolicitacoesKYCPendentes adquire todas as solicitações de verificação
+// que aguardam análise, com seus documentos, em ordem de criação
+func AdquireSolicitacoesKYCPendentes() ([]SolicitacaoKYC, error) {
+	return adquireSolicitacoesKYC(`WHERE s.estado = ?`, KYCPendente)
+}
+
+// AdquireDocumentoKYC adquire o documento 'id'. Retorna ErrDocumentoNaoExiste
+// se o documento não existe.
+func AdquireDocumentoKYC(id int64) (DocumentoKYC, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return DocumentoKYC{}, err
+	}
+
+	d := DocumentoKYC{}
+	sqlCode := `SELECT id, solicitacao_id, tipo, arquivo, tipo_conteudo, tamanho
+		FROM documento_kyc WHERE id = ?;`
+	err = db.QueryRow(sqlCode, id).Scan(&d.ID, &d.SolicitacaoID, &d.Tipo, &d.Arquivo, &d.TipoConteudo, &d.Tamanho)
+	if err == sql.ErrNoRows {
+		return DocumentoKYC{}, ErrDocumentoNaoExiste
+	}
+	return d, err
+}
+
+// AnalisaSolicitacaoKYC registra a análise da solicitação pendente 'id' pelo
+// usuário 'analista' no momento 'em' ("YYYY-MM-DD HH:MM:SS"). Se aprovada, o
+// nível do usuário é elevado ao nível solicitado; um nível maior já concedido
+// é mantido. Retorna ErrSolicitacaoNaoExiste se a solicitação não existe ou
+// não está pendente, ErrUsuarioNaoExiste se o analista não existe e
+// ErrAnalisePropria se o analista é o próprio solicitante.
+func AnalisaSolicitacaoKYC(id int64, aprovada bool, analista string, motivo string, em string) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	analistaID, err := adquireUsuarioIDDeEmail(tx, analista)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	var usrID uint
+	var nivel int
+	sqlCode := `SELECT usuario_id, nivel FROM solicitacao_kyc
+		WHERE id = ? AND estado = ?
+		FOR UPDATE;`
+	err = tx.QueryRow(sqlCode, id, KYCPendente).Scan(&usrID, &nivel)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return ErrSolicitacaoNaoExiste
+	} else if err != nil {
+		tx.Rollback()
+		return err
+	} else if usrID == analistaID {
+		tx.Rollback()
+		return ErrAnalisePropria
+	}
+
+	estado := KYCRejeitada
+	if aprovada {
+		estado = KYCAprovada
+	}
+	sqlCode = `UPDATE solicitacao_kyc
+		SET estado = ?, analista_id = ?, analisada_em = ?, motivo = ?
+		WHERE id = ?;`
+	if _, err := tx.Exec(sqlCode, estado, analistaID, em, motivo, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if aprovada {
+		sqlCode = `UPDATE usuario SET nivel = GREATEST(nivel, ?) WHERE id = ?;`
+		if _, err := tx.Exec(sqlCode, nivel, usrID); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// adquireSolicitacoesKYC adquire as solicitações de verificação que satisfazem
+// a condição 'where' (sobre as tabelas 's' e 'u'), com seus documentos, em
+// ordem de criação
+func adquireSolicitacoesKYC(where string, args ...interface{}) ([]SolicitacaoKYC, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlCode := `SELECT s.id, u.email, s.nivel, s.estado, s.criada, a.email, s.analisada_em, s.motivo
+		FROM solicitacao_kyc AS s
+		INNER JOIN usuario AS u ON u.id = s.usuario_id
+		LEFT JOIN usuario AS a ON a.id = s.analista_id
+		` + where + `
+		ORDER BY s.criada, s.id;`
+	rows, err := db.Query(sqlCode, args...)
+	if err != nil {
+		return nil, err
+	}
+	solicitacoes := make([]SolicitacaoKYC, 0)
+	defer rows.Close()
+	for rows.Next() {
+		s := SolicitacaoKYC{Documentos: make([]DocumentoKYC, 0)}
+		var analista, analisadaEm sql.NullString
+		if err := rows.Scan(&s.ID, &s.Usuario, &s.Nivel, &s.Estado, &s.Criada,
+			&analista, &analisadaEm, &s.Motivo); err != nil {
+			return nil, err
+		}
+		s.Analista = analista.String
+		s.AnalisadaEm = analisadaEm.String
+		solicitacoes = append(solicitacoes, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Adquire os documentos de cada solicitação
+	sqlCode = `SELECT id, solicitacao_id, tipo, arquivo, tipo_conteudo, tamanho
+		FROM documento_kyc WHERE solicitacao_id = ?
+		ORDER BY id;`
+	for i := range solicitacoes {
+		docs, err := db.Query(sqlCode, solicitacoes[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		for docs.Next() {
+			d := DocumentoKYC{}
+			if err := docs.Scan(&d.ID, &d.SolicitacaoID, &d.Tipo, &d.Arquivo, &d.TipoConteudo, &d.Tamanho); err != nil {
+				docs.Close()
+				return nil, err
+			}
+			solicitacoes[i].Documentos = append(solicitacoes[i].Documentos, d)
+		}
+		err = docs.Err()
+		docs.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return solicitacoes, nil
+}
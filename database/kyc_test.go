@@ -0,0 +1,94 @@
+package database
+
+import "testing"
+
+func TestSolicitacoesKYC(t *testing.T) {
+	usr := Usuario{
+		Email:      "testekyc@gmail.com",
+		Senha:      []byte("senhakyc"),
+		Nome:       "Conta KYC",
+		Nascimento: "1994-03-07",
+		CPF:        "39053344705",
+	}
+	if err := InsereUsuario(&usr); err != nil {
+		t.Fatalf("Erro inesperado ao inserir usuário: %v", err)
+	}
+	s := SolicitacaoKYC{
+		Usuario: "testekyc@gmail.com",
+		Nivel:   2,
+		Criada:  "2018-01-01 10:00:00",
+		Documentos: []DocumentoKYC{
+			{Tipo: "identidade", Arquivo: "aa11.png", TipoConteudo: "image/png", Tamanho: 10},
+			{Tipo: "selfie", Arquivo: "bb22.jpg", TipoConteudo: "image/jpeg", Tamanho: 20},
+		},
+	}
+	id, err := InsereSolicitacaoKYC(s)
+	if err != nil {
+		t.Fatalf("Erro inesperado ao inserir solicitação: %v", err)
+	}
+	// Apenas uma solicitação pendente por usuário
+	if _, err := InsereSolicitacaoKYC(s); err != ErrSolicitacaoPendente {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	s.Usuario = "naoexistente@gmail.com"
+	if _, err := InsereSolicitacaoKYC(s); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Solicitações pendentes e do usuário
+	pendentes, err := AdquireSolicitacoesKYCPendentes()
+	if err != nil || len(pendentes) != 1 || pendentes[0].ID != id || len(pendentes[0].Documentos) != 2 {
+		t.Fatalf("Solicitações inesperadas: %v (%v)", pendentes, err)
+	}
+	d, err := AdquireDocumentoKYC(pendentes[0].Documentos[1].ID)
+	if err != nil || d.SolicitacaoID != id || d.Arquivo != "bb22.jpg" || d.TipoConteudo != "image/jpeg" {
+		t.Errorf("Documento inesperado: %v (%v)", d, err)
+	}
+	if _, err := AdquireDocumentoKYC(0); err != ErrDocumentoNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Rejeição não altera o nível; a análise só pode ser feita uma vez
+	if err := AnalisaSolicitacaoKYC(id, false, "valido1@gmail.com", "documento ilegível", "2018-01-02 10:00:00"); err != nil {
+		t.Fatalf("Erro inesperado ao analisar solicitação: %v", err)
+	}
+	if err := AnalisaSolicitacaoKYC(id, true, "valido1@gmail.com", "", "2018-01-02 10:00:00"); err != ErrSolicitacaoNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if usr, err := AdquireUsuario("testekyc@gmail.com"); err != nil || usr.Nivel != 0 {
+		t.Errorf("Usuário inesperado: %v (%v)", usr, err)
+	}
+
+	// Aprovação eleva o nível do usuário
+	s.Usuario = "testekyc@gmail.com"
+	s.Criada = "2018-01-03 10:00:00"
+	id, err = InsereSolicitacaoKYC(s)
+	if err != nil {
+		t.Fatalf("Erro inesperado ao inserir solicitação: %v", err)
+	}
+	if err := AnalisaSolicitacaoKYC(id, true, "naoexistente@gmail.com", "", "2018-01-04 10:00:00"); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := AnalisaSolicitacaoKYC(id, true, "testekyc@gmail.com", "", "2018-01-04 10:00:00"); err != ErrAnalisePropria {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := AnalisaSolicitacaoKYC(id, true, "valido1@gmail.com", "", "2018-01-04 10:00:00"); err != nil {
+		t.Fatalf("Erro inesperado ao analisar solicitação: %v", err)
+	}
+	if usr, err := AdquireUsuario("testekyc@gmail.com"); err != nil || usr.Nivel != 2 {
+		t.Errorf("Usuário inesperado: %v (%v)", usr, err)
+	}
+
+	// Histórico do usuário
+	solicitacoes, err := AdquireSolicitacoesKYCUsuario("testekyc@gmail.com")
+	if err != nil || len(solicitacoes) != 2 {
+		t.Fatalf("Solicitações inesperadas: %v (%v)", solicitacoes, err)
+	}
+	if r := solicitacoes[0]; r.Estado != KYCRejeitada || r.Analista != "valido1@gmail.com" ||
+		r.AnalisadaEm != "2018-01-02 10:00:00" || r.Motivo != "documento ilegível" {
+		t.Errorf("Solicitação inesperada: %v", r)
+	}
+	if a := solicitacoes[1]; a.Estado != KYCAprovada || a.Nivel != 2 {
+		t.Errorf("Solicitação inesperada: %v", a)
+	}
+}
@@ -0,0 +1,99 @@
+package database
+
+// Esse arquivo define funções para os limites de transação de cada nível de
+// verificação dos usuários
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Limites é a estrutura com os limites de volume em reais do nível de
+// verificação de um usuário e o volume já utilizado pelo usuário no dia e no
+// mês de referência
+type Limites struct {
+	Nivel           int     `json:"nivel"`
+	PorTransacao    float64 `json:"porTransacao"`
+	Diario          float64 `json:"diario"`
+	Mensal          float64 `json:"mensal"`
+	UtilizadoDiario float64 `json:"utilizadoDiario"`
+	UtilizadoMensal float64 `json:"utilizadoMensal"`
+}
+
+// AdquireLimitesUsuario adquire os limites do usuário e o volume em reais
+// utilizado por ele no dia "YYYY-MM-DD" passado e no mês desse dia
+func AdquireLimitesUsuario(email string, data string) (Limites, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return Limites{}, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return Limites{}, err
+	}
+	usrID, err := adquireUsuarioIDDeEmail(tx, email)
+	if err != nil {
+		tx.Rollback()
+		return Limites{}, err
+	}
+	limites, err := adquireLimites(tx, usrID, data)
+	if err != nil {
+		tx.Rollback()
+		return Limites{}, err
+	}
+	return limites, tx.Commit()
+}
+
+// verificaLimitesUsuario verifica se uma transação de 'preco' reais na data
+// "YYYY-MM-DD HH:MM:SS" passada respeita os limites por transação, diário e
+// mensal do usuário. Retorna ErrLimiteExcedido caso algum limite seja
+// ultrapassado.
+func verificaLimitesUsuario(tx *sql.Tx, usrID uint, preco float64, data string) error {
+	limites, err := adquireLimites(tx, usrID, data)
+	if err != nil {
+		return err
+	}
+	if preco > limites.PorTransacao ||
+		limites.UtilizadoDiario+preco > limites.Diario ||
+		limites.UtilizadoMensal+preco > limites.Mensal {
+		return ErrLimiteExcedido
+	}
+	return nil
+}
+
+// adquireLimites adquire os limites do nível do usuário e seu volume em reais
+// (compras e vendas) no dia e no mês da data passada. A data pode estar no
+// formato "YYYY-MM-DD" ou "YYYY-MM-DD HH:MM:SS"; apenas o dia é considerado.
+func adquireLimites(tx *sql.Tx, usrID uint, data string) (Limites, error) {
+	if len(data) > 10 {
+		data = data[:10]
+	}
+	dia, err := time.Parse("2006-01-02", data)
+	if err != nil {
+		return Limites{}, err
+	}
+	inicioMes := time.Date(dia.Year(), dia.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	sqlCode := `SELECT
+		l.nivel, l.por_transacao, l.diario, l.mensal,
+		(SELECT IFNULL(SUM(t.creditos), 0) FROM transacao AS t
+			WHERE t.usuario_id = u.id AND t.dia >= ? AND t.dia < ?),
+		(SELECT IFNULL(SUM(t.creditos), 0) FROM transacao AS t
+			WHERE t.usuario_id = u.id AND t.dia >= ? AND t.dia < ?)
+		FROM usuario AS u
+		INNER JOIN limite AS l ON l.nivel = u.nivel
+		WHERE u.id=?;`
+	var limites Limites
+	err = tx.QueryRow(sqlCode,
+		dia.Format(formatoDatetime), dia.AddDate(0, 0, 1).Format(formatoDatetime),
+		inicioMes.Format(formatoDatetime), inicioMes.AddDate(0, 1, 0).Format(formatoDatetime),
+		usrID).Scan(
+		&limites.Nivel,
+		&limites.PorTransacao,
+		&limites.Diario,
+		&limites.Mensal,
+		&limites.UtilizadoDiario,
+		&limites.UtilizadoMensal)
+	return limites, err
+}
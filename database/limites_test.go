@@ -0,0 +1,77 @@
+package database
+
+import "testing"
+
+func TestAdquireLimitesUsuario(t *testing.T) {
+	// Utiliza a conta valido1@gmail.com, que possui 30 reais transacionados em
+	// 2018-01-02 e 40 reais transacionados em janeiro de 2018
+	limites, err := AdquireLimitesUsuario("valido1@gmail.com", "2018-01-02")
+	if err != nil {
+		t.Fatalf("Erro inesperado ao adquirir limites: %v", err)
+	}
+	esperado := Limites{
+		Nivel:           0,
+		PorTransacao:    1000,
+		Diario:          2000,
+		Mensal:          10000,
+		UtilizadoDiario: 30,
+		UtilizadoMensal: 40,
+	}
+	if limites != esperado {
+		t.Errorf("Limites incorretos: %v", limites)
+	}
+
+	// Usuário inexistente
+	if _, err := AdquireLimitesUsuario("naoexistente@gmail.com", "2018-01-02"); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+func TestInsereTransacaoLimites(t *testing.T) {
+	// Limite por transação
+	err := InsereTransacao("valido2@gmail.com", true, 0.1, 1000.01, "2018-02-10 10:00:00")
+	if err != ErrLimiteExcedido {
+		t.Errorf("Erro inesperado na transação: %v", err)
+	}
+
+	// Limite diário: duas transações de 900 reais são permitidas, a terceira
+	// ultrapassa o limite de 2000 reais
+	if err := InsereTransacao("valido2@gmail.com", true, 0.01, 900, "2018-02-10 10:00:00"); err != nil {
+		t.Fatalf("Erro inesperado na transação: %v", err)
+	}
+	if err := InsereTransacao("valido2@gmail.com", false, 0.01, 900, "2018-02-10 10:00:00"); err != nil {
+		t.Fatalf("Erro inesperado na transação: %v", err)
+	}
+	if err := InsereTransacao("valido2@gmail.com", true, 0.01, 900, "2018-02-10 10:00:00"); err != ErrLimiteExcedido {
+		t.Errorf("Erro inesperado na transação: %v", err)
+	}
+	// Em outro dia, a mesma transação é permitida
+	if err := InsereTransacao("valido2@gmail.com", true, 0.01, 900, "2018-02-11 10:00:00"); err != nil {
+		t.Errorf("Erro inesperado na transação: %v", err)
+	}
+}
+
+func TestInsereTransacaoAposLimiteExcedido(t *testing.T) {
+	// Uma transação recusada pelos limites não pode manter as linhas do
+	// usuário travadas: as transações seguintes devem ser realizadas
+	usr := Usuario{Email: "testelimites@gmail.com", Senha: []byte("senhalimites"),
+		Nome: "Conta Limites", Nascimento: "1990-05-10"}
+	if err := InsereUsuario(&usr); err != nil {
+		t.Fatalf("Erro inesperado ao inserir usuário: %v", err)
+	}
+	if err := InsereTransacao(usr.Email, true, 0.1, 500, "2018-03-10 10:00:00"); err != nil {
+		t.Fatalf("Erro inesperado na transação: %v", err)
+	}
+	if err := InsereTransacao(usr.Email, true, 0.1, 1500, "2018-03-10 10:00:00"); err != ErrLimiteExcedido {
+		t.Errorf("Erro inesperado na transação: %v", err)
+	}
+	if err := InsereTransacao(usr.Email, false, 0.05, 300, "2018-03-10 10:00:00"); err != nil {
+		t.Errorf("Erro inesperado na transação: %v", err)
+	}
+	if err := InsereTransacao(usr.Email, false, 1, 300, "2018-03-10 10:00:00"); err != ErrSaldoInsuficiente {
+		t.Errorf("Erro inesperado na transação: %v", err)
+	}
+	if err := InsereTransacao(usr.Email, true, 0.05, 300, "2018-03-10 10:00:00"); err != nil {
+		t.Errorf("Erro inesperado na transação: %v", err)
+	}
+}
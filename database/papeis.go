@@ -0,0 +1,56 @@
+package database
+
+// Esse arquivo define os papéis dos usuários, que determinam suas permissões
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Papéis possíveis de um usuário. Clientes têm acesso apenas aos próprios
+// dados; suporte e administradores formam a equipe da RedCoins.
+const (
+	PapelCliente = "cliente"
+	PapelSuporte = "suporte"
+	PapelAdmin   = "admin"
+)
+
+// Lista de possíveis erros dos papéis
+var (
+	ErrPapelInvalido = errors.New("papel_invalido")
+)
+
+// PapelValido retorna se 'papel' é um dos papéis possíveis
+func PapelValido(papel string) bool {
+	return papel == PapelCliente || papel == PapelSuporte || papel == PapelAdmin
+}
+
+// AlteraPapelUsuario altera o papel do usuário do e-mail passado. Retorna
+// ErrPapelInvalido se o papel não existe e ErrUsuarioNaoExiste se o usuário
+// não existe.
+func AlteraPapelUsuario(email string, papel string) error {
+	if !PapelValido(papel) {
+		return ErrPapelInvalido
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := adquireUsuarioIDDeEmail(tx, email); err != nil {
+		tx.Rollback()
+		return err
+	}
+	sqlCode := `UPDATE usuario SET papel = ? WHERE email = ?;`
+	if _, err := tx.Exec(sqlCode, papel, email); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
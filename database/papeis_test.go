@@ -0,0 +1,26 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestAlteraPapelUsuario(t *testing.T) {
+	if err := AlteraPapelUsuario("valido3@gmail.com", PapelSuporte); err != nil {
+		t.Fatalf("Erro inesperado ao alterar papel: %v", err)
+	}
+	usr, err := AdquireUsuario("valido3@gmail.com")
+	if err != nil || usr.Papel != PapelSuporte {
+		t.Errorf("Papel inesperado: %v (%v)", usr.Papel, err)
+	}
+	if err := AlteraPapelUsuario("valido3@gmail.com", PapelCliente); err != nil {
+		t.Fatalf("Erro inesperado ao alterar papel: %v", err)
+	}
+
+	// Papel e usuário inexistentes
+	if err := AlteraPapelUsuario("valido3@gmail.com", "gerente"); err != ErrPapelInvalido {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := AlteraPapelUsuario("naoexistente@gmail.com", PapelAdmin); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
@@ -0,0 +1,285 @@
+package database
+
+// Esse arquivo define funções para os planos de compra recorrente de Bitcoins
+// e para o registro das execuções desses planos
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Erros possíveis dos planos de compra recorrente
+var (
+	ErrPlanoNaoExiste = errors.New("plano_nao_existente")
+)
+
+// Estados possíveis de um plano de compra recorrente
+const (
+	PlanoAtivo    = "ativo"
+	PlanoPausado  = "pausado"
+	PlanoRemovido = "removido"
+)
+
+// Plano é a estrutura com os dados de um plano de compra recorrente. 'Valor' é
+// o valor em reais a ser gasto em cada execução. 'Frequencia' pode ser
+// "semanal", "mensal" ou "cron", sendo que no último caso 'Expressao' contém a
+// expressão cron do plano. 'ProximaExecucao' está no formato
+// "YYYY-MM-DD HH:MM:SS".
+type Plano struct {
+	ID              int64   `json:"id"`
+	Usuario         string  `json:"usuario"`
+	Valor           float64 `json:"valor"`
+	Frequencia      string  `json:"frequencia"`
+	Expressao       string  `json:"expressao,omitempty"`
+	Estado          string  `json:"estado"`
+	ProximaExecucao string  `json:"proximaExecucao"`
+}
+
+// ExecucaoPlano é a estrutura com o resultado de uma execução de um plano de
+// compra recorrente. 'Resultado' é "sucesso" ou o código do erro que impediu a
+// compra.
+type ExecucaoPlano struct {
+	Momento   string  `json:"momento"`
+	Sucesso   bool    `json:"sucesso"`
+	Resultado string  `json:"resultado"`
+	Bitcoins  float64 `json:"bitcoins"`
+	Creditos  float64 `json:"creditos"`
+}
+
+// InserePlano cria um novo plano de compra recorrente ativo para o usuário do
+// campo 'Usuario' do plano. O ID gerado é armazenado no campo 'ID'.
+func InserePlano(p *Plano) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	usrID, err := adquireUsuarioIDDeEmail(tx, p.Usuario)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	sqlCode := `INSERT INTO plano
+		(usuario_id, valor, frequencia, expressao, estado, proxima_execucao)
+		VALUES (?, ?, ?, ?, ?, ?);`
+	res, err := tx.Exec(sqlCode, usrID, fmt.Sprintf("%18.9f", p.Valor),
+		p.Frequencia, p.Expressao, PlanoAtivo, p.ProximaExecucao)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if p.ID, err = res.LastInsertId(); err != nil {
+		tx.Rollback()
+		return err
+	}
+	p.Estado = PlanoAtivo
+	return tx.Commit()
+}
+
+// AdquirePlanosDeUsuario adquire todos os planos não removidos de um usuário
+// identificado pelo seu e-mail
+func AdquirePlanosDeUsuario(email string) ([]Plano, error) {
+	sqlCode := `SELECT
+		p.id, u.email, p.valor, p.frequencia, p.expressao, p.estado, p.proxima_execucao
+		FROM plano AS p
+		INNER JOIN usuario AS u ON u.id = p.usuario_id
+		WHERE u.email=? AND p.estado<>?
+		ORDER BY p.id;`
+	return adquirePlanos(sqlCode, email, PlanoRemovido)
+}
+
+// AdquirePlanosPendentes adquire todos os planos ativos cuja próxima execução
+// é anterior ou igual a 'momento' ("YYYY-MM-DD HH:MM:SS")
+func AdquirePlanosPendentes(momento string) ([]Plano, error) {
+	sqlCode := `SELECT
+		p.id, u.email, p.valor, p.frequencia, p.expressao, p.estado, p.proxima_execucao
+		FROM plano AS p
+		INNER JOIN usuario AS u ON u.id = p.usuario_id
+		WHERE p.estado=? AND p.proxima_execucao<=?
+		ORDER BY p.proxima_execucao, p.id;`
+	return adquirePlanos(sqlCode, PlanoAtivo, momento)
+}
+
+// AdquireExecucoesPlano adquire o histórico de execuções de um plano do usuário
+// do e-mail passado, da mais recente para a mais antiga
+func AdquireExecucoesPlano(email string, id int64) ([]ExecucaoPlano, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlCode := `SELECT e.momento, e.sucesso, e.resultado, e.bitcoins, e.creditos
+		FROM execucao_plano AS e
+		INNER JOIN plano AS p ON p.id = e.plano_id
+		INNER JOIN usuario AS u ON u.id = p.usuario_id
+		WHERE e.plano_id=? AND u.email=?
+		ORDER BY e.momento DESC, e.id DESC;`
+	rows, err := db.Query(sqlCode, id, email)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	execucoes := make([]ExecucaoPlano, 0)
+	for rows.Next() {
+		ex := ExecucaoPlano{}
+		sucesso := make([]uint8, 1)
+		if err := rows.Scan(&ex.Momento, &sucesso, &ex.Resultado, &ex.Bitcoins, &ex.Creditos); err != nil {
+			return nil, err
+		}
+		ex.Sucesso = sucesso[0] == 1
+		execucoes = append(execucoes, ex)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return execucoes, nil
+}
+
+// AlteraEstadoPlano altera o estado de um plano não removido pertencente ao
+// usuário do e-mail passado. Retorna ErrPlanoNaoExiste se o plano não existe,
+// já foi removido ou pertence a outro usuário.
+func AlteraEstadoPlano(email string, id int64, estado string) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+
+	sqlCode := `UPDATE plano AS p
+		INNER JOIN usuario AS u ON u.id = p.usuario_id
+		SET p.estado=?
+		WHERE p.id=? AND u.email=? AND p.estado<>?;`
+	res, err := db.Exec(sqlCode, estado, id, email, PlanoRemovido)
+	if err != nil {
+		return err
+	}
+	return verificaLinhaAfetada(db, res, id, email)
+}
+
+// RetomaPlano reativa um plano pausado do usuário do e-mail passado, definindo
+// sua próxima execução como 'proxima'. Retorna ErrPlanoNaoExiste se o plano não
+// existe, foi removido ou pertence a outro usuário.
+func RetomaPlano(email string, id int64, proxima string) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+
+	sqlCode := `UPDATE plano AS p
+		INNER JOIN usuario AS u ON u.id = p.usuario_id
+		SET p.estado=?, p.proxima_execucao=?
+		WHERE p.id=? AND u.email=? AND p.estado<>?;`
+	res, err := db.Exec(sqlCode, PlanoAtivo, proxima, id, email, PlanoRemovido)
+	if err != nil {
+		return err
+	}
+	return verificaLinhaAfetada(db, res, id, email)
+}
+
+// AvancaPlano atualiza a próxima execução de um plano para 'proxima' somente se
+// a próxima execução atual ainda é 'anterior'. Retorna se a atualização foi
+// feita, o que permite que apenas um agendador execute cada ocorrência do
+// plano.
+func AvancaPlano(id int64, anterior string, proxima string) (bool, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return false, err
+	}
+
+	sqlCode := `UPDATE plano SET proxima_execucao=?
+		WHERE id=? AND proxima_execucao=? AND estado=?;`
+	res, err := db.Exec(sqlCode, proxima, id, anterior, PlanoAtivo)
+	if err != nil {
+		return false, err
+	}
+	qtd, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return qtd == 1, nil
+}
+
+// RegistraExecucaoPlano armazena o resultado de uma execução de um plano
+func RegistraExecucaoPlano(id int64, ex ExecucaoPlano) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+
+	sqlCode := `INSERT INTO execucao_plano
+		(plano_id, momento, sucesso, resultado, bitcoins, creditos)
+		VALUES (?, ?, ?, ?, ?, ?);`
+	var intSucesso uint8
+	if ex.Sucesso {
+		intSucesso = 1
+	}
+	_, err = db.Exec(sqlCode, id, ex.Momento, intSucesso, ex.Resultado,
+		fmt.Sprintf("%15.8f", ex.Bitcoins), fmt.Sprintf("%18.9f", ex.Creditos))
+	return err
+}
+
+// adquirePlanos executa uma busca na tabela 'plano' que retorna as colunas na
+// ordem id, email, valor, frequencia, expressao, estado e proxima_execucao
+func adquirePlanos(sqlCode string, args ...interface{}) ([]Plano, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(sqlCode, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	planos := make([]Plano, 0)
+	for rows.Next() {
+		p := Plano{}
+		if err := rows.Scan(&p.ID, &p.Usuario, &p.Valor, &p.Frequencia,
+			&p.Expressao, &p.Estado, &p.ProximaExecucao); err != nil {
+			return nil, err
+		}
+		planos = append(planos, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return planos, nil
+}
+
+// verificaLinhaAfetada retorna ErrPlanoNaoExiste caso nenhuma linha tenha sido
+// afetada pelo UPDATE e o plano de fato não exista para o usuário. O MySQL não
+// conta como afetadas as linhas em que os valores não mudaram, por isso a
+// existência do plano é verificada separadamente.
+func verificaLinhaAfetada(db *sql.DB, res sql.Result, id int64, email string) error {
+	qtd, err := res.RowsAffected()
+	if err != nil {
+		return err
+	} else if qtd > 0 {
+		return nil
+	}
+	sqlCode := `SELECT COUNT(*)
+		FROM plano AS p
+		INNER JOIN usuario AS u ON u.id = p.usuario_id
+		WHERE p.id=? AND u.email=? AND p.estado<>?;`
+	if err := db.QueryRow(sqlCode, id, email, PlanoRemovido).Scan(&qtd); err != nil {
+		return err
+	} else if qtd == 0 {
+		return ErrPlanoNaoExiste
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package database
+
+import "testing"
+
+func TestInserePlano(t *testing.T) {
+	p := Plano{
+		Usuario:         "valido2@gmail.com",
+		Valor:           100,
+		Frequencia:      "semanal",
+		ProximaExecucao: "2018-01-01 09:00:00",
+	}
+	if err := InserePlano(&p); err != nil {
+		t.Fatalf("Erro inesperado ao inserir plano: %v", err)
+	}
+	if p.ID == 0 || p.Estado != PlanoAtivo {
+		t.Errorf("Plano inserido incorretamente: %v", p)
+	}
+
+	// Usuário inexistente
+	p.Usuario = "naoexistente@gmail.com"
+	if err := InserePlano(&p); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado ao inserir plano: %v", err)
+	}
+}
+
+func TestAvancaPlano(t *testing.T) {
+	p := Plano{
+		Usuario:         "valido3@gmail.com",
+		Valor:           50,
+		Frequencia:      "mensal",
+		ProximaExecucao: "2018-01-01 09:00:00",
+	}
+	if err := InserePlano(&p); err != nil {
+		t.Fatalf("Erro inesperado ao inserir plano: %v", err)
+	}
+
+	// O plano deve estar pendente
+	pendentes, err := AdquirePlanosPendentes("2018-01-01 09:00:00")
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	encontrado := false
+	for _, pendente := range pendentes {
+		encontrado = encontrado || pendente.ID == p.ID
+	}
+	if !encontrado {
+		t.Errorf("Plano não está pendente: %v", pendentes)
+	}
+
+	// Apenas o primeiro avanço a partir da mesma execução deve ocorrer
+	if avancado, err := AvancaPlano(p.ID, p.ProximaExecucao, "2018-02-01 09:00:00"); err != nil || !avancado {
+		t.Errorf("Plano não foi avançado: %v", err)
+	}
+	if avancado, err := AvancaPlano(p.ID, p.ProximaExecucao, "2018-02-01 09:00:00"); err != nil || avancado {
+		t.Errorf("Plano foi avançado duas vezes: %v", err)
+	}
+
+	// Registro de execução
+	ex := ExecucaoPlano{Momento: "2018-01-01 09:00:05", Resultado: "preco_indisponivel"}
+	if err := RegistraExecucaoPlano(p.ID, ex); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	execucoes, err := AdquireExecucoesPlano("valido3@gmail.com", p.ID)
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	} else if len(execucoes) != 1 || execucoes[0].Resultado != ex.Resultado || execucoes[0].Sucesso {
+		t.Errorf("Execuções incorretas: %v", execucoes)
+	}
+
+	// Plano pausado não é alterado por outro usuário
+	if err := AlteraEstadoPlano("valido1@gmail.com", p.ID, PlanoPausado); err != ErrPlanoNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package database
+
+// Esse arquivo define funções para as regras de negociação do mercado
+
+import "database/sql"
+
+// RegrasMercado é a estrutura com as regras de negociação do mercado.
+// 'QtdMinima' e 'QtdMaxima' limitam a quantidade de Bitcoins de uma transação,
+// 'Passo' é o incremento mínimo da quantidade (a quantidade deve ser um
+// múltiplo do passo), 'ValorMinimo' é o valor mínimo em reais de uma transação
+// e 'CasasDecimais' é o número máximo de casas decimais da quantidade.
+type RegrasMercado struct {
+	QtdMinima     float64 `json:"qtdMinima"`
+	QtdMaxima     float64 `json:"qtdMaxima"`
+	Passo         float64 `json:"passo"`
+	ValorMinimo   float64 `json:"valorMinimo"`
+	CasasDecimais int     `json:"casasDecimais"`
+}
+
+// AdquireRegrasMercado adquire as regras de negociação do mercado
+func AdquireRegrasMercado() (RegrasMercado, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return RegrasMercado{}, err
+	}
+
+	sqlCode := `SELECT qtd_minima, qtd_maxima, passo, valor_minimo, casas_decimais
+		FROM regra_mercado
+		WHERE id=1;`
+	var regras RegrasMercado
+	err = db.QueryRow(sqlCode).Scan(
+		&regras.QtdMinima,
+		&regras.QtdMaxima,
+		&regras.Passo,
+		&regras.ValorMinimo,
+		&regras.CasasDecimais)
+	return regras, err
+}
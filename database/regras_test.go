@@ -0,0 +1,20 @@
+package database
+
+import "testing"
+
+func TestAdquireRegrasMercado(t *testing.T) {
+	regras, err := AdquireRegrasMercado()
+	if err != nil {
+		t.Fatalf("Erro inesperado ao adquirir regras: %v", err)
+	}
+	esperado := RegrasMercado{
+		QtdMinima:     0.00001,
+		QtdMaxima:     10000,
+		Passo:         0.00000001,
+		ValorMinimo:   1,
+		CasasDecimais: 8,
+	}
+	if regras != esperado {
+		t.Errorf("Regras de mercado incorretas: %v", regras)
+	}
+}
@@ -0,0 +1,167 @@
+package database
+
+// Esse arquivo define a busca de transações com filtros e paginação utilizada
+// pelos relatórios
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// errFimPercurso é utilizado internamente para interromper um percurso de
+// transações sem indicar um erro
+var errFimPercurso = errors.New("fim do percurso")
+
+// FiltroTransacoes define os filtros de uma busca de transações. Campos vazios
+// ou zerados não filtram as transações.
+type FiltroTransacoes struct {
+	// Email é o e-mail do usuário das transações
+	Email string
+	// Inicio e Fim limitam a data das transações ("YYYY-MM-DD HH:MM:SS"),
+	// sendo 'Inicio' inclusivo e 'Fim' exclusivo
+	Inicio string
+	Fim    string
+	// Tipo é "compra" ou "venda"
+	Tipo string
+	// ValorMinimo e ValorMaximo limitam o valor em reais das transações
+	ValorMinimo float64
+	ValorMaximo float64
+	// Apos faz com que apenas as transações posteriores ao cursor sejam
+	// retornadas
+	Apos Cursor
+	// Limite é a quantidade máxima de transações retornadas
+	Limite int
+}
+
+// Cursor identifica a posição de uma transação na ordenação dos relatórios,
+// que é pela data e, em seguida, pelo ID da transação. O cursor zerado indica o
+// início (ou, quando retornado por uma busca, o fim) dos resultados.
+type Cursor struct {
+	Dia string
+	ID  int64
+}
+
+// Vazio retorna se o cursor está zerado
+func (c Cursor) Vazio() bool {
+	return c.Dia == "" && c.ID == 0
+}
+
+// AdquireTransacoesFiltradas adquire as transações que atendem aos filtros em
+// ordem de data e ID. Se há mais transações além do limite do filtro, retorna
+// também o cursor da última transação retornada, a ser utilizado na busca da
+// próxima página; caso contrário, o cursor retornado é zerado.
+func AdquireTransacoesFiltradas(f FiltroTransacoes) ([]Transacao, Cursor, error) {
+	transacoes := make([]Transacao, 0)
+	proximo := Cursor{}
+	err := percorreTransacoes(f, func(id int64, tr Transacao) error {
+		// A busca retorna uma transação além do limite para indicar que há
+		// uma próxima página
+		if f.Limite > 0 && len(transacoes) == f.Limite {
+			return errFimPercurso
+		}
+		transacoes = append(transacoes, tr)
+		proximo = Cursor{Dia: tr.Dia, ID: id}
+		return nil
+	})
+	if err == errFimPercurso {
+		return transacoes, proximo, nil
+	} else if err != nil {
+		return nil, Cursor{}, err
+	}
+	return transacoes, Cursor{}, nil
+}
+
+// PercorreTransacoesFiltradas chama 'f' para cada transação que atende aos
+// filtros, em ordem de data e ID, sem armazenar as transações em memória. O
+// percurso é interrompido no primeiro erro retornado por 'f', que é então
+// retornado.
+func PercorreTransacoesFiltradas(filtro FiltroTransacoes, f func(Transacao) error) error {
+	return percorreTransacoes(filtro, func(_ int64, tr Transacao) error {
+		return f(tr)
+	})
+}
+
+// percorreTransacoes executa a busca de transações com os filtros passados e
+// chama 'f' com o ID e os dados de cada transação encontrada
+func percorreTransacoes(filtro FiltroTransacoes, f func(int64, Transacao) error) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+
+	sqlCode, args := montaBuscaTransacoes(filtro)
+	rows, err := db.Query(sqlCode, args...)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		tr := Transacao{}
+		compra := make([]uint8, 1)
+		if err := rows.Scan(&id, &tr.Usuario, &compra, &tr.Creditos, &tr.Bitcoins, &tr.Dia); err != nil {
+			return err
+		}
+		tr.Compra = compra[0] == 1
+		if err := f(id, tr); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// montaBuscaTransacoes monta o código SQL e os argumentos da busca de
+// transações com os filtros passados. As condições utilizam as indexes
+// (usuario_id, dia, id) e (dia, id) da tabela 'transacao'.
+func montaBuscaTransacoes(f FiltroTransacoes) (string, []interface{}) {
+	condicoes := make([]string, 0)
+	args := make([]interface{}, 0)
+	if f.Email != "" {
+		condicoes = append(condicoes, "u.email=?")
+		args = append(args, f.Email)
+	}
+	if f.Inicio != "" {
+		condicoes = append(condicoes, "t.dia >= ?")
+		args = append(args, f.Inicio)
+	}
+	if f.Fim != "" {
+		condicoes = append(condicoes, "t.dia < ?")
+		args = append(args, f.Fim)
+	}
+	switch f.Tipo {
+	case "compra":
+		condicoes = append(condicoes, "t.compra = 1")
+	case "venda":
+		condicoes = append(condicoes, "t.compra = 0")
+	}
+	if f.ValorMinimo > 0 {
+		condicoes = append(condicoes, "t.creditos >= ?")
+		args = append(args, fmt.Sprintf("%18.9f", f.ValorMinimo))
+	}
+	if f.ValorMaximo > 0 {
+		condicoes = append(condicoes, "t.creditos <= ?")
+		args = append(args, fmt.Sprintf("%18.9f", f.ValorMaximo))
+	}
+	if !f.Apos.Vazio() {
+		condicoes = append(condicoes, "(t.dia > ? OR (t.dia = ? AND t.id > ?))")
+		args = append(args, f.Apos.Dia, f.Apos.Dia, f.Apos.ID)
+	}
+
+	sqlCode := `SELECT
+		t.id, u.email, t.compra, t.creditos, t.bitcoins, t.dia
+		FROM transacao AS t
+		INNER JOIN usuario AS u ON u.id = t.usuario_id`
+	if len(condicoes) > 0 {
+		sqlCode += "\n\t\tWHERE " + strings.Join(condicoes, " AND ")
+	}
+	sqlCode += "\n\t\tORDER BY t.dia, t.id"
+	if f.Limite > 0 {
+		sqlCode += "\n\t\tLIMIT ?"
+		args = append(args, f.Limite+1)
+	}
+	return sqlCode + ";", args
+}
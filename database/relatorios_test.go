@@ -0,0 +1,73 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestAdquireTransacoesFiltradas(t *testing.T) {
+	// Primeira página com as duas transações mais antigas de 2018
+	filtro := FiltroTransacoes{Inicio: "2018-01-01 00:00:00", Limite: 2}
+	transacoes, proximo, err := AdquireTransacoesFiltradas(filtro)
+	if err != nil {
+		t.Fatalf("Erro inesperado ao adquirir transações: %v", err)
+	}
+	valorEsperado := `[{valido1@gmail.com true 10 0.004 2018-01-01 00:00:00} ` +
+		`{valido2@gmail.com true 20 0.003 2018-01-02 00:00:00}]`
+	if valorEsperado != fmt.Sprintf("%v", transacoes) {
+		t.Errorf("Lista de transações possui valor inesperado: %v", transacoes)
+	}
+	if proximo != (Cursor{Dia: "2018-01-02 00:00:00", ID: 2}) {
+		t.Errorf("Cursor inesperado: %v", proximo)
+	}
+
+	// Segunda e última página
+	filtro.Apos = proximo
+	transacoes, proximo, err = AdquireTransacoesFiltradas(filtro)
+	if err != nil {
+		t.Fatalf("Erro inesperado ao adquirir transações: %v", err)
+	}
+	valorEsperado = `[{valido1@gmail.com false 30 0.002 2018-01-02 00:00:00} ` +
+		`{valido2@gmail.com false 40 0.001 2018-01-03 00:00:00}]`
+	if valorEsperado != fmt.Sprintf("%v", transacoes) {
+		t.Errorf("Lista de transações possui valor inesperado: %v", transacoes)
+	}
+	if !proximo.Vazio() {
+		t.Errorf("Cursor inesperado: %v", proximo)
+	}
+
+	// Filtros por usuário, tipo e valor
+	filtro = FiltroTransacoes{Email: "valido2@gmail.com", Tipo: "venda", ValorMinimo: 35, ValorMaximo: 45}
+	transacoes, _, err = AdquireTransacoesFiltradas(filtro)
+	if err != nil {
+		t.Fatalf("Erro inesperado ao adquirir transações: %v", err)
+	}
+	valorEsperado = `[{valido2@gmail.com false 40 0.001 2018-01-03 00:00:00}]`
+	if valorEsperado != fmt.Sprintf("%v", transacoes) {
+		t.Errorf("Lista de transações possui valor inesperado: %v", transacoes)
+	}
+}
+
+func TestPercorreTransacoesFiltradas(t *testing.T) {
+	// Percorre as vendas de 2018 e interrompe o percurso na primeira
+	filtro := FiltroTransacoes{Inicio: "2018-01-01 00:00:00", Tipo: "venda"}
+	creditos := make([]float64, 0)
+	err := PercorreTransacoesFiltradas(filtro, func(tr Transacao) error {
+		creditos = append(creditos, tr.Creditos)
+		return nil
+	})
+	if err != nil || fmt.Sprintf("%v", creditos) != "[30 40]" {
+		t.Errorf("Percurso inesperado: %v (%v)", creditos, err)
+	}
+
+	errTeste := errors.New("teste")
+	qtd := 0
+	err = PercorreTransacoesFiltradas(filtro, func(tr Transacao) error {
+		qtd++
+		return errTeste
+	})
+	if err != errTeste || qtd != 1 {
+		t.Errorf("Percurso não interrompido: %v (%v)", qtd, err)
+	}
+}
@@ -0,0 +1,182 @@
+package database
+
+// Esse arquivo define o histórico diário dos saldos dos usuários, utilizado
+// para consultar os saldos em uma data sem percorrer todas as transações
+
+import (
+	"database/sql"
+	"time"
+)
+
+// SaldoHistorico são os saldos de um usuário ao fim de um dia ("YYYY-MM-DD")
+type SaldoHistorico struct {
+	Usuario  string  `json:"usuario"`
+	Dia      string  `json:"dia"`
+	Bitcoins float64 `json:"bitcoins"`
+	Reais    float64 `json:"reais"`
+}
+
+// DivergenciaSaldo é um saldo registrado no histórico que difere do saldo
+// calculado a partir de todas as transações do usuário
+type DivergenciaSaldo struct {
+	Registrado SaldoHistorico `json:"registrado"`
+	Calculado  SaldoHistorico `json:"calculado"`
+}
+
+// RegistraSaldosDia registra no histórico os saldos de todos os usuários ao fim
+// do dia 'dia' ("YYYY-MM-DD"). Os saldos são calculados a partir do último
+// registro anterior de cada usuário e das transações feitas desde então. Se o
+// dia já foi registrado, seus saldos são recalculados.
+func RegistraSaldosDia(dia string) error {
+	fim, err := diaSeguinte(dia)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+
+	sqlCode := `INSERT INTO saldo_historico (usuario_id, dia, bitcoins, reais)
+		SELECT u.id, ?,
+			IFNULL(s.bitcoins, 0) + IFNULL(SUM(IF(t.compra = 1, t.bitcoins, -t.bitcoins)), 0),
+			IFNULL(s.reais, 0) + IFNULL(SUM(IF(t.compra = 1, -t.creditos, t.creditos)), 0)
+		FROM usuario AS u
+		LEFT JOIN saldo_historico AS s ON s.usuario_id = u.id AND s.dia = (
+			SELECT MAX(s2.dia) FROM saldo_historico AS s2
+			WHERE s2.usuario_id = u.id AND s2.dia < ?)
+		LEFT JOIN transacao AS t ON t.usuario_id = u.id AND t.dia < ?
+			AND (s.dia IS NULL OR t.dia >= s.dia + INTERVAL 1 DAY)
+		GROUP BY u.id, s.bitcoins, s.reais
+		ON DUPLICATE KEY UPDATE bitcoins = VALUES(bitcoins), reais = VALUES(reais);`
+	_, err = db.Exec(sqlCode, dia, dia, fim)
+	return err
+}
+
+// AdquireUltimoDiaSaldos retorna o último dia ("YYYY-MM-DD") registrado no
+// histórico de saldos, ou uma string vazia se o histórico está vazio
+func AdquireUltimoDiaSaldos() (string, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return "", err
+	}
+
+	var dia sql.NullString
+	sqlCode := `SELECT MAX(dia) FROM saldo_historico;`
+	if err := db.QueryRow(sqlCode).Scan(&dia); err != nil {
+		return "", err
+	}
+	return dia.String, nil
+}
+
+// AdquireSaldosEm adquire os saldos do usuário do e-mail passado ao fim do dia
+// 'dia' ("YYYY-MM-DD"), combinando o registro mais próximo do histórico com as
+// transações feitas após ele. Retorna, também, o dia do registro utilizado, ou
+// uma string vazia se não havia registro anterior. Retorna ErrUsuarioNaoExiste
+// se o usuário não existe.
+func AdquireSaldosEm(email string, dia string) (SaldoHistorico, string, error) {
+	fim, err := diaSeguinte(dia)
+	if err != nil {
+		return SaldoHistorico{}, "", err
+	}
+
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return SaldoHistorico{}, "", err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return SaldoHistorico{}, "", err
+	}
+	usrID, err := adquireUsuarioIDDeEmail(tx, email)
+	if err != nil {
+		tx.Rollback()
+		return SaldoHistorico{}, "", err
+	}
+
+	// Registro mais próximo do histórico
+	saldo := SaldoHistorico{Usuario: email, Dia: dia}
+	registro, inicio := "", "1000-01-01 00:00:00"
+	sqlCode := `SELECT dia, bitcoins, reais FROM saldo_historico
+		WHERE usuario_id = ? AND dia <= ?
+		ORDER BY dia DESC
+		LIMIT 1;`
+	err = tx.QueryRow(sqlCode, usrID, dia).Scan(&registro, &saldo.Bitcoins, &saldo.Reais)
+	if err == nil {
+		if inicio, err = diaSeguinte(registro); err != nil {
+			tx.Rollback()
+			return SaldoHistorico{}, "", err
+		}
+	} else if err != sql.ErrNoRows {
+		tx.Rollback()
+		return SaldoHistorico{}, "", err
+	}
+
+	// Transações posteriores ao registro
+	var bitcoins, reais float64
+	sqlCode = `SELECT
+		IFNULL(SUM(IF(compra = 1, bitcoins, -bitcoins)), 0),
+		IFNULL(SUM(IF(compra = 1, -creditos, creditos)), 0)
+		FROM transacao
+		WHERE usuario_id = ? AND dia >= ? AND dia < ?;`
+	if err := tx.QueryRow(sqlCode, usrID, inicio, fim).Scan(&bitcoins, &reais); err != nil {
+		tx.Rollback()
+		return SaldoHistorico{}, "", err
+	}
+	saldo.Bitcoins += bitcoins
+	saldo.Reais += reais
+	return saldo, registro, tx.Commit()
+}
+
+// VerificaSaldosHistorico compara cada registro do histórico de saldos com os
+// saldos calculados a partir de todas as transações do usuário até o fim do
+// dia registrado e retorna os registros divergentes
+func VerificaSaldosHistorico() ([]DivergenciaSaldo, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlCode := `SELECT u.email, s.dia, s.bitcoins, s.reais,
+		IFNULL(SUM(IF(t.compra = 1, t.bitcoins, -t.bitcoins)), 0) AS calculado_bitcoins,
+		IFNULL(SUM(IF(t.compra = 1, -t.creditos, t.creditos)), 0) AS calculado_reais
+		FROM saldo_historico AS s
+		INNER JOIN usuario AS u ON u.id = s.usuario_id
+		LEFT JOIN transacao AS t ON t.usuario_id = s.usuario_id
+			AND t.dia < s.dia + INTERVAL 1 DAY
+		GROUP BY s.usuario_id, s.dia, u.email, s.bitcoins, s.reais
+		HAVING s.bitcoins <> calculado_bitcoins OR s.reais <> calculado_reais
+		ORDER BY s.dia, u.email;`
+	rows, err := db.Query(sqlCode)
+	if err != nil {
+		return nil, err
+	}
+
+	divergencias := make([]DivergenciaSaldo, 0)
+	defer rows.Close()
+	for rows.Next() {
+		d := DivergenciaSaldo{}
+		if err := rows.Scan(&d.Registrado.Usuario, &d.Registrado.Dia, &d.Registrado.Bitcoins,
+			&d.Registrado.Reais, &d.Calculado.Bitcoins, &d.Calculado.Reais); err != nil {
+			return nil, err
+		}
+		d.Calculado.Usuario, d.Calculado.Dia = d.Registrado.Usuario, d.Registrado.Dia
+		divergencias = append(divergencias, d)
+	}
+	return divergencias, rows.Err()
+}
+
+// diaSeguinte retorna o início do dia seguinte ao dia "YYYY-MM-DD" passado, no
+// formato DATETIME
+func diaSeguinte(dia string) (string, error) {
+	t, err := time.Parse("2006-01-02", dia)
+	if err != nil {
+		return "", err
+	}
+	return t.AddDate(0, 0, 1).Format(formatoDatetime), nil
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestSaldosHistorico(t *testing.T) {
+	// valido1@gmail.com comprou 0.004 Bitcoins por 10 reais em 2018-01-01 e
+	// vendeu 0.002 Bitcoins por 30 reais em 2018-01-02
+	if err := RegistraSaldosDia("2018-01-01"); err != nil {
+		t.Fatalf("Erro inesperado ao registrar saldos: %v", err)
+	}
+	if dia, err := AdquireUltimoDiaSaldos(); err != nil || dia != "2018-01-01" {
+		t.Errorf("Último dia inesperado: %v (%v)", dia, err)
+	}
+
+	// Registro do dia anterior combinado com as transações do dia
+	saldo, registro, err := AdquireSaldosEm("valido1@gmail.com", "2018-01-02")
+	if err != nil {
+		t.Fatalf("Erro inesperado ao adquirir saldos: %v", err)
+	}
+	if saldo.Bitcoins != 0.002 || saldo.Reais != 20 || registro != "2018-01-01" {
+		t.Errorf("Saldos inesperados: %v (registro %v)", saldo, registro)
+	}
+
+	// Registro incremental a partir do registro anterior
+	if err := RegistraSaldosDia("2018-01-02"); err != nil {
+		t.Fatalf("Erro inesperado ao registrar saldos: %v", err)
+	}
+	saldo, registro, err = AdquireSaldosEm("valido1@gmail.com", "2018-01-05")
+	if err != nil {
+		t.Fatalf("Erro inesperado ao adquirir saldos: %v", err)
+	}
+	if saldo.Bitcoins != 0.002 || saldo.Reais != 20 || registro != "2018-01-02" {
+		t.Errorf("Saldos inesperados: %v (registro %v)", saldo, registro)
+	}
+
+	// Dia anterior a todos os registros
+	saldo, registro, err = AdquireSaldosEm("valido2@gmail.com", "2017-12-31")
+	if err != nil || saldo.Bitcoins != 0 || saldo.Reais != 0 || registro != "" {
+		t.Errorf("Saldos inesperados: %v (registro %v, erro %v)", saldo, registro, err)
+	}
+	if _, _, err := AdquireSaldosEm("naoexistente@gmail.com", "2018-01-01"); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+func TestVerificaSaldosHistorico(t *testing.T) {
+	if err := RegistraSaldosDia("2018-01-03"); err != nil {
+		t.Fatalf("Erro inesperado ao registrar saldos: %v", err)
+	}
+	divergencias, err := VerificaSaldosHistorico()
+	if err != nil || len(divergencias) != 0 {
+		t.Fatalf("Divergências inesperadas: %v (%v)", divergencias, err)
+	}
+
+	// Altera um registro para criar uma divergência
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	sqlCode := `UPDATE saldo_historico SET reais = reais + 1 WHERE usuario_id = 2 AND dia = "2018-01-03";`
+	if _, err := db.Exec(sqlCode); err != nil {
+		t.Fatalf("%v", err)
+	}
+	divergencias, err = VerificaSaldosHistorico()
+	if err != nil || len(divergencias) != 1 {
+		t.Fatalf("Divergências inesperadas: %v (%v)", divergencias, err)
+	}
+	d := divergencias[0]
+	if d.Registrado.Usuario != "valido2@gmail.com" || d.Registrado.Reais != 21 || d.Calculado.Reais != 20 {
+		t.Errorf("Divergência inesperada: %v", d)
+	}
+
+	// O novo registro do dia corrige a divergência
+	if err := RegistraSaldosDia("2018-01-03"); err != nil {
+		t.Fatalf("Erro inesperado ao registrar saldos: %v", err)
+	}
+	if divergencias, err := VerificaSaldosHistorico(); err != nil || len(divergencias) != 0 {
+		t.Errorf("Divergências inesperadas: %v (%v)", divergencias, err)
+	}
+}
@@ -87,26 +87,106 @@ func criaTabelas() error {
 		return err
 	}
 	// Criação das tabelas individualmente
+	if err := criaTabelaLimite(tx); err != nil {
+		return err
+	}
 	if err := criaTabelaUsuario(tx); err != nil {
 		return err
 	}
 	if err := criaTabelaTransacao(tx); err != nil {
 		return err
 	}
+	if err := criaTabelaRegraMercado(tx); err != nil {
+		return err
+	}
+	if err := criaTabelaPlano(tx); err != nil {
+		return err
+	}
+	if err := criaTabelaExecucaoPlano(tx); err != nil {
+		return err
+	}
+	if err := criaTabelaSaldoHistorico(tx); err != nil {
+		return err
+	}
+	if err := criaTabelaSessao(tx); err != nil {
+		return err
+	}
+	if err := criaTabelaChaveAPI(tx); err != nil {
+		return err
+	}
+	if err := criaTabelaTOTP(tx); err != nil {
+		return err
+	}
+	if err := criaTabelaCodigoRecuperacao(tx); err != nil {
+		return err
+	}
+	if err := criaTabelaTokenUsuario(tx); err != nil {
+		return err
+	}
+	if err := criaTabelaSolicitacaoKYC(tx); err != nil {
+		return err
+	}
+	if err := criaTabelaDocumentoKYC(tx); err != nil {
+		return err
+	}
 
 	return tx.Commit()
 }
 
+// criaTabelaLimite cria a tabela 'limite' no banco de dados que armazena os
+// limites de volume em reais de cada nível de verificação dos usuários e a
+// popula com os limites padrões. Os limites podem ser alterados diretamente no
+// banco de dados.
+// 'por_transacao' é o valor máximo de uma única transação, e 'diario' e
+// 'mensal' são o volume máximo somado de compras e vendas em um dia e em um mês.
+func criaTabelaLimite(tx *sql.Tx) error {
+	sqlCode := `CREATE TABLE limite (
+		nivel TINYINT UNSIGNED NOT NULL,
+		por_transacao DECIMAL(18,9) NOT NULL,
+		diario DECIMAL(18,9) NOT NULL,
+		mensal DECIMAL(18,9) NOT NULL,
+		CONSTRAINT pk_limite_nivel PRIMARY KEY (nivel)
+	) ENGINE=InnoDB;`
+	if _, err := tx.Exec(sqlCode); err != nil {
+		return err
+	}
+	// Limites padrões: 0 para contas não verificadas, 1 para contas com
+	// verificação básica e 2 para contas com verificação completa
+	sqlCode = `INSERT INTO limite
+		(nivel, por_transacao, diario, mensal)
+		VALUES
+			(0, 1000, 2000, 10000),
+			(1, 10000, 20000, 100000),
+			(2, 100000, 500000, 5000000);`
+	if _, err := tx.Exec(sqlCode); err != nil {
+		return err
+	}
+	return nil
+}
+
 // criaTabelaUsuario cria a tabela 'usuario' no banco de dados que armazena
-// os dados cadastrais dos usuários
+// os dados cadastrais dos usuários. 'nivel' é o nível de verificação do
+// usuário, que determina seus limites na tabela 'limite', 'papel' é o papel
+// do usuário no sistema, que determina suas permissões, 'cpf' contém apenas
+// os dígitos do CPF do usuário, nulo enquanto não informado, e 'encerrado_em'
+// é o momento em que a conta foi encerrada e seus dados pessoais anonimizados
+// (nulo se a conta está ativa).
 func criaTabelaUsuario(tx *sql.Tx) error {
 	sqlCode := `CREATE TABLE usuario (
 		id INT(11) UNSIGNED AUTO_INCREMENT,
 		email VARCHAR(128) UNIQUE NOT NULL,
-		senha CHAR(60) NOT NULL,
+		senha VARCHAR(255) NOT NULL,
 		nome VARCHAR(255) NOT NULL,
 		nascimento DATE NOT NULL,
-		CONSTRAINT pk_usuario_id PRIMARY KEY (id)
+		nivel TINYINT UNSIGNED NOT NULL DEFAULT 0,
+		papel ENUM('cliente', 'suporte', 'admin') NOT NULL DEFAULT 'cliente',
+		email_verificado BOOLEAN NOT NULL DEFAULT FALSE,
+		cpf CHAR(11) NULL DEFAULT NULL UNIQUE,
+		encerrado_em DATETIME NULL DEFAULT NULL,
+		CONSTRAINT pk_usuario_id PRIMARY KEY (id),
+		CONSTRAINT fk_usuario_nivel
+			FOREIGN KEY (nivel)
+			REFERENCES limite(nivel)
 	) ENGINE=InnoDB;`
 	if _, err := tx.Exec(sqlCode); err != nil {
 		return err
@@ -126,7 +206,8 @@ func criaTabelaUsuario(tx *sql.Tx) error {
 // pelo usuário na transação, 'bitcoins' indica o mesmo para seu crédito de
 // BitCoins, e 'compra' indica se a transação foi uma compra ou venda de
 // BitCoins (0 = venda; 1 = compra). 'dia' indica quando a transação foi
-// realizada (YYYY-MM-DD).
+// realizada (YYYY-MM-DD HH:MM:SS), no fuso horário configurado para as
+// transações.
 func criaTabelaTransacao(tx *sql.Tx) error {
 	sqlCode := `CREATE TABLE transacao (
 		id INT(11) UNSIGNED AUTO_INCREMENT,
@@ -134,7 +215,7 @@ func criaTabelaTransacao(tx *sql.Tx) error {
 		compra BIT(1) NOT NULL,
 		creditos DECIMAL(18,9) NOT NULL,
 		bitcoins DECIMAL(15,8) NOT NULL,
-		dia DATE NOT NULL,
+		dia DATETIME NOT NULL,
 		CONSTRAINT pk_transacao_id PRIMARY KEY (id),
 		CONSTRAINT fk_transacao_usuario_id
 			FOREIGN KEY (usuario_id)
@@ -144,16 +225,301 @@ func criaTabelaTransacao(tx *sql.Tx) error {
 		return err
 	}
 	// Adiciona uma index no ID do usuário e uma index na coluna de data para
-	// otimizar pesquisas
+	// otimizar pesquisas. Ambas incluem a data e o ID da transação, que são a
+	// ordenação dos relatórios.
 	sqlCode = `ALTER TABLE transacao
-		ADD INDEX idx_transacao_usuario_id (usuario_id);`
+		ADD INDEX idx_transacao_usuario_id (usuario_id, dia, id);`
 	if _, err := tx.Exec(sqlCode); err != nil {
 		return err
 	}
 	sqlCode = `ALTER TABLE transacao
-		ADD INDEX idx_transacao_dia (dia);`
+		ADD INDEX idx_transacao_dia (dia, id);`
+	if _, err := tx.Exec(sqlCode); err != nil {
+		return err
+	}
+	return nil
+}
+
+// criaTabelaRegraMercado cria a tabela 'regra_mercado' no banco de dados que
+// armazena as regras de negociação do mercado e a popula com as regras padrões.
+// A tabela possui uma única linha (id = 1), que pode ser alterada diretamente
+// no banco de dados.
+// 'qtd_minima' e 'qtd_maxima' limitam a quantidade de BitCoins de uma
+// transação, 'passo' é o incremento mínimo da quantidade, 'valor_minimo' é o
+// valor mínimo em reais de uma transação e 'casas_decimais' é o número máximo
+// de casas decimais da quantidade (no máximo 8, a precisão da coluna
+// 'bitcoins' da tabela 'transacao').
+func criaTabelaRegraMercado(tx *sql.Tx) error {
+	sqlCode := `CREATE TABLE regra_mercado (
+		id TINYINT UNSIGNED NOT NULL,
+		qtd_minima DECIMAL(15,8) NOT NULL,
+		qtd_maxima DECIMAL(15,8) NOT NULL,
+		passo DECIMAL(15,8) NOT NULL,
+		valor_minimo DECIMAL(18,9) NOT NULL,
+		casas_decimais TINYINT UNSIGNED NOT NULL,
+		CONSTRAINT pk_regra_mercado_id PRIMARY KEY (id),
+		CONSTRAINT ck_regra_mercado_casas_decimais CHECK (casas_decimais <= 8)
+	) ENGINE=InnoDB;`
+	if _, err := tx.Exec(sqlCode); err != nil {
+		return err
+	}
+	sqlCode = `INSERT INTO regra_mercado
+		(id, qtd_minima, qtd_maxima, passo, valor_minimo, casas_decimais)
+		VALUES (1, 0.00001, 10000, 0.00000001, 1, 8);`
+	if _, err := tx.Exec(sqlCode); err != nil {
+		return err
+	}
+	return nil
+}
+
+// criaTabelaPlano cria a tabela 'plano' no banco de dados que armazena os
+// planos de compra recorrente dos usuários.
+// 'valor' é o valor em reais gasto em cada execução, 'frequencia' é "semanal",
+// "mensal" ou "cron" (com a expressão cron em 'expressao'), 'estado' é
+// "ativo", "pausado" ou "removido" e 'proxima_execucao' indica quando o plano
+// deve ser executado novamente.
+func criaTabelaPlano(tx *sql.Tx) error {
+	sqlCode := `CREATE TABLE plano (
+		id INT(11) UNSIGNED AUTO_INCREMENT,
+		usuario_id INT(11) UNSIGNED NOT NULL,
+		valor DECIMAL(18,9) NOT NULL,
+		frequencia VARCHAR(16) NOT NULL,
+		expressao VARCHAR(128) NOT NULL DEFAULT '',
+		estado VARCHAR(16) NOT NULL,
+		proxima_execucao DATETIME NOT NULL,
+		CONSTRAINT pk_plano_id PRIMARY KEY (id),
+		CONSTRAINT fk_plano_usuario_id
+			FOREIGN KEY (usuario_id)
+			REFERENCES usuario(id)
+	) ENGINE=InnoDB;`
+	if _, err := tx.Exec(sqlCode); err != nil {
+		return err
+	}
+	// Adiciona uma index para a busca de planos pendentes pelo agendador
+	sqlCode = `ALTER TABLE plano
+		ADD INDEX idx_plano_estado_proxima_execucao (estado, proxima_execucao);`
+	if _, err := tx.Exec(sqlCode); err != nil {
+		return err
+	}
+	return nil
+}
+
+// criaTabelaExecucaoPlano cria a tabela 'execucao_plano' no banco de dados que
+// armazena o resultado de cada execução dos planos de compra recorrente.
+// 'resultado' é "sucesso" ou o código do erro que impediu a compra, e
+// 'bitcoins' e 'creditos' são os valores da compra efetuada (zero se a compra
+// não foi efetuada).
+func criaTabelaExecucaoPlano(tx *sql.Tx) error {
+	sqlCode := `CREATE TABLE execucao_plano (
+		id INT(11) UNSIGNED AUTO_INCREMENT,
+		plano_id INT(11) UNSIGNED NOT NULL,
+		momento DATETIME NOT NULL,
+		sucesso BIT(1) NOT NULL,
+		resultado VARCHAR(64) NOT NULL,
+		bitcoins DECIMAL(15,8) NOT NULL,
+		creditos DECIMAL(18,9) NOT NULL,
+		CONSTRAINT pk_execucao_plano_id PRIMARY KEY (id),
+		CONSTRAINT fk_execucao_plano_plano_id
+			FOREIGN KEY (plano_id)
+			REFERENCES plano(id)
+	) ENGINE=InnoDB;`
+	if _, err := tx.Exec(sqlCode); err != nil {
+		return err
+	}
+	sqlCode = `ALTER TABLE execucao_plano
+		ADD INDEX idx_execucao_plano_plano_id (plano_id);`
+	if _, err := tx.Exec(sqlCode); err != nil {
+		return err
+	}
+	return nil
+}
+
+// criaTabelaSaldoHistorico cria a tabela 'saldo_historico' no banco de dados
+// que armazena os saldos de cada usuário ao fim de cada dia, registrados
+// diariamente. 'bitcoins' e 'reais' consideram todas as transações anteriores
+// ao dia seguinte a 'dia'; o saldo em reais é o valor líquido das transações.
+func criaTabelaSaldoHistorico(tx *sql.Tx) error {
+	sqlCode := `CREATE TABLE saldo_historico (
+		usuario_id INT(11) UNSIGNED NOT NULL,
+		dia DATE NOT NULL,
+		bitcoins DECIMAL(21,8) NOT NULL,
+		reais DECIMAL(24,9) NOT NULL,
+		CONSTRAINT pk_saldo_historico PRIMARY KEY (usuario_id, dia),
+		CONSTRAINT fk_saldo_historico_usuario_id
+			FOREIGN KEY (usuario_id)
+			REFERENCES usuario(id)
+	) ENGINE=InnoDB;`
+	if _, err := tx.Exec(sqlCode); err != nil {
+		return err
+	}
+	return nil
+}
+
+// criaTabelaSessao cria a tabela 'sessao' no banco de dados que armazena as
+// sessões dos usuários. 'id' identifica a sessão nos tokens de acesso,
+// 'renovacao' é o hash SHA-256 (em hexadecimal) do token de renovação atual,
+// 'expira' é a expiração do token de renovação e 'revogada_em' é o momento em
+// que a sessão foi revogada (nulo se ainda é válida).
+func criaTabelaSessao(tx *sql.Tx) error {
+	sqlCode := `CREATE TABLE sessao (
+		id CHAR(32) NOT NULL,
+		usuario_id INT(11) UNSIGNED NOT NULL,
+		renovacao CHAR(64) NOT NULL,
+		criada DATETIME NOT NULL,
+		expira DATETIME NOT NULL,
+		revogada_em DATETIME NULL DEFAULT NULL,
+		CONSTRAINT pk_sessao_id PRIMARY KEY (id),
+		CONSTRAINT uq_sessao_renovacao UNIQUE (renovacao),
+		CONSTRAINT fk_sessao_usuario_id
+			FOREIGN KEY (usuario_id)
+			REFERENCES usuario(id)
+	) ENGINE=InnoDB;`
+	if _, err := tx.Exec(sqlCode); err != nil {
+		return err
+	}
+	sqlCode = `ALTER TABLE sessao
+		ADD INDEX idx_sessao_revogada_em (revogada_em);`
 	if _, err := tx.Exec(sqlCode); err != nil {
 		return err
 	}
 	return nil
 }
+
+// criaTabelaChaveAPI cria a tabela 'chave_api' no banco de dados que armazena
+// as chaves de API dos usuários. 'id' é o identificador público da chave,
+// enviado nos pedidos, e 'segredo' é a chave HMAC (em hexadecimal) com a qual
+// os pedidos são assinados. 'ips' é a lista, separada por vírgulas, de IPs ou
+// redes CIDR permitidos (vazia se todos são permitidos), 'expira' é nulo se a
+// chave não expira e 'revogada_em' é nulo se a chave não foi revogada.
+func criaTabelaChaveAPI(tx *sql.Tx) error {
+	sqlCode := `CREATE TABLE chave_api (
+		id CHAR(32) NOT NULL,
+		usuario_id INT(11) UNSIGNED NOT NULL,
+		nome VARCHAR(64) NOT NULL,
+		segredo CHAR(64) NOT NULL,
+		escopos SET('relatorios', 'negociacao', 'transferencia') NOT NULL,
+		ips VARCHAR(512) NOT NULL DEFAULT '',
+		criada DATETIME NOT NULL,
+		expira DATETIME NULL DEFAULT NULL,
+		revogada_em DATETIME NULL DEFAULT NULL,
+		CONSTRAINT pk_chave_api_id PRIMARY KEY (id),
+		CONSTRAINT fk_chave_api_usuario_id
+			FOREIGN KEY (usuario_id)
+			REFERENCES usuario(id)
+	) ENGINE=InnoDB;`
+	_, err := tx.Exec(sqlCode)
+	return err
+}
+
+// criaTabelaTOTP cria a tabela 'totp' no banco de dados que armazena o segredo
+// TOTP (em base32) da autenticação em dois fatores de cada usuário. O segredo
+// só é exigido após ser confirmado, quando 'ativo' se torna verdadeiro.
+// 'ultimo_passo' é o último passo de tempo cujo código foi aceito.
+func criaTabelaTOTP(tx *sql.Tx) error {
+	sqlCode := `CREATE TABLE totp (
+		usuario_id INT(11) UNSIGNED NOT NULL,
+		segredo VARCHAR(64) NOT NULL,
+		ativo BOOLEAN NOT NULL DEFAULT FALSE,
+		ultimo_passo BIGINT NOT NULL DEFAULT 0,
+		CONSTRAINT pk_totp_usuario_id PRIMARY KEY (usuario_id),
+		CONSTRAINT fk_totp_usuario_id
+			FOREIGN KEY (usuario_id)
+			REFERENCES usuario(id)
+	) ENGINE=InnoDB;`
+	_, err := tx.Exec(sqlCode)
+	return err
+}
+
+// criaTabelaCodigoRecuperacao cria a tabela 'codigo_recuperacao' no banco de
+// dados que armazena o hash SHA-256 (em hexadecimal) dos códigos de
+// recuperação da autenticação em dois fatores. Cada código só pode ser
+// utilizado uma vez; 'usado_em' é nulo se o código ainda não foi utilizado.
+func criaTabelaCodigoRecuperacao(tx *sql.Tx) error {
+	sqlCode := `CREATE TABLE codigo_recuperacao (
+		usuario_id INT(11) UNSIGNED NOT NULL,
+		hash CHAR(64) NOT NULL,
+		usado_em DATETIME NULL DEFAULT NULL,
+		CONSTRAINT pk_codigo_recuperacao PRIMARY KEY (usuario_id, hash),
+		CONSTRAINT fk_codigo_recuperacao_usuario_id
+			FOREIGN KEY (usuario_id)
+			REFERENCES usuario(id)
+	) ENGINE=InnoDB;`
+	_, err := tx.Exec(sqlCode)
+	return err
+}
+
+// criaTabelaTokenUsuario cria a tabela 'token_usuario' no banco de dados que
+// armazena os tokens de uso único enviados por e-mail aos usuários, como os de
+// verificação do e-mail. 'hash' é o hash SHA-256 (em hexadecimal) do token,
+// 'finalidade' identifica a operação autorizada pelo token, 'dado' é um valor
+// associado à operação (se houver) e 'usado_em' é nulo enquanto o token não
+// foi utilizado.
+func criaTabelaTokenUsuario(tx *sql.Tx) error {
+	sqlCode := `CREATE TABLE token_usuario (
+		hash CHAR(64) NOT NULL,
+		usuario_id INT(11) UNSIGNED NOT NULL,
+		finalidade VARCHAR(32) NOT NULL,
+		dado VARCHAR(255) NOT NULL DEFAULT '',
+		criado DATETIME NOT NULL,
+		expira DATETIME NOT NULL,
+		usado_em DATETIME NULL DEFAULT NULL,
+		CONSTRAINT pk_token_usuario_hash PRIMARY KEY (hash),
+		CONSTRAINT fk_token_usuario_usuario_id
+			FOREIGN KEY (usuario_id)
+			REFERENCES usuario(id)
+	) ENGINE=InnoDB;`
+	_, err := tx.Exec(sqlCode)
+	return err
+}
+
+// criaTabelaSolicitacaoKYC cria a tabela 'solicitacao_kyc' no banco de dados
+// que armazena as solicitações de verificação de identidade dos usuários.
+// 'nivel' é o nível de verificação solicitado, 'estado' indica se a solicitação
+// aguarda análise, foi aprovada ou rejeitada, e 'analista_id', 'analisada_em' e
+// 'motivo' identificam quem a analisou, quando e por quê.
+func criaTabelaSolicitacaoKYC(tx *sql.Tx) error {
+	sqlCode := `CREATE TABLE solicitacao_kyc (
+		id INT(11) UNSIGNED AUTO_INCREMENT,
+		usuario_id INT(11) UNSIGNED NOT NULL,
+		nivel TINYINT UNSIGNED NOT NULL,
+		estado ENUM('pendente', 'aprovada', 'rejeitada') NOT NULL DEFAULT 'pendente',
+		criada DATETIME NOT NULL,
+		analista_id INT(11) UNSIGNED NULL DEFAULT NULL,
+		analisada_em DATETIME NULL DEFAULT NULL,
+		motivo VARCHAR(255) NOT NULL DEFAULT '',
+		CONSTRAINT pk_solicitacao_kyc_id PRIMARY KEY (id),
+		CONSTRAINT fk_solicitacao_kyc_usuario_id
+			FOREIGN KEY (usuario_id)
+			REFERENCES usuario(id),
+		CONSTRAINT fk_solicitacao_kyc_analista_id
+			FOREIGN KEY (analista_id)
+			REFERENCES usuario(id),
+		CONSTRAINT fk_solicitacao_kyc_nivel
+			FOREIGN KEY (nivel)
+			REFERENCES limite(nivel)
+	) ENGINE=InnoDB;`
+	_, err := tx.Exec(sqlCode)
+	return err
+}
+
+// criaTabelaDocumentoKYC cria a tabela 'documento_kyc' no banco de dados que
+// armazena os documentos enviados em cada solicitação de verificação. O
+// conteúdo dos documentos não é armazenado no banco de dados: 'arquivo' é a
+// chave do documento no armazenamento configurado, 'tipo' identifica o
+// documento (identidade, selfie...) e 'tipo_conteudo' é seu tipo MIME.
+func criaTabelaDocumentoKYC(tx *sql.Tx) error {
+	sqlCode := `CREATE TABLE documento_kyc (
+		id INT(11) UNSIGNED AUTO_INCREMENT,
+		solicitacao_id INT(11) UNSIGNED NOT NULL,
+		tipo VARCHAR(32) NOT NULL,
+		arquivo VARCHAR(128) NOT NULL,
+		tipo_conteudo VARCHAR(64) NOT NULL,
+		tamanho INT(11) UNSIGNED NOT NULL,
+		CONSTRAINT pk_documento_kyc_id PRIMARY KEY (id),
+		CONSTRAINT fk_documento_kyc_solicitacao_id
+			FOREIGN KEY (solicitacao_id)
+			REFERENCES solicitacao_kyc(id)
+	) ENGINE=InnoDB;`
+	_, err := tx.Exec(sqlCode)
+	return err
+}
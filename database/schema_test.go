@@ -38,7 +38,7 @@ func TestCriaDatabase(t *testing.T) {
 	sqlCode = `SELECT COUNT(*) FROM information_schema.tables WHERE table_schema=?;`
 	if err := db.QueryRow(sqlCode, dbNome).Scan(&qtd); err != nil {
 		t.Fatalf("%v", err)
-	} else if qtd != 2 {
+	} else if qtd != 14 {
 		t.Errorf("Quantidade inesperada de tabelas: %v", qtd)
 	}
 
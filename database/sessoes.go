@@ -0,0 +1,195 @@
+package database
+
+// Esse arquivo define as sessões dos usuários, criadas a partir dos
+// credenciais e utilizadas para emitir tokens de acesso
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Lista de possíveis erros das sessões
+var (
+	ErrSessaoNaoExiste = errors.New("sessao_nao_existente")
+)
+
+// Sessao é a estrutura para a tabela 'sessao'. 'Renovacao' é o hash do token
+// de renovação atual da sessão; o token em si nunca é armazenado. As datas
+// estão no formato "YYYY-MM-DD HH:MM:SS" e 'RevogadaEm' é vazio se a sessão
+// não foi revogada.
+type Sessao struct {
+	ID         string
+	Usuario    string
+	Renovacao  string
+	Criada     string
+	Expira     string
+	RevogadaEm string
+}
+
+// InsereSessao cria uma nova sessão para o usuário do e-mail 'Usuario' da
+// sessão passada. Retorna ErrUsuarioNaoExiste se o usuário não existe.
+func InsereSessao(s Sessao) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, s.Usuario)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	sqlCode := `INSERT INTO sessao
+		(id, usuario_id, renovacao, criada, expira)
+		VALUES (?, ?, ?, ?, ?);`
+	if _, err := tx.Exec(sqlCode, s.ID, usrID, s.Renovacao, s.Criada, s.Expira); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// AdquireSessaoPorRenovacao adquire a sessão cujo token de renovação atual tem
+// o hash passado. Retorna ErrSessaoNaoExiste se não há tal sessão.
+func AdquireSessaoPorRenovacao(renovacao string) (Sessao, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return Sessao{}, err
+	}
+
+	s := Sessao{}
+	var revogadaEm sql.NullString
+	sqlCode := `SELECT s.id, u.email, s.renovacao, s.criada, s.expira, s.revogada_em
+		FROM sessao AS s
+		INNER JOIN usuario AS u ON u.id = s.usuario_id
+		WHERE s.renovacao = ?;`
+	err = db.QueryRow(sqlCode, renovacao).Scan(&s.ID, &s.Usuario, &s.Renovacao, &s.Criada, &s.Expira, &revogadaEm)
+	if err == sql.ErrNoRows {
+		return Sessao{}, ErrSessaoNaoExiste
+	} else if err != nil {
+		return Sessao{}, err
+	}
+	s.RevogadaEm = revogadaEm.String
+	return s, nil
+}
+
+// RenovaSessao substitui o hash do token de renovação da sessão 'id' e sua
+// data de expiração, desde que a sessão não tenha sido revogada e o hash atual
+// ainda seja 'renovacaoAtual'. Retorna se a sessão foi renovada; se não foi,
+// outro pedido já utilizou o token de renovação.
+func RenovaSessao(id string, renovacaoAtual string, renovacaoNova string, expira string) (bool, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return false, err
+	}
+
+	sqlCode := `UPDATE sessao
+		SET renovacao = ?, expira = ?
+		WHERE id = ? AND renovacao = ? AND revogada_em IS NULL;`
+	res, err := db.Exec(sqlCode, renovacaoNova, expira, id, renovacaoAtual)
+	if err != nil {
+		return false, err
+	}
+	linhas, err := res.RowsAffected()
+	return linhas == 1, err
+}
+
+// RevogaSessao revoga a sessão 'id' no momento 'em' ("YYYY-MM-DD HH:MM:SS").
+// Revogar uma sessão já revogada não tem efeito.
+func RevogaSessao(id string, em string) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+
+	sqlCode := `UPDATE sessao SET revogada_em = ? WHERE id = ? AND revogada_em IS NULL;`
+	_, err = db.Exec(sqlCode, em, id)
+	return err
+}
+
+// RevogaSessoesUsuario revoga no momento 'em' ("YYYY-MM-DD HH:MM:SS") todas as
+// sessões ainda não revogadas do usuário e retorna seus IDs. Retorna
+// ErrUsuarioNaoExiste se o usuário não existe.
+func RevogaSessoesUsuario(email string, em string) ([]string, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return nil, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, email)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	sqlCode := `SELECT id FROM sessao
+		WHERE usuario_id = ? AND revogada_em IS NULL
+		FOR UPDATE;`
+	rows, err := tx.Query(sqlCode, usrID)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	sqlCode = `UPDATE sessao SET revogada_em = ?
+		WHERE usuario_id = ? AND revogada_em IS NULL;`
+	if _, err := tx.Exec(sqlCode, em, usrID); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return ids, tx.Commit()
+}
+
+// AdquireSessoesRevogadas adquire os IDs das sessões revogadas a partir de
+// 'desde' ("YYYY-MM-DD HH:MM:SS")
+func AdquireSessoesRevogadas(desde string) ([]string, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlCode := `SELECT id FROM sessao WHERE revogada_em >= ?;`
+	rows, err := db.Query(sqlCode, desde)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0)
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSessoes(t *testing.T) {
+	s := Sessao{
+		ID:        "00112233445566778899aabbccddeeff",
+		Usuario:   "valido1@gmail.com",
+		Renovacao: "a1",
+		Criada:    "2018-01-01 10:00:00",
+		Expira:    "2018-01-31 10:00:00",
+	}
+	if err := InsereSessao(s); err != nil {
+		t.Fatalf("Erro inesperado ao inserir sessão: %v", err)
+	}
+	if adquirida, err := AdquireSessaoPorRenovacao("a1"); err != nil || adquirida != s {
+		t.Errorf("Sessão inesperada: %v (%v)", adquirida, err)
+	}
+
+	// Renovação: o token antigo deixa de ser válido
+	if renovada, err := RenovaSessao(s.ID, "a1", "b2", "2018-02-01 10:00:00"); err != nil || !renovada {
+		t.Errorf("Renovação inesperada: %v (%v)", renovada, err)
+	}
+	if renovada, err := RenovaSessao(s.ID, "a1", "c3", "2018-02-01 10:00:00"); err != nil || renovada {
+		t.Errorf("Renovação inesperada com token antigo: %v (%v)", renovada, err)
+	}
+	if _, err := AdquireSessaoPorRenovacao("a1"); err != ErrSessaoNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Revogação
+	if err := RevogaSessao(s.ID, "2018-01-02 10:00:00"); err != nil {
+		t.Fatalf("Erro inesperado ao revogar sessão: %v", err)
+	}
+	if renovada, err := RenovaSessao(s.ID, "b2", "c3", "2018-02-01 10:00:00"); err != nil || renovada {
+		t.Errorf("Renovação inesperada de sessão revogada: %v (%v)", renovada, err)
+	}
+	if adquirida, err := AdquireSessaoPorRenovacao("b2"); err != nil || adquirida.RevogadaEm != "2018-01-02 10:00:00" {
+		t.Errorf("Sessão inesperada: %v (%v)", adquirida, err)
+	}
+	ids, err := AdquireSessoesRevogadas("2018-01-02 00:00:00")
+	if err != nil || fmt.Sprintf("%v", ids) != "["+s.ID+"]" {
+		t.Errorf("Sessões revogadas inesperadas: %v (%v)", ids, err)
+	}
+
+	// Usuário inexistente
+	s.ID, s.Usuario, s.Renovacao = "ffeeddccbbaa99887766554433221100", "naoexistente@gmail.com", "d4"
+	if err := InsereSessao(s); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+func TestRevogaSessoesUsuario(t *testing.T) {
+	for i, id := range []string{"0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a0a", "0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b"} {
+		s := Sessao{
+			ID:        id,
+			Usuario:   "valido2@gmail.com",
+			Renovacao: fmt.Sprintf("r%d", i),
+			Criada:    "2018-03-01 10:00:00",
+			Expira:    "2018-03-31 10:00:00",
+		}
+		if err := InsereSessao(s); err != nil {
+			t.Fatalf("Erro inesperado ao inserir sessão: %v", err)
+		}
+	}
+	ids, err := RevogaSessoesUsuario("valido2@gmail.com", "2018-03-02 10:00:00")
+	if err != nil || len(ids) != 2 {
+		t.Errorf("Sessões revogadas inesperadas: %v (%v)", ids, err)
+	}
+	if s, err := AdquireSessaoPorRenovacao("r0"); err != nil || s.RevogadaEm != "2018-03-02 10:00:00" {
+		t.Errorf("Sessão inesperada: %v (%v)", s, err)
+	}
+
+	// As sessões já revogadas não são retornadas novamente
+	if ids, err := RevogaSessoesUsuario("valido2@gmail.com", "2018-03-03 10:00:00"); err != nil || len(ids) != 0 {
+		t.Errorf("Sessões revogadas inesperadas: %v (%v)", ids, err)
+	}
+	if _, err := RevogaSessoesUsuario("naoexistente@gmail.com", "2018-03-03 10:00:00"); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
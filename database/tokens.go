@@ -0,0 +1,172 @@
+package database
+
+// Esse arquivo define os tokens de uso único enviados por e-mail aos usuários,
+// que autorizam operações como a verificação do e-mail, a redefinição da senha
+// e a alteração do e-mail
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Lista de possíveis erros dos tokens
+var (
+	ErrTokenInvalido = errors.New("token_invalido")
+)
+
+// Finalidades dos tokens
+const (
+	TokenVerificacaoEmail = "verificacao_email"
+	TokenRedefinicaoSenha = "redefinicao_senha"
+	TokenAlteracaoEmail   = "alteracao_email"
+)
+
+// TokenUsuario é a estrutura para a tabela 'token_usuario'. 'Hash' é o hash
+// do token; o token em si nunca é armazenado. As datas estão no formato
+// "YYYY-MM-DD HH:MM:SS".
+type TokenUsuario struct {
+	Hash       string
+	Usuario    string
+	Finalidade string
+	Dado       string
+	Criado     string
+	Expira     string
+}
+
+// InsereTokenUsuario cria um novo token para o usuário do e-mail 'Usuario' do
+// token passado. Retorna ErrUsuarioNaoExiste se o usuário não existe.
+func InsereTokenUsuario(t TokenUsuario) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, t.Usuario)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	sqlCode := `INSERT INTO token_usuario
+		(hash, usuario_id, finalidade, dado, criado, expira)
+		VALUES (?, ?, ?, ?, ?, ?);`
+	if _, err := tx.Exec(sqlCode, t.Hash, usrID, t.Finalidade, t.Dado, t.Criado, t.Expira); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// ConsomeTokenUsuario marca como utilizado no momento 'agora'
+// ("YYYY-MM-DD HH:MM:SS") o token com o hash e a finalidade passados e o
+// retorna. Retorna ErrTokenInvalido se o token não existe, já foi utilizado ou
+// expirou.
+func ConsomeTokenUsuario(hash string, finalidade string, agora string) (TokenUsuario, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return TokenUsuario{}, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return TokenUsuario{}, err
+	}
+
+	t := TokenUsuario{}
+	sqlCode := `SELECT t.hash, u.email, t.finalidade, t.dado, t.criado, t.expira
+		FROM token_usuario AS t
+		INNER JOIN usuario AS u ON u.id = t.usuario_id
+		WHERE t.hash = ? AND t.finalidade = ? AND t.usado_em IS NULL AND t.expira > ?
+		FOR UPDATE;`
+	err = tx.QueryRow(sqlCode, hash, finalidade, agora).Scan(
+		&t.Hash, &t.Usuario, &t.Finalidade, &t.Dado, &t.Criado, &t.Expira)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return TokenUsuario{}, ErrTokenInvalido
+	} else if err != nil {
+		tx.Rollback()
+		return TokenUsuario{}, err
+	}
+	sqlCode = `UPDATE token_usuario SET usado_em = ? WHERE hash = ?;`
+	if _, err := tx.Exec(sqlCode, agora, hash); err != nil {
+		tx.Rollback()
+		return TokenUsuario{}, err
+	}
+	return t, tx.Commit()
+}
+
+// ContaTokensUsuario retorna a quantidade de tokens com a finalidade passada
+// criados para o usuário a partir de 'desde' ("YYYY-MM-DD HH:MM:SS"). Retorna
+// ErrUsuarioNaoExiste se o usuário não existe.
+func ContaTokensUsuario(email string, finalidade string, desde string) (int, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return 0, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, email)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	var qtd int
+	sqlCode := `SELECT COUNT(*) FROM token_usuario
+		WHERE usuario_id = ? AND finalidade = ? AND criado >= ?;`
+	if err := tx.QueryRow(sqlCode, usrID, finalidade, desde).Scan(&qtd); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return qtd, tx.Commit()
+}
+
+// InvalidaTokensUsuario marca como utilizados no momento 'em'
+// ("YYYY-MM-DD HH:MM:SS") todos os tokens ainda não utilizados do usuário com a
+// finalidade passada
+func InvalidaTokensUsuario(email string, finalidade string, em string) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+
+	sqlCode := `UPDATE token_usuario AS t
+		INNER JOIN usuario AS u ON u.id = t.usuario_id
+		SET t.usado_em = ?
+		WHERE u.email = ? AND t.finalidade = ? AND t.usado_em IS NULL;`
+	_, err = db.Exec(sqlCode, em, email, finalidade)
+	return err
+}
+
+// MarcaEmailVerificado marca o e-mail do usuário como verificado. Retorna
+// ErrUsuarioNaoExiste se o usuário não existe.
+func MarcaEmailVerificado(email string) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if _, err := adquireUsuarioIDDeEmail(tx, email); err != nil {
+		tx.Rollback()
+		return err
+	}
+	sqlCode := `UPDATE usuario SET email_verificado = TRUE WHERE email = ?;`
+	if _, err := tx.Exec(sqlCode, email); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
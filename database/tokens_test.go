@@ -0,0 +1,75 @@
+package database
+
+import "testing"
+
+func TestTokensUsuario(t *testing.T) {
+	token := TokenUsuario{
+		Hash:       "aa11",
+		Usuario:    "valido3@gmail.com",
+		Finalidade: TokenVerificacaoEmail,
+		Criado:     "2018-01-01 10:00:00",
+		Expira:     "2018-01-02 10:00:00",
+	}
+	if err := InsereTokenUsuario(token); err != nil {
+		t.Fatalf("Erro inesperado ao inserir token: %v", err)
+	}
+
+	// Finalidade diferente ou token expirado
+	if _, err := ConsomeTokenUsuario("aa11", "outra", "2018-01-01 11:00:00"); err != ErrTokenInvalido {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if _, err := ConsomeTokenUsuario("aa11", TokenVerificacaoEmail, "2018-01-02 10:00:00"); err != ErrTokenInvalido {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// O token só pode ser utilizado uma vez
+	if consumido, err := ConsomeTokenUsuario("aa11", TokenVerificacaoEmail, "2018-01-01 11:00:00"); err != nil || consumido != token {
+		t.Errorf("Token inesperado: %v (%v)", consumido, err)
+	}
+	if _, err := ConsomeTokenUsuario("aa11", TokenVerificacaoEmail, "2018-01-01 11:00:00"); err != ErrTokenInvalido {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Verificação do e-mail
+	if err := MarcaEmailVerificado("valido3@gmail.com"); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if usr, err := AdquireUsuario("valido3@gmail.com"); err != nil || !usr.EmailVerificado {
+		t.Errorf("Usuário inesperado: %v (%v)", usr, err)
+	}
+	if err := MarcaEmailVerificado("naoexistente@gmail.com"); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+func TestTokensRedefinicaoSenha(t *testing.T) {
+	for _, hash := range []string{"bb11", "bb22"} {
+		token := TokenUsuario{
+			Hash:       hash,
+			Usuario:    "valido2@gmail.com",
+			Finalidade: TokenRedefinicaoSenha,
+			Criado:     "2018-02-01 10:00:00",
+			Expira:     "2018-02-01 11:00:00",
+		}
+		if err := InsereTokenUsuario(token); err != nil {
+			t.Fatalf("Erro inesperado ao inserir token: %v", err)
+		}
+	}
+	if qtd, err := ContaTokensUsuario("valido2@gmail.com", TokenRedefinicaoSenha, "2018-02-01 09:00:00"); err != nil || qtd != 2 {
+		t.Errorf("Quantidade inesperada: %d (%v)", qtd, err)
+	}
+	if qtd, err := ContaTokensUsuario("valido2@gmail.com", TokenRedefinicaoSenha, "2018-02-01 10:00:01"); err != nil || qtd != 0 {
+		t.Errorf("Quantidade inesperada: %d (%v)", qtd, err)
+	}
+	if _, err := ContaTokensUsuario("naoexistente@gmail.com", TokenRedefinicaoSenha, "2018-02-01 09:00:00"); err != ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Os tokens invalidados não podem mais ser utilizados
+	if err := InvalidaTokensUsuario("valido2@gmail.com", TokenRedefinicaoSenha, "2018-02-01 10:10:00"); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if _, err := ConsomeTokenUsuario("bb22", TokenRedefinicaoSenha, "2018-02-01 10:20:00"); err != ErrTokenInvalido {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
@@ -0,0 +1,201 @@
+package database
+
+// Esse arquivo define a autenticação em dois fatores dos usuários: o segredo
+// TOTP (RFC 6238) de cada usuário e seus códigos de recuperação
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Lista de possíveis erros da autenticação em dois fatores
+var (
+	ErrTOTPNaoExiste = errors.New("totp_nao_existente")
+)
+
+// TOTP é a estrutura para a tabela 'totp'. 'Segredo' está codificado em
+// base32. 'UltimoPasso' é o último passo de tempo cujo código foi aceito, de
+// forma que um código não possa ser utilizado duas vezes.
+type TOTP struct {
+	Usuario     string
+	Segredo     string
+	Ativo       bool
+	UltimoPasso int64
+}
+
+// DefineSegredoTOTP define o segredo TOTP do usuário, ainda inativo. Se o
+// usuário já possui a autenticação em dois fatores ativa, o segredo atual é
+// mantido. Retorna ErrUsuarioNaoExiste se o usuário não existe.
+func DefineSegredoTOTP(email string, segredo string) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, email)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	sqlCode := `INSERT INTO totp (usuario_id, segredo) VALUES (?, ?)
+		ON DUPLICATE KEY UPDATE
+			segredo = IF(ativo, segredo, VALUES(segredo)),
+			ultimo_passo = IF(ativo, ultimo_passo, 0);`
+	if _, err := tx.Exec(sqlCode, usrID, segredo); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// AdquireTOTP adquire o segredo TOTP do usuário. Retorna ErrTOTPNaoExiste se
+// o usuário não definiu um segredo.
+func AdquireTOTP(email string) (TOTP, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return TOTP{}, err
+	}
+
+	t := TOTP{}
+	sqlCode := `SELECT u.email, t.segredo, t.ativo, t.ultimo_passo
+		FROM totp AS t
+		INNER JOIN usuario AS u ON u.id = t.usuario_id
+		WHERE u.email = ?;`
+	err = db.QueryRow(sqlCode, email).Scan(&t.Usuario, &t.Segredo, &t.Ativo, &t.UltimoPasso)
+	if err == sql.ErrNoRows {
+		return TOTP{}, ErrTOTPNaoExiste
+	}
+	return t, err
+}
+
+// AtivaTOTP ativa a autenticação em dois fatores do usuário, registrando
+// 'passo' como o último passo utilizado, e substitui seus códigos de
+// recuperação pelos hashes passados. Retorna se a autenticação foi ativada; se
+// não foi, ela já estava ativa ou o passo já havia sido utilizado.
+func AtivaTOTP(email string, passo int64, codigos []string) (bool, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return false, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, email)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	sqlCode := `UPDATE totp SET ativo = TRUE, ultimo_passo = ?
+		WHERE usuario_id = ? AND NOT ativo AND ultimo_passo < ?;`
+	res, err := tx.Exec(sqlCode, passo, usrID, passo)
+	if err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	if linhas, err := res.RowsAffected(); err != nil || linhas == 0 {
+		tx.Rollback()
+		return false, err
+	}
+	if err := substituiCodigosRecuperacao(tx, usrID, codigos); err != nil {
+		tx.Rollback()
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// RegistraPassoTOTP registra 'passo' como o último passo utilizado pelo
+// usuário. Retorna se o passo foi registrado; se não foi, a autenticação em
+// dois fatores está inativa ou um passo igual ou posterior já foi utilizado.
+func RegistraPassoTOTP(email string, passo int64) (bool, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return false, err
+	}
+
+	sqlCode := `UPDATE totp AS t
+		INNER JOIN usuario AS u ON u.id = t.usuario_id
+		SET t.ultimo_passo = ?
+		WHERE u.email = ? AND t.ativo AND t.ultimo_passo < ?;`
+	res, err := db.Exec(sqlCode, passo, email, passo)
+	if err != nil {
+		return false, err
+	}
+	linhas, err := res.RowsAffected()
+	return linhas == 1, err
+}
+
+// UsaCodigoRecuperacao marca como utilizado no momento 'em'
+// ("YYYY-MM-DD HH:MM:SS") o código de recuperação do usuário com o hash
+// passado. Retorna se o código existia e ainda não havia sido utilizado.
+func UsaCodigoRecuperacao(email string, hash string, em string) (bool, error) {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return false, err
+	}
+
+	sqlCode := `UPDATE codigo_recuperacao AS c
+		INNER JOIN usuario AS u ON u.id = c.usuario_id
+		SET c.usado_em = ?
+		WHERE u.email = ? AND c.hash = ? AND c.usado_em IS NULL;`
+	res, err := db.Exec(sqlCode, em, email, hash)
+	if err != nil {
+		return false, err
+	}
+	linhas, err := res.RowsAffected()
+	return linhas == 1, err
+}
+
+// RemoveTOTP desativa a autenticação em dois fatores do usuário, removendo seu
+// segredo e seus códigos de recuperação
+func RemoveTOTP(email string) error {
+	db, err := sql.Open("mysql", dsn)
+	defer db.Close()
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	usrID, err := adquireUsuarioIDDeEmail(tx, email)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := substituiCodigosRecuperacao(tx, usrID, nil); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM totp WHERE usuario_id = ?;`, usrID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// substituiCodigosRecuperacao remove os códigos de recuperação do usuário e
+// insere os hashes passados
+func substituiCodigosRecuperacao(tx *sql.Tx, usrID uint, codigos []string) error {
+	if _, err := tx.Exec(`DELETE FROM codigo_recuperacao WHERE usuario_id = ?;`, usrID); err != nil {
+		return err
+	}
+	sqlCode := `INSERT INTO codigo_recuperacao (usuario_id, hash) VALUES (?, ?);`
+	for _, codigo := range codigos {
+		if _, err := tx.Exec(sqlCode, usrID, codigo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package database
+
+import "testing"
+
+func TestTOTP(t *testing.T) {
+	email := "valido2@gmail.com"
+	if _, err := AdquireTOTP(email); err != ErrTOTPNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Definição do segredo: substituído enquanto inativo
+	if err := DefineSegredoTOTP(email, "AAAA"); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if err := DefineSegredoTOTP(email, "BBBB"); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if totp, err := AdquireTOTP(email); err != nil || totp != (TOTP{email, "BBBB", false, 0}) {
+		t.Errorf("TOTP inesperado: %v (%v)", totp, err)
+	}
+	if registrado, err := RegistraPassoTOTP(email, 5); err != nil || registrado {
+		t.Errorf("Passo registrado com TOTP inativo: %v (%v)", registrado, err)
+	}
+
+	// Ativação, apenas uma vez
+	if ativado, err := AtivaTOTP(email, 10, []string{"h1", "h2"}); err != nil || !ativado {
+		t.Fatalf("Ativação inesperada: %v (%v)", ativado, err)
+	}
+	if ativado, err := AtivaTOTP(email, 11, []string{"h3"}); err != nil || ativado {
+		t.Errorf("Ativação repetida: %v (%v)", ativado, err)
+	}
+	if err := DefineSegredoTOTP(email, "CCCC"); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if totp, err := AdquireTOTP(email); err != nil || totp != (TOTP{email, "BBBB", true, 10}) {
+		t.Errorf("TOTP inesperado: %v (%v)", totp, err)
+	}
+
+	// Passos só podem avançar
+	if registrado, err := RegistraPassoTOTP(email, 10); err != nil || registrado {
+		t.Errorf("Passo repetido registrado: %v (%v)", registrado, err)
+	}
+	if registrado, err := RegistraPassoTOTP(email, 11); err != nil || !registrado {
+		t.Errorf("Passo não registrado: %v (%v)", registrado, err)
+	}
+
+	// Códigos de recuperação só podem ser utilizados uma vez
+	if usado, err := UsaCodigoRecuperacao(email, "h1", "2018-01-01 10:00:00"); err != nil || !usado {
+		t.Errorf("Código não utilizado: %v (%v)", usado, err)
+	}
+	if usado, err := UsaCodigoRecuperacao(email, "h1", "2018-01-01 10:00:00"); err != nil || usado {
+		t.Errorf("Código utilizado duas vezes: %v (%v)", usado, err)
+	}
+	if usado, err := UsaCodigoRecuperacao(email, "h3", "2018-01-01 10:00:00"); err != nil || usado {
+		t.Errorf("Código inexistente utilizado: %v (%v)", usado, err)
+	}
+
+	// Remoção
+	if err := RemoveTOTP(email); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if _, err := AdquireTOTP(email); err != ErrTOTPNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if usado, err := UsaCodigoRecuperacao(email, "h2", "2018-01-01 10:00:00"); err != nil || usado {
+		t.Errorf("Código de TOTP removido utilizado: %v (%v)", usado, err)
+	}
+}
@@ -0,0 +1,163 @@
+// Package extrato gera o extrato das movimentações dos usuários em um período,
+// com os saldos em Bitcoins e em reais após cada movimentação.
+// Esse package usa exclusivamente a estrutura de erros 'erros.Erros'.
+package extrato
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// Lista de possíveis erros do módulo
+var (
+	ErrDataInvalida    = erros.Cria(false, 400, "data_invalida")
+	ErrPeriodoInvalido = erros.Cria(false, 400, "periodo_invalido")
+)
+
+// Precisão dos saldos: os saldos são acumulados em unidades inteiras para
+// evitar erros de arredondamento nas somas sucessivas
+const (
+	unidadesBitcoin = 1e8
+	unidadesReais   = 1e9
+)
+
+// Saldos é a estrutura com os saldos de um usuário em um momento. 'Reais' é o
+// valor líquido das transações: vendas somam e compras subtraem.
+type Saldos struct {
+	Bitcoins float64 `json:"bitcoins"`
+	Reais    float64 `json:"reais"`
+}
+
+// Movimentacao é uma linha do extrato: uma transação e os saldos do usuário
+// após ela
+type Movimentacao struct {
+	Dia           string  `json:"dia"`
+	Compra        bool    `json:"compra"`
+	Bitcoins      float64 `json:"bitcoins"`
+	Creditos      float64 `json:"creditos"`
+	SaldoBitcoins float64 `json:"saldoBitcoins"`
+	SaldoReais    float64 `json:"saldoReais"`
+}
+
+// Extrato é o extrato de um usuário no período de 'De' a 'Ate', inclusive
+type Extrato struct {
+	De            string         `json:"de"`
+	Ate           string         `json:"ate"`
+	SaldoInicial  Saldos         `json:"saldoInicial"`
+	SaldoFinal    Saldos         `json:"saldoFinal"`
+	Movimentacoes []Movimentacao `json:"movimentacoes"`
+}
+
+// ExtratoHTTP retorna os bytes da string JSON com o extrato do usuário do
+// e-mail passado no período dos campos "de" e "ate" ("YYYY-MM-DD", inclusive).
+// Por padrão, o período vai do primeiro dia do mês atual até o dia atual.
+func ExtratoHTTP(r *http.Request, email string) ([]byte, erros.Erros) {
+	ext, err := GeraExtrato(r, email)
+	if !erros.Vazio(err) {
+		return nil, err
+	}
+	extBytes, err2 := json.Marshal(ext)
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	return extBytes, erros.CriaVazio()
+}
+
+// GeraExtrato gera o extrato do usuário do e-mail passado no período dos
+// campos "de" e "ate" do request
+func GeraExtrato(r *http.Request, email string) (Extrato, erros.Erros) {
+	ext, _, err := geraExtrato(r, email)
+	return ext, err
+}
+
+// geraExtrato gera o extrato do usuário do e-mail passado no período dos campos
+// "de" e "ate" do request e retorna, também, os IDs das transações de cada
+// movimentação
+func geraExtrato(r *http.Request, email string) (Extrato, []int64, erros.Erros) {
+	de, ate, err := validaPeriodo(r, transacao.Agora())
+	if !erros.Vazio(err) {
+		return Extrato{}, nil, err
+	}
+	inicio := de.Format("2006-01-02 15:04:05")
+	fim := ate.AddDate(0, 0, 1).Format("2006-01-02 15:04:05")
+
+	bitcoins, reais, err2 := database.AdquireSaldosUsuario(email, inicio)
+	if err2 != nil {
+		return Extrato{}, nil, erros.CriaInternoPadrao(err2)
+	}
+	transacoes, ids, err2 := database.AdquireMovimentacoesUsuario(email, inicio, fim)
+	if err2 != nil {
+		return Extrato{}, nil, erros.CriaInternoPadrao(err2)
+	}
+	ext := montaExtrato(Saldos{Bitcoins: bitcoins, Reais: reais}, transacoes)
+	ext.De, ext.Ate = de.Format("2006-01-02"), ate.Format("2006-01-02")
+	return ext, ids, erros.CriaVazio()
+}
+
+// validaPeriodo adquire o período dos campos "de" e "ate" do request. 'agora'
+// define o período padrão.
+func validaPeriodo(r *http.Request, agora time.Time) (time.Time, time.Time, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return time.Time{}, time.Time{}, erros.CriaInternoPadrao(err)
+	}
+	de := time.Date(agora.Year(), agora.Month(), 1, 0, 0, 0, 0, time.UTC)
+	ate := time.Date(agora.Year(), agora.Month(), agora.Day(), 0, 0, 0, 0, time.UTC)
+
+	var err error
+	if s := r.FormValue("de"); s != "" {
+		if de, err = time.Parse("2006-01-02", s); err != nil {
+			return time.Time{}, time.Time{}, ErrDataInvalida
+		}
+	}
+	if s := r.FormValue("ate"); s != "" {
+		if ate, err = time.Parse("2006-01-02", s); err != nil {
+			return time.Time{}, time.Time{}, ErrDataInvalida
+		}
+	}
+	if ate.Before(de) {
+		return time.Time{}, time.Time{}, ErrPeriodoInvalido
+	}
+	return de, ate, erros.CriaVazio()
+}
+
+// montaExtrato monta o extrato a partir dos saldos anteriores ao período e das
+// transações do período em ordem cronológica
+func montaExtrato(inicial Saldos, transacoes []database.Transacao) Extrato {
+	ext := Extrato{
+		SaldoInicial:  inicial,
+		Movimentacoes: make([]Movimentacao, 0, len(transacoes)),
+	}
+	bitcoins := int64(math.Round(inicial.Bitcoins * unidadesBitcoin))
+	reais := int64(math.Round(inicial.Reais * unidadesReais))
+	for _, tr := range transacoes {
+		qtd := int64(math.Round(tr.Bitcoins * unidadesBitcoin))
+		valor := int64(math.Round(tr.Creditos * unidadesReais))
+		if tr.Compra {
+			bitcoins += qtd
+			reais -= valor
+		} else {
+			bitcoins -= qtd
+			reais += valor
+		}
+		ext.Movimentacoes = append(ext.Movimentacoes, Movimentacao{
+			Dia:           tr.Dia,
+			Compra:        tr.Compra,
+			Bitcoins:      tr.Bitcoins,
+			Creditos:      tr.Creditos,
+			SaldoBitcoins: float64(bitcoins) / unidadesBitcoin,
+			SaldoReais:    float64(reais) / unidadesReais,
+		})
+	}
+	ext.SaldoFinal = Saldos{
+		Bitcoins: float64(bitcoins) / unidadesBitcoin,
+		Reais:    float64(reais) / unidadesReais,
+	}
+	return ext
+}
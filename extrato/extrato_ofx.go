@@ -0,0 +1,215 @@
+package extrato
+
+// Esse arquivo define o extrato em OFX 2.2, o formato de importação dos
+// programas de finanças pessoais. As transações são exportadas como um extrato
+// de investimentos, com cada compra e venda identificada pelo ID da transação
+// para que importações repetidas não dupliquem as movimentações.
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/precobtc"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// Identificação da RedCoins e do Bitcoin nos extratos OFX
+const (
+	instituicaoOFX = "RedCoins"
+	corretoraOFX   = "redcoins.com.br"
+	tickerBitcoin  = "BTC"
+)
+
+// ExtratoOFXHTTP gera o extrato em OFX do usuário do e-mail passado no período
+// dos campos "de" e "ate" do request. Retorna os bytes do OFX e o nome sugerido
+// para o arquivo. A posição em Bitcoins no fim do período só é incluída se o
+// preço atual da Bitcoin estiver disponível.
+func ExtratoOFXHTTP(r *http.Request, email string) ([]byte, string, erros.Erros) {
+	ext, ids, err := geraExtrato(r, email)
+	if !erros.Vazio(err) {
+		return nil, "", err
+	}
+	preco, err2 := precobtc.PrecoUnidade()
+	if err2 != nil {
+		preco = 0
+	}
+	nome := "extrato-" + ext.De + "-" + ext.Ate + ".ofx"
+	return geraOFX(ext, ids, email, preco, transacao.Agora()), nome, erros.CriaVazio()
+}
+
+// escritorOFX escreve os elementos de um documento OFX
+type escritorOFX struct {
+	bytes.Buffer
+}
+
+// abre escreve a tag de abertura dos elementos agregados passados
+func (e *escritorOFX) abre(agregados ...string) {
+	for _, agregado := range agregados {
+		e.WriteString("<" + agregado + ">\n")
+	}
+}
+
+// fecha escreve a tag de fechamento dos elementos agregados passados
+func (e *escritorOFX) fecha(agregados ...string) {
+	for _, agregado := range agregados {
+		e.WriteString("</" + agregado + ">\n")
+	}
+}
+
+// elemento escreve um elemento com o valor passado
+func (e *escritorOFX) elemento(nome string, valor string) {
+	e.WriteString("<" + nome + ">")
+	xml.EscapeText(e, []byte(valor))
+	e.WriteString("</" + nome + ">\n")
+}
+
+// status escreve o agregado de status de sucesso de uma resposta
+func (e *escritorOFX) status() {
+	e.abre("STATUS")
+	e.elemento("CODE", "0")
+	e.elemento("SEVERITY", "INFO")
+	e.fecha("STATUS")
+}
+
+// secid escreve o identificador do Bitcoin
+func (e *escritorOFX) secid() {
+	e.abre("SECID")
+	e.elemento("UNIQUEID", tickerBitcoin)
+	e.elemento("UNIQUEIDTYPE", "TICKER")
+	e.fecha("SECID")
+}
+
+// geraOFX escreve o extrato como um documento OFX. 'ids' são os IDs das
+// transações de cada movimentação e 'preco' é o preço atual da Bitcoin, ou 0
+// se indisponível.
+func geraOFX(ext Extrato, ids []int64, email string, preco float64, gerado time.Time) []byte {
+	e := &escritorOFX{}
+	e.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n")
+	e.WriteString(`<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n")
+	e.abre("OFX")
+
+	// Resposta de autenticação, obrigatória em todo documento
+	e.abre("SIGNONMSGSRSV1", "SONRS")
+	e.status()
+	e.elemento("DTSERVER", dataOFX(gerado))
+	e.elemento("LANGUAGE", "POR")
+	e.abre("FI")
+	e.elemento("ORG", instituicaoOFX)
+	e.elemento("FID", instituicaoOFX)
+	e.fecha("FI", "SONRS", "SIGNONMSGSRSV1")
+
+	// Extrato de investimentos
+	e.abre("INVSTMTMSGSRSV1", "INVSTMTTRNRS")
+	e.elemento("TRNUID", "0")
+	e.status()
+	e.abre("INVSTMTRS")
+	e.elemento("DTASOF", dataOFX(gerado))
+	e.elemento("CURDEF", "BRL")
+	e.abre("INVACCTFROM")
+	e.elemento("BROKERID", corretoraOFX)
+	e.elemento("ACCTID", email)
+	e.fecha("INVACCTFROM")
+
+	e.abre("INVTRANLIST")
+	de, _ := time.ParseInLocation("2006-01-02", ext.De, gerado.Location())
+	ate, _ := time.ParseInLocation("2006-01-02", ext.Ate, gerado.Location())
+	e.elemento("DTSTART", dataOFX(de))
+	e.elemento("DTEND", dataOFX(ate.AddDate(0, 0, 1)))
+	for i, m := range ext.Movimentacoes {
+		escreveTransacaoOFX(e, m, ids[i], gerado.Location())
+	}
+	e.fecha("INVTRANLIST")
+
+	if preco > 0 {
+		e.abre("INVPOSLIST", "POSOTHER", "INVPOS")
+		e.secid()
+		e.elemento("HELDINACCT", "CASH")
+		e.elemento("POSTYPE", "LONG")
+		e.elemento("UNITS", numeroOFX(ext.SaldoFinal.Bitcoins, 8))
+		e.elemento("UNITPRICE", numeroOFX(preco, 2))
+		e.elemento("MKTVAL", numeroOFX(ext.SaldoFinal.Bitcoins*preco, 2))
+		e.elemento("DTPRICEASOF", dataOFX(gerado))
+		e.fecha("INVPOS", "POSOTHER", "INVPOSLIST")
+	}
+	e.fecha("INVSTMTRS", "INVSTMTTRNRS", "INVSTMTMSGSRSV1")
+
+	// Descrição do Bitcoin, referenciado pelas transações
+	e.abre("SECLISTMSGSRSV1", "SECLIST", "OTHERINFO", "SECINFO")
+	e.secid()
+	e.elemento("SECNAME", "Bitcoin")
+	e.elemento("TICKER", tickerBitcoin)
+	e.fecha("SECINFO", "OTHERINFO", "SECLIST", "SECLISTMSGSRSV1")
+
+	e.fecha("OFX")
+	return e.Bytes()
+}
+
+// escreveTransacaoOFX escreve uma movimentação como uma compra (BUYOTHER) ou
+// venda (SELLOTHER) de outros investimentos. Na compra, o total em reais é
+// negativo; na venda, a quantidade de Bitcoins é negativa.
+func escreveTransacaoOFX(e *escritorOFX, m Movimentacao, id int64, fuso *time.Location) {
+	transacaoOFX, investimento := "SELLOTHER", "INVSELL"
+	memo := "Venda de Bitcoins"
+	unidades, total := -m.Bitcoins, m.Creditos
+	if m.Compra {
+		transacaoOFX, investimento = "BUYOTHER", "INVBUY"
+		memo = "Compra de Bitcoins"
+		unidades, total = m.Bitcoins, -m.Creditos
+	}
+	dia, _ := time.ParseInLocation("2006-01-02 15:04:05", m.Dia, fuso)
+	var preco float64
+	if m.Bitcoins != 0 {
+		preco = m.Creditos / m.Bitcoins
+	}
+
+	e.abre(transacaoOFX, investimento, "INVTRAN")
+	e.elemento("FITID", "RC-"+strconv.FormatInt(id, 10))
+	e.elemento("DTTRADE", dataOFX(dia))
+	e.elemento("MEMO", memo)
+	e.fecha("INVTRAN")
+	e.secid()
+	e.elemento("UNITS", numeroOFX(unidades, 8))
+	e.elemento("UNITPRICE", numeroOFX(preco, 2))
+	e.elemento("TOTAL", numeroOFX(total, 2))
+	e.elemento("SUBACCTSEC", "CASH")
+	e.elemento("SUBACCTFUND", "CASH")
+	e.fecha(investimento, transacaoOFX)
+}
+
+// dataOFX formata uma data no formato do OFX, com o deslocamento do fuso
+// horário em horas e sua abreviação ("20180102100000.000[-3:BRT]"). O OFX
+// exige uma abreviação alfabética; abreviações numéricas, como a "-03" do fuso
+// America/Sao_Paulo, são omitidas ("20180102100000.000[-3]").
+func dataOFX(t time.Time) string {
+	zona, deslocamento := t.Zone()
+	horas := strconv.FormatFloat(float64(deslocamento)/3600, 'f', -1, 64)
+	if !abreviacaoAlfabetica(zona) {
+		return fmt.Sprintf("%s[%s]", t.Format("20060102150405.000"), horas)
+	}
+	return fmt.Sprintf("%s[%s:%s]", t.Format("20060102150405.000"), horas, zona)
+}
+
+// abreviacaoAlfabetica verifica se a abreviação do fuso horário contém apenas
+// letras ASCII
+func abreviacaoAlfabetica(zona string) bool {
+	if zona == "" {
+		return false
+	}
+	for _, c := range zona {
+		if (c < 'A' || c > 'Z') && (c < 'a' || c > 'z') {
+			return false
+		}
+	}
+	return true
+}
+
+// numeroOFX formata um número com 'casas' casas decimais e ponto como
+// separador decimal
+func numeroOFX(v float64, casas int) string {
+	return strconv.FormatFloat(v, 'f', casas, 64)
+}
@@ -0,0 +1,90 @@
+package extrato
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/transacao"
+)
+
+func TestGeraOFX(t *testing.T) {
+	fuso := time.FixedZone("BRT", -3*60*60)
+	gerado := time.Date(2018, 3, 15, 12, 0, 0, 0, fuso)
+	ext := montaExtrato(Saldos{}, []database.Transacao{
+		{Compra: true, Bitcoins: 0.5, Creditos: 5000, Dia: "2018-01-01 10:00:00"},
+		{Compra: false, Bitcoins: 0.25, Creditos: 3000, Dia: "2018-01-02 10:30:00"},
+	})
+	ext.De, ext.Ate = "2018-01-01", "2018-01-31"
+	ofx := geraOFX(ext, []int64{7, 9}, "teste&1@gmail.com", 20000, gerado)
+
+	if !bytes.HasPrefix(ofx, []byte(`<?xml version="1.0"`)) ||
+		!bytes.Contains(ofx, []byte(`<?OFX OFXHEADER="200" VERSION="220"`)) {
+		t.Errorf("Cabeçalho inesperado: %s", ofx)
+	}
+	esperados := []string{
+		"<DTSERVER>20180315120000.000[-3:BRT]</DTSERVER>",
+		"<ACCTID>teste&amp;1@gmail.com</ACCTID>",
+		"<DTSTART>20180101000000.000[-3:BRT]</DTSTART>",
+		"<DTEND>20180201000000.000[-3:BRT]</DTEND>",
+		"<BUYOTHER>\n<INVBUY>\n<INVTRAN>\n<FITID>RC-7</FITID>\n<DTTRADE>20180101100000.000[-3:BRT]</DTTRADE>",
+		"<UNITS>0.50000000</UNITS>\n<UNITPRICE>10000.00</UNITPRICE>\n<TOTAL>-5000.00</TOTAL>",
+		"<SELLOTHER>\n<INVSELL>\n<INVTRAN>\n<FITID>RC-9</FITID>\n<DTTRADE>20180102103000.000[-3:BRT]</DTTRADE>",
+		"<UNITS>-0.25000000</UNITS>\n<UNITPRICE>12000.00</UNITPRICE>\n<TOTAL>3000.00</TOTAL>",
+		"<UNITS>0.25000000</UNITS>\n<UNITPRICE>20000.00</UNITPRICE>\n<MKTVAL>5000.00</MKTVAL>",
+	}
+	for _, esperado := range esperados {
+		if !bytes.Contains(ofx, []byte(esperado)) {
+			t.Errorf("Trecho não encontrado no OFX: %q", esperado)
+		}
+	}
+
+	// O documento deve ser XML bem formado
+	decoder := xml.NewDecoder(bytes.NewReader(ofx))
+	for {
+		if _, err := decoder.Token(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("OFX mal formado: %v", err)
+		}
+	}
+
+	// Sem o preço da Bitcoin, a posição é omitida
+	ofx = geraOFX(ext, []int64{7, 9}, "teste@gmail.com", 0, gerado)
+	if strings.Contains(string(ofx), "INVPOSLIST") {
+		t.Errorf("Posição inesperada no OFX: %s", ofx)
+	}
+
+	// Uma movimentação sem Bitcoins possui preço unitário zero
+	ext = montaExtrato(Saldos{}, []database.Transacao{{Compra: true, Dia: "2018-01-01 10:00:00"}})
+	ofx = geraOFX(ext, []int64{1}, "teste@gmail.com", 0, gerado)
+	if !strings.Contains(string(ofx), "<UNITPRICE>0.00</UNITPRICE>") {
+		t.Errorf("Preço unitário inesperado no OFX: %s", ofx)
+	}
+}
+
+func TestDataOFX(t *testing.T) {
+	casos := map[string]time.Time{
+		"20180102100000.000[0:UTC]":   time.Date(2018, 1, 2, 10, 0, 0, 0, time.UTC),
+		"20180102100000.000[-3:BRT]":  time.Date(2018, 1, 2, 10, 0, 0, 0, time.FixedZone("BRT", -3*60*60)),
+		"20180102100000.000[5.5:IST]": time.Date(2018, 1, 2, 10, 0, 0, 0, time.FixedZone("IST", 11*30*60)),
+		"20180102100000.000[-3]":      time.Date(2018, 1, 2, 10, 0, 0, 0, time.FixedZone("-03", -3*60*60)),
+	}
+	for esperado, data := range casos {
+		if s := dataOFX(data); s != esperado {
+			t.Errorf("Data inesperada: %v (esperado %v)", s, esperado)
+		}
+	}
+
+	// O fuso horário das transações (America/Sao_Paulo por padrão) possui
+	// abreviação numérica, que não pode ser escrita no OFX
+	s := dataOFX(time.Date(2018, 7, 2, 10, 0, 0, 0, transacao.Fuso()))
+	if ok, _ := regexp.MatchString(`^20180702100000\.000\[-?[0-9.]+(:[A-Za-z]+)?\]$`, s); !ok {
+		t.Errorf("Data inesperada: %v", s)
+	}
+}
@@ -0,0 +1,220 @@
+package extrato
+
+// Esse arquivo define o extrato em PDF, com cabeçalho identificando o titular,
+// tabela paginada das movimentações, totais do período e um código de
+// verificação que permite à RedCoins confirmar a autenticidade do documento
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// chaveAssinatura é a chave HMAC dos códigos de verificação dos extratos
+var chaveAssinatura []byte
+
+func init() {
+	// Inicializa as configurações da package com as variáveis de ambiente. Sem
+	// a chave configurada, uma chave aleatória é gerada e os códigos de
+	// verificação deixam de ser verificáveis quando o servidor é reiniciado.
+	chaveAssinatura = []byte(os.Getenv("REDCOINS_EX_CHAVE"))
+	if len(chaveAssinatura) == 0 {
+		log.Printf("extrato: REDCOINS_EX_CHAVE não definida, utilizando chave aleatória")
+		chaveAssinatura = make([]byte, 32)
+		if _, err := rand.Read(chaveAssinatura); err != nil {
+			log.Fatalf("extrato: %s", err)
+		}
+	}
+}
+
+// Posições horizontais das colunas da tabela de movimentações. A coluna de
+// data é alinhada à esquerda e as colunas numéricas, à direita.
+const (
+	colunaData          = 50.0
+	colunaTipo          = 150.0
+	colunaBitcoins      = 300.0
+	colunaValor         = 380.0
+	colunaSaldoBitcoins = 470.0
+	colunaSaldoReais    = 545.0
+)
+
+// Posições verticais do conteúdo das páginas
+const (
+	topoTabela   = 700.0
+	fimTabela    = 70.0
+	alturaLinha  = 14.0
+	tamanhoFonte = 9.0
+)
+
+// ExtratoPDFHTTP gera o extrato em PDF do usuário do e-mail passado no período
+// dos campos "de" e "ate" do request. Retorna os bytes do PDF e o nome sugerido
+// para o arquivo.
+func ExtratoPDFHTTP(r *http.Request, email string) ([]byte, string, erros.Erros) {
+	ext, err := GeraExtrato(r, email)
+	if !erros.Vazio(err) {
+		return nil, "", err
+	}
+	usr, err2 := database.AdquireUsuario(email)
+	if err2 != nil {
+		return nil, "", erros.CriaInternoPadrao(err2)
+	}
+	nome := "extrato-" + ext.De + "-" + ext.Ate + ".pdf"
+	return geraPDF(ext, usr, transacao.Agora()), nome, erros.CriaVazio()
+}
+
+// codigoVerificacao calcula o código de verificação de um extrato: um HMAC dos
+// dados que identificam o documento, mostrado em grupos de quatro caracteres
+func codigoVerificacao(ext Extrato, email string, gerado time.Time) string {
+	mac := hmac.New(sha256.New, chaveAssinatura)
+	fmt.Fprintf(mac, "%s|%s|%s|%s|%d|%.8f|%.9f", email, ext.De, ext.Ate,
+		gerado.Format("2006-01-02 15:04:05"), len(ext.Movimentacoes),
+		ext.SaldoFinal.Bitcoins, ext.SaldoFinal.Reais)
+	codigo := strings.ToUpper(hex.EncodeToString(mac.Sum(nil))[:20])
+	grupos := make([]string, 0, 5)
+	for i := 0; i < len(codigo); i += 4 {
+		grupos = append(grupos, codigo[i:i+4])
+	}
+	return strings.Join(grupos, "-")
+}
+
+// geraPDF desenha o extrato em um documento PDF
+func geraPDF(ext Extrato, usr database.Usuario, gerado time.Time) []byte {
+	doc := &documentoPDF{titulo: "Extrato RedCoins " + ext.De + " a " + ext.Ate}
+	codigo := codigoVerificacao(ext, usr.Email, gerado)
+
+	y := 0.0
+	novaPagina := func() {
+		doc.novaPagina()
+		desenhaCabecalho(doc, ext, usr, gerado)
+		desenhaTitulosTabela(doc, topoTabela)
+		y = topoTabela - alturaLinha - 4
+	}
+	// proximaLinha retorna a posição da próxima linha, criando uma nova página
+	// quando a atual está cheia
+	proximaLinha := func() float64 {
+		if y < fimTabela {
+			novaPagina()
+		}
+		atual := y
+		y -= alturaLinha
+		return atual
+	}
+
+	novaPagina()
+	desenhaSaldo(doc, proximaLinha(), "Saldo inicial", ext.SaldoInicial)
+	compras, vendas := 0, 0
+	var btcComprado, btcVendido, reaisComprado, reaisVendido float64
+	for _, m := range ext.Movimentacoes {
+		linhaY := proximaLinha()
+		doc.texto(colunaData, linhaY, tamanhoFonte, false, formataData(m.Dia))
+		tipo := "Venda"
+		if m.Compra {
+			tipo = "Compra"
+			compras++
+			btcComprado += m.Bitcoins
+			reaisComprado += m.Creditos
+		} else {
+			vendas++
+			btcVendido += m.Bitcoins
+			reaisVendido += m.Creditos
+		}
+		doc.texto(colunaTipo, linhaY, tamanhoFonte, false, tipo)
+		doc.textoDireita(colunaBitcoins, linhaY, tamanhoFonte, false, formataNumero(m.Bitcoins, 8))
+		doc.textoDireita(colunaValor, linhaY, tamanhoFonte, false, formataNumero(m.Creditos, 2))
+		doc.textoDireita(colunaSaldoBitcoins, linhaY, tamanhoFonte, false, formataNumero(m.SaldoBitcoins, 8))
+		doc.textoDireita(colunaSaldoReais, linhaY, tamanhoFonte, false, formataNumero(m.SaldoReais, 2))
+	}
+	desenhaSaldo(doc, proximaLinha(), "Saldo final", ext.SaldoFinal)
+
+	// Totais do período
+	proximaLinha()
+	totais := []string{
+		fmt.Sprintf("Compras: %d, totalizando %s BTC por R$ %s", compras,
+			formataNumero(btcComprado, 8), formataNumero(reaisComprado, 2)),
+		fmt.Sprintf("Vendas: %d, totalizando %s BTC por R$ %s", vendas,
+			formataNumero(btcVendido, 8), formataNumero(reaisVendido, 2)),
+	}
+	for _, total := range totais {
+		doc.texto(colunaData, proximaLinha(), tamanhoFonte, false, total)
+	}
+
+	// Rodapé de todas as páginas
+	for i := range doc.paginas {
+		doc.selecionaPagina(i)
+		doc.linha(50, 50, 545, 50)
+		doc.texto(50, 36, 8, false, "Código de verificação: "+codigo)
+		doc.textoDireita(545, 36, 8, false, fmt.Sprintf("Página %d de %d", i+1, len(doc.paginas)))
+	}
+	return doc.bytes()
+}
+
+// desenhaCabecalho desenha o cabeçalho de uma página do extrato
+func desenhaCabecalho(doc *documentoPDF, ext Extrato, usr database.Usuario, gerado time.Time) {
+	doc.texto(50, 800, 16, true, "RedCoins - Extrato de movimentações")
+	doc.texto(50, 778, 10, false, "Titular: "+usr.Nome)
+	doc.texto(50, 764, 10, false, "E-mail: "+usr.Email)
+	doc.texto(50, 750, 10, false, "Período: "+formataData(ext.De)+" a "+formataData(ext.Ate))
+	doc.texto(50, 736, 10, false, "Gerado em: "+gerado.Format("02/01/2006 15:04:05"))
+	doc.linha(50, 726, 545, 726)
+}
+
+// desenhaTitulosTabela desenha os títulos das colunas da tabela de
+// movimentações na posição vertical 'y'
+func desenhaTitulosTabela(doc *documentoPDF, y float64) {
+	doc.texto(colunaData, y, tamanhoFonte, true, "Data")
+	doc.texto(colunaTipo, y, tamanhoFonte, true, "Tipo")
+	doc.textoDireita(colunaBitcoins, y, tamanhoFonte, true, "Bitcoins")
+	doc.textoDireita(colunaValor, y, tamanhoFonte, true, "Valor (R$)")
+	doc.textoDireita(colunaSaldoBitcoins, y, tamanhoFonte, true, "Saldo (BTC)")
+	doc.textoDireita(colunaSaldoReais, y, tamanhoFonte, true, "Saldo (R$)")
+	doc.linha(50, y-4, 545, y-4)
+}
+
+// desenhaSaldo desenha uma linha da tabela com saldos
+func desenhaSaldo(doc *documentoPDF, y float64, titulo string, saldos Saldos) {
+	doc.texto(colunaData, y, tamanhoFonte, true, titulo)
+	doc.textoDireita(colunaSaldoBitcoins, y, tamanhoFonte, true, formataNumero(saldos.Bitcoins, 8))
+	doc.textoDireita(colunaSaldoReais, y, tamanhoFonte, true, formataNumero(saldos.Reais, 2))
+}
+
+// formataData converte uma data "YYYY-MM-DD" ou "YYYY-MM-DD HH:MM:SS" para o
+// formato brasileiro. Datas em outro formato são mantidas.
+func formataData(data string) string {
+	if t, err := time.Parse("2006-01-02 15:04:05", data); err == nil {
+		return t.Format("02/01/2006 15:04:05")
+	}
+	if t, err := time.Parse("2006-01-02", data); err == nil {
+		return t.Format("02/01/2006")
+	}
+	return data
+}
+
+// formataNumero formata um número no padrão brasileiro, com 'casas' casas
+// decimais, vírgula como separador decimal e ponto como separador de milhares
+func formataNumero(v float64, casas int) string {
+	s := strconv.FormatFloat(v, 'f', casas, 64)
+	sinal := ""
+	if strings.HasPrefix(s, "-") {
+		sinal, s = "-", s[1:]
+	}
+	inteiro, decimal := s, ""
+	if i := strings.Index(s, "."); i >= 0 {
+		inteiro, decimal = s[:i], ","+s[i+1:]
+	}
+	for i := len(inteiro) - 3; i > 0; i -= 3 {
+		inteiro = inteiro[:i] + "." + inteiro[i:]
+	}
+	return sinal + inteiro + decimal
+}
@@ -0,0 +1,94 @@
+package extrato
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+)
+
+func TestGeraPDF(t *testing.T) {
+	usr := database.Usuario{Email: "teste@gmail.com", Nome: "João"}
+	gerado := time.Date(2018, 3, 15, 12, 0, 0, 0, time.UTC)
+	ext := montaExtrato(Saldos{}, []database.Transacao{
+		{Compra: true, Bitcoins: 0.5, Creditos: 1500, Dia: "2018-01-01 10:00:00"},
+		{Compra: false, Bitcoins: 0.25, Creditos: 1000, Dia: "2018-01-02 10:00:00"},
+	})
+	ext.De, ext.Ate = "2018-01-01", "2018-01-31"
+	pdf := geraPDF(ext, usr, gerado)
+
+	esperados := []string{
+		"(Titular: Jo\xe3o)",
+		"(E-mail: teste@gmail.com)",
+		"(Per\xedodo: 01/01/2018 a 31/01/2018)",
+		"(Gerado em: 15/03/2018 12:00:00)",
+		"(01/01/2018 10:00:00)",
+		"(1.500,00)",
+		"(Compras: 1, totalizando 0,50000000 BTC por R$ 1.500,00)",
+		"(Vendas: 1, totalizando 0,25000000 BTC por R$ 1.000,00)",
+		"(P\xe1gina 1 de 1)",
+		"(C\xf3digo de verifica\xe7\xe3o: " + codigoVerificacao(ext, usr.Email, gerado) + ")",
+	}
+	for _, esperado := range esperados {
+		if !bytes.Contains(pdf, []byte(esperado)) {
+			t.Errorf("Texto não encontrado no PDF: %q", esperado)
+		}
+	}
+
+	// Extrato com movimentações suficientes para várias páginas
+	transacoes := make([]database.Transacao, 120)
+	for i := range transacoes {
+		transacoes[i] = database.Transacao{Compra: true, Bitcoins: 0.01, Creditos: 100, Dia: "2018-01-01 10:00:00"}
+	}
+	ext = montaExtrato(Saldos{}, transacoes)
+	ext.De, ext.Ate = "2018-01-01", "2018-01-31"
+	pdf = geraPDF(ext, usr, gerado)
+	paginas := bytes.Count(pdf, []byte("/Type /Page /Parent"))
+	if paginas < 2 {
+		t.Fatalf("Quantidade de páginas inesperada: %v", paginas)
+	}
+	for i := 1; i <= paginas; i++ {
+		if !bytes.Contains(pdf, []byte(fmt.Sprintf("(P\xe1gina %d de %d)", i, paginas))) {
+			t.Errorf("Rodapé da página %d não encontrado", i)
+		}
+	}
+	if bytes.Count(pdf, []byte("(Titular: Jo\xe3o)")) != paginas {
+		t.Errorf("Cabeçalho não repetido em todas as páginas")
+	}
+}
+
+func TestCodigoVerificacao(t *testing.T) {
+	gerado := time.Date(2018, 3, 15, 12, 0, 0, 0, time.UTC)
+	ext := Extrato{De: "2018-01-01", Ate: "2018-01-31", SaldoFinal: Saldos{Bitcoins: 1, Reais: -100}}
+	codigo := codigoVerificacao(ext, "teste@gmail.com", gerado)
+	if len(codigo) != 24 || codigo != codigoVerificacao(ext, "teste@gmail.com", gerado) {
+		t.Errorf("Código inesperado: %v", codigo)
+	}
+
+	// Qualquer alteração nos dados altera o código
+	ext.SaldoFinal.Reais = -101
+	if codigo == codigoVerificacao(ext, "teste@gmail.com", gerado) {
+		t.Errorf("Código não depende do saldo final")
+	}
+}
+
+func TestFormataNumero(t *testing.T) {
+	casos := []struct {
+		valor    float64
+		casas    int
+		esperado string
+	}{
+		{0, 2, "0,00"},
+		{1234.5, 2, "1.234,50"},
+		{-1234567.891, 2, "-1.234.567,89"},
+		{0.001, 8, "0,00100000"},
+		{123, 0, "123"},
+	}
+	for _, c := range casos {
+		if s := formataNumero(c.valor, c.casas); s != c.esperado {
+			t.Errorf("Formatação inesperada de %v: %v (esperado %v)", c.valor, s, c.esperado)
+		}
+	}
+}
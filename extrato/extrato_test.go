@@ -0,0 +1,65 @@
+package extrato
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+func TestMontaExtrato(t *testing.T) {
+	inicial := Saldos{Bitcoins: 0.1, Reais: -100}
+	transacoes := []database.Transacao{
+		{Compra: true, Bitcoins: 0.2, Creditos: 200.5, Dia: "2018-01-01 10:00:00"},
+		{Compra: false, Bitcoins: 0.3, Creditos: 400, Dia: "2018-01-02 10:00:00"},
+	}
+	ext := montaExtrato(inicial, transacoes)
+
+	esperado := `[{2018-01-01 10:00:00 true 0.2 200.5 0.3 -300.5} ` +
+		`{2018-01-02 10:00:00 false 0.3 400 0 99.5}]`
+	if fmt.Sprintf("%v", ext.Movimentacoes) != esperado {
+		t.Errorf("Movimentações inesperadas: %v", ext.Movimentacoes)
+	}
+	if ext.SaldoInicial != inicial || ext.SaldoFinal != (Saldos{Bitcoins: 0, Reais: 99.5}) {
+		t.Errorf("Saldos inesperados: %v %v", ext.SaldoInicial, ext.SaldoFinal)
+	}
+
+	// Período sem transações
+	ext = montaExtrato(inicial, nil)
+	if len(ext.Movimentacoes) != 0 || ext.SaldoFinal != inicial {
+		t.Errorf("Extrato inesperado: %v", ext)
+	}
+}
+
+func TestValidaPeriodo(t *testing.T) {
+	agora := time.Date(2018, 3, 15, 12, 0, 0, 0, time.UTC)
+	casos := []struct {
+		query    string
+		de, ate  string
+		esperado erros.Erros
+	}{
+		{"", "2018-03-01", "2018-03-15", erros.CriaVazio()},
+		{"de=2018-01-01&ate=2018-01-31", "2018-01-01", "2018-01-31", erros.CriaVazio()},
+		{"de=2018-01-01&ate=2018-01-01", "2018-01-01", "2018-01-01", erros.CriaVazio()},
+		{"de=2018-02-01&ate=2018-01-31", "", "", ErrPeriodoInvalido},
+		{"de=2018-0101", "", "", ErrDataInvalida},
+		{"ate=ontem", "", "", ErrDataInvalida},
+	}
+	for _, c := range casos {
+		r, err := http.NewRequest("GET", "/extrato?"+c.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		de, ate, errPeriodo := validaPeriodo(r, agora)
+		if errPeriodo.Error() != c.esperado.Error() {
+			t.Errorf("Erro inesperado para %q: %v", c.query, errPeriodo)
+			continue
+		}
+		if erros.Vazio(errPeriodo) && (de.Format("2006-01-02") != c.de || ate.Format("2006-01-02") != c.ate) {
+			t.Errorf("Período inesperado para %q: %v %v", c.query, de, ate)
+		}
+	}
+}
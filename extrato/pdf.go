@@ -0,0 +1,152 @@
+package extrato
+
+// Esse arquivo define um gerador mínimo de documentos PDF, suficiente para os
+// extratos: páginas A4 com textos nas fontes padrão Helvetica e Helvetica-Bold
+// (codificação WinAnsi) e linhas retas. Os documentos são gerados sem
+// dependências externas.
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Dimensões de uma página A4 em pontos
+const (
+	larguraPagina = 595.0
+	alturaPagina  = 842.0
+)
+
+// larguraCaracteres são as larguras dos caracteres da Helvetica (em milésimos
+// do tamanho da fonte) utilizados em textos alinhados à direita. Os demais
+// caracteres utilizam a largura média 'larguraPadrao'.
+var larguraCaracteres = map[rune]float64{
+	'0': 556, '1': 556, '2': 556, '3': 556, '4': 556, '5': 556, '6': 556,
+	'7': 556, '8': 556, '9': 556, '.': 278, ',': 278, '-': 333, ' ': 278,
+	'R': 722, '$': 556,
+}
+
+// larguraPadrao é a largura média dos caracteres da Helvetica
+const larguraPadrao = 556.0
+
+// documentoPDF é um documento PDF em construção. Cada página é um fluxo de
+// operações de desenho, e os desenhos são feitos na página de índice 'atual'.
+type documentoPDF struct {
+	titulo  string
+	paginas []*bytes.Buffer
+	atual   int
+}
+
+// novaPagina adiciona uma página ao fim do documento, que passa a receber os
+// desenhos
+func (d *documentoPDF) novaPagina() {
+	d.paginas = append(d.paginas, &bytes.Buffer{})
+	d.atual = len(d.paginas) - 1
+}
+
+// selecionaPagina faz com que a página de índice 'i' passe a receber os
+// desenhos
+func (d *documentoPDF) selecionaPagina(i int) {
+	d.atual = i
+}
+
+// pagina retorna a página atual
+func (d *documentoPDF) pagina() *bytes.Buffer {
+	return d.paginas[d.atual]
+}
+
+// texto escreve 's' na página atual a partir do ponto (x, y), medido a partir
+// do canto inferior esquerdo da página
+func (d *documentoPDF) texto(x, y, tamanho float64, negrito bool, s string) {
+	fonte := "F1"
+	if negrito {
+		fonte = "F2"
+	}
+	fmt.Fprintf(d.pagina(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", fonte, tamanho, x, y, codificaTexto(s))
+}
+
+// textoDireita escreve 's' na página atual terminando no ponto (x, y)
+func (d *documentoPDF) textoDireita(x, y, tamanho float64, negrito bool, s string) {
+	d.texto(x-larguraTexto(s, tamanho), y, tamanho, negrito, s)
+}
+
+// linha desenha uma linha reta de (x1, y1) a (x2, y2) na página atual
+func (d *documentoPDF) linha(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.pagina(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+// bytes retorna o documento PDF completo
+func (d *documentoPDF) bytes() []byte {
+	var buf bytes.Buffer
+	offsets := make([]int, 0)
+	// objeto adiciona o próximo objeto ao documento, registrando sua posição
+	// para a tabela de referências cruzadas
+	objeto := func(conteudo string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), conteudo)
+	}
+
+	// Objetos 1 a 5: catálogo, árvore de páginas, fontes e informações do
+	// documento. Cada página ocupa dois objetos a partir do 6: a página e o
+	// fluxo com seu conteúdo.
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	kids := make([]string, len(d.paginas))
+	for i := range d.paginas {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	objeto("<< /Type /Catalog /Pages 2 0 R >>")
+	objeto(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.paginas)))
+	objeto("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	objeto("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	objeto(fmt.Sprintf("<< /Title (%s) /Producer (RedCoins) >>", codificaTexto(d.titulo)))
+	for i, p := range d.paginas {
+		objeto(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			larguraPagina, alturaPagina, 7+2*i))
+		objeto(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.Len(), p.String()))
+	}
+
+	// Tabela de referências cruzadas: cada entrada tem exatamente 20 bytes
+	inicioXref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets)+1, inicioXref)
+	return buf.Bytes()
+}
+
+// codificaTexto converte um texto para a codificação WinAnsi e escapa os
+// caracteres especiais das strings PDF. Caracteres fora do Latin-1 são
+// substituídos por '?'.
+func codificaTexto(s string) string {
+	var buf bytes.Buffer
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(byte(r))
+		case r < 32:
+			buf.WriteByte(' ')
+		case r < 256:
+			buf.WriteByte(byte(r))
+		default:
+			buf.WriteByte('?')
+		}
+	}
+	return buf.String()
+}
+
+// larguraTexto retorna a largura aproximada de um texto em pontos
+func larguraTexto(s string, tamanho float64) float64 {
+	largura := 0.0
+	for _, r := range s {
+		l, ok := larguraCaracteres[r]
+		if !ok {
+			l = larguraPadrao
+		}
+		largura += l
+	}
+	return largura * tamanho / 1000
+}
@@ -0,0 +1,58 @@
+package extrato
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+func TestDocumentoPDF(t *testing.T) {
+	doc := &documentoPDF{titulo: "Teste (1)"}
+	doc.novaPagina()
+	doc.texto(50, 800, 12, false, "Olá, mundo")
+	doc.novaPagina()
+	doc.linha(50, 50, 545, 50)
+	pdf := doc.bytes()
+
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(pdf, []byte("%%EOF\n")) {
+		t.Fatalf("Documento com início ou fim inesperado: %q", pdf)
+	}
+	if !bytes.Contains(pdf, []byte("(Ol\xe1, mundo) Tj")) {
+		t.Errorf("Texto não codificado em WinAnsi: %q", pdf)
+	}
+	if !bytes.Contains(pdf, []byte("/Title (Teste \\(1\\))")) {
+		t.Errorf("Título não escapado: %q", pdf)
+	}
+	if !bytes.Contains(pdf, []byte("/Kids [6 0 R 8 0 R] /Count 2")) {
+		t.Errorf("Árvore de páginas inesperada: %q", pdf)
+	}
+
+	// Cada entrada da tabela de referências cruzadas deve apontar para o início
+	// do objeto correspondente
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+	if startxref == nil {
+		t.Fatalf("startxref não encontrado")
+	}
+	inicioXref, _ := strconv.Atoi(string(startxref[1]))
+	if !bytes.HasPrefix(pdf[inicioXref:], []byte("xref\n0 10\n")) {
+		t.Fatalf("startxref aponta para posição inesperada: %q", pdf[inicioXref:])
+	}
+	entradas := regexp.MustCompile(`(\d{10}) 00000 n \n`).FindAllSubmatch(pdf[inicioXref:], -1)
+	if len(entradas) != 9 {
+		t.Fatalf("Quantidade de entradas inesperada: %v", len(entradas))
+	}
+	for i, entrada := range entradas {
+		offset, _ := strconv.Atoi(string(entrada[1]))
+		if !bytes.HasPrefix(pdf[offset:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))) {
+			t.Errorf("Entrada %d aponta para posição inesperada: %v", i+1, offset)
+		}
+	}
+}
+
+func TestLarguraTexto(t *testing.T) {
+	if largura := larguraTexto("1.0", 10); largura != 13.9 {
+		t.Errorf("Largura inesperada: %v", largura)
+	}
+}
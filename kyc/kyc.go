@@ -0,0 +1,323 @@
+// Package kyc trata da verificação de identidade dos usuários. O usuário envia
+// os documentos exigidos para o nível de verificação desejado, que são
+// gravados no armazenamento configurado, e a equipe de suporte aprova ou
+// rejeita a solicitação. Uma solicitação aprovada eleva o nível do usuário,
+// que determina seus limites de transação.
+// Esse package usa exclusivamente erros.Erros como estrutura de erros.
+package kyc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/loteny/redcoins/armazenamento"
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// Lista de possíveis erros do módulo
+var (
+	ErrNivelInvalido        = erros.Cria(false, 400, "nivel_invalido")
+	ErrNivelJaConcedido     = erros.Cria(false, 400, "nivel_ja_concedido")
+	ErrDocumentoAusente     = erros.Cria(false, 400, "documento_ausente")
+	ErrDocumentoInvalido    = erros.Cria(false, 400, "documento_invalido")
+	ErrDocumentoMuitoGrande = erros.Cria(false, 400, "documento_muito_grande")
+	ErrSolicitacaoPendente  = erros.Cria(false, 400, "solicitacao_kyc_pendente")
+	ErrDecisaoInvalida      = erros.Cria(false, 400, "decisao_invalida")
+	ErrMotivoInvalido       = erros.Cria(false, 400, "motivo_invalido")
+	ErrIDInvalido           = erros.Cria(false, 400, "id_invalido")
+	ErrUsuarioNaoExiste     = erros.Cria(false, 400, "usuario_nao_existente")
+	ErrCPFObrigatorio       = erros.Cria(false, 403, "cpf_obrigatorio")
+	ErrAnalisePropria       = erros.Cria(false, 403, "analise_propria")
+	ErrSolicitacaoNaoExiste = erros.Cria(false, 404, "solicitacao_kyc_nao_existente")
+	ErrDocumentoNaoExiste   = erros.Cria(false, 404, "documento_kyc_nao_existente")
+)
+
+// Tipos de documentos aceitos nas solicitações
+const (
+	DocumentoIdentidade  = "identidade"
+	DocumentoSelfie      = "selfie"
+	DocumentoComprovante = "comprovante_residencia"
+)
+
+// documentosExigidos são os documentos exigidos para cada nível de
+// verificação. O nível 0 é o de todo usuário cadastrado e não pode ser
+// solicitado.
+var documentosExigidos = map[int][]string{
+	1: {DocumentoIdentidade},
+	2: {DocumentoIdentidade, DocumentoSelfie, DocumentoComprovante},
+}
+
+// tiposAceitos são os tipos de conteúdo aceitos nos documentos, identificados
+// pelo próprio conteúdo, e as extensões com que são gravados
+var tiposAceitos = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"application/pdf": ".pdf",
+}
+
+// tamanhoMaximoDocumento é o tamanho máximo, em bytes, de cada documento
+const tamanhoMaximoDocumento = 5 << 20
+
+// tamanhoMaximoMotivo é o tamanho máximo, em caracteres, do motivo da análise
+const tamanhoMaximoMotivo = 255
+
+// formatoData é o formato das colunas DATETIME do banco de dados
+const formatoData = "2006-01-02 15:04:05"
+
+// verificacaoResposta é a estrutura JSON com o nível de verificação do
+// usuário e suas solicitações enviada ao cliente
+type verificacaoResposta struct {
+	Nivel        int                       `json:"nivel"`
+	Solicitacoes []database.SolicitacaoKYC `json:"solicitacoes"`
+}
+
+// SolicitaVerificacaoHTTP cria uma solicitação de verificação para o usuário a
+// partir de um request multipart com o nível desejado no campo "nivel" e um
+// arquivo para cada documento exigido pelo nível, no campo com o nome do
+// documento. Os documentos devem ser imagens JPEG ou PNG ou arquivos PDF de até
+// 5 MiB. O usuário deve ter informado seu CPF e não pode ter outra solicitação
+// pendente. Retorna os bytes da string JSON com a solicitação criada.
+func SolicitaVerificacaoHTTP(r *http.Request, email string) ([]byte, erros.Erros) {
+	r.Body = http.MaxBytesReader(nil, r.Body, int64(len(documentosExigidos[2])+1)*tamanhoMaximoDocumento)
+	if err := r.ParseMultipartForm(tamanhoMaximoDocumento); err != nil {
+		return nil, ErrDocumentoInvalido
+	}
+	defer r.MultipartForm.RemoveAll()
+	nivel, err := strconv.Atoi(r.FormValue("nivel"))
+	exigidos, ok := documentosExigidos[nivel]
+	if err != nil || !ok {
+		return nil, ErrNivelInvalido
+	}
+	usr, err := database.AdquireUsuario(email)
+	if err == database.ErrUsuarioNaoExiste {
+		return nil, ErrUsuarioNaoExiste
+	} else if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	if usr.CPF == "" {
+		return nil, ErrCPFObrigatorio
+	} else if usr.Nivel >= nivel {
+		return nil, ErrNivelJaConcedido
+	}
+
+	// Lê e valida todos os documentos antes de gravá-los
+	s := database.SolicitacaoKYC{
+		Usuario: email,
+		Nivel:   nivel,
+		Estado:  database.KYCPendente,
+		Criada:  transacao.Agora().Format(formatoData),
+	}
+	conteudos := make([][]byte, 0, len(exigidos))
+	for _, tipo := range exigidos {
+		arquivos := r.MultipartForm.File[tipo]
+		if len(arquivos) != 1 {
+			return nil, ErrDocumentoAusente
+		}
+		conteudo, tipoConteudo, err := leDocumento(arquivos[0])
+		if !erros.Vazio(err) {
+			return nil, err
+		}
+		chave, err2 := aleatorio(16)
+		if err2 != nil {
+			return nil, erros.CriaInternoPadrao(err2)
+		}
+		s.Documentos = append(s.Documentos, database.DocumentoKYC{
+			Tipo:         tipo,
+			Arquivo:      chave + tiposAceitos[tipoConteudo],
+			TipoConteudo: tipoConteudo,
+			Tamanho:      int64(len(conteudo)),
+		})
+		conteudos = append(conteudos, conteudo)
+	}
+
+	// Grava os documentos e insere a solicitação. Se a inserção falhar, os
+	// documentos já gravados são removidos.
+	for i, d := range s.Documentos {
+		if err := armazenamento.Grava(d.Arquivo, bytes.NewReader(conteudos[i])); err != nil {
+			removeDocumentos(s.Documentos[:i])
+			return nil, erros.CriaInternoPadrao(err)
+		}
+	}
+	id, err := database.InsereSolicitacaoKYC(s)
+	if err != nil {
+		removeDocumentos(s.Documentos)
+		if err == database.ErrSolicitacaoPendente {
+			return nil, ErrSolicitacaoPendente
+		}
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	s.ID = id
+
+	resposta, err := json.Marshal(s)
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	return resposta, erros.CriaVazio()
+}
+
+// VerificacaoHTTP retorna os bytes da string JSON com o nível de verificação
+// atual do usuário e todas as suas solicitações, em ordem de criação
+func VerificacaoHTTP(email string) ([]byte, erros.Erros) {
+	usr, err := database.AdquireUsuario(email)
+	if err == database.ErrUsuarioNaoExiste {
+		return nil, ErrUsuarioNaoExiste
+	} else if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	solicitacoes, err := database.AdquireSolicitacoesKYCUsuario(email)
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	resposta, err := json.Marshal(verificacaoResposta{Nivel: usr.Nivel, Solicitacoes: solicitacoes})
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	return resposta, erros.CriaVazio()
+}
+
+// SolicitacoesPendentesHTTP retorna os bytes da string JSON com todas as
+// solicitações que aguardam análise, em ordem de criação
+func SolicitacoesPendentesHTTP() ([]byte, erros.Erros) {
+	solicitacoes, err := database.AdquireSolicitacoesKYCPendentes()
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	resposta, err := json.Marshal(solicitacoes)
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	return resposta, erros.CriaVazio()
+}
+
+// DocumentoHTTP retorna o conteúdo e o tipo de conteúdo do documento
+// identificado pelo campo "id" do request
+func DocumentoHTTP(r *http.Request) ([]byte, string, erros.Erros) {
+	id, err := validaID(r)
+	if !erros.Vazio(err) {
+		return nil, "", err
+	}
+	d, err2 := database.AdquireDocumentoKYC(id)
+	if err2 == database.ErrDocumentoNaoExiste {
+		return nil, "", ErrDocumentoNaoExiste
+	} else if err2 != nil {
+		return nil, "", erros.CriaInternoPadrao(err2)
+	}
+	f, err2 := armazenamento.Abre(d.Arquivo)
+	if err2 == armazenamento.ErrNaoExiste {
+		return nil, "", ErrDocumentoNaoExiste
+	} else if err2 != nil {
+		return nil, "", erros.CriaInternoPadrao(err2)
+	}
+	defer f.Close()
+	conteudo, err2 := ioutil.ReadAll(f)
+	if err2 != nil {
+		return nil, "", erros.CriaInternoPadrao(err2)
+	}
+	return conteudo, d.TipoConteudo, erros.CriaVazio()
+}
+
+// AnalisaSolicitacaoHTTP registra a análise, pelo usuário 'analista', da
+// solicitação identificada pelo campo "id" do request. O campo "decisao" deve
+// ser "aprovar" ou "rejeitar" e o campo "motivo", com até 255 caracteres, é
+// obrigatório nas rejeições, já que é exibido ao usuário. Um analista não pode
+// analisar as próprias solicitações.
+func AnalisaSolicitacaoHTTP(r *http.Request, analista string) erros.Erros {
+	id, err := validaID(r)
+	if !erros.Vazio(err) {
+		return err
+	}
+	var aprovada bool
+	switch r.FormValue("decisao") {
+	case "aprovar":
+		aprovada = true
+	case "rejeitar":
+		aprovada = false
+	default:
+		return ErrDecisaoInvalida
+	}
+	motivo := r.FormValue("motivo")
+	if utf8.RuneCountInString(motivo) > tamanhoMaximoMotivo || (!aprovada && motivo == "") {
+		return ErrMotivoInvalido
+	}
+
+	err2 := database.AnalisaSolicitacaoKYC(id, aprovada, analista, motivo, transacao.Agora().Format(formatoData))
+	if err2 == database.ErrSolicitacaoNaoExiste {
+		return ErrSolicitacaoNaoExiste
+	} else if err2 == database.ErrAnalisePropria {
+		return ErrAnalisePropria
+	} else if err2 == database.ErrUsuarioNaoExiste {
+		return ErrUsuarioNaoExiste
+	} else if err2 != nil {
+		return erros.CriaInternoPadrao(err2)
+	}
+	return erros.CriaVazio()
+}
+
+// leDocumento lê o documento enviado e identifica seu tipo de conteúdo pelo
+// próprio conteúdo, ignorando o tipo informado pelo cliente
+func leDocumento(fh *multipart.FileHeader) ([]byte, string, erros.Erros) {
+	if fh.Size > tamanhoMaximoDocumento {
+		return nil, "", ErrDocumentoMuitoGrande
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return nil, "", erros.CriaInternoPadrao(err)
+	}
+	defer f.Close()
+	conteudo, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, "", erros.CriaInternoPadrao(err)
+	} else if len(conteudo) > tamanhoMaximoDocumento {
+		return nil, "", ErrDocumentoMuitoGrande
+	} else if len(conteudo) == 0 {
+		return nil, "", ErrDocumentoInvalido
+	}
+	tipo := http.DetectContentType(conteudo)
+	if _, ok := tiposAceitos[tipo]; !ok {
+		return nil, "", ErrDocumentoInvalido
+	}
+	return conteudo, tipo, erros.CriaVazio()
+}
+
+// removeDocumentos remove os documentos do armazenamento. As falhas são
+// apenas registradas, já que os documentos não são referenciados por nenhuma
+// solicitação.
+func removeDocumentos(documentos []database.DocumentoKYC) {
+	for _, d := range documentos {
+		if err := armazenamento.Remove(d.Arquivo); err != nil {
+			log.Printf("kyc: erro ao remover o documento %s: %s", d.Arquivo, err)
+		}
+	}
+}
+
+// validaID adquire o ID do campo "id" do request
+func validaID(r *http.Request) (int64, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return 0, erros.CriaInternoPadrao(err)
+	}
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrIDInvalido
+	}
+	return id, erros.CriaVazio()
+}
+
+// aleatorio retorna 'n' bytes aleatórios em hexadecimal
+func aleatorio(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,227 @@
+package kyc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/loteny/redcoins/armazenamento"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+// Conteúdos de documentos válidos, identificados pelos primeiros bytes
+var (
+	testPNG = "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 32)
+	testPDF = "%PDF-1.4\n" + strings.Repeat("a", 32)
+)
+
+// init deleta o banco de dados e cria um novo apenas com alguns usuários para
+// testes
+func init() {
+	if err := database.DeletaDatabaseTeste(); err != nil {
+		log.Fatalf("erro ao deletar database: %s", err)
+	}
+	if err := database.CriaDatabase(); err != nil {
+		log.Fatalf("erro ao criar database: %s", err)
+	}
+	if err := testPopulaDatabase(); err != nil {
+		log.Fatalf("erro ao popular banco de dados: %s", err)
+	}
+}
+
+func TestSolicitaVerificacaoHTTP(t *testing.T) {
+	diretorio := testArmazenamento(t)
+	defer os.RemoveAll(diretorio)
+
+	// Nível inválido, CPF não informado, documentos ausentes ou inválidos
+	casos := []struct {
+		email      string
+		nivel      string
+		documentos map[string]string
+		erro       erros.Erros
+	}{
+		{"cliente@gmail.com", "0", map[string]string{"identidade": testPNG}, ErrNivelInvalido},
+		{"cliente@gmail.com", "3", map[string]string{"identidade": testPNG}, ErrNivelInvalido},
+		{"semcpf@gmail.com", "1", map[string]string{"identidade": testPNG}, ErrCPFObrigatorio},
+		{"cliente@gmail.com", "2", map[string]string{"identidade": testPNG, "selfie": testPNG}, ErrDocumentoAusente},
+		{"cliente@gmail.com", "1", map[string]string{"identidade": "texto simples"}, ErrDocumentoInvalido},
+		{"cliente@gmail.com", "1", map[string]string{"identidade": testPNG + strings.Repeat("a", tamanhoMaximoDocumento)}, ErrDocumentoMuitoGrande},
+	}
+	for _, c := range casos {
+		if _, err := SolicitaVerificacaoHTTP(testRequestDocumentos(t, c.nivel, c.documentos), c.email); err.Error() != c.erro.Error() {
+			t.Errorf("Erro inesperado para %s (nível %s): %v", c.email, c.nivel, err)
+		}
+	}
+	if arquivos, _ := ioutil.ReadDir(diretorio); len(arquivos) != 0 {
+		t.Errorf("Documentos gravados em solicitações inválidas: %v", arquivos)
+	}
+
+	// Solicitação válida; apenas uma pode estar pendente
+	documentos := map[string]string{"identidade": testPNG, "selfie": testPNG, "comprovante_residencia": testPDF}
+	resposta, err := SolicitaVerificacaoHTTP(testRequestDocumentos(t, "2", documentos), "cliente@gmail.com")
+	if !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	s := database.SolicitacaoKYC{}
+	if err := json.Unmarshal(resposta, &s); err != nil || s.Estado != database.KYCPendente || len(s.Documentos) != 3 {
+		t.Fatalf("Resposta inesperada: %s (%v)", resposta, err)
+	}
+	if s.Documentos[2].TipoConteudo != "application/pdf" {
+		t.Errorf("Documento inesperado: %v", s.Documentos[2])
+	}
+	if _, err := SolicitaVerificacaoHTTP(testRequestDocumentos(t, "2", documentos), "cliente@gmail.com"); err.Error() != ErrSolicitacaoPendente.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if arquivos, _ := ioutil.ReadDir(diretorio); len(arquivos) != 3 {
+		t.Errorf("Documentos inesperados: %v", arquivos)
+	}
+}
+
+func TestAnalisaSolicitacaoHTTP(t *testing.T) {
+	diretorio := testArmazenamento(t)
+	defer os.RemoveAll(diretorio)
+
+	documentos := map[string]string{"identidade": testPNG}
+	if _, err := SolicitaVerificacaoHTTP(testRequestDocumentos(t, "1", documentos), "analisado@gmail.com"); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	pendentes, err := SolicitacoesPendentesHTTP()
+	if !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	solicitacoes := []database.SolicitacaoKYC{}
+	if err := json.Unmarshal(pendentes, &solicitacoes); err != nil {
+		t.Fatalf("Resposta inesperada: %s (%v)", pendentes, err)
+	}
+	var s database.SolicitacaoKYC
+	for _, p := range solicitacoes {
+		if p.Usuario == "analisado@gmail.com" {
+			s = p
+		}
+	}
+	if s.ID == 0 || len(s.Documentos) != 1 {
+		t.Fatalf("Solicitação não encontrada: %s", pendentes)
+	}
+
+	// O documento pode ser consultado pela equipe
+	id := url.Values{"id": {itoa(s.Documentos[0].ID)}}
+	conteudo, tipo, err := DocumentoHTTP(testRequestForm(t, id))
+	if !erros.Vazio(err) || string(conteudo) != testPNG || tipo != "image/png" {
+		t.Errorf("Documento inesperado: %q %s (%v)", conteudo, tipo, err)
+	}
+	if _, _, err := DocumentoHTTP(testRequestForm(t, url.Values{"id": {"999"}})); err.Error() != ErrDocumentoNaoExiste.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Decisões inválidas, rejeição sem motivo e análise própria
+	casos := []struct {
+		form     url.Values
+		analista string
+		erro     erros.Erros
+	}{
+		{url.Values{"id": {"abc"}, "decisao": {"aprovar"}}, "suporte@gmail.com", ErrIDInvalido},
+		{url.Values{"id": {itoa(s.ID)}, "decisao": {"talvez"}}, "suporte@gmail.com", ErrDecisaoInvalida},
+		{url.Values{"id": {itoa(s.ID)}, "decisao": {"rejeitar"}}, "suporte@gmail.com", ErrMotivoInvalido},
+		{url.Values{"id": {itoa(s.ID)}, "decisao": {"aprovar"}}, "analisado@gmail.com", ErrAnalisePropria},
+		{url.Values{"id": {"999"}, "decisao": {"aprovar"}}, "suporte@gmail.com", ErrSolicitacaoNaoExiste},
+	}
+	for _, c := range casos {
+		if err := AnalisaSolicitacaoHTTP(testRequestForm(t, c.form), c.analista); err.Error() != c.erro.Error() {
+			t.Errorf("Erro inesperado para %v: %v", c.form, err)
+		}
+	}
+
+	// Aprovação eleva o nível do usuário
+	form := url.Values{"id": {itoa(s.ID)}, "decisao": {"aprovar"}}
+	if err := AnalisaSolicitacaoHTTP(testRequestForm(t, form), "suporte@gmail.com"); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	resposta, err := VerificacaoHTTP("analisado@gmail.com")
+	if !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	v := verificacaoResposta{}
+	if err := json.Unmarshal(resposta, &v); err != nil || v.Nivel != 1 || len(v.Solicitacoes) != 1 ||
+		v.Solicitacoes[0].Estado != database.KYCAprovada || v.Solicitacoes[0].Analista != "suporte@gmail.com" {
+		t.Errorf("Resposta inesperada: %s (%v)", resposta, err)
+	}
+	// O nível concedido não pode ser solicitado novamente
+	if _, err := SolicitaVerificacaoHTTP(testRequestDocumentos(t, "1", documentos), "analisado@gmail.com"); err.Error() != ErrNivelJaConcedido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+// testArmazenamento substitui o armazenamento padrão por um diretório
+// temporário, que é retornado
+func testArmazenamento(t *testing.T) string {
+	diretorio, err := ioutil.TempDir("", "kyc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	armazenamento.DefinePadrao(armazenamento.Local{Diretorio: diretorio})
+	return diretorio
+}
+
+// testRequestDocumentos cria um request multipart com o nível e os documentos
+// passados
+func testRequestDocumentos(t *testing.T, nivel string, documentos map[string]string) *http.Request {
+	corpo := &bytes.Buffer{}
+	w := multipart.NewWriter(corpo)
+	w.WriteField("nivel", nivel)
+	for tipo, conteudo := range documentos {
+		f, err := w.CreateFormFile(tipo, tipo+".bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(conteudo))
+	}
+	w.Close()
+	r, err := http.NewRequest("POST", "/", corpo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Add("Content-Type", w.FormDataContentType())
+	return r
+}
+
+// testRequestForm cria um request com os campos de 'form' no corpo
+func testRequestForm(t *testing.T, form url.Values) *http.Request {
+	r, err := http.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// itoa converte o ID para string
+func itoa(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+func testPopulaDatabase() error {
+	usuarios := []database.Usuario{
+		{Email: "cliente@gmail.com", CPF: "52998224725"},
+		{Email: "semcpf@gmail.com"},
+		{Email: "analisado@gmail.com", CPF: "11144477735"},
+		{Email: "suporte@gmail.com", Papel: database.PapelSuporte},
+	}
+	for _, usr := range usuarios {
+		usr.Senha = []byte("senha")
+		usr.Nome = "Conta KYC"
+		usr.Nascimento = "1994-03-07"
+		if err := database.InsereUsuario(&usr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,30 +1,232 @@
+// Package passenc trata da encriptação das senhas dos usuários. As senhas são
+// armazenadas em strings auto-descritivas no formato PHC, que identificam o
+// algoritmo e os parâmetros utilizados, de forma que senhas geradas com
+// configurações antigas continuem válidas e possam ser atualizadas.
 package passenc
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"golang.org/x/crypto/argon2"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// GeraHashed gera uma array de bytes contendo as informações do algoritmo de
-// encriptação, o salt utilizado e a senha hashed.
-// O resultado possui entre 59 e 60 bytes.
-// Até 50 bytes, a senha é garantida de funcionar como esperado. Além dessa
-// quantidade, problemas indesejados como truncamento de senha podem ocorrer.
+// Lista de possíveis erros do módulo
+var (
+	ErrAlgoritmoInvalido = errors.New("passenc: algoritmo inválido")
+	ErrHashInvalido      = errors.New("passenc: hash inválido")
+	ErrSenhaMuitoLonga   = errors.New("passenc: senha muito longa")
+)
+
+// Algoritmos suportados
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// Tamanhos máximos das senhas, em bytes, para cada algoritmo. O bcrypt ignora
+// os bytes além de 72; o Argon2id não possui limite, mas senhas muito longas
+// tornam o hashing desnecessariamente custoso.
+const (
+	tamanhoMaximoBcrypt   = 72
+	tamanhoMaximoArgon2id = 256
+)
+
+// Tamanhos do salt e do hash do Argon2id, em bytes
+const (
+	tamanhoSaltArgon2id = 16
+	tamanhoHashArgon2id = 32
+)
+
+// Parametros são o algoritmo e os parâmetros utilizados para gerar as senhas
+// hashed. 'Custo' é utilizado apenas pelo bcrypt; 'Memoria' (em KiB),
+// 'Iteracoes' e 'Paralelismo', apenas pelo Argon2id.
+type Parametros struct {
+	Algoritmo   string
+	Custo       int
+	Memoria     uint32
+	Iteracoes   uint32
+	Paralelismo uint8
+}
+
+// padrao são os parâmetros utilizados para gerar novas senhas hashed
+var padrao Parametros
+
+func init() {
+	// Inicializa os parâmetros com as variáveis de ambiente. Por padrão, é
+	// utilizado o Argon2id com 19 MiB de memória, 2 iterações e paralelismo 1;
+	// com o bcrypt, o custo padrão é 12.
+	padrao = Parametros{
+		Algoritmo:   os.Getenv("REDCOINS_PE_ALGORITMO"),
+		Custo:       inteiroVariavel("REDCOINS_PE_CUSTO", 12),
+		Memoria:     uint32(inteiroVariavel("REDCOINS_PE_MEMORIA", 19*1024)),
+		Iteracoes:   uint32(inteiroVariavel("REDCOINS_PE_ITERACOES", 2)),
+		Paralelismo: uint8(inteiroVariavel("REDCOINS_PE_PARALELISMO", 1)),
+	}
+	if padrao.Algoritmo == "" {
+		padrao.Algoritmo = Argon2id
+	}
+	if err := padrao.valida(); err != nil {
+		log.Fatalf("passenc: %s", err)
+	}
+}
+
+// inteiroVariavel retorna o inteiro positivo da variável de ambiente passada
+// ou 'padrao' se a variável não está definida ou é inválida
+func inteiroVariavel(variavel string, padrao int) int {
+	if n, err := strconv.Atoi(os.Getenv(variavel)); err == nil && n > 0 {
+		return n
+	}
+	return padrao
+}
+
+// valida verifica se o algoritmo é suportado e se os parâmetros são válidos
+// para ele
+func (p Parametros) valida() error {
+	switch p.Algoritmo {
+	case Bcrypt:
+		if p.Custo < bcrypt.MinCost || p.Custo > bcrypt.MaxCost {
+			return fmt.Errorf("passenc: custo do bcrypt inválido: %d", p.Custo)
+		}
+	case Argon2id:
+		if p.Memoria < 8*uint32(p.Paralelismo) || p.Iteracoes < 1 || p.Paralelismo < 1 {
+			return fmt.Errorf("passenc: parâmetros do Argon2id inválidos: %+v", p)
+		}
+	default:
+		return ErrAlgoritmoInvalido
+	}
+	return nil
+}
+
+// TamanhoMaximo retorna o tamanho máximo, em bytes, das senhas aceitas pelo
+// algoritmo configurado
+func TamanhoMaximo() int {
+	if padrao.Algoritmo == Bcrypt {
+		return tamanhoMaximoBcrypt
+	}
+	return tamanhoMaximoArgon2id
+}
+
+// GeraHashed gera a string PHC da senha com os parâmetros configurados,
+// contendo o algoritmo, seus parâmetros, o salt utilizado e a senha hashed.
+// Retorna ErrSenhaMuitoLonga se a senha excede TamanhoMaximo.
 func GeraHashed(senha []byte) ([]byte, error) {
-	hash, err := bcrypt.GenerateFromPassword(senha, bcrypt.MinCost)
-	if err != nil {
-		return []byte{}, err
+	return GeraHashedParametros(senha, padrao)
+}
+
+// GeraHashedParametros gera a string PHC da senha com os parâmetros passados.
+// O bcrypt utiliza seu próprio formato ("$2a$..."), que também identifica o
+// algoritmo e o custo.
+func GeraHashedParametros(senha []byte, p Parametros) ([]byte, error) {
+	if err := p.valida(); err != nil {
+		return nil, err
 	}
-	return hash, nil
+	if p.Algoritmo == Bcrypt {
+		if len(senha) > tamanhoMaximoBcrypt {
+			return nil, ErrSenhaMuitoLonga
+		}
+		return bcrypt.GenerateFromPassword(senha, p.Custo)
+	}
+
+	if len(senha) > tamanhoMaximoArgon2id {
+		return nil, ErrSenhaMuitoLonga
+	}
+	salt := make([]byte, tamanhoSaltArgon2id)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	hash := argon2.IDKey(senha, salt, p.Iteracoes, p.Memoria, p.Paralelismo, tamanhoHashArgon2id)
+	return []byte(fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		Argon2id, argon2.Version, p.Memoria, p.Iteracoes, p.Paralelismo,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(hash))), nil
 }
 
 // VerificaSenha checa se a senha e a senha hashed passada são equivalentes. O
-// retorno da função indica se são.
+// retorno da função indica se são. O algoritmo é identificado pela própria
+// senha hashed.
 func VerificaSenha(senha, senhaHashed []byte) (bool, error) {
-	err := bcrypt.CompareHashAndPassword(senhaHashed, senha)
-	if err == bcrypt.ErrMismatchedHashAndPassword {
-		return false, nil
-	} else if err != nil {
+	p, salt, hash, err := decodifica(senhaHashed)
+	if err != nil {
 		return false, err
 	}
-	return true, nil
+	if p.Algoritmo == Bcrypt {
+		if len(senha) > tamanhoMaximoBcrypt {
+			return false, nil
+		}
+		err := bcrypt.CompareHashAndPassword(senhaHashed, senha)
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	if len(senha) > tamanhoMaximoArgon2id {
+		return false, nil
+	}
+	calculado := argon2.IDKey(senha, salt, p.Iteracoes, p.Memoria, p.Paralelismo, uint32(len(hash)))
+	return subtle.ConstantTimeCompare(calculado, hash) == 1, nil
+}
+
+// PrecisaRehash retorna se a senha hashed foi gerada com um algoritmo ou
+// parâmetros diferentes dos configurados, devendo ser gerada novamente no
+// próximo login bem-sucedido
+func PrecisaRehash(senhaHashed []byte) bool {
+	p, _, _, err := decodifica(senhaHashed)
+	if err != nil {
+		return false
+	} else if p.Algoritmo != padrao.Algoritmo {
+		return true
+	} else if p.Algoritmo == Bcrypt {
+		return p.Custo != padrao.Custo
+	}
+	return p.Memoria != padrao.Memoria || p.Iteracoes != padrao.Iteracoes ||
+		p.Paralelismo != padrao.Paralelismo
+}
+
+// decodifica identifica o algoritmo e os parâmetros de uma senha hashed. Para
+// o Argon2id, também retorna o salt e o hash.
+func decodifica(senhaHashed []byte) (Parametros, []byte, []byte, error) {
+	if bytes.HasPrefix(senhaHashed, []byte("$2")) {
+		custo, err := bcrypt.Cost(senhaHashed)
+		if err != nil {
+			return Parametros{}, nil, nil, ErrHashInvalido
+		}
+		return Parametros{Algoritmo: Bcrypt, Custo: custo}, nil, nil, nil
+	}
+
+	partes := bytes.Split(senhaHashed, []byte("$"))
+	if len(partes) != 6 || len(partes[0]) != 0 || string(partes[1]) != Argon2id {
+		return Parametros{}, nil, nil, ErrHashInvalido
+	}
+	var versao int
+	if _, err := fmt.Sscanf(string(partes[2]), "v=%d", &versao); err != nil || versao != argon2.Version {
+		return Parametros{}, nil, nil, ErrHashInvalido
+	}
+	p := Parametros{Algoritmo: Argon2id}
+	if _, err := fmt.Sscanf(string(partes[3]), "m=%d,t=%d,p=%d", &p.Memoria, &p.Iteracoes, &p.Paralelismo); err != nil {
+		return Parametros{}, nil, nil, ErrHashInvalido
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(string(partes[4]))
+	if err != nil {
+		return Parametros{}, nil, nil, ErrHashInvalido
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(string(partes[5]))
+	if err != nil || len(hash) == 0 {
+		return Parametros{}, nil, nil, ErrHashInvalido
+	}
+	if err := p.valida(); err != nil {
+		return Parametros{}, nil, nil, ErrHashInvalido
+	}
+	return p, salt, hash, nil
 }
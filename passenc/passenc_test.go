@@ -1,6 +1,8 @@
 package passenc
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"golang.org/x/crypto/bcrypt"
@@ -11,36 +13,99 @@ func TestGeraHashed(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Erro inesperado: %v", err)
 	}
-	// Checa manualmente a validade do resultado da função
-	err = bcrypt.CompareHashAndPassword(hashed, []byte("123456"))
+	// Checa o formato PHC do resultado
+	if !bytes.HasPrefix(hashed, []byte("$argon2id$v=19$m=19456,t=2,p=1$")) {
+		t.Errorf("Formato inesperado: %s", hashed)
+	}
+	if PrecisaRehash(hashed) {
+		t.Errorf("Rehash inesperado para os parâmetros padrões")
+	}
+	// Cada senha hashed utiliza um salt diferente
+	if outro, _ := GeraHashed([]byte("123456")); bytes.Equal(hashed, outro) {
+		t.Errorf("Senhas hashed iguais: %s", hashed)
+	}
+	// Senha acima do tamanho máximo
+	if _, err := GeraHashed(bytes.Repeat([]byte("a"), TamanhoMaximo()+1)); err != ErrSenhaMuitoLonga {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+func TestGeraHashedBcrypt(t *testing.T) {
+	p := Parametros{Algoritmo: Bcrypt, Custo: bcrypt.MinCost}
+	hashed, err := GeraHashedParametros([]byte("123456"), p)
 	if err != nil {
-		t.Errorf("Resultado do hashing inválido: %v", err)
+		t.Fatalf("Erro inesperado: %v", err)
 	}
-	// Checa a verificação para uma senha incorreta
-	err = bcrypt.CompareHashAndPassword(hashed, []byte("1234567"))
-	if err != bcrypt.ErrMismatchedHashAndPassword {
+	// Checa manualmente a validade do resultado da função
+	if err := bcrypt.CompareHashAndPassword(hashed, []byte("123456")); err != nil {
 		t.Errorf("Resultado do hashing inválido: %v", err)
 	}
+	if _, err := GeraHashedParametros(bytes.Repeat([]byte("a"), 73), p); err != ErrSenhaMuitoLonga {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if _, err := GeraHashedParametros([]byte("123456"), Parametros{Algoritmo: "md5"}); err != ErrAlgoritmoInvalido {
+		t.Errorf("Erro inesperado: %v", err)
+	}
 }
 
 func TestChecaSenha(t *testing.T) {
 	senha := []byte("123456")
-	hash, err := bcrypt.GenerateFromPassword(senha, bcrypt.MinCost)
+	bcryptHash, err := bcrypt.GenerateFromPassword(senha, bcrypt.MinCost)
 	if err != nil {
 		t.Fatalf("Erro inesperado: %v", err)
 	}
-	// Checa senha válida
-	valido, err := VerificaSenha(senha, hash)
+	argon2Hash, err := GeraHashedParametros(senha, Parametros{Algoritmo: Argon2id, Memoria: 64, Iteracoes: 1, Paralelismo: 1})
 	if err != nil {
-		t.Errorf("Erro inesperado: %v", err)
-	} else if !valido {
-		t.Error("Senha considerada inválida quando deveria ser válida.")
+		t.Fatalf("Erro inesperado: %v", err)
 	}
-	// Checa senha inválida
-	valido, err = VerificaSenha([]byte("1234567"), hash)
-	if err != nil {
-		t.Errorf("Erro inesperado: %v", err)
-	} else if valido {
-		t.Error("Senha considerada válida quando deveria ser inválida.")
+	for _, hash := range [][]byte{bcryptHash, argon2Hash} {
+		// Checa senha válida
+		valido, err := VerificaSenha(senha, hash)
+		if err != nil {
+			t.Errorf("Erro inesperado: %v", err)
+		} else if !valido {
+			t.Errorf("Senha considerada inválida quando deveria ser válida: %s", hash)
+		}
+		// Checa senha inválida
+		valido, err = VerificaSenha([]byte("1234567"), hash)
+		if err != nil {
+			t.Errorf("Erro inesperado: %v", err)
+		} else if valido {
+			t.Errorf("Senha considerada válida quando deveria ser inválida: %s", hash)
+		}
+		// Hashes com parâmetros diferentes dos configurados são atualizados
+		if !PrecisaRehash(hash) {
+			t.Errorf("Rehash esperado para %s", hash)
+		}
+	}
+	// Senhas longas são recusadas sem erro
+	if valido, err := VerificaSenha(bytes.Repeat([]byte("a"), 100), bcryptHash); valido || err != nil {
+		t.Errorf("Retorno inesperado: %v (%v)", valido, err)
+	}
+}
+
+func TestDecodifica(t *testing.T) {
+	invalidos := []string{
+		"",
+		"senhavalido1",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=18$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=x,t=1,p=1$c2FsdA$aGFzaA",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$!!",
+		"$argon2i$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA",
+		"$2a$99$" + strings.Repeat("a", 53),
+	}
+	for _, hash := range invalidos {
+		if _, _, _, err := decodifica([]byte(hash)); err != ErrHashInvalido {
+			t.Errorf("Erro inesperado para %q: %v", hash, err)
+		}
+		if _, err := VerificaSenha([]byte("123456"), []byte(hash)); err == nil {
+			t.Errorf("Erro esperado para %q", hash)
+		}
+	}
+	p, salt, hash, err := decodifica([]byte("$argon2id$v=19$m=64,t=1,p=2$c2FsdA$aGFzaA"))
+	esperado := Parametros{Algoritmo: Argon2id, Memoria: 64, Iteracoes: 1, Paralelismo: 2}
+	if err != nil || p != esperado || string(salt) != "salt" || string(hash) != "hash" {
+		t.Errorf("Retorno inesperado: %+v %s %s (%v)", p, salt, hash, err)
 	}
 }
@@ -0,0 +1,94 @@
+package planos
+
+// Esse arquivo define o agendador que executa os planos de compra recorrente
+// pendentes
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// intervalo é o tempo entre duas verificações de planos pendentes pelo
+// agendador
+var intervalo time.Duration
+
+func init() {
+	// Inicializa as configurações da package com as variáveis de ambiente. O
+	// intervalo é dado em segundos e é de um minuto por padrão.
+	intervalo = time.Minute
+	if s, err := strconv.Atoi(os.Getenv("REDCOINS_PL_INTERVALO")); err == nil && s > 0 {
+		intervalo = time.Duration(s) * time.Second
+	}
+}
+
+// IniciaAgendador inicia, em uma nova goroutine, o agendador que executa os
+// planos pendentes periodicamente
+func IniciaAgendador() {
+	go func() {
+		ticker := time.NewTicker(intervalo)
+		defer ticker.Stop()
+		for {
+			executaPlanosPendentes(transacao.Agora())
+			<-ticker.C
+		}
+	}()
+}
+
+// executaPlanosPendentes executa todos os planos ativos cuja próxima execução
+// é anterior ou igual a 'agora'
+func executaPlanosPendentes(agora time.Time) {
+	planos, err := database.AdquirePlanosPendentes(agora.Format(formatoMomento))
+	if err != nil {
+		log.Printf("planos: executaPlanosPendentes: %s", err)
+		return
+	}
+	for _, p := range planos {
+		executaPlano(p, agora)
+	}
+}
+
+// executaPlano realiza uma execução de um plano pendente e registra seu
+// resultado. Antes da compra, a próxima execução do plano é avançada; se outro
+// agendador já o fez, o plano não é executado novamente. Se a compra não pode
+// ser realizada (por exemplo, se o preço da Bitcoin não está disponível ou o
+// usuário não pode realizar a transação), a execução é pulada e o motivo é
+// registrado.
+func executaPlano(p database.Plano, agora time.Time) {
+	proxima, err := proximaExecucao(p, agora)
+	if err != nil {
+		log.Printf("planos: executaPlano: plano %d: %s", p.ID, err)
+		if err := database.AlteraEstadoPlano(p.Usuario, p.ID, database.PlanoPausado); err != nil {
+			log.Printf("planos: executaPlano: plano %d: %s", p.ID, err)
+		}
+		return
+	}
+	avancado, err := database.AvancaPlano(p.ID, p.ProximaExecucao, proxima.Format(formatoMomento))
+	if err != nil {
+		log.Printf("planos: executaPlano: plano %d: %s", p.ID, err)
+		return
+	} else if !avancado {
+		return
+	}
+
+	ex := database.ExecucaoPlano{Momento: agora.Format(formatoMomento)}
+	bitcoins, creditos, errTr := transacao.CompraValor(p.Usuario, p.Valor)
+	if erros.Vazio(errTr) {
+		ex.Sucesso = true
+		ex.Resultado = "sucesso"
+		ex.Bitcoins = bitcoins
+		ex.Creditos = creditos
+	} else if interno, _, _ := erros.Abre(errTr); interno {
+		ex.Resultado = "erro_interno"
+	} else {
+		ex.Resultado = erros.Lista(errTr)[0]
+	}
+	if err := database.RegistraExecucaoPlano(p.ID, ex); err != nil {
+		log.Printf("planos: executaPlano: plano %d: %s", p.ID, err)
+	}
+}
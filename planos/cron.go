@@ -0,0 +1,149 @@
+package planos
+
+// Esse arquivo define a interpretação das expressões cron utilizadas pelos
+// planos de compra recorrente
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Erros possíveis das expressões cron
+var (
+	errCronInvalido   = errors.New("expressão cron inválida")
+	errCronSemHorario = errors.New("expressão cron sem horário possível")
+)
+
+// cron é uma expressão cron interpretada no formato de cinco campos
+// (minuto, hora, dia do mês, mês e dia da semana). Cada campo é armazenado como
+// um conjunto de valores permitidos.
+type cron struct {
+	minutos    map[int]bool
+	horas      map[int]bool
+	diasMes    map[int]bool
+	meses      map[int]bool
+	diasSemana map[int]bool
+	// diaMesLivre e diaSemanaLivre indicam se os respectivos campos são "*".
+	// Quando os dois campos são restritos, basta que um deles seja satisfeito,
+	// assim como no cron tradicional.
+	diaMesLivre    bool
+	diaSemanaLivre bool
+}
+
+// interpretaCron interpreta uma expressão cron de cinco campos. Cada campo
+// aceita "*", valores únicos, intervalos ("1-5"), listas ("1,3,5") e passos
+// ("*/15" ou "0-30/10"). No dia da semana, 0 e 7 representam o domingo.
+func interpretaCron(expressao string) (cron, error) {
+	campos := strings.Fields(expressao)
+	if len(campos) != 5 {
+		return cron{}, errCronInvalido
+	}
+	var c cron
+	var err error
+	if c.minutos, err = interpretaCampoCron(campos[0], 0, 59); err != nil {
+		return cron{}, err
+	}
+	if c.horas, err = interpretaCampoCron(campos[1], 0, 23); err != nil {
+		return cron{}, err
+	}
+	if c.diasMes, err = interpretaCampoCron(campos[2], 1, 31); err != nil {
+		return cron{}, err
+	}
+	if c.meses, err = interpretaCampoCron(campos[3], 1, 12); err != nil {
+		return cron{}, err
+	}
+	if c.diasSemana, err = interpretaCampoCron(campos[4], 0, 7); err != nil {
+		return cron{}, err
+	}
+	if c.diasSemana[7] {
+		c.diasSemana[0] = true
+	}
+	c.diaMesLivre = campos[2] == "*"
+	c.diaSemanaLivre = campos[4] == "*"
+	return c, nil
+}
+
+// proxima retorna o primeiro horário estritamente posterior a 't' (com precisão
+// de minutos) que satisfaz a expressão. Retorna errCronSemHorario caso nenhum
+// horário nos próximos cinco anos satisfaça a expressão (por exemplo, em
+// "0 0 30 2 *").
+func (c cron) proxima(t time.Time) (time.Time, error) {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limite := t.AddDate(5, 0, 0)
+	for t.Before(limite) {
+		if !c.meses[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.diaPermitido(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.horas[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.minutos[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, nil
+	}
+	return time.Time{}, errCronSemHorario
+}
+
+// diaPermitido verifica se o dia de 't' satisfaz os campos de dia do mês e dia
+// da semana da expressão
+func (c cron) diaPermitido(t time.Time) bool {
+	diaMes := c.diasMes[t.Day()]
+	diaSemana := c.diasSemana[int(t.Weekday())]
+	if c.diaMesLivre || c.diaSemanaLivre {
+		return diaMes && diaSemana
+	}
+	return diaMes || diaSemana
+}
+
+// interpretaCampoCron interpreta um campo de uma expressão cron e retorna o
+// conjunto de valores permitidos entre 'min' e 'max'
+func interpretaCampoCron(campo string, min int, max int) (map[int]bool, error) {
+	valores := make(map[int]bool)
+	for _, parte := range strings.Split(campo, ",") {
+		// Separa o passo, se existir
+		passo := 1
+		if i := strings.Index(parte, "/"); i >= 0 {
+			p, err := strconv.Atoi(parte[i+1:])
+			if err != nil || p <= 0 {
+				return nil, errCronInvalido
+			}
+			passo = p
+			parte = parte[:i]
+		}
+		// Define o intervalo da parte
+		inicio, fim := min, max
+		if parte != "*" {
+			limites := strings.SplitN(parte, "-", 2)
+			var err error
+			if inicio, err = strconv.Atoi(limites[0]); err != nil {
+				return nil, errCronInvalido
+			}
+			fim = inicio
+			if len(limites) == 2 {
+				if fim, err = strconv.Atoi(limites[1]); err != nil {
+					return nil, errCronInvalido
+				}
+			} else if passo > 1 {
+				// "5/15" equivale a "5-max/15"
+				fim = max
+			}
+		}
+		if inicio < min || fim > max || inicio > fim {
+			return nil, errCronInvalido
+		}
+		for v := inicio; v <= fim; v += passo {
+			valores[v] = true
+		}
+	}
+	return valores, nil
+}
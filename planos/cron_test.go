@@ -0,0 +1,85 @@
+package planos
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+)
+
+func TestInterpretaCron(t *testing.T) {
+	// Expressões válidas
+	validas := []string{"* * * * *", "0 9 * * 1", "*/15 0-6 1,15 * 1-5", "30 12 1 */3 7", "5/10 * * * *"}
+	for _, e := range validas {
+		if _, err := interpretaCron(e); err != nil {
+			t.Errorf("Expressão deveria ser válida: %v (%v)", e, err)
+		}
+	}
+	// Expressões inválidas
+	invalidas := []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"}
+	for _, e := range invalidas {
+		if _, err := interpretaCron(e); err == nil {
+			t.Errorf("Expressão deveria ser inválida: %v", e)
+		}
+	}
+}
+
+func TestCronProxima(t *testing.T) {
+	// 2019-01-22 foi uma terça-feira
+	base := time.Date(2019, 1, 22, 10, 30, 0, 0, time.UTC)
+	casos := map[string]time.Time{
+		"* * * * *":     time.Date(2019, 1, 22, 10, 31, 0, 0, time.UTC),
+		"0 9 * * 1":     time.Date(2019, 1, 28, 9, 0, 0, 0, time.UTC),
+		"0 12 * * *":    time.Date(2019, 1, 22, 12, 0, 0, 0, time.UTC),
+		"0 0 1 * *":     time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":    time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		"*/20 10 * * *": time.Date(2019, 1, 22, 10, 40, 0, 0, time.UTC),
+		// Dia do mês ou dia da semana: dia 25 (sexta-feira) ou segunda-feira
+		"0 0 25 * 1": time.Date(2019, 1, 25, 0, 0, 0, 0, time.UTC),
+	}
+	for e, esperado := range casos {
+		c, err := interpretaCron(e)
+		if err != nil {
+			t.Fatalf("Erro inesperado: %v", err)
+		}
+		if proxima, err := c.proxima(base); err != nil {
+			t.Errorf("Erro inesperado para %v: %v", e, err)
+		} else if !proxima.Equal(esperado) {
+			t.Errorf("Próxima execução incorreta para %v: %v (esperado %v)", e, proxima, esperado)
+		}
+	}
+
+	// Expressão sem horário possível
+	c, err := interpretaCron("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if _, err := c.proxima(base); err != errCronSemHorario {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+func TestProximaExecucao(t *testing.T) {
+	depois := time.Date(2019, 3, 1, 0, 0, 0, 0, time.Local)
+	// Plano semanal atrasado: mantém o dia da semana e horário
+	p := database.Plano{Frequencia: frequenciaSemanal, ProximaExecucao: "2019-02-12 09:00:00"}
+	if proxima, err := proximaExecucao(p, depois); err != nil {
+		t.Errorf("Erro inesperado: %v", err)
+	} else if proxima.Format(formatoMomento) != "2019-03-05 09:00:00" {
+		t.Errorf("Próxima execução incorreta: %v", proxima)
+	}
+	// Plano mensal no último dia do mês
+	p = database.Plano{Frequencia: frequenciaMensal, ProximaExecucao: "2019-01-31 09:00:00"}
+	if proxima, err := proximaExecucao(p, time.Date(2019, 2, 1, 0, 0, 0, 0, time.Local)); err != nil {
+		t.Errorf("Erro inesperado: %v", err)
+	} else if proxima.Format(formatoMomento) != "2019-02-28 09:00:00" {
+		t.Errorf("Próxima execução incorreta: %v", proxima)
+	}
+	// Plano com expressão cron
+	p = database.Plano{Frequencia: frequenciaCron, Expressao: "0 9 * * 1"}
+	if proxima, err := proximaExecucao(p, depois); err != nil {
+		t.Errorf("Erro inesperado: %v", err)
+	} else if proxima.Format(formatoMomento) != "2019-03-04 09:00:00" {
+		t.Errorf("Próxima execução incorreta: %v", proxima)
+	}
+}
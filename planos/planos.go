@@ -0,0 +1,251 @@
+// Package planos trata dos planos de compra recorrente de Bitcoins: criação,
+// pausa e remoção dos planos pelos usuários e a execução periódica dos planos
+// pendentes por um agendador interno ao servidor.
+// Esse package usa exclusivamente a estrutura de erros 'erros.Erros'.
+package planos
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// Lista de possíveis erros do módulo
+var (
+	ErrValorInvalido      = erros.Cria(false, 400, "valor_invalido")
+	ErrFrequenciaInvalida = erros.Cria(false, 400, "frequencia_invalida")
+	ErrExpressaoInvalida  = erros.Cria(false, 400, "expressao_invalida")
+	ErrInicioInvalido     = erros.Cria(false, 400, "inicio_invalido")
+	ErrIDInvalido         = erros.Cria(false, 400, "id_invalido")
+	ErrPlanoNaoExiste     = erros.Cria(false, 404, "plano_nao_existente")
+)
+
+// Frequências possíveis de um plano
+const (
+	frequenciaSemanal = "semanal"
+	frequenciaMensal  = "mensal"
+	frequenciaCron    = "cron"
+)
+
+// formatoMomento é o formato das datas e horários dos planos e das execuções,
+// idêntico ao formato DATETIME do MySQL
+const formatoMomento = "2006-01-02 15:04:05"
+
+// CriaPlanoHTTP cria um plano de compra recorrente para o usuário a partir de
+// um request HTTP. O request deve conter os campos "valor" (reais gastos em cada
+// execução) e "frequencia" ("semanal", "mensal" ou "cron"). Para a frequência
+// "cron", o campo "expressao" deve conter a expressão cron de cinco campos. O
+// campo opcional "inicio" ("YYYY-MM-DD HH:MM") define a primeira execução dos
+// planos semanais e mensais; se omitido, a primeira execução é imediata.
+// Retorna os bytes da string JSON do plano criado.
+func CriaPlanoHTTP(r *http.Request, email string) ([]byte, erros.Erros) {
+	plano, err := validaDadosPlano(r, transacao.Agora())
+	if !erros.Vazio(err) {
+		return nil, err
+	}
+	plano.Usuario = email
+	if err := database.InserePlano(&plano); err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	planoBytes, err2 := json.Marshal(plano)
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	return planoBytes, erros.CriaVazio()
+}
+
+// PlanosUsuarioHTTP retorna os bytes da string JSON com todos os planos não
+// removidos do usuário
+func PlanosUsuarioHTTP(email string) ([]byte, erros.Erros) {
+	planos, err := database.AdquirePlanosDeUsuario(email)
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	planosBytes, err := json.Marshal(map[string][]database.Plano{"planos": planos})
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	return planosBytes, erros.CriaVazio()
+}
+
+// ExecucoesPlanoHTTP retorna os bytes da string JSON com o histórico de
+// execuções do plano identificado pelo campo "id" do request
+func ExecucoesPlanoHTTP(r *http.Request, email string) ([]byte, erros.Erros) {
+	id, err := validaIDPlano(r)
+	if !erros.Vazio(err) {
+		return nil, err
+	}
+	execucoes, err2 := database.AdquireExecucoesPlano(email, id)
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	exBytes, err2 := json.Marshal(map[string][]database.ExecucaoPlano{"execucoes": execucoes})
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	return exBytes, erros.CriaVazio()
+}
+
+// PausaPlanoHTTP pausa o plano identificado pelo campo "id" do request. Um
+// plano pausado não é executado até ser retomado.
+func PausaPlanoHTTP(r *http.Request, email string) erros.Erros {
+	id, err := validaIDPlano(r)
+	if !erros.Vazio(err) {
+		return err
+	}
+	return converteErroDatabase(database.AlteraEstadoPlano(email, id, database.PlanoPausado))
+}
+
+// RetomaPlanoHTTP reativa o plano identificado pelo campo "id" do request. As
+// execuções perdidas enquanto o plano esteve pausado não são realizadas: a
+// próxima execução é calculada a partir do momento em que o plano é retomado.
+func RetomaPlanoHTTP(r *http.Request, email string) erros.Erros {
+	id, err := validaIDPlano(r)
+	if !erros.Vazio(err) {
+		return err
+	}
+	planos, err2 := database.AdquirePlanosDeUsuario(email)
+	if err2 != nil {
+		return erros.CriaInternoPadrao(err2)
+	}
+	for _, p := range planos {
+		if p.ID != id {
+			continue
+		}
+		agora := transacao.Agora()
+		proxima, err := proximaExecucao(p, agora)
+		if err != nil {
+			return erros.CriaInternoPadrao(err)
+		}
+		// Um plano semanal ou mensal cuja próxima execução ainda não passou
+		// mantém sua data original
+		if anterior, err := time.ParseInLocation(formatoMomento, p.ProximaExecucao, transacao.Fuso()); err == nil && anterior.After(agora) {
+			proxima = anterior
+		}
+		return converteErroDatabase(database.RetomaPlano(email, id, proxima.Format(formatoMomento)))
+	}
+	return ErrPlanoNaoExiste
+}
+
+// RemovePlanoHTTP remove o plano identificado pelo campo "id" do request. O
+// histórico de execuções do plano é mantido.
+func RemovePlanoHTTP(r *http.Request, email string) erros.Erros {
+	id, err := validaIDPlano(r)
+	if !erros.Vazio(err) {
+		return err
+	}
+	return converteErroDatabase(database.AlteraEstadoPlano(email, id, database.PlanoRemovido))
+}
+
+// validaDadosPlano valida os campos de criação de um plano e retorna o plano
+// com sua primeira execução definida. 'agora' é o momento da criação.
+func validaDadosPlano(r *http.Request, agora time.Time) (database.Plano, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return database.Plano{}, erros.CriaInternoPadrao(err)
+	}
+	plano := database.Plano{
+		Frequencia: r.PostFormValue("frequencia"),
+		Expressao:  r.PostFormValue("expressao"),
+	}
+
+	err := erros.CriaVazio()
+	valor, err2 := strconv.ParseFloat(r.PostFormValue("valor"), 64)
+	if err2 != nil || valor <= 0 || math.IsInf(valor, 0) || math.IsNaN(valor) {
+		err = erros.JuntaErros(err, ErrValorInvalido)
+	}
+	plano.Valor = valor
+
+	// Primeira execução do plano
+	primeira := agora
+	switch plano.Frequencia {
+	case frequenciaSemanal, frequenciaMensal:
+		plano.Expressao = ""
+		if inicio := r.PostFormValue("inicio"); inicio != "" {
+			t, err2 := time.ParseInLocation("2006-01-02 15:04", inicio, transacao.Fuso())
+			if err2 != nil || t.Before(agora.Add(-time.Minute)) {
+				err = erros.JuntaErros(err, ErrInicioInvalido)
+			}
+			primeira = t
+		}
+	case frequenciaCron:
+		c, err2 := interpretaCron(plano.Expressao)
+		if err2 != nil {
+			err = erros.JuntaErros(err, ErrExpressaoInvalida)
+		} else if primeira, err2 = c.proxima(agora); err2 != nil {
+			err = erros.JuntaErros(err, ErrExpressaoInvalida)
+		}
+	default:
+		err = erros.JuntaErros(err, ErrFrequenciaInvalida)
+	}
+	plano.ProximaExecucao = primeira.Format(formatoMomento)
+	return plano, err
+}
+
+// validaIDPlano adquire o campo "id" do request
+func validaIDPlano(r *http.Request) (int64, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return 0, erros.CriaInternoPadrao(err)
+	}
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, ErrIDInvalido
+	}
+	return id, erros.CriaVazio()
+}
+
+// proximaExecucao calcula a primeira execução do plano estritamente posterior
+// a 'depois'. Planos semanais e mensais mantêm o dia da semana, dia do mês e
+// horário da execução anterior.
+func proximaExecucao(p database.Plano, depois time.Time) (time.Time, error) {
+	if p.Frequencia == frequenciaCron {
+		c, err := interpretaCron(p.Expressao)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return c.proxima(depois)
+	}
+
+	t, err := time.ParseInLocation(formatoMomento, p.ProximaExecucao, transacao.Fuso())
+	if err != nil {
+		return time.Time{}, err
+	}
+	for !t.After(depois) {
+		if p.Frequencia == frequenciaSemanal {
+			t = t.AddDate(0, 0, 7)
+		} else {
+			t = adicionaMeses(t, 1)
+		}
+	}
+	return t, nil
+}
+
+// adicionaMeses soma 'n' meses a 't', limitando o dia ao último dia do mês
+// resultante (31 de janeiro mais um mês resulta em 28 ou 29 de fevereiro, ao
+// invés de em março)
+func adicionaMeses(t time.Time, n int) time.Time {
+	ultimoDia := time.Date(t.Year(), t.Month()+time.Month(n)+1, 0, 0, 0, 0, 0, t.Location()).Day()
+	dia := t.Day()
+	if dia > ultimoDia {
+		dia = ultimoDia
+	}
+	return time.Date(t.Year(), t.Month()+time.Month(n), dia,
+		t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+}
+
+// converteErroDatabase converte os erros do banco de dados para os erros do
+// módulo
+func converteErroDatabase(err error) erros.Erros {
+	if err == database.ErrPlanoNaoExiste {
+		return ErrPlanoNaoExiste
+	} else if err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	return erros.CriaVazio()
+}
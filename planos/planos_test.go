@@ -0,0 +1,248 @@
+package planos
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/passenc"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// init deleta o banco de dados e cria um novo apenas com alguns usuários para
+// testes
+func init() {
+	if err := database.DeletaDatabaseTeste(); err != nil {
+		log.Fatalf("erro ao deletar database: %s", err)
+	}
+	if err := database.CriaDatabase(); err != nil {
+		log.Fatalf("erro ao criar database: %s", err)
+	}
+	if err := testPopulaDatabase(); err != nil {
+		log.Fatalf("erro ao popular banco de dados: %s", err)
+	}
+}
+
+func TestCriaPlanoHTTP(t *testing.T) {
+	// Plano semanal válido
+	form := url.Values{}
+	form.Set("valor", "100")
+	form.Set("frequencia", "semanal")
+	var plano database.Plano
+	rotaHTTP := func(w http.ResponseWriter, r *http.Request) {
+		resp, err := CriaPlanoHTTP(r, "valido1@gmail.com")
+		if !erros.Vazio(err) {
+			t.Fatalf("Erro inesperado na criação do plano: %v", err)
+		}
+		if err := json.Unmarshal(resp, &plano); err != nil {
+			t.Fatalf("Resposta inesperada: %v", string(resp))
+		}
+		if plano.ID == 0 || plano.Valor != 100 || plano.Estado != database.PlanoAtivo {
+			t.Errorf("Plano criado incorretamente: %v", plano)
+		}
+	}
+	testRealizaRequestHTTPForm(t, "POST", form, rotaHTTP)
+
+	// O plano deve aparecer na lista de planos do usuário
+	planos, err := database.AdquirePlanosDeUsuario("valido1@gmail.com")
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	} else if len(planos) != 1 || planos[0].ID != plano.ID {
+		t.Errorf("Lista de planos incorreta: %v", planos)
+	}
+
+	// Dados inválidos
+	form.Set("valor", "-1")
+	form.Set("frequencia", "cron")
+	form.Set("expressao", "0 9 * *")
+	erroEsperado := erros.JuntaErros(ErrValorInvalido, ErrExpressaoInvalida)
+	rotaHTTP = func(w http.ResponseWriter, r *http.Request) {
+		_, err := CriaPlanoHTTP(r, "valido1@gmail.com")
+		if err.Error() != erroEsperado.Error() {
+			t.Errorf("Erro inesperado na criação do plano: %v", err)
+		}
+	}
+	testRealizaRequestHTTPForm(t, "POST", form, rotaHTTP)
+	form.Set("valor", "NaN")
+	testRealizaRequestHTTPForm(t, "POST", form, rotaHTTP)
+	form.Set("valor", "+Inf")
+	testRealizaRequestHTTPForm(t, "POST", form, rotaHTTP)
+
+	// Frequência inválida
+	form.Set("valor", "100")
+	form.Set("frequencia", "diaria")
+	rotaHTTP = func(w http.ResponseWriter, r *http.Request) {
+		_, err := CriaPlanoHTTP(r, "valido1@gmail.com")
+		if err.Error() != ErrFrequenciaInvalida.Error() {
+			t.Errorf("Erro inesperado na criação do plano: %v", err)
+		}
+	}
+	testRealizaRequestHTTPForm(t, "POST", form, rotaHTTP)
+}
+
+func TestPausaRetomaRemovePlanoHTTP(t *testing.T) {
+	plano := testCriaPlano(t, "valido2@gmail.com", transacao.Agora().Add(-time.Hour))
+	form := url.Values{}
+	form.Set("id", strconv.FormatInt(plano.ID, 10))
+
+	// Pausa
+	rotaHTTP := func(w http.ResponseWriter, r *http.Request) {
+		if err := PausaPlanoHTTP(r, "valido2@gmail.com"); !erros.Vazio(err) {
+			t.Fatalf("Erro inesperado: %v", err)
+		}
+	}
+	testRealizaRequestHTTPForm(t, "POST", form, rotaHTTP)
+	if p := testAdquirePlano(t, "valido2@gmail.com", plano.ID); p.Estado != database.PlanoPausado {
+		t.Errorf("Plano não foi pausado: %v", p)
+	}
+
+	// Outro usuário não pode alterar o plano
+	rotaHTTP = func(w http.ResponseWriter, r *http.Request) {
+		if err := RetomaPlanoHTTP(r, "valido1@gmail.com"); err.Error() != ErrPlanoNaoExiste.Error() {
+			t.Errorf("Erro inesperado: %v", err)
+		}
+	}
+	testRealizaRequestHTTPForm(t, "POST", form, rotaHTTP)
+
+	// Retomada: a execução perdida não é realizada
+	rotaHTTP = func(w http.ResponseWriter, r *http.Request) {
+		if err := RetomaPlanoHTTP(r, "valido2@gmail.com"); !erros.Vazio(err) {
+			t.Fatalf("Erro inesperado: %v", err)
+		}
+	}
+	testRealizaRequestHTTPForm(t, "POST", form, rotaHTTP)
+	p := testAdquirePlano(t, "valido2@gmail.com", plano.ID)
+	if p.Estado != database.PlanoAtivo || p.ProximaExecucao <= transacao.Agora().Format(formatoMomento) {
+		t.Errorf("Plano não foi retomado corretamente: %v", p)
+	}
+
+	// Remoção
+	rotaHTTP = func(w http.ResponseWriter, r *http.Request) {
+		if err := RemovePlanoHTTP(r, "valido2@gmail.com"); !erros.Vazio(err) {
+			t.Fatalf("Erro inesperado: %v", err)
+		}
+	}
+	testRealizaRequestHTTPForm(t, "DELETE", form, rotaHTTP)
+	planos, err := database.AdquirePlanosDeUsuario("valido2@gmail.com")
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	} else if len(planos) != 0 {
+		t.Errorf("Plano não foi removido: %v", planos)
+	}
+}
+
+func TestExecutaPlanosPendentes(t *testing.T) {
+	agora := transacao.Agora()
+	plano := testCriaPlano(t, "valido3@gmail.com", agora.Add(-time.Minute))
+
+	// A execução do plano deve ser registrada, seja ela bem-sucedida ou pulada
+	// por falta de preço disponível
+	executaPlanosPendentes(agora)
+	execucoes, err := database.AdquireExecucoesPlano("valido3@gmail.com", plano.ID)
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	} else if len(execucoes) != 1 {
+		t.Fatalf("Quantidade de execuções incorreta: %v", execucoes)
+	}
+	if ex := execucoes[0]; ex.Sucesso && (ex.Resultado != "sucesso" || ex.Bitcoins <= 0) {
+		t.Errorf("Execução registrada incorretamente: %v", ex)
+	} else if !ex.Sucesso && ex.Resultado != "preco_indisponivel" {
+		t.Errorf("Execução registrada incorretamente: %v", ex)
+	}
+
+	// A próxima execução deve ter sido avançada em uma semana e o plano não
+	// deve ser executado novamente
+	p := testAdquirePlano(t, "valido3@gmail.com", plano.ID)
+	esperado := agora.Add(-time.Minute).AddDate(0, 0, 7).Format(formatoMomento)
+	if p.ProximaExecucao != esperado {
+		t.Errorf("Próxima execução incorreta: %v (esperado %v)", p.ProximaExecucao, esperado)
+	}
+	executaPlanosPendentes(agora)
+	if execucoes, err := database.AdquireExecucoesPlano("valido3@gmail.com", plano.ID); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	} else if len(execucoes) != 1 {
+		t.Errorf("Plano executado mais de uma vez: %v", execucoes)
+	}
+}
+
+// testCriaPlano cria diretamente no banco de dados um plano semanal de R$ 100
+// para o usuário com a próxima execução em 'proxima'
+func testCriaPlano(t *testing.T, email string, proxima time.Time) database.Plano {
+	plano := database.Plano{
+		Usuario:         email,
+		Valor:           100,
+		Frequencia:      frequenciaSemanal,
+		ProximaExecucao: proxima.Format(formatoMomento),
+	}
+	if err := database.InserePlano(&plano); err != nil {
+		t.Fatalf("Erro ao criar plano: %v", err)
+	}
+	return plano
+}
+
+// testAdquirePlano adquire um plano não removido do usuário pelo seu ID
+func testAdquirePlano(t *testing.T, email string, id int64) database.Plano {
+	planos, err := database.AdquirePlanosDeUsuario(email)
+	if err != nil {
+		t.Fatalf("Erro ao adquirir planos: %v", err)
+	}
+	for _, p := range planos {
+		if p.ID == id {
+			return p
+		}
+	}
+	t.Fatalf("Plano %v não encontrado: %v", id, planos)
+	return database.Plano{}
+}
+
+// testRealizaRequestHTTPForm é uma função auxiliar para geração de requests
+// HTTP com formulário. Para o método DELETE, o formulário é enviado na query.
+func testRealizaRequestHTTPForm(t *testing.T, metodo string, form url.Values,
+	f func(w http.ResponseWriter, r *http.Request)) {
+	// Criação do request HTTP
+	request, err := http.NewRequest(metodo, "/", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if metodo == "DELETE" {
+		request.URL.RawQuery = form.Encode()
+	}
+
+	// Recorder para armazenar a resposta
+	recorder := httptest.NewRecorder()
+
+	// Upload do servidor de teste
+	handler := http.HandlerFunc(f)
+	handler.ServeHTTP(recorder, request)
+}
+
+// testPopulaDatabase insere dados no banco de dados necessários para a
+// realização dos testes. Essa função cria três usuários, um para cada teste.
+func testPopulaDatabase() error {
+	for i := 1; i <= 3; i++ {
+		senha, err := passenc.GeraHashed([]byte("senhavalido" + strconv.Itoa(i)))
+		if err != nil {
+			return err
+		}
+		usr := database.Usuario{
+			Email:           "valido" + strconv.Itoa(i) + "@gmail.com",
+			Senha:           senha,
+			Nome:            "Conta Válida " + strconv.Itoa(i),
+			Nascimento:      "1994-03-07",
+			EmailVerificado: true,
+		}
+		if err := database.InsereUsuario(&usr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+// Package privacidade trata dos direitos dos titulares de dados pessoais
+// previstos na LGPD: a exportação de todos os dados do usuário em um arquivo
+// legível por máquina e o encerramento da conta, que anonimiza os dados
+// pessoais mas mantém as transações, cuja guarda é exigida por lei.
+// Esse package usa exclusivamente erros.Erros como estrutura de erros.
+package privacidade
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/loteny/redcoins/armazenamento"
+	"github.com/loteny/redcoins/cadastro"
+	"github.com/loteny/redcoins/chaves"
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/correio"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/precobtc"
+	"github.com/loteny/redcoins/sessao"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// Lista de possíveis erros do módulo
+var (
+	ErrSaldoNaoZerado   = erros.Cria(false, 400, "saldo_nao_zerado")
+	ErrLiquidarInvalido = erros.Cria(false, 400, "liquidar_invalido")
+)
+
+// formatoData é o formato das colunas DATETIME do banco de dados
+const formatoData = "2006-01-02 15:04:05"
+
+// tamanhoMaximoFormulario é o tamanho máximo, em bytes, do corpo do pedido de
+// encerramento da conta
+const tamanhoMaximoFormulario = 1 << 16
+
+// dadosExportados é a estrutura do arquivo "dados.json" da exportação dos
+// dados do usuário
+type dadosExportados struct {
+	GeradoEm         string               `json:"geradoEm"`
+	Perfil           json.RawMessage      `json:"perfil"`
+	DoisFatoresAtivo bool                 `json:"doisFatoresAtivo"`
+	Verificacao      verificacaoExportada `json:"verificacao"`
+	Chaves           json.RawMessage      `json:"chaves"`
+	Planos           []planoExportado     `json:"planos"`
+	Transacoes       []database.Transacao `json:"transacoes"`
+}
+
+// verificacaoExportada contém o nível de verificação do usuário e suas
+// solicitações. Os documentos enviados estão no diretório "documentos" do
+// arquivo exportado, com o nome do campo 'arquivo' de cada documento.
+type verificacaoExportada struct {
+	Nivel        int                       `json:"nivel"`
+	Solicitacoes []database.SolicitacaoKYC `json:"solicitacoes"`
+}
+
+// planoExportado contém um plano de compra recorrente e suas execuções
+type planoExportado struct {
+	database.Plano
+	Execucoes []database.ExecucaoPlano `json:"execucoes"`
+}
+
+// ExportaDadosHTTP retorna um arquivo ZIP com todos os dados pessoais e as
+// transações do usuário, e o nome do arquivo. O arquivo contém "dados.json",
+// com o perfil, a verificação de identidade, as chaves de API (sem seus
+// segredos), os planos de compra recorrente e as transações, e o diretório
+// "documentos", com os documentos enviados na verificação de identidade.
+func ExportaDadosHTTP(email string) ([]byte, string, erros.Erros) {
+	agora := transacao.Agora()
+	dados, arquivos, errs := adquireDados(email)
+	if !erros.Vazio(errs) {
+		return nil, "", errs
+	}
+	dados.GeradoEm = agora.Format(formatoData)
+	dadosBytes, err := json.MarshalIndent(dados, "", "  ")
+	if err != nil {
+		return nil, "", erros.CriaInternoPadrao(err)
+	}
+
+	buf := &bytes.Buffer{}
+	z := zip.NewWriter(buf)
+	if err := adicionaArquivo(z, "dados.json", bytes.NewReader(dadosBytes), agora); err != nil {
+		return nil, "", erros.CriaInternoPadrao(err)
+	}
+	for _, arquivo := range arquivos {
+		if err := adicionaDocumento(z, arquivo, agora); err != nil {
+			return nil, "", erros.CriaInternoPadrao(err)
+		}
+	}
+	if err := z.Close(); err != nil {
+		return nil, "", erros.CriaInternoPadrao(err)
+	}
+	return buf.Bytes(), "redcoins-dados-" + agora.Format("20060102") + ".zip", erros.CriaVazio()
+}
+
+// EncerraContaHTTP encerra a conta do usuário. O campo "senha" do corpo do
+// request deve conter a senha atual e, se o usuário possui a autenticação em
+// dois fatores ativa, o campo "codigo" deve conter um código TOTP ou de
+// recuperação válido. O saldo de Bitcoins deve estar zerado; se o campo
+// "liquidar" for verdadeiro, o saldo é vendido pelo preço atual antes do
+// encerramento. Os dados pessoais são anonimizados, os documentos de
+// verificação são removidos, as sessões são encerradas e o e-mail do usuário
+// é avisado do encerramento.
+func EncerraContaHTTP(r *http.Request, email string) erros.Erros {
+	form, err := formularioCorpo(r)
+	if err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	logado, errs := cadastro.VerificaLoginOrigem(email, form.Get("senha"), comunicacao.IPRequest(r))
+	if !erros.Vazio(errs) {
+		return errs
+	} else if !logado {
+		return cadastro.ErrSenhaAtualIncorreta
+	}
+	if errs := cadastro.VerificaSegundoFator(email, form.Get("codigo")); !erros.Vazio(errs) {
+		return errs
+	}
+	// O saldo é vendido pelo preço atual no próprio encerramento, sem as regras
+	// de mercado e os limites do usuário, para que qualquer saldo possa ser
+	// resgatado
+	precoLiquidacao := 0.0
+	if valor := form.Get("liquidar"); valor != "" {
+		liquidar, err := strconv.ParseBool(valor)
+		if err != nil {
+			return ErrLiquidarInvalido
+		}
+		if liquidar {
+			precoLiquidacao, err = precobtc.PrecoUnidade()
+			if err != nil || precoLiquidacao <= 0 {
+				return transacao.ErrPrecoIndisponivel
+			}
+		}
+	}
+
+	anonimo, arquivos, err := database.EncerraUsuario(email, transacao.Agora().Format(formatoData), precoLiquidacao)
+	if err == database.ErrSaldoNaoZerado {
+		return ErrSaldoNaoZerado
+	} else if err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	// A conta já foi encerrada: falhas na remoção dos documentos e no aviso ao
+	// usuário são apenas registradas
+	for _, arquivo := range arquivos {
+		if err := armazenamento.Remove(arquivo); err != nil {
+			log.Printf("privacidade: erro ao remover o documento %s: %s", arquivo, err)
+		}
+	}
+	m := correio.Mensagem{
+		Para:    email,
+		Assunto: "Sua conta na RedCoins foi encerrada",
+		Corpo: "Olá.\n\n" +
+			"Sua conta na RedCoins foi encerrada e seus dados pessoais foram removidos. " +
+			"O histórico de transações é mantido de forma anônima pelo prazo exigido em lei.\n",
+	}
+	if err := correio.Envia(m); err != nil {
+		log.Printf("privacidade: erro ao avisar %s do encerramento da conta: %s", email, err)
+	}
+	return sessao.EncerraSessoesUsuario(anonimo)
+}
+
+// adquireDados adquire todos os dados do usuário exportados em "dados.json" e
+// as chaves no armazenamento dos documentos de verificação enviados
+func adquireDados(email string) (dadosExportados, []string, erros.Erros) {
+	dados := dadosExportados{}
+	perfil, errs := cadastro.PerfilHTTP(email)
+	if !erros.Vazio(errs) {
+		return dados, nil, errs
+	}
+	dados.Perfil = perfil
+	if totp, err := database.AdquireTOTP(email); err == nil {
+		dados.DoisFatoresAtivo = totp.Ativo
+	} else if err != database.ErrTOTPNaoExiste {
+		return dados, nil, erros.CriaInternoPadrao(err)
+	}
+
+	usr, err := database.AdquireUsuario(email)
+	if err != nil {
+		return dados, nil, erros.CriaInternoPadrao(err)
+	}
+	solicitacoes, err := database.AdquireSolicitacoesKYCUsuario(email)
+	if err != nil {
+		return dados, nil, erros.CriaInternoPadrao(err)
+	}
+	dados.Verificacao = verificacaoExportada{Nivel: usr.Nivel, Solicitacoes: solicitacoes}
+	arquivos := make([]string, 0)
+	for _, s := range solicitacoes {
+		for _, d := range s.Documentos {
+			arquivos = append(arquivos, d.Arquivo)
+		}
+	}
+
+	// As chaves são exportadas como na listagem, sem os segredos
+	chavesBytes, errs := chaves.ChavesUsuarioHTTP(email)
+	if !erros.Vazio(errs) {
+		return dados, nil, errs
+	}
+	listaChaves := struct {
+		Chaves json.RawMessage `json:"chaves"`
+	}{}
+	if err := json.Unmarshal(chavesBytes, &listaChaves); err != nil {
+		return dados, nil, erros.CriaInternoPadrao(err)
+	}
+	dados.Chaves = listaChaves.Chaves
+
+	planos, err := database.AdquirePlanosDeUsuario(email)
+	if err != nil {
+		return dados, nil, erros.CriaInternoPadrao(err)
+	}
+	dados.Planos = make([]planoExportado, 0, len(planos))
+	for _, p := range planos {
+		execucoes, err := database.AdquireExecucoesPlano(email, p.ID)
+		if err != nil {
+			return dados, nil, erros.CriaInternoPadrao(err)
+		}
+		dados.Planos = append(dados.Planos, planoExportado{Plano: p, Execucoes: execucoes})
+	}
+
+	dados.Transacoes, err = database.AdquireTransacoesDeUsuario(email)
+	if err != nil {
+		return dados, nil, erros.CriaInternoPadrao(err)
+	}
+	return dados, arquivos, erros.CriaVazio()
+}
+
+// adicionaDocumento adiciona ao diretório "documentos" do arquivo ZIP o
+// documento de verificação do armazenamento. Documentos não encontrados no
+// armazenamento são ignorados.
+func adicionaDocumento(z *zip.Writer, arquivo string, agora time.Time) error {
+	f, err := armazenamento.Abre(arquivo)
+	if err == armazenamento.ErrNaoExiste {
+		log.Printf("privacidade: documento %s não encontrado no armazenamento", arquivo)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+	return adicionaArquivo(z, "documentos/"+arquivo, f, agora)
+}
+
+// adicionaArquivo adiciona ao arquivo ZIP um arquivo com o nome e o conteúdo
+// passados, modificado em 'agora'
+func adicionaArquivo(z *zip.Writer, nome string, conteudo io.Reader, agora time.Time) error {
+	w, err := z.CreateHeader(&zip.FileHeader{Name: nome, Method: zip.Deflate, Modified: agora})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, conteudo)
+	return err
+}
+
+// formularioCorpo retorna os campos do corpo do request no formato
+// "application/x-www-form-urlencoded". O corpo dos pedidos DELETE não é lido
+// por ParseForm, mas a senha não deve ser enviada na URL.
+func formularioCorpo(r *http.Request) (url.Values, error) {
+	if r.Body == nil {
+		return url.Values{}, nil
+	}
+	corpo, err := ioutil.ReadAll(io.LimitReader(r.Body, tamanhoMaximoFormulario))
+	if err != nil {
+		return nil, err
+	}
+	return url.ParseQuery(string(corpo))
+}
@@ -0,0 +1,223 @@
+package privacidade
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/loteny/redcoins/armazenamento"
+	"github.com/loteny/redcoins/cadastro"
+	"github.com/loteny/redcoins/correio"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/passenc"
+)
+
+// init deleta o banco de dados e cria um novo apenas com alguns usuários para
+// testes
+func init() {
+	if err := database.DeletaDatabaseTeste(); err != nil {
+		log.Fatalf("erro ao deletar database: %s", err)
+	}
+	if err := database.CriaDatabase(); err != nil {
+		log.Fatalf("erro ao criar database: %s", err)
+	}
+	if err := testPopulaDatabase(); err != nil {
+		log.Fatalf("erro ao popular banco de dados: %s", err)
+	}
+}
+
+func TestExportaDadosHTTP(t *testing.T) {
+	diretorio := testArmazenamento(t)
+	defer os.RemoveAll(diretorio)
+	if err := armazenamento.Grava("aa11.png", strings.NewReader("conteúdo do documento")); err != nil {
+		t.Fatal(err)
+	}
+	s := database.SolicitacaoKYC{Usuario: "exportacao@gmail.com", Nivel: 1, Criada: "2018-01-03 10:00:00",
+		Documentos: []database.DocumentoKYC{{Tipo: "identidade", Arquivo: "aa11.png", TipoConteudo: "image/png", Tamanho: 22}}}
+	if _, err := database.InsereSolicitacaoKYC(s); err != nil {
+		t.Fatal(err)
+	}
+
+	arquivo, nome, err := ExportaDadosHTTP("exportacao@gmail.com")
+	if !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if !strings.HasPrefix(nome, "redcoins-dados-") || !strings.HasSuffix(nome, ".zip") {
+		t.Errorf("Nome inesperado: %s", nome)
+	}
+	conteudos := testLeZip(t, arquivo)
+	if conteudos["documentos/aa11.png"] != "conteúdo do documento" {
+		t.Errorf("Documento inesperado: %q", conteudos["documentos/aa11.png"])
+	}
+	dados := struct {
+		Perfil struct {
+			Email string `json:"email"`
+			Nome  string `json:"nome"`
+			CPF   string `json:"cpf"`
+		} `json:"perfil"`
+		Verificacao struct {
+			Solicitacoes []database.SolicitacaoKYC `json:"solicitacoes"`
+		} `json:"verificacao"`
+		Chaves     []json.RawMessage    `json:"chaves"`
+		Planos     []json.RawMessage    `json:"planos"`
+		Transacoes []database.Transacao `json:"transacoes"`
+	}{}
+	if err := json.Unmarshal([]byte(conteudos["dados.json"]), &dados); err != nil {
+		t.Fatalf("Dados inesperados: %s (%v)", conteudos["dados.json"], err)
+	}
+	if dados.Perfil.Email != "exportacao@gmail.com" || dados.Perfil.Nome != "Conta Exportação" ||
+		dados.Perfil.CPF != "52998224725" || len(dados.Verificacao.Solicitacoes) != 1 ||
+		len(dados.Chaves) != 0 || len(dados.Planos) != 0 || len(dados.Transacoes) != 2 {
+		t.Errorf("Dados inesperados: %s", conteudos["dados.json"])
+	}
+}
+
+func TestEncerraContaHTTP(t *testing.T) {
+	diretorio := testArmazenamento(t)
+	defer os.RemoveAll(diretorio)
+	caixa := correio.NovaCaixaSaida("")
+	anterior := correio.Padrao()
+	correio.DefinePadrao(caixa)
+	defer correio.DefinePadrao(anterior)
+
+	if err := armazenamento.Grava("bb22.png", strings.NewReader("documento")); err != nil {
+		t.Fatal(err)
+	}
+	s := database.SolicitacaoKYC{Usuario: "encerramento@gmail.com", Nivel: 1, Criada: "2018-01-03 10:00:00",
+		Documentos: []database.DocumentoKYC{{Tipo: "identidade", Arquivo: "bb22.png", TipoConteudo: "image/png", Tamanho: 9}}}
+	if _, err := database.InsereSolicitacaoKYC(s); err != nil {
+		t.Fatal(err)
+	}
+
+	// Senha incorreta, campo "liquidar" inválido e saldo não zerado
+	casos := []struct {
+		email string
+		form  url.Values
+		erro  erros.Erros
+	}{
+		{"encerramento@gmail.com", url.Values{"senha": {"senhaincorreta"}}, cadastro.ErrSenhaAtualIncorreta},
+		{"encerramento@gmail.com", url.Values{"senha": {"senhaencerramento"}, "liquidar": {"talvez"}}, ErrLiquidarInvalido},
+		{"exportacao@gmail.com", url.Values{"senha": {"senhaexportacao"}}, ErrSaldoNaoZerado},
+	}
+	for _, c := range casos {
+		if err := EncerraContaHTTP(testRequestDelete(c.form), c.email); err.Error() != c.erro.Error() {
+			t.Errorf("Erro inesperado para %s (%v): %v", c.email, c.form, err)
+		}
+	}
+
+	// Encerramento: os dados pessoais e os documentos são removidos e o
+	// usuário é avisado
+	form := url.Values{"senha": {"senhaencerramento"}, "liquidar": {"false"}}
+	if err := EncerraContaHTTP(testRequestDelete(form), "encerramento@gmail.com"); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if _, err := database.AdquireUsuario("encerramento@gmail.com"); err != database.ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if logado, _ := cadastro.VerificaLogin("encerramento@gmail.com", "senhaencerramento"); logado {
+		t.Errorf("Login aceito após o encerramento da conta")
+	}
+	if arquivos, _ := ioutil.ReadDir(diretorio); len(arquivos) != 0 {
+		t.Errorf("Documentos não removidos: %v", arquivos)
+	}
+	if m, ok := caixa.Ultima("encerramento@gmail.com"); !ok || !strings.Contains(m.Assunto, "encerrada") {
+		t.Errorf("Aviso de encerramento não enviado: %v", m)
+	}
+}
+
+func TestEncerraContaHTTPLiquidacao(t *testing.T) {
+	// O saldo acima dos limites do nível 0 é vendido no encerramento
+	form := url.Values{"senha": {"senhaliquidacao"}, "liquidar": {"true"}}
+	if err := EncerraContaHTTP(testRequestDelete(form), "liquidacao@gmail.com"); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if _, err := database.AdquireUsuario("liquidacao@gmail.com"); err != database.ErrUsuarioNaoExiste {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+// testArmazenamento substitui o armazenamento padrão por um diretório
+// temporário, que é retornado
+func testArmazenamento(t *testing.T) string {
+	diretorio, err := ioutil.TempDir("", "privacidade")
+	if err != nil {
+		t.Fatal(err)
+	}
+	armazenamento.DefinePadrao(armazenamento.Local{Diretorio: diretorio})
+	return diretorio
+}
+
+// testRequestDelete cria um request DELETE com os campos de 'form' no corpo
+func testRequestDelete(form url.Values) *http.Request {
+	r, _ := http.NewRequest("DELETE", "/", strings.NewReader(form.Encode()))
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+// testLeZip retorna o conteúdo de cada arquivo do arquivo ZIP pelo seu nome
+func testLeZip(t *testing.T, arquivo []byte) map[string]string {
+	z, err := zip.NewReader(bytes.NewReader(arquivo), int64(len(arquivo)))
+	if err != nil {
+		t.Fatalf("Arquivo ZIP inválido: %v", err)
+	}
+	conteudos := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conteudo, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conteudos[f.Name] = string(conteudo)
+	}
+	return conteudos
+}
+
+func testPopulaDatabase() error {
+	usuarios := []struct {
+		usr   database.Usuario
+		senha string
+	}{
+		{database.Usuario{Email: "exportacao@gmail.com", Nome: "Conta Exportação", CPF: "52998224725"}, "senhaexportacao"},
+		{database.Usuario{Email: "encerramento@gmail.com", Nome: "Conta Encerramento", CPF: "11144477735"}, "senhaencerramento"},
+		{database.Usuario{Email: "liquidacao@gmail.com", Nome: "Conta Liquidação"}, "senhaliquidacao"},
+	}
+	for _, u := range usuarios {
+		senha, err := passenc.GeraHashed([]byte(u.senha))
+		if err != nil {
+			return err
+		}
+		u.usr.Senha = senha
+		u.usr.Nascimento = "1994-03-07"
+		u.usr.EmailVerificado = true
+		if err := database.InsereUsuario(&u.usr); err != nil {
+			return err
+		}
+	}
+	// O usuário da exportação e o da liquidação possuem saldo; o saldo do
+	// usuário da liquidação vale mais do que os limites do nível 0 permitem
+	// vender em uma transação
+	if err := database.InsereTransacao("exportacao@gmail.com", true, 0.5, 100, "2018-01-01 10:00:00"); err != nil {
+		return err
+	}
+	if err := database.InsereTransacao("exportacao@gmail.com", true, 0.25, 60, "2018-01-02 10:00:00"); err != nil {
+		return err
+	}
+	for _, dia := range []string{"2018-01-01 10:00:00", "2018-01-02 10:00:00", "2018-01-03 10:00:00"} {
+		if err := database.InsereTransacao("liquidacao@gmail.com", true, 0.1, 900, dia); err != nil {
+			return err
+		}
+	}
+	return nil
+}
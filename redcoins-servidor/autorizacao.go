@@ -0,0 +1,47 @@
+package main
+
+// Esse arquivo define a autorização dos usuários autenticados de acordo com
+// seus papéis
+
+import (
+	"net/http"
+
+	"github.com/loteny/redcoins/cadastro"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+// ErrAcessoNegado é enviado quando o usuário autenticado não tem permissão
+// para acessar a rota ou os dados pedidos
+var ErrAcessoNegado = erros.Cria(false, http.StatusForbidden, "acesso_negado")
+
+// equipe são os papéis da equipe da RedCoins, que têm acesso aos dados de
+// todos os usuários
+var equipe = []string{database.PapelSuporte, database.PapelAdmin}
+
+// autorizaPapel verifica se o usuário do e-mail passado possui um dos papéis
+// passados. Caso não possua, responde ao cliente que o acesso foi negado.
+// Retorna se o usuário está autorizado.
+func autorizaPapel(w http.ResponseWriter, email string, papeis ...string) bool {
+	papel, err := cadastro.PapelUsuario(email)
+	if respondeErro(w, err) {
+		return false
+	}
+	for _, p := range papeis {
+		if papel == p {
+			return true
+		}
+	}
+	respondeErro(w, ErrAcessoNegado)
+	return false
+}
+
+// autorizaDonoOuEquipe verifica se o usuário do e-mail passado é o dono dos
+// dados do usuário 'dono' ou se faz parte da equipe. Caso contrário, responde
+// ao cliente que o acesso foi negado. Retorna se o usuário está autorizado.
+func autorizaDonoOuEquipe(w http.ResponseWriter, email string, dono string) bool {
+	if email == dono {
+		return true
+	}
+	return autorizaPapel(w, email, equipe...)
+}
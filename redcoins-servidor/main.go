@@ -4,8 +4,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 
+	"github.com/loteny/redcoins/carteira"
 	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/planos"
+	"github.com/loteny/redcoins/sessao"
 )
 
 // addrHTTPS e addrHTTP especificam o endereço (incluindo porta) do servidor
@@ -18,6 +22,10 @@ var addrHTTP string
 var pem string
 var key string
 
+// basicAuth especifica se os pedidos podem ser autenticados com Basic Auth além
+// dos tokens de acesso das sessões
+var basicAuth = true
+
 // config é a estrutura com as configurações do servidor
 type config struct {
 	RedcoinsServidor struct {
@@ -34,6 +42,9 @@ func init() {
 	addrHTTP = os.Getenv("REDCOINS_SV_ADDRHTTP")
 	pem = os.Getenv("REDCOINS_SV_PEM")
 	key = os.Getenv("REDCOINS_SV_KEY")
+	if b, err := strconv.ParseBool(os.Getenv("REDCOINS_SV_BASICAUTH")); err == nil {
+		basicAuth = b
+	}
 }
 
 // escutaConexoes estabelece as rotas do servidor, coloca o servidor em modo de
@@ -60,15 +71,51 @@ func escutaConexoes() {
 // pedida do servidor
 func estabeleceRotas() {
 	http.HandleFunc("/cadastro", RotaCadastro)
+	http.HandleFunc("/cadastro/verificar", RotaVerificacaoEmail)
+	http.HandleFunc("/cadastro/dois-fatores", RotaDoisFatores)
+	http.HandleFunc("/cadastro/dois-fatores/confirmacao", RotaDoisFatoresConfirmacao)
+	http.HandleFunc("/perfil", RotaPerfil)
+	http.HandleFunc("/perfil/senha", RotaPerfilSenha)
+	http.HandleFunc("/perfil/email", RotaPerfilEmail)
+	http.HandleFunc("/perfil/dados", RotaPerfilDados)
+	http.HandleFunc("/kyc", RotaKYC)
+	http.HandleFunc("/kyc/pendentes", RotaKYCPendentes)
+	http.HandleFunc("/kyc/documento", RotaKYCDocumento)
+	http.HandleFunc("/kyc/analise", RotaKYCAnalise)
+	http.HandleFunc("/senha/esqueci", RotaSenhaEsqueci)
+	http.HandleFunc("/senha/redefinir", RotaSenhaRedefinir)
+	http.HandleFunc("/usuarios/papel", RotaPapel)
+	http.HandleFunc("/usuarios/desbloqueio", RotaDesbloqueio)
+	http.HandleFunc("/sessoes", RotaSessoes)
+	http.HandleFunc("/sessoes/renovacao", RotaSessaoRenovacao)
+	http.HandleFunc("/chaves", RotaChaves)
 	http.HandleFunc("/transacoes/compra", RotaCompra)
 	http.HandleFunc("/transacoes/venda", RotaVenda)
 	http.HandleFunc("/relatorios/data", RotaRelatorioDia)
 	http.HandleFunc("/relatorios/usuario", RotaRelatorioUsuario)
+	http.HandleFunc("/relatorios/impostos", RotaRelatorioImpostos)
+	http.HandleFunc("/relatorios/estatisticas", RotaRelatorioEstatisticas)
+	http.HandleFunc("/limites", RotaLimites)
+	http.HandleFunc("/portfolio", RotaPortfolio)
+	http.HandleFunc("/carteira", RotaCarteira)
+	http.HandleFunc("/carteira/verificacao", RotaCarteiraVerificacao)
+	http.HandleFunc("/extrato", RotaExtrato)
+	http.HandleFunc("/extrato.pdf", RotaExtratoPDF)
+	http.HandleFunc("/extrato.ofx", RotaExtratoOFX)
+	http.HandleFunc("/planos", RotaPlanos)
+	http.HandleFunc("/planos/pausa", RotaPlanoPausa)
+	http.HandleFunc("/planos/retoma", RotaPlanoRetoma)
+	http.HandleFunc("/planos/execucoes", RotaPlanoExecucoes)
 }
 
 func main() {
 	if err := database.CriaDatabase(); err != nil {
 		log.Fatalf("Erro ao tentar banco de dados: %s", err)
 	}
+	if err := sessao.CarregaRevogadas(); err != nil {
+		log.Printf("Erro ao carregar sessões revogadas: %s", err)
+	}
+	planos.IniciaAgendador()
+	carteira.IniciaRegistroSaldos()
 	escutaConexoes()
 }
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/loteny/redcoins/cadastro"
+	"github.com/loteny/redcoins/carteira"
+	"github.com/loteny/redcoins/chaves"
 	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/database"
 	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/extrato"
+	"github.com/loteny/redcoins/privacidade"
+	"github.com/loteny/redcoins/sessao"
 	"github.com/loteny/redcoins/transacao"
 )
 
@@ -38,14 +47,15 @@ func RotaCadastro(w http.ResponseWriter, r *http.Request) {
 // request HTTPS. O pedido deve ser feito com o método POST e ter os campos
 // "email", "senha", "qtd" e "data" preenchidos, sendo "qtd" a quantidade de
 // Bitcoins a ser comprada, apenas dígitos e com o separado decimal sendo ponto
-// e "data" no formato "YYYY-MM-DD".
+// e "data" no formato "YYYY-MM-DD HH:MM:SS". O campo "data" só é utilizado se
+// a política de datas das transações for "cliente".
 func RotaCompra(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
 		return
 	}
 
-	autenticado, email := autenticaUsuario(w, r)
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoNegociacao)
 	if !autenticado {
 		return
 	}
@@ -69,14 +79,15 @@ func RotaCompra(w http.ResponseWriter, r *http.Request) {
 // HTTPS. O pedido deve ser feito com o método POST e ter os campos "email",
 // "senha", "qtd" e "data" preenchidos, sendo "qtd" a quantidade de Bitcoins a
 // ser vendida, apenas dígitos e com o separado decimal sendo ponto e "data" no
-// formato "YYYY-MM-DD".
+// formato "YYYY-MM-DD HH:MM:SS". O campo "data" só é utilizado se a política de
+// datas das transações for "cliente".
 func RotaVenda(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
 		return
 	}
 
-	autenticado, email := autenticaUsuario(w, r)
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoNegociacao)
 	if !autenticado {
 		return
 	}
@@ -97,15 +108,31 @@ func RotaVenda(w http.ResponseWriter, r *http.Request) {
 }
 
 // RotaRelatorioDia retorna todas as transações feitas em um determinado dia
-// no campo "data" (YYYY-MM-DD)
+// no campo "data" (YYYY-MM-DD). O relatório é enviado em JSON, CSV ou XLSX
+// segundo o campo "formato" ou o header Accept. Apenas administradores têm
+// acesso ao relatório.
 func RotaRelatorioDia(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
 		return
 	}
 
-	autenticado, _ := autenticaUsuario(w, r)
-	if !autenticado {
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoRelatorios)
+	if !autenticado || !autorizaPapel(w, email, database.PapelAdmin) {
+		return
+	}
+
+	// Relatórios em CSV ou XLSX são enviados à medida que são gerados
+	formato, err := transacao.FormatoRelatorio(r)
+	if respondeErro(w, err) {
+		return
+	}
+	if formato != transacao.FormatoJSON {
+		exportacao, err := transacao.ExportaTransacoesDiaHTTP(r, formato)
+		if respondeErro(w, err) {
+			return
+		}
+		respondeExportacao(w, exportacao)
 		return
 	}
 
@@ -125,16 +152,93 @@ func RotaRelatorioDia(w http.ResponseWriter, r *http.Request) {
 	comunicacao.Responde(w, http.StatusOK, resposta)
 }
 
+// RotaPortfolio retorna a posição em Bitcoins do usuário autenticado, com seu
+// custo de aquisição, valor de mercado e lucros realizado e não realizado
+func RotaPortfolio(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoRelatorios)
+	if !autenticado {
+		return
+	}
+
+	resposta, err := carteira.PortfolioHTTP(email)
+	if respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, resposta)
+}
+
+// RotaCarteira retorna os saldos do usuário autenticado ao fim do dia do campo
+// "em" (padrão é o dia atual)
+func RotaCarteira(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoRelatorios)
+	if !autenticado {
+		return
+	}
+
+	resposta, err := carteira.CarteiraHTTP(r, email)
+	if respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, resposta)
+}
+
+// RotaCarteiraVerificacao compara o histórico de saldos com os saldos
+// calculados a partir de todas as transações e retorna os registros
+// divergentes. Apenas administradores têm acesso à verificação.
+func RotaCarteiraVerificacao(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoRelatorios)
+	if !autenticado || !autorizaPapel(w, email, database.PapelAdmin) {
+		return
+	}
+
+	resposta, err := carteira.VerificaHistoricoHTTP()
+	if respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, resposta)
+}
+
 // RotaRelatorioUsuario retorna todas as transações feitas em um determinado
-// usuário a partir de seu e-mail no campo "email"
+// usuário a partir de seu e-mail no campo "email". O relatório é enviado em
+// JSON, CSV ou XLSX segundo o campo "formato" ou o header Accept. Clientes têm
+// acesso apenas ao próprio relatório; a equipe, ao de qualquer usuário.
 func RotaRelatorioUsuario(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
 		return
 	}
 
-	autenticado, _ := autenticaUsuario(w, r)
-	if !autenticado {
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoRelatorios)
+	if !autenticado || !autorizaDonoOuEquipe(w, email, r.FormValue("email")) {
+		return
+	}
+
+	// Relatórios em CSV ou XLSX são enviados à medida que são gerados
+	formato, err := transacao.FormatoRelatorio(r)
+	if respondeErro(w, err) {
+		return
+	}
+	if formato != transacao.FormatoJSON {
+		exportacao, err := transacao.ExportaTransacoesUsuarioHTTP(r, formato)
+		if respondeErro(w, err) {
+			return
+		}
+		respondeExportacao(w, exportacao)
 		return
 	}
 
@@ -154,13 +258,472 @@ func RotaRelatorioUsuario(w http.ResponseWriter, r *http.Request) {
 	comunicacao.Responde(w, http.StatusOK, resposta)
 }
 
-// autenticaUsuario verifica se o usuário é cadastrado e se a senha está
-// correta utilizando Basic Auth e retorna, também, seu e-mail. Em caso de erro
-// de autenticação, a função responde devidamente ao cliente que o pedido foi
-// proibido (ou um erro ocorreu).
-func autenticaUsuario(w http.ResponseWriter, r *http.Request) (bool, string) {
+// RotaRelatorioImpostos retorna o relatório anual de ganhos de capital do
+// usuário autenticado para o ano do campo "ano", em JSON ou, se o campo
+// "formato" for "csv", em CSV
+func RotaRelatorioImpostos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoRelatorios)
+	if !autenticado {
+		return
+	}
+
+	resposta, tipo, err := carteira.RelatorioImpostosHTTP(r, email)
+	if respondeErro(w, err) {
+		return
+	}
+	comunicacao.RespondeTipo(w, http.StatusOK, tipo, resposta)
+}
+
+// RotaRelatorioEstatisticas retorna as estatísticas agregadas do mercado no
+// período dos campos "de" e "ate", por dia ou por hora conforme o campo
+// "intervalo"
+func RotaRelatorioEstatisticas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	if autenticado, _ := autenticaUsuario(w, r, chaves.EscopoRelatorios); !autenticado {
+		return
+	}
+
+	resposta, err := transacao.EstatisticasHTTP(r)
+	if respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, resposta)
+}
+
+// RotaExtrato retorna o extrato do usuário autenticado no período dos campos
+// "de" e "ate", com os saldos após cada movimentação e os saldos inicial e final
+// do período
+func RotaExtrato(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoRelatorios)
+	if !autenticado {
+		return
+	}
+
+	resposta, err := extrato.ExtratoHTTP(r, email)
+	if respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, resposta)
+}
+
+// RotaExtratoPDF retorna o extrato do usuário autenticado no período dos campos
+// "de" e "ate" como um documento PDF
+func RotaExtratoPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoRelatorios)
+	if !autenticado {
+		return
+	}
+
+	pdf, nome, err := extrato.ExtratoPDFHTTP(r, email)
+	if respondeErro(w, err) {
+		return
+	}
+	w.Header().Set("Content-Disposition", `inline; filename="`+nome+`"`)
+	comunicacao.RespondeTipo(w, http.StatusOK, "application/pdf", pdf)
+}
+
+// RotaExtratoOFX retorna o extrato do usuário autenticado no período dos campos
+// "de" e "ate" como um extrato de investimentos OFX, para importação em
+// programas de finanças pessoais
+func RotaExtratoOFX(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoRelatorios)
+	if !autenticado {
+		return
+	}
+
+	ofx, nome, err := extrato.ExtratoOFXHTTP(r, email)
+	if respondeErro(w, err) {
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+nome+`"`)
+	comunicacao.RespondeTipo(w, http.StatusOK, "application/x-ofx", ofx)
+}
+
+// RotaPapel altera o papel do usuário do campo "email" para o papel do campo
+// "papel". Apenas administradores podem alterar papéis.
+func RotaPapel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, "")
+	if !autenticado || !autorizaPapel(w, email, database.PapelAdmin) {
+		return
+	}
+
+	if err := cadastro.AlteraPapelRequestHTTP(r); respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, []byte{})
+}
+
+// RotaDesbloqueio desbloqueia as tentativas de login da conta do campo "email"
+// e do IP do campo "ip", bloqueadas após falhas consecutivas. Apenas
+// administradores podem desbloquear contas. O pedido deve ser feito com o
+// método POST.
+func RotaDesbloqueio(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, "")
+	if !autenticado || !autorizaPapel(w, email, database.PapelAdmin) {
+		return
+	}
+
+	if err := cadastro.DesbloqueiaRequestHTTP(r); respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, []byte{})
+}
+
+// RotaSessoes cria ou encerra uma sessão. Com o método POST, o pedido deve ter
+// os campos "email" e "senha" preenchidos e a resposta contém o token de acesso
+// e o token de renovação da sessão. Com o método DELETE, a sessão do token de
+// acesso do header "Authorization: Bearer" é revogada.
+func RotaSessoes(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "POST":
+		resposta, err := sessao.CriaSessaoHTTP(r)
+		defineRetryAfter(w, r, r.FormValue("email"), err)
+		if respondeErro(w, err) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusCreated, resposta)
+	case "DELETE":
+		if respondeErro(w, sessao.EncerraSessaoHTTP(r)) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusOK, []byte{})
+	default:
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+	}
+}
+
+// RotaSessaoRenovacao troca o token de renovação do campo "renovacao" por um
+// novo token de acesso e um novo token de renovação. O pedido deve ser feito
+// com o método POST.
+func RotaSessaoRenovacao(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+	resposta, err := sessao.RenovaSessaoHTTP(r)
+	if respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, resposta)
+}
+
+// RotaVerificacaoEmail trata a verificação do e-mail dos usuários. Com o método
+// GET, marca como verificado o e-mail do token do campo "token", enviado por
+// e-mail após o cadastro; não é necessária autenticação. Com o método POST,
+// envia um novo link de verificação ao e-mail do usuário autenticado.
+func RotaVerificacaoEmail(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		if respondeErro(w, cadastro.VerificaEmailHTTP(r)) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusOK, []byte{})
+	case "POST":
+		autenticado, email := autenticaUsuario(w, r, "")
+		if !autenticado {
+			return
+		}
+		if respondeErro(w, cadastro.ReenviaVerificacaoHTTP(email)) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusOK, []byte{})
+	default:
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+	}
+}
+
+// RotaPerfil trata o perfil do usuário autenticado. Com o método GET, retorna
+// o perfil. Com o método PATCH, altera os campos "nome" e "nascimento"
+// presentes no pedido e retorna o perfil atualizado. Com o método DELETE,
+// encerra a conta do usuário; o campo "senha" do corpo do pedido deve conter a
+// senha atual e o saldo de Bitcoins deve estar zerado, ou ser vendido com o
+// campo "liquidar".
+func RotaPerfil(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "PATCH" && r.Method != "DELETE" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+	autenticado, email := autenticaUsuario(w, r, "")
+	if !autenticado {
+		return
+	}
+
+	var resposta []byte
+	var err erros.Erros
+	switch r.Method {
+	case "GET":
+		resposta, err = cadastro.PerfilHTTP(email)
+	case "PATCH":
+		resposta, err = cadastro.AlteraPerfilHTTP(r, email)
+	case "DELETE":
+		err = privacidade.EncerraContaHTTP(r, email)
+		defineRetryAfter(w, r, email, err)
+		resposta = []byte{}
+	}
+	if respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, resposta)
+}
+
+// RotaPerfilDados retorna um arquivo ZIP com todos os dados pessoais e as
+// transações do usuário autenticado. O pedido deve ser feito com o método GET.
+func RotaPerfilDados(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+	autenticado, email := autenticaUsuario(w, r, "")
+	if !autenticado {
+		return
+	}
+
+	arquivo, nome, err := privacidade.ExportaDadosHTTP(email)
+	if respondeErro(w, err) {
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+nome+`"`)
+	comunicacao.RespondeTipo(w, http.StatusOK, "application/zip", arquivo)
+}
+
+// RotaPerfilSenha substitui a senha do usuário autenticado pela senha do campo
+// "senha" e encerra todas as sessões do usuário. O campo "senhaAtual" deve
+// conter a senha atual. O pedido deve ser feito com o método POST.
+func RotaPerfilSenha(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+	autenticado, email := autenticaUsuario(w, r, "")
+	if !autenticado {
+		return
+	}
+	err := cadastro.AlteraSenhaHTTP(r, email)
+	defineRetryAfter(w, r, email, err)
+	if respondeErro(w, err) {
+		return
+	}
+	if respondeErro(w, sessao.EncerraSessoesUsuario(email)) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, []byte{})
+}
+
+// RotaPerfilEmail trata a alteração do e-mail dos usuários. Com o método POST,
+// envia um link de confirmação ao novo e-mail do campo "email" do usuário
+// autenticado; o campo "senha" deve conter a senha atual. Com o método GET,
+// confirma a alteração com o token do campo "token", enviado ao novo e-mail,
+// e encerra todas as sessões do usuário; não é necessária autenticação.
+func RotaPerfilEmail(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		email, err := cadastro.ConfirmaAlteracaoEmailHTTP(r)
+		if respondeErro(w, err) {
+			return
+		}
+		if respondeErro(w, sessao.EncerraSessoesUsuario(email)) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusOK, []byte{})
+	case "POST":
+		autenticado, email := autenticaUsuario(w, r, "")
+		if !autenticado {
+			return
+		}
+		err := cadastro.SolicitaAlteracaoEmailHTTP(r, email)
+		defineRetryAfter(w, r, email, err)
+		if respondeErro(w, err) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusAccepted, []byte{})
+	default:
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+	}
+}
+
+// RotaSenhaEsqueci envia um link de redefinição da senha ao e-mail do campo
+// "email". A resposta é a mesma se o e-mail não está cadastrado. O pedido deve
+// ser feito com o método POST e não é necessária autenticação.
+func RotaSenhaEsqueci(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+	if respondeErro(w, cadastro.SolicitaRedefinicaoSenhaHTTP(r)) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, []byte{})
+}
+
+// RotaSenhaRedefinir substitui a senha do usuário do token do campo "token",
+// enviado por e-mail, pela senha do campo "senha" e encerra todas as sessões do
+// usuário. O pedido deve ser feito com o método POST e não é necessária
+// autenticação.
+func RotaSenhaRedefinir(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+	email, err := cadastro.RedefineSenhaHTTP(r)
+	if respondeErro(w, err) {
+		return
+	}
+	if respondeErro(w, sessao.EncerraSessoesUsuario(email)) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, []byte{})
+}
+
+// RotaDoisFatores trata a autenticação em dois fatores do usuário autenticado.
+// Com o método POST, gera um novo segredo TOTP e retorna o segredo e sua URI de
+// provisionamento. Com o método DELETE, desativa a autenticação em dois
+// fatores; o campo "codigo" deve conter um código TOTP ou de recuperação.
+func RotaDoisFatores(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" && r.Method != "DELETE" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+	autenticado, email := autenticaUsuario(w, r, "")
+	if !autenticado {
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		resposta, err := cadastro.IniciaDoisFatoresHTTP(email)
+		if respondeErro(w, err) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusOK, resposta)
+	case "DELETE":
+		err := cadastro.DesativaDoisFatoresHTTP(r, email)
+		defineRetryAfter(w, r, email, err)
+		if respondeErro(w, err) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusNoContent, []byte{})
+	}
+}
+
+// RotaDoisFatoresConfirmacao ativa a autenticação em dois fatores do usuário
+// autenticado com o código do campo "codigo" e retorna os códigos de
+// recuperação. O pedido deve ser feito com o método POST.
+func RotaDoisFatoresConfirmacao(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+	autenticado, email := autenticaUsuario(w, r, "")
+	if !autenticado {
+		return
+	}
+
+	resposta, err := cadastro.ConfirmaDoisFatoresHTTP(r, email)
+	if respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, resposta)
+}
+
+// RotaChaves trata as chaves de API do usuário autenticado. Com o método GET,
+// retorna as chaves do usuário, sem seus segredos. Com o método POST, cria uma
+// nova chave a partir dos campos "nome", "escopos", "ips" e "expira" e retorna
+// a chave com seu segredo. Com o método DELETE, revoga a chave do campo "id".
+// As chaves de API não podem ser utilizadas para gerenciar as chaves.
+func RotaChaves(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" && r.Method != "DELETE" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+	autenticado, email := autenticaUsuario(w, r, "")
+	if !autenticado {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		resposta, err := chaves.ChavesUsuarioHTTP(email)
+		if respondeErro(w, err) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusOK, resposta)
+	case "POST":
+		resposta, err := chaves.CriaChaveHTTP(r, email)
+		defineRetryAfter(w, r, email, err)
+		if respondeErro(w, err) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusCreated, resposta)
+	case "DELETE":
+		if respondeErro(w, chaves.RevogaChaveHTTP(r, email)) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusNoContent, []byte{})
+	}
+}
+
+// autenticaUsuario verifica a assinatura de um pedido feito com uma chave de
+// API, o token de acesso do header "Authorization: Bearer" ou, se não houver
+// nenhum dos dois e Basic Auth estiver habilitado, se o usuário é cadastrado e
+// se a senha está correta utilizando Basic Auth. Chaves de API só são aceitas
+// se possuírem o escopo passado; com um escopo vazio, não são aceitas. Retorna,
+// também, o e-mail do usuário. Em caso de erro de autenticação, a função
+// responde devidamente ao cliente que o pedido foi proibido (ou um erro
+// ocorreu).
+func autenticaUsuario(w http.ResponseWriter, r *http.Request, escopo string) (bool, string) {
+	if chaves.RequestAssinado(r) {
+		email, err := chaves.AutenticaRequest(r, escopo)
+		if respondeErro(w, err) {
+			return false, ""
+		}
+		return true, email
+	} else if token, ok := sessao.TokenRequest(r); ok {
+		email, err := sessao.ValidaAcesso(token)
+		if respondeErro(w, err) {
+			return false, ""
+		}
+		return true, email
+	} else if !basicAuth {
+		comunicacao.Responde(w, http.StatusForbidden, []byte{})
+		return false, ""
+	}
 	autenticado, email, err := cadastro.VerificaLoginRequestHTTP(r)
 	if !erros.Vazio(err) {
+		defineRetryAfter(w, r, email, err)
 		interno, status, _ := erros.Abre(err)
 		if !interno {
 			comunicacao.RespondeErro(w, status, err)
@@ -174,3 +737,67 @@ func autenticaUsuario(w http.ResponseWriter, r *http.Request) (bool, string) {
 	}
 	return true, email
 }
+
+// respondeErro envia ao cliente o erro gerado, se houver. Se o erro gerado for
+// externo, envia os erros para o usuário. Se não, envia apenas um status code
+// indicando erro interno. Retorna se havia algum erro a ser enviado.
+func respondeErro(w http.ResponseWriter, err erros.Erros) bool {
+	if erros.Vazio(err) {
+		return false
+	}
+	interno, status, _ := erros.Abre(err)
+	if !interno {
+		comunicacao.RespondeErro(w, status, err)
+		return true
+	}
+	comunicacao.Responde(w, status, []byte{})
+	return true
+}
+
+// defineRetryAfter define o header "Retry-After" da resposta com o tempo, em
+// segundos, até que uma nova tentativa de login da conta seja aceita, se o erro
+// gerado é o bloqueio da conta ou do IP do pedido
+func defineRetryAfter(w http.ResponseWriter, r *http.Request, email string, err erros.Erros) {
+	if erros.Vazio(err) || err.Error() != cadastro.ErrContaBloqueada.Error() {
+		return
+	}
+	restante := cadastro.TempoBloqueio(email, comunicacao.IPRequest(r))
+	segundos := int64((restante + time.Second - 1) / time.Second)
+	if segundos < 1 {
+		segundos = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(segundos, 10))
+}
+
+// respondeExportacao envia ao cliente um relatório exportado como anexo. O
+// relatório é escrito diretamente na resposta; um erro durante a escrita só
+// pode ser registrado no log, pois o status code já foi enviado.
+func respondeExportacao(w http.ResponseWriter, exportacao transacao.Exportacao) {
+	w.Header().Set("Content-Type", exportacao.Tipo)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+exportacao.NomeArquivo+`"`)
+	w.WriteHeader(http.StatusOK)
+	if err := exportacao.Escreve(w); err != nil {
+		log.Printf("redcoins-servidor: respondeExportacao: %s", err)
+	}
+}
+
+// RotaLimites retorna os limites de volume em reais do usuário autenticado,
+// definidos pelo seu nível de verificação, e quanto ainda pode ser
+// transacionado no dia e no mês atuais
+func RotaLimites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoRelatorios)
+	if !autenticado {
+		return
+	}
+
+	resposta, err := transacao.LimitesUsuarioHTTP(email)
+	if respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, resposta)
+}
@@ -0,0 +1,104 @@
+package main
+
+// Esse arquivo define as rotas da verificação de identidade (KYC) dos usuários
+
+import (
+	"net/http"
+
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/kyc"
+)
+
+// RotaKYC trata a verificação de identidade do usuário autenticado. Com o
+// método GET, retorna o nível de verificação do usuário e suas solicitações.
+// Com o método POST, cria uma solicitação a partir de um pedido
+// multipart/form-data com o campo "nivel" e um arquivo para cada documento
+// exigido pelo nível ("identidade", "selfie" e "comprovante_residencia").
+func RotaKYC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, "")
+	if !autenticado {
+		return
+	}
+
+	if r.Method == "GET" {
+		resposta, err := kyc.VerificacaoHTTP(email)
+		if respondeErro(w, err) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusOK, resposta)
+		return
+	}
+	resposta, err := kyc.SolicitaVerificacaoHTTP(r, email)
+	if respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusCreated, resposta)
+}
+
+// RotaKYCPendentes retorna as solicitações de verificação que aguardam
+// análise. Apenas a equipe pode consultá-las.
+func RotaKYCPendentes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, "")
+	if !autenticado || !autorizaPapel(w, email, equipe...) {
+		return
+	}
+
+	resposta, err := kyc.SolicitacoesPendentesHTTP()
+	if respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, resposta)
+}
+
+// RotaKYCDocumento retorna o conteúdo do documento do campo "id". Apenas a
+// equipe pode consultar os documentos.
+func RotaKYCDocumento(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, "")
+	if !autenticado || !autorizaPapel(w, email, equipe...) {
+		return
+	}
+
+	conteudo, tipo, err := kyc.DocumentoHTTP(r)
+	if respondeErro(w, err) {
+		return
+	}
+	w.Header().Set("Content-Disposition", "attachment")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	comunicacao.RespondeTipo(w, http.StatusOK, tipo, conteudo)
+}
+
+// RotaKYCAnalise aprova ou rejeita a solicitação de verificação do campo "id"
+// conforme o campo "decisao" ("aprovar" ou "rejeitar"), com o motivo do campo
+// "motivo", obrigatório nas rejeições. Apenas a equipe pode analisar as
+// solicitações, e nunca as próprias.
+func RotaKYCAnalise(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, "")
+	if !autenticado || !autorizaPapel(w, email, equipe...) {
+		return
+	}
+
+	if respondeErro(w, kyc.AnalisaSolicitacaoHTTP(r, email)) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, []byte{})
+}
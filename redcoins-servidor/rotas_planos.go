@@ -0,0 +1,106 @@
+package main
+
+// Esse arquivo define as rotas dos planos de compra recorrente
+
+import (
+	"net/http"
+
+	"github.com/loteny/redcoins/chaves"
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/planos"
+)
+
+// RotaPlanos trata os planos de compra recorrente do usuário autenticado. Com o
+// método GET, retorna os planos do usuário. Com o método POST, cria um novo
+// plano a partir dos campos "valor", "frequencia" ("semanal", "mensal" ou
+// "cron"), "expressao" (apenas para "cron") e "inicio" (opcional,
+// "YYYY-MM-DD HH:MM"). Com o método DELETE, remove o plano do campo "id".
+func RotaPlanos(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" && r.Method != "DELETE" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoNegociacao)
+	if !autenticado {
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		resposta, err := planos.PlanosUsuarioHTTP(email)
+		if respondeErro(w, err) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusOK, resposta)
+	case "POST":
+		resposta, err := planos.CriaPlanoHTTP(r, email)
+		if respondeErro(w, err) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusCreated, resposta)
+	case "DELETE":
+		if respondeErro(w, planos.RemovePlanoHTTP(r, email)) {
+			return
+		}
+		comunicacao.Responde(w, http.StatusNoContent, []byte{})
+	}
+}
+
+// RotaPlanoPausa pausa o plano do campo "id" do usuário autenticado. O pedido
+// deve ser feito com o método POST.
+func RotaPlanoPausa(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoNegociacao)
+	if !autenticado {
+		return
+	}
+
+	if respondeErro(w, planos.PausaPlanoHTTP(r, email)) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusNoContent, []byte{})
+}
+
+// RotaPlanoRetoma reativa o plano pausado do campo "id" do usuário
+// autenticado. O pedido deve ser feito com o método POST.
+func RotaPlanoRetoma(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoNegociacao)
+	if !autenticado {
+		return
+	}
+
+	if respondeErro(w, planos.RetomaPlanoHTTP(r, email)) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusNoContent, []byte{})
+}
+
+// RotaPlanoExecucoes retorna o histórico de execuções do plano do campo "id"
+// do usuário autenticado
+func RotaPlanoExecucoes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		comunicacao.Responde(w, http.StatusMethodNotAllowed, []byte{})
+		return
+	}
+
+	autenticado, email := autenticaUsuario(w, r, chaves.EscopoRelatorios)
+	if !autenticado {
+		return
+	}
+
+	resposta, err := planos.ExecucoesPlanoHTTP(r, email)
+	if respondeErro(w, err) {
+		return
+	}
+	comunicacao.Responde(w, http.StatusOK, resposta)
+}
@@ -1,20 +1,31 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/loteny/redcoins/correio"
 	"github.com/loteny/redcoins/database"
 	"github.com/loteny/redcoins/passenc"
 )
 
+// caixaSaida guarda os e-mails enviados durante os testes
+var caixaSaida = correio.NovaCaixaSaida("")
+
 // init deleta o banco de dados e cria um novo apropriadamente populado
 func init() {
+	correio.DefinePadrao(caixaSaida)
 	if err := database.DeletaDatabaseTeste(); err != nil {
 		log.Fatalf("erro ao deletar database: %s", err)
 	}
@@ -30,7 +41,7 @@ func TestRotaCadastro(t *testing.T) {
 	// Cadastro válido
 	form := url.Values{}
 	form.Set("email", "testerotacadastro@gmail.com")
-	form.Set("senha", "123456")
+	form.Set("senha", "senhateste1")
 	form.Set("nome", "Teste Rota Cadastro")
 	form.Set("nascimento", "1994-03-07")
 	statusCode, body := testPostSimples(t, form, RotaCadastro)
@@ -51,6 +62,340 @@ func TestRotaCadastro(t *testing.T) {
 	}
 }
 
+func TestRotaVerificacaoEmail(t *testing.T) {
+	form := url.Values{}
+	form.Set("email", "testeverificacao@gmail.com")
+	form.Set("senha", "senhateste1")
+	form.Set("nome", "Teste Verificação")
+	form.Set("nascimento", "1994-03-07")
+	if statusCode, _ := testPostSimples(t, form, RotaCadastro); statusCode != 201 {
+		t.Fatalf("Status code inesperado: %v", statusCode)
+	}
+
+	// Transações são recusadas antes da verificação
+	form = url.Values{}
+	form.Set("qtd", "0.0001")
+	statusCode, body := testPostAuth(t, form, RotaCompra, "testeverificacao@gmail.com", "senhateste1")
+	if statusCode != 403 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["email_nao_verificado"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Verificação com o link enviado por e-mail, apenas uma vez
+	m, ok := caixaSaida.Ultima("testeverificacao@gmail.com")
+	if !ok {
+		t.Fatalf("E-mail de verificação não enviado")
+	}
+	i := strings.Index(m.Corpo, "token=")
+	if i < 0 {
+		t.Fatalf("Link de verificação não encontrado: %v", m.Corpo)
+	}
+	token, _ := url.QueryUnescape(strings.Fields(m.Corpo[i+len("token="):])[0])
+	statusCode, _ = testGetAuth(t, map[string]string{"token": token}, RotaVerificacaoEmail, "", "")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	statusCode, body = testGetAuth(t, map[string]string{"token": token}, RotaVerificacaoEmail, "", "")
+	if statusCode != 400 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["token_email_invalido"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Após a verificação, um novo link não é enviado
+	statusCode, body = testPostAuth(t, url.Values{}, RotaVerificacaoEmail, "testeverificacao@gmail.com", "senhateste1")
+	if statusCode != 400 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["email_ja_verificado"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+}
+
+func TestRotaSenha(t *testing.T) {
+	form := url.Values{}
+	form.Set("email", "testesenha@gmail.com")
+	form.Set("senha", "senhaantiga")
+	form.Set("nome", "Teste Senha")
+	form.Set("nascimento", "1994-03-07")
+	if statusCode, _ := testPostSimples(t, form, RotaCadastro); statusCode != 201 {
+		t.Fatalf("Status code inesperado: %v", statusCode)
+	}
+	form = url.Values{}
+	form.Set("email", "testesenha@gmail.com")
+	form.Set("senha", "senhaantiga")
+	statusCode, body := testPostSimples(t, form, RotaSessoes)
+	if statusCode != 201 {
+		t.Fatalf("Status code inesperado: %v", statusCode)
+	}
+	tokens := struct {
+		Acesso string `json:"acesso"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &tokens); err != nil {
+		t.Fatalf("Corpo da resposta inesperado: %v (%v)", body, err)
+	}
+
+	// A resposta não revela se o e-mail está cadastrado
+	for _, email := range []string{"testesenha@gmail.com", "naoexistente@gmail.com"} {
+		form = url.Values{}
+		form.Set("email", email)
+		statusCode, body = testPostSimples(t, form, RotaSenhaEsqueci)
+		if statusCode != 200 || body != "" {
+			t.Errorf("Resposta inesperada para %v: %v %v", email, statusCode, body)
+		}
+	}
+	m, ok := caixaSaida.Ultima("testesenha@gmail.com")
+	i := strings.Index(m.Corpo, "/senha/redefinir?token=")
+	if !ok || i < 0 {
+		t.Fatalf("Link de redefinição não encontrado: %v", m.Corpo)
+	}
+	token, _ := url.QueryUnescape(strings.Fields(m.Corpo[i+len("/senha/redefinir?token="):])[0])
+
+	// Redefinição: a senha antiga e as sessões deixam de ser aceitas
+	form = url.Values{}
+	form.Set("token", token)
+	form.Set("senha", "senhanova")
+	if statusCode, body = testPostSimples(t, form, RotaSenhaRedefinir); statusCode != 200 {
+		t.Errorf("Status code inesperado: %v %v", statusCode, body)
+	}
+	statusCode, body = testPostSimples(t, form, RotaSenhaRedefinir)
+	if statusCode != 400 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["token_email_invalido"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+	if statusCode, _ = testGetAuth(t, map[string]string{}, RotaLimites, "testesenha@gmail.com", "senhaantiga"); statusCode != 403 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if statusCode, _ = testGetAuth(t, map[string]string{}, RotaLimites, "testesenha@gmail.com", "senhanova"); statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if statusCode, _ = testRequestToken(t, "GET", url.Values{}, RotaLimites, tokens.Acesso); statusCode != 401 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+}
+
+func TestRotaPerfil(t *testing.T) {
+	form := url.Values{}
+	form.Set("email", "testeperfil@gmail.com")
+	form.Set("senha", "senhaperfil")
+	form.Set("nome", "Teste Perfil")
+	form.Set("nascimento", "1994-03-07")
+	if statusCode, _ := testPostSimples(t, form, RotaCadastro); statusCode != 201 {
+		t.Fatalf("Status code inesperado: %v", statusCode)
+	}
+
+	// Consulta
+	statusCode, body := testGetAuth(t, map[string]string{}, RotaPerfil, "testeperfil@gmail.com", "senhaperfil")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.HasPrefix(body, `{"email":"testeperfil@gmail.com","nome":"Teste Perfil",`) {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Alteração com o método PATCH
+	form = url.Values{}
+	form.Set("email", "testeperfil@gmail.com")
+	form.Set("senha", "senhaperfil")
+	statusCode, body = testPostSimples(t, form, RotaSessoes)
+	tokens := struct {
+		Acesso string `json:"acesso"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &tokens); statusCode != 201 || err != nil {
+		t.Fatalf("Resposta inesperada: %v %v", statusCode, body)
+	}
+	form = url.Values{}
+	form.Set("nascimento", "1994-13-07")
+	statusCode, body = testRequestToken(t, "PATCH", form, RotaPerfil, tokens.Acesso)
+	if statusCode != 400 || body != `{"erros":["nascimento_invalido"]}` {
+		t.Errorf("Resposta inesperada: %v %v", statusCode, body)
+	}
+	form.Set("nascimento", "1990-01-01")
+	statusCode, body = testRequestToken(t, "PATCH", form, RotaPerfil, tokens.Acesso)
+	if statusCode != 200 || !strings.Contains(body, `"nascimento":"1990-01-01"`) {
+		t.Errorf("Resposta inesperada: %v %v", statusCode, body)
+	}
+
+	// Alteração da senha
+	form = url.Values{}
+	form.Set("senhaAtual", "senhaincorreta")
+	form.Set("senha", "senhanova")
+	statusCode, body = testPostAuth(t, form, RotaPerfilSenha, "testeperfil@gmail.com", "senhaperfil")
+	if statusCode != 403 || body != `{"erros":["senha_atual_incorreta"]}` {
+		t.Errorf("Resposta inesperada: %v %v", statusCode, body)
+	}
+	form.Set("senhaAtual", "senhaperfil")
+	if statusCode, body = testPostAuth(t, form, RotaPerfilSenha, "testeperfil@gmail.com", "senhaperfil"); statusCode != 200 {
+		t.Errorf("Resposta inesperada: %v %v", statusCode, body)
+	}
+
+	// As sessões são encerradas com a alteração da senha
+	if statusCode, _ = testRequestToken(t, "GET", url.Values{}, RotaPerfil, tokens.Acesso); statusCode != 401 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	form = url.Values{}
+	form.Set("email", "testeperfil@gmail.com")
+	form.Set("senha", "senhanova")
+	statusCode, body = testPostSimples(t, form, RotaSessoes)
+	if err := json.Unmarshal([]byte(body), &tokens); statusCode != 201 || err != nil {
+		t.Fatalf("Resposta inesperada: %v %v", statusCode, body)
+	}
+
+	// Alteração do e-mail, confirmada pelo link enviado ao novo e-mail
+	form = url.Values{}
+	form.Set("email", "testeperfilnovo@gmail.com")
+	form.Set("senha", "senhanova")
+	if statusCode, body = testPostAuth(t, form, RotaPerfilEmail, "testeperfil@gmail.com", "senhanova"); statusCode != 202 {
+		t.Errorf("Resposta inesperada: %v %v", statusCode, body)
+	}
+	m, ok := caixaSaida.Ultima("testeperfilnovo@gmail.com")
+	i := strings.Index(m.Corpo, "/perfil/email?token=")
+	if !ok || i < 0 {
+		t.Fatalf("Link de confirmação não encontrado: %v", m.Corpo)
+	}
+	token, _ := url.QueryUnescape(strings.Fields(m.Corpo[i+len("/perfil/email?token="):])[0])
+	if statusCode, body = testGetAuth(t, map[string]string{"token": token}, RotaPerfilEmail, "", ""); statusCode != 200 {
+		t.Errorf("Resposta inesperada: %v %v", statusCode, body)
+	}
+	statusCode, body = testGetAuth(t, map[string]string{}, RotaPerfil, "testeperfilnovo@gmail.com", "senhanova")
+	if statusCode != 200 || !strings.Contains(body, `"emailVerificado":true`) {
+		t.Errorf("Resposta inesperada: %v %v", statusCode, body)
+	}
+	if statusCode, _ = testRequestToken(t, "GET", url.Values{}, RotaPerfil, tokens.Acesso); statusCode != 401 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+}
+
+func TestRotaPerfilDados(t *testing.T) {
+	form := url.Values{}
+	form.Set("email", "testedados@gmail.com")
+	form.Set("senha", "senhadados")
+	form.Set("nome", "Teste Dados")
+	form.Set("nascimento", "1994-03-07")
+	if statusCode, _ := testPostSimples(t, form, RotaCadastro); statusCode != 201 {
+		t.Fatalf("Status code inesperado: %v", statusCode)
+	}
+
+	// Exportação dos dados
+	statusCode, body := testGetAuth(t, map[string]string{}, RotaPerfilDados, "testedados@gmail.com", "senhadados")
+	if statusCode != 200 || !strings.HasPrefix(body, "PK") {
+		t.Errorf("Resposta inesperada: %v %q", statusCode, body)
+	}
+
+	// Encerramento da conta com o método DELETE, com a senha no corpo
+	statusCode, body = testPostSimples(t, form, RotaSessoes)
+	tokens := struct {
+		Acesso string `json:"acesso"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &tokens); statusCode != 201 || err != nil {
+		t.Fatalf("Resposta inesperada: %v %v", statusCode, body)
+	}
+	form = url.Values{}
+	form.Set("senha", "senhaincorreta")
+	statusCode, body = testRequestToken(t, "DELETE", form, RotaPerfil, tokens.Acesso)
+	if statusCode != 403 || body != `{"erros":["senha_atual_incorreta"]}` {
+		t.Errorf("Resposta inesperada: %v %v", statusCode, body)
+	}
+	form.Set("senha", "senhadados")
+	if statusCode, body = testRequestToken(t, "DELETE", form, RotaPerfil, tokens.Acesso); statusCode != 200 {
+		t.Errorf("Resposta inesperada: %v %v", statusCode, body)
+	}
+	if m, ok := caixaSaida.Ultima("testedados@gmail.com"); !ok || !strings.Contains(m.Assunto, "encerrada") {
+		t.Errorf("Aviso de encerramento não enviado: %v", m)
+	}
+
+	// A sessão é encerrada e o login não é mais aceito
+	if statusCode, _ = testRequestToken(t, "GET", url.Values{}, RotaPerfil, tokens.Acesso); statusCode != 401 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if statusCode, _ = testGetAuth(t, map[string]string{}, RotaPerfil, "testedados@gmail.com", "senhadados"); statusCode == 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+}
+
+func TestRotaKYC(t *testing.T) {
+	// O usuário consulta seu nível de verificação
+	statusCode, body := testGetAuth(t, map[string]string{}, RotaKYC, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 200 || body != `{"nivel":0,"solicitacoes":[]}` {
+		t.Errorf("Resposta inesperada: %v %v", statusCode, body)
+	}
+	// As solicitações devem ser enviadas como multipart/form-data
+	form := url.Values{}
+	form.Set("nivel", "1")
+	if statusCode, body := testPostAuth(t, form, RotaKYC, "valido1@gmail.com", "senhavalido1"); statusCode != 400 {
+		t.Errorf("Resposta inesperada: %v %v", statusCode, body)
+	}
+
+	// Apenas a equipe acessa as solicitações pendentes e analisa solicitações
+	if statusCode, _ := testGetAuth(t, map[string]string{}, RotaKYCPendentes, "valido1@gmail.com", "senhavalido1"); statusCode != 403 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if statusCode, body := testGetAuth(t, map[string]string{}, RotaKYCPendentes, "suporte@gmail.com", "senhasuporte"); statusCode != 200 || body != "[]" {
+		t.Errorf("Resposta inesperada: %v %v", statusCode, body)
+	}
+	if statusCode, _ := testGetAuth(t, map[string]string{"id": "1"}, RotaKYCDocumento, "valido1@gmail.com", "senhavalido1"); statusCode != 403 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if statusCode, _ := testGetAuth(t, map[string]string{"id": "1"}, RotaKYCDocumento, "suporte@gmail.com", "senhasuporte"); statusCode != 404 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	form = url.Values{}
+	form.Set("id", "1")
+	form.Set("decisao", "aprovar")
+	if statusCode, _ := testPostAuth(t, form, RotaKYCAnalise, "valido1@gmail.com", "senhavalido1"); statusCode != 403 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if statusCode, _ := testPostAuth(t, form, RotaKYCAnalise, "admin@gmail.com", "senhaadmin"); statusCode != 404 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+}
+
+func TestRotaDesbloqueio(t *testing.T) {
+	form := url.Values{}
+	form.Set("email", "testebloqueio@gmail.com")
+	form.Set("senha", "senhabloqueio")
+	form.Set("nome", "Teste Bloqueio")
+	form.Set("nascimento", "1994-03-07")
+	if statusCode, _ := testPostSimples(t, form, RotaCadastro); statusCode != 201 {
+		t.Fatalf("Status code inesperado: %v", statusCode)
+	}
+
+	// Após algumas falhas, as tentativas são recusadas por um tempo
+	for i := 0; i < 3; i++ {
+		if statusCode, _ := testGetAuth(t, map[string]string{}, RotaPerfil, "testebloqueio@gmail.com", "senhaincorreta"); statusCode != 403 {
+			t.Errorf("Status code inesperado: %v", statusCode)
+		}
+	}
+	request, _ := http.NewRequest("GET", "/", nil)
+	request.SetBasicAuth("testebloqueio@gmail.com", "senhabloqueio")
+	recorder := httptest.NewRecorder()
+	http.HandlerFunc(RotaPerfil).ServeHTTP(recorder, request)
+	if recorder.Code != 429 || recorder.Body.String() != `{"erros":["conta_bloqueada"]}` {
+		t.Errorf("Resposta inesperada: %v %v", recorder.Code, recorder.Body.String())
+	}
+	if recorder.Header().Get("Retry-After") != "1" {
+		t.Errorf("Retry-After inesperado: %v", recorder.Header().Get("Retry-After"))
+	}
+
+	// Apenas administradores podem desbloquear contas
+	form = url.Values{}
+	form.Set("email", "testebloqueio@gmail.com")
+	if statusCode, _ := testPostAuth(t, form, RotaDesbloqueio, "suporte@gmail.com", "senhasuporte"); statusCode != 403 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if statusCode, _ := testPostAuth(t, form, RotaDesbloqueio, "admin@gmail.com", "senhaadmin"); statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if statusCode, _ := testGetAuth(t, map[string]string{}, RotaPerfil, "testebloqueio@gmail.com", "senhabloqueio"); statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+}
+
 func TestRotaCompra(t *testing.T) {
 	// Compra válida
 	form := url.Values{}
@@ -73,13 +418,14 @@ func TestRotaCompra(t *testing.T) {
 		t.Errorf("Corpo da resposta inesperado: %v", body)
 	}
 
-	// Data inválida
+	// Com a política de datas padrão, a data enviada é ignorada mesmo que seja
+	// inválida, pois o servidor atribui a data da transação
 	form.Set("data", "200001-01")
 	statusCode, body = testPostAuth(t, form, RotaCompra, "valido4@gmail.com", "senhavalido4")
-	if statusCode != 400 {
+	if statusCode != 201 {
 		t.Errorf("Status code inesperado: %v", statusCode)
 	}
-	if body != `{"erros":["data_invalida"]}` {
+	if body != "" {
 		t.Errorf("Corpo da resposta inesperado: %v", body)
 	}
 }
@@ -106,13 +452,14 @@ func TestRotaVenda(t *testing.T) {
 		t.Errorf("Corpo da resposta inesperado: %v", body)
 	}
 
-	// Data inválida
+	// Com a política de datas padrão, a data enviada é ignorada mesmo que seja
+	// inválida, pois o servidor atribui a data da transação
 	form.Set("data", "200001-01")
 	statusCode, body = testPostAuth(t, form, RotaVenda, "valido3@gmail.com", "senhavalido3")
-	if statusCode != 400 {
+	if statusCode != 201 {
 		t.Errorf("Status code inesperado: %v", statusCode)
 	}
-	if body != `{"erros":["data_invalida"]}` {
+	if body != "" {
 		t.Errorf("Corpo da resposta inesperado: %v", body)
 	}
 
@@ -127,6 +474,16 @@ func TestRotaVenda(t *testing.T) {
 		t.Errorf("Corpo da resposta inesperado: %v", body)
 	}
 
+	// Quantidade com casas decimais demais
+	form.Set("qtd", "0.000100001")
+	statusCode, body = testPostAuth(t, form, RotaVenda, "valido3@gmail.com", "senhavalido3")
+	if statusCode != 400 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["qtd_casas_decimais"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
 	// Saldo insuficiente
 	form.Set("qtd", "10000")
 	statusCode, body = testPostAuth(t, form, RotaVenda, "valido3@gmail.com", "senhavalido3")
@@ -141,17 +498,31 @@ func TestRotaVenda(t *testing.T) {
 func TestRotaRelatorioDia(t *testing.T) {
 	// Verificaremos as transações do dia 2018-01-02
 	dados := map[string]string{"data": "2018-01-02"}
-	statusCode, body := testGetAuth(t, dados, RotaRelatorioDia, "valido1@gmail.com", "senhavalido1")
+	statusCode, body := testGetAuth(t, dados, RotaRelatorioDia, "admin@gmail.com", "senhaadmin")
 	if statusCode != 200 {
 		t.Errorf("Status code inesperado: %v", statusCode)
 	}
 	if body != `{"transacoes":[`+
-		`{"usuario":"valido1@gmail.com","compra":true,"creditos":30,"bitcoins":0.003,"dia":"2018-01-02"},`+
-		`{"usuario":"valido2@gmail.com","compra":true,"creditos":40,"bitcoins":0.004,"dia":"2018-01-02"},`+
-		`{"usuario":"valido2@gmail.com","compra":false,"creditos":15,"bitcoins":0.0005,"dia":"2018-01-02"}]}` {
+		`{"usuario":"valido1@gmail.com","compra":true,"creditos":30,"bitcoins":0.003,"dia":"2018-01-02 10:00:00"},`+
+		`{"usuario":"valido2@gmail.com","compra":true,"creditos":40,"bitcoins":0.004,"dia":"2018-01-02 10:00:00"},`+
+		`{"usuario":"valido2@gmail.com","compra":false,"creditos":15,"bitcoins":0.0005,"dia":"2018-01-02 10:00:00"}]}` {
 		t.Errorf("Corpo da resposta inesperado: %v", body)
 	}
 
+	// Apenas administradores têm acesso
+	for usuario, senha := range map[string]string{
+		"valido1@gmail.com": "senhavalido1",
+		"suporte@gmail.com": "senhasuporte",
+	} {
+		statusCode, body = testGetAuth(t, dados, RotaRelatorioDia, usuario, senha)
+		if statusCode != 403 {
+			t.Errorf("Status code inesperado para %v: %v", usuario, statusCode)
+		}
+		if body != `{"erros":["acesso_negado"]}` {
+			t.Errorf("Corpo da resposta inesperado para %v: %v", usuario, body)
+		}
+	}
+
 	// Autenticação falha
 	statusCode, body = testGetAuth(t, dados, RotaRelatorioDia, "valido1@gmail.com", "senhaincorreta")
 	if statusCode != 403 {
@@ -170,12 +541,51 @@ func TestRotaRelatorioUsuario(t *testing.T) {
 		t.Errorf("Status code inesperado: %v", statusCode)
 	}
 	if body != `{"transacoes":[`+
-		`{"usuario":"valido1@gmail.com","compra":true,"creditos":10,"bitcoins":0.001,"dia":"2018-01-01"},`+
-		`{"usuario":"valido1@gmail.com","compra":true,"creditos":20,"bitcoins":0.002,"dia":"2018-01-01"},`+
-		`{"usuario":"valido1@gmail.com","compra":true,"creditos":30,"bitcoins":0.003,"dia":"2018-01-02"}]}` {
+		`{"usuario":"valido1@gmail.com","compra":true,"creditos":10,"bitcoins":0.001,"dia":"2018-01-01 10:00:00"},`+
+		`{"usuario":"valido1@gmail.com","compra":true,"creditos":20,"bitcoins":0.002,"dia":"2018-01-01 10:00:00"},`+
+		`{"usuario":"valido1@gmail.com","compra":true,"creditos":30,"bitcoins":0.003,"dia":"2018-01-02 10:00:00"}]}` {
 		t.Errorf("Corpo da resposta inesperado: %v", body)
 	}
 
+	// Exportação em CSV
+	dados["formato"] = "csv"
+	statusCode, body = testGetAuth(t, dados, RotaRelatorioUsuario, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.HasSuffix(body, "Data;Usuário;Tipo;Bitcoins;Valor (R$)\n"+
+		"01/01/2018 10:00:00;valido1@gmail.com;Compra;0,00100000;10,00\n"+
+		"01/01/2018 10:00:00;valido1@gmail.com;Compra;0,00200000;20,00\n"+
+		"02/01/2018 10:00:00;valido1@gmail.com;Compra;0,00300000;30,00\n") {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+	delete(dados, "formato")
+
+	// Clientes não têm acesso ao relatório de outros usuários, nem ao de todos
+	for _, email := range []string{"valido2@gmail.com", ""} {
+		dados["email"] = email
+		statusCode, body = testGetAuth(t, dados, RotaRelatorioUsuario, "valido1@gmail.com", "senhavalido1")
+		if statusCode != 403 {
+			t.Errorf("Status code inesperado: %v", statusCode)
+		}
+		if body != `{"erros":["acesso_negado"]}` {
+			t.Errorf("Corpo da resposta inesperado: %v", body)
+		}
+	}
+
+	// A equipe tem acesso ao relatório de qualquer usuário
+	dados["email"] = "valido2@gmail.com"
+	statusCode, body = testGetAuth(t, dados, RotaRelatorioUsuario, "suporte@gmail.com", "senhasuporte")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"transacoes":[`+
+		`{"usuario":"valido2@gmail.com","compra":true,"creditos":40,"bitcoins":0.004,"dia":"2018-01-02 10:00:00"},`+
+		`{"usuario":"valido2@gmail.com","compra":false,"creditos":15,"bitcoins":0.0005,"dia":"2018-01-02 10:00:00"}]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+	dados["email"] = "valido1@gmail.com"
+
 	// Autenticação falha
 	statusCode, body = testGetAuth(t, dados, RotaRelatorioUsuario, "valido1@gmail.com", "senhaincorreta")
 	if statusCode != 403 {
@@ -186,6 +596,449 @@ func TestRotaRelatorioUsuario(t *testing.T) {
 	}
 }
 
+func TestRotaPapel(t *testing.T) {
+	// Apenas administradores podem alterar papéis
+	form := url.Values{}
+	form.Set("email", "valido4@gmail.com")
+	form.Set("papel", "suporte")
+	statusCode, body := testPostAuth(t, form, RotaPapel, "suporte@gmail.com", "senhasuporte")
+	if statusCode != 403 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["acesso_negado"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Papel inválido
+	form.Set("papel", "gerente")
+	statusCode, body = testPostAuth(t, form, RotaPapel, "admin@gmail.com", "senhaadmin")
+	if statusCode != 400 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["papel_invalido"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Alteração válida, desfeita em seguida
+	for _, papel := range []string{"suporte", "cliente"} {
+		form.Set("papel", papel)
+		statusCode, body = testPostAuth(t, form, RotaPapel, "admin@gmail.com", "senhaadmin")
+		if statusCode != 200 {
+			t.Errorf("Status code inesperado: %v", statusCode)
+		}
+		if body != `` {
+			t.Errorf("Corpo da resposta inesperado: %v", body)
+		}
+	}
+}
+
+func TestRotaPlanos(t *testing.T) {
+	// Criação de plano válido
+	form := url.Values{}
+	form.Set("valor", "100")
+	form.Set("frequencia", "cron")
+	form.Set("expressao", "0 9 * * 1")
+	statusCode, body := testPostAuth(t, form, RotaPlanos, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 201 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.Contains(body, `"frequencia":"cron","expressao":"0 9 * * 1","estado":"ativo"`) {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Listagem dos planos
+	statusCode, body = testGetAuth(t, map[string]string{}, RotaPlanos, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.HasPrefix(body, `{"planos":[{"id":`) {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Frequência inválida
+	form.Set("frequencia", "anual")
+	statusCode, body = testPostAuth(t, form, RotaPlanos, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 400 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["frequencia_invalida"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Pausa de plano inexistente
+	form = url.Values{}
+	form.Set("id", "999999")
+	statusCode, body = testPostAuth(t, form, RotaPlanoPausa, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 404 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["plano_nao_existente"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+}
+
+func TestRotaLimites(t *testing.T) {
+	statusCode, body := testGetAuth(t, map[string]string{}, RotaLimites, "valido2@gmail.com", "senhavalido2")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.HasPrefix(body, `{"nivel":0,"porTransacao":1000,"diario":2000,"mensal":10000,`) {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Autenticação falha
+	statusCode, _ = testGetAuth(t, map[string]string{}, RotaLimites, "valido2@gmail.com", "senhaincorreta")
+	if statusCode != 403 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+}
+
+func TestRotaPortfolio(t *testing.T) {
+	// valido3@gmail.com comprou 1 Bitcoin por 400 reais
+	statusCode, body := testGetAuth(t, map[string]string{}, RotaPortfolio, "valido3@gmail.com", "senhavalido3")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.Contains(body, `"metodoCusto":"medio"`) {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Autenticação falha
+	statusCode, _ = testGetAuth(t, map[string]string{}, RotaPortfolio, "valido3@gmail.com", "senhaincorreta")
+	if statusCode != 403 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+}
+
+func TestRotaCarteira(t *testing.T) {
+	// Até 2018-01-01, valido1@gmail.com comprou 0.003 Bitcoins por 30 reais
+	dados := map[string]string{"em": "2018-01-01"}
+	statusCode, body := testGetAuth(t, dados, RotaCarteira, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"em":"2018-01-01","bitcoins":0.003,"reais":-30}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Data inválida
+	dados["em"] = "01/01/2018"
+	statusCode, body = testGetAuth(t, dados, RotaCarteira, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 400 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["data_invalida"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+}
+
+func TestRotaCarteiraVerificacao(t *testing.T) {
+	statusCode, body := testGetAuth(t, map[string]string{}, RotaCarteiraVerificacao, "admin@gmail.com", "senhaadmin")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `[]` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Apenas administradores têm acesso
+	statusCode, body = testGetAuth(t, map[string]string{}, RotaCarteiraVerificacao, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 403 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["acesso_negado"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+}
+
+func TestRotaRelatorioImpostos(t *testing.T) {
+	// valido3@gmail.com comprou 1 Bitcoin por 400 reais em 2012
+	dados := map[string]string{"ano": "2012"}
+	statusCode, body := testGetAuth(t, dados, RotaRelatorioImpostos, "valido3@gmail.com", "senhavalido3")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.Contains(body, `"posicaoFinal":{"data":"2012-12-31","bitcoins":1,"custoTotal":400}`) {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Formato CSV
+	dados["formato"] = "csv"
+	statusCode, body = testGetAuth(t, dados, RotaRelatorioImpostos, "valido3@gmail.com", "senhavalido3")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.HasPrefix(body, "mes,volume_vendas,lucro_realizado,isento,lucro_tributavel\n") {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Ano inválido
+	dados["ano"] = "20x2"
+	statusCode, body = testGetAuth(t, dados, RotaRelatorioImpostos, "valido3@gmail.com", "senhavalido3")
+	if statusCode != 400 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["ano_invalido"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+}
+
+func TestRotaRelatorioEstatisticas(t *testing.T) {
+	// Em 2018-01-01, valido1@gmail.com comprou 0.001 e 0.002 Bitcoins por 10 e
+	// 20 reais
+	dados := map[string]string{"de": "2018-01-01", "ate": "2018-01-01"}
+	statusCode, body := testGetAuth(t, dados, RotaRelatorioEstatisticas, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `[{"periodo":"2018-01-01","compras":2,"vendas":0,"volumeBitcoins":0.003,"volumeReais":30,`+
+		`"precoMedio":10000,"usuarios":1,"maiorTransacao":20}]` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Intervalo inválido
+	dados["intervalo"] = "mes"
+	statusCode, body = testGetAuth(t, dados, RotaRelatorioEstatisticas, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 400 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["intervalo_invalido"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+}
+
+func TestRotaExtrato(t *testing.T) {
+	// Em 2018-01-02, valido1@gmail.com comprou 0.003 Bitcoins por 30 reais,
+	// após ter comprado 0.001 e 0.002 Bitcoins por 10 e 20 reais em 2018-01-01
+	dados := map[string]string{"de": "2018-01-02", "ate": "2018-01-02"}
+	statusCode, body := testGetAuth(t, dados, RotaExtrato, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"de":"2018-01-02","ate":"2018-01-02",`+
+		`"saldoInicial":{"bitcoins":0.003,"reais":-30},"saldoFinal":{"bitcoins":0.006,"reais":-60},`+
+		`"movimentacoes":[{"dia":"2018-01-02 10:00:00","compra":true,"bitcoins":0.003,"creditos":30,"saldoBitcoins":0.006,"saldoReais":-60}]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Período inválido
+	dados["de"] = "2018-01-03"
+	statusCode, body = testGetAuth(t, dados, RotaExtrato, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 400 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["periodo_invalido"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+}
+
+func TestRotaExtratoPDF(t *testing.T) {
+	dados := map[string]string{"de": "2018-01-01", "ate": "2018-01-02"}
+	statusCode, body := testGetAuth(t, dados, RotaExtratoPDF, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.HasPrefix(body, "%PDF-") || !strings.Contains(body, "valido1@gmail.com") {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Período inválido
+	dados["de"] = "2018-01-03"
+	statusCode, body = testGetAuth(t, dados, RotaExtratoPDF, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 400 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["periodo_invalido"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+}
+
+func TestRotaExtratoOFX(t *testing.T) {
+	// As compras de valido1@gmail.com são as três primeiras transações
+	dados := map[string]string{"de": "2018-01-01", "ate": "2018-01-02"}
+	statusCode, body := testGetAuth(t, dados, RotaExtratoOFX, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.Contains(body, `<?OFX OFXHEADER="200" VERSION="220"`) ||
+		strings.Count(body, "<BUYOTHER>") != 3 || !strings.Contains(body, "<FITID>RC-3</FITID>") {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Período inválido
+	dados["de"] = "2018-01-03"
+	statusCode, body = testGetAuth(t, dados, RotaExtratoOFX, "valido1@gmail.com", "senhavalido1")
+	if statusCode != 400 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["periodo_invalido"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+}
+
+func TestRotaSessoes(t *testing.T) {
+	// Credenciais incorretos
+	form := url.Values{}
+	form.Set("email", "valido2@gmail.com")
+	form.Set("senha", "senhaincorreta")
+	statusCode, body := testPostSimples(t, form, RotaSessoes)
+	if statusCode != 403 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["credenciais_invalidos"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Criação da sessão
+	form.Set("senha", "senhavalido2")
+	statusCode, body = testPostSimples(t, form, RotaSessoes)
+	if statusCode != 201 {
+		t.Fatalf("Status code inesperado: %v", statusCode)
+	}
+	tokens := struct {
+		Acesso    string `json:"acesso"`
+		Renovacao string `json:"renovacao"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &tokens); err != nil {
+		t.Fatalf("Corpo da resposta inesperado: %v (%v)", body, err)
+	}
+
+	// O token de acesso autentica o usuário
+	statusCode, body = testRequestToken(t, "GET", url.Values{}, RotaLimites, tokens.Acesso)
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.HasPrefix(body, `{"nivel":0,`) {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Renovação
+	form = url.Values{}
+	form.Set("renovacao", tokens.Renovacao)
+	statusCode, body = testPostSimples(t, form, RotaSessaoRenovacao)
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.HasPrefix(body, `{"acesso":"`) {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+	statusCode, body = testPostSimples(t, form, RotaSessaoRenovacao)
+	if statusCode != 401 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["renovacao_invalida"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Encerramento da sessão: o token de acesso deixa de ser aceito
+	statusCode, _ = testRequestToken(t, "DELETE", url.Values{}, RotaSessoes, tokens.Acesso)
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	statusCode, body = testRequestToken(t, "GET", url.Values{}, RotaLimites, tokens.Acesso)
+	if statusCode != 401 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["token_invalido"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Com Basic Auth desabilitado, apenas tokens de acesso são aceitos
+	basicAuth = false
+	defer func() { basicAuth = true }()
+	statusCode, _ = testGetAuth(t, map[string]string{}, RotaLimites, "valido2@gmail.com", "senhavalido2")
+	if statusCode != 403 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+}
+
+func TestRotaChaves(t *testing.T) {
+	// Criação de uma chave com o escopo de relatórios
+	form := url.Values{}
+	form.Set("nome", "robô")
+	form.Set("escopos", "relatorios")
+	statusCode, body := testPostAuth(t, form, RotaChaves, "valido3@gmail.com", "senhavalido3")
+	if statusCode != 201 {
+		t.Fatalf("Status code inesperado: %v (%v)", statusCode, body)
+	}
+	chave := struct {
+		ID      string `json:"id"`
+		Segredo string `json:"segredo"`
+	}{}
+	if err := json.Unmarshal([]byte(body), &chave); err != nil {
+		t.Fatalf("Corpo da resposta inesperado: %v (%v)", body, err)
+	}
+
+	// A chave autentica rotas do seu escopo
+	statusCode, body = testRequestAssinado(t, "GET", "", RotaLimites, chave.ID, chave.Segredo)
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.HasPrefix(body, `{"nivel":0,`) {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Rotas fora do escopo e o gerenciamento de chaves são recusados
+	for _, f := range []func(w http.ResponseWriter, r *http.Request){RotaCompra, RotaChaves} {
+		statusCode, body = testRequestAssinado(t, "POST", "qtd=0.1", f, chave.ID, chave.Segredo)
+		if statusCode != 403 {
+			t.Errorf("Status code inesperado: %v", statusCode)
+		}
+		if body != `{"erros":["escopo_insuficiente"]}` {
+			t.Errorf("Corpo da resposta inesperado: %v", body)
+		}
+	}
+
+	// Listagem e revogação
+	statusCode, body = testGetAuth(t, map[string]string{}, RotaChaves, "valido3@gmail.com", "senhavalido3")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.HasPrefix(body, `{"chaves":[{"id":"`+chave.ID+`","nome":"robô","escopos":["relatorios"],"ips":[]`) ||
+		strings.Contains(body, chave.Segredo) {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+	statusCode, _ = testDeleteAuth(t, map[string]string{"id": chave.ID}, RotaChaves, "valido3@gmail.com", "senhavalido3")
+	if statusCode != 204 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	statusCode, body = testRequestAssinado(t, "GET", "", RotaLimites, chave.ID, chave.Segredo)
+	if statusCode != 401 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["chave_invalida"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+}
+
+func TestRotaDoisFatores(t *testing.T) {
+	// Cadastro do segredo
+	statusCode, body := testPostAuth(t, url.Values{}, RotaDoisFatores, "valido4@gmail.com", "senhavalido4")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if !strings.HasPrefix(body, `{"segredo":"`) || !strings.Contains(body, `"uri":"otpauth://totp/RedCoins:valido4@gmail.com?`) {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Confirmação com código inválido
+	form := url.Values{}
+	form.Set("codigo", "abc")
+	statusCode, body = testPostAuth(t, form, RotaDoisFatoresConfirmacao, "valido4@gmail.com", "senhavalido4")
+	if statusCode != 401 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+	if body != `{"erros":["codigo_2fa_invalido"]}` {
+		t.Errorf("Corpo da resposta inesperado: %v", body)
+	}
+
+	// Sem confirmação, a autenticação em dois fatores não é exigida
+	statusCode, _ = testGetAuth(t, map[string]string{}, RotaLimites, "valido4@gmail.com", "senhavalido4")
+	if statusCode != 200 {
+		t.Errorf("Status code inesperado: %v", statusCode)
+	}
+}
+
 // testPostSimples realiza um request HTTP POST que a função 'f' vai receber.
 // Retorna o status code e o corpo da mensagem de resposta.
 func testPostSimples(t *testing.T, form url.Values, f func(w http.ResponseWriter, r *http.Request)) (int, string) {
@@ -268,6 +1121,102 @@ func testGetAuth(t *testing.T, dados map[string]string,
 	return statusCode, string(body)
 }
 
+// testDeleteAuth realiza um request HTTP DELETE que a função 'f' vai receber.
+// Retorna o status code e o corpo da mensagem de resposta. Utiliza HTTP Auth
+// Basic com os argumentos 'usuario' e 'senha'.
+func testDeleteAuth(t *testing.T, dados map[string]string,
+	f func(w http.ResponseWriter, r *http.Request),
+	usuario string, senha string) (int, string) {
+	request, err := http.NewRequest("DELETE", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.SetBasicAuth(usuario, senha)
+	q := request.URL.Query()
+	for k, v := range dados {
+		q.Add(k, v)
+	}
+	request.URL.RawQuery = q.Encode()
+
+	// Armazena a resposta da rota
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(f)
+	handler.ServeHTTP(recorder, request)
+
+	result := recorder.Result()
+	statusCode := result.StatusCode
+	body, err := ioutil.ReadAll(result.Body)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return statusCode, string(body)
+}
+
+// testRequestToken realiza um request HTTP com o método e o formulário
+// passados que a função 'f' vai receber. Retorna o status code e o corpo da
+// mensagem de resposta. Utiliza o token de acesso no header
+// "Authorization: Bearer".
+func testRequestToken(t *testing.T, metodo string, form url.Values,
+	f func(w http.ResponseWriter, r *http.Request), token string) (int, string) {
+	request, err := http.NewRequest(metodo, "/", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	request.Header.Add("Authorization", "Bearer "+token)
+
+	// Armazena a resposta da rota
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(f)
+	handler.ServeHTTP(recorder, request)
+
+	result := recorder.Result()
+	statusCode := result.StatusCode
+	body, err := ioutil.ReadAll(result.Body)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return statusCode, string(body)
+}
+
+// testRequestAssinado realiza um request HTTP com o método e o corpo passados
+// que a função 'f' vai receber. Retorna o status code e o corpo da mensagem de
+// resposta. O request é assinado com a chave de API 'id' e seu segredo.
+func testRequestAssinado(t *testing.T, metodo string, corpo string,
+	f func(w http.ResponseWriter, r *http.Request), id string, segredo string) (int, string) {
+	request, err := http.NewRequest(metodo, "/", strings.NewReader(corpo))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	chave, err := hex.DecodeString(segredo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, chave)
+	mac.Write([]byte(metodo + "\n/\n" + timestamp + "\n" + corpo))
+	request.Header.Add("X-RedCoins-Chave", id)
+	request.Header.Add("X-RedCoins-Timestamp", timestamp)
+	request.Header.Add("X-RedCoins-Assinatura", hex.EncodeToString(mac.Sum(nil)))
+
+	// Armazena a resposta da rota
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(f)
+	handler.ServeHTTP(recorder, request)
+
+	result := recorder.Result()
+	statusCode := result.StatusCode
+	body, err := ioutil.ReadAll(result.Body)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+
+	return statusCode, string(body)
+}
+
 // testPopulaDatabase insere dados no banco de dados necessários para a
 // realização dos testes. Essa função cria no total:
 // - 4 usuários
@@ -283,10 +1232,11 @@ func testPopulaDatabase() error {
 		return err
 	}
 	usr := database.Usuario{
-		Email:      "valido1@gmail.com",
-		Senha:      senha,
-		Nome:       "Conta Válida 1",
-		Nascimento: "1994-03-07",
+		Email:           "valido1@gmail.com",
+		Senha:           senha,
+		Nome:            "Conta Válida 1",
+		Nascimento:      "1994-03-07",
+		EmailVerificado: true,
 	}
 	if err := database.InsereUsuario(&usr); err != nil {
 		return err
@@ -298,10 +1248,11 @@ func testPopulaDatabase() error {
 		return err
 	}
 	usr = database.Usuario{
-		Email:      "valido2@gmail.com",
-		Senha:      senha,
-		Nome:       "Conta Válida 2",
-		Nascimento: "1994-03-08",
+		Email:           "valido2@gmail.com",
+		Senha:           senha,
+		Nome:            "Conta Válida 2",
+		Nascimento:      "1994-03-08",
+		EmailVerificado: true,
 	}
 	if err := database.InsereUsuario(&usr); err != nil {
 		return err
@@ -313,10 +1264,11 @@ func testPopulaDatabase() error {
 		return err
 	}
 	usr = database.Usuario{
-		Email:      "valido3@gmail.com",
-		Senha:      senha,
-		Nome:       "Conta Válida 3",
-		Nascimento: "1994-03-09",
+		Email:           "valido3@gmail.com",
+		Senha:           senha,
+		Nome:            "Conta Válida 3",
+		Nascimento:      "1994-03-09",
+		EmailVerificado: true,
 	}
 	if err := database.InsereUsuario(&usr); err != nil {
 		return err
@@ -328,33 +1280,66 @@ func testPopulaDatabase() error {
 		return err
 	}
 	usr = database.Usuario{
-		Email:      "valido4@gmail.com",
-		Senha:      senha,
-		Nome:       "Conta Válida 4",
-		Nascimento: "1994-03-10",
+		Email:           "valido4@gmail.com",
+		Senha:           senha,
+		Nome:            "Conta Válida 4",
+		Nascimento:      "1994-03-10",
+		EmailVerificado: true,
+	}
+	if err := database.InsereUsuario(&usr); err != nil {
+		return err
+	}
+
+	// Equipe: suporte e administrador
+	senha, err = passenc.GeraHashed([]byte("senhasuporte"))
+	if err != nil {
+		return err
+	}
+	usr = database.Usuario{
+		Email:           "suporte@gmail.com",
+		Senha:           senha,
+		Nome:            "Conta Suporte",
+		Nascimento:      "1990-01-01",
+		Papel:           database.PapelSuporte,
+		EmailVerificado: true,
+	}
+	if err := database.InsereUsuario(&usr); err != nil {
+		return err
+	}
+	senha, err = passenc.GeraHashed([]byte("senhaadmin"))
+	if err != nil {
+		return err
+	}
+	usr = database.Usuario{
+		Email:           "admin@gmail.com",
+		Senha:           senha,
+		Nome:            "Conta Administrador",
+		Nascimento:      "1990-01-01",
+		Papel:           database.PapelAdmin,
+		EmailVerificado: true,
 	}
 	if err := database.InsereUsuario(&usr); err != nil {
 		return err
 	}
 
 	// Compras
-	if err := database.InsereTransacao("valido1@gmail.com", true, 0.001, 10, "2018-01-01"); err != nil {
+	if err := database.InsereTransacao("valido1@gmail.com", true, 0.001, 10, "2018-01-01 10:00:00"); err != nil {
 		return err
 	}
-	if err := database.InsereTransacao("valido1@gmail.com", true, 0.002, 20, "2018-01-01"); err != nil {
+	if err := database.InsereTransacao("valido1@gmail.com", true, 0.002, 20, "2018-01-01 10:00:00"); err != nil {
 		return err
 	}
-	if err := database.InsereTransacao("valido1@gmail.com", true, 0.003, 30, "2018-01-02"); err != nil {
+	if err := database.InsereTransacao("valido1@gmail.com", true, 0.003, 30, "2018-01-02 10:00:00"); err != nil {
 		return err
 	}
-	if err := database.InsereTransacao("valido2@gmail.com", true, 0.004, 40, "2018-01-02"); err != nil {
+	if err := database.InsereTransacao("valido2@gmail.com", true, 0.004, 40, "2018-01-02 10:00:00"); err != nil {
 		return err
 	}
-	if err := database.InsereTransacao("valido3@gmail.com", true, 1, 400, "2012-01-02"); err != nil {
+	if err := database.InsereTransacao("valido3@gmail.com", true, 1, 400, "2012-01-02 10:00:00"); err != nil {
 		return err
 	}
 	// Venda
-	if err := database.InsereTransacao("valido2@gmail.com", false, 0.0005, 15, "2018-01-02"); err != nil {
+	if err := database.InsereTransacao("valido2@gmail.com", false, 0.0005, 15, "2018-01-02 10:00:00"); err != nil {
 		return err
 	}
 
@@ -0,0 +1,41 @@
+package sessao
+
+// Esse arquivo define o registro em memória das sessões revogadas, consultado
+// na validação dos tokens de acesso
+
+import (
+	"sync"
+	"time"
+)
+
+// sessoesRevogadas registra as sessões revogadas até o momento em que seus
+// tokens de acesso deixam de ser válidos, quando não precisam mais ser
+// registradas
+type sessoesRevogadas struct {
+	sync.Mutex
+	ate map[string]time.Time
+}
+
+// revogadas são as sessões revogadas conhecidas pelo servidor
+var revogadas = &sessoesRevogadas{ate: make(map[string]time.Time)}
+
+// adiciona registra a sessão 'id' como revogada até o momento 'ate'. As
+// sessões cujo registro já expirou são removidas.
+func (s *sessoesRevogadas) adiciona(id string, ate time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	for revogada, expira := range s.ate {
+		if !expira.After(ate.Add(-duracaoAcesso)) {
+			delete(s.ate, revogada)
+		}
+	}
+	s.ate[id] = ate
+}
+
+// contem retorna se a sessão 'id' está registrada como revogada em 'agora'
+func (s *sessoesRevogadas) contem(id string, agora time.Time) bool {
+	s.Lock()
+	defer s.Unlock()
+	ate, ok := s.ate[id]
+	return ok && agora.Before(ate)
+}
@@ -0,0 +1,25 @@
+package sessao
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessoesRevogadas(t *testing.T) {
+	s := &sessoesRevogadas{ate: make(map[string]time.Time)}
+	agora := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	s.adiciona("a", agora.Add(duracaoAcesso))
+	if !s.contem("a", agora) || s.contem("b", agora) {
+		t.Errorf("Sessões revogadas inesperadas: %v", s.ate)
+	}
+	if s.contem("a", agora.Add(duracaoAcesso)) {
+		t.Errorf("Sessão revogada após a validade dos tokens")
+	}
+
+	// Registros expirados são removidos ao adicionar uma nova sessão
+	depois := agora.Add(2 * duracaoAcesso)
+	s.adiciona("b", depois.Add(duracaoAcesso))
+	if _, ok := s.ate["a"]; ok || !s.contem("b", depois) {
+		t.Errorf("Sessões revogadas inesperadas: %v", s.ate)
+	}
+}
@@ -0,0 +1,254 @@
+// Package sessao trata das sessões dos usuários: a troca dos credenciais por
+// um token de acesso e um token de renovação, a validação dos tokens de acesso
+// sem consultar o banco de dados, a renovação e a revogação das sessões.
+// Esse package usa exclusivamente erros.Erros como estrutura de erros.
+package sessao
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/loteny/redcoins/cadastro"
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/transacao"
+)
+
+// Lista de possíveis erros do módulo
+var (
+	ErrCredenciaisInvalidos = erros.Cria(false, 403, "credenciais_invalidos")
+	ErrTokenInvalido        = erros.Cria(false, 401, "token_invalido")
+	ErrTokenExpirado        = erros.Cria(false, 401, "token_expirado")
+	ErrRenovacaoInvalida    = erros.Cria(false, 401, "renovacao_invalida")
+)
+
+// formatoData é o formato das colunas DATETIME do banco de dados
+const formatoData = "2006-01-02 15:04:05"
+
+// Configurações das sessões
+var (
+	// chave é a chave HMAC dos tokens de acesso
+	chave []byte
+	// duracaoAcesso é a validade de um token de acesso
+	duracaoAcesso time.Duration
+	// duracaoRenovacao é a validade de um token de renovação
+	duracaoRenovacao time.Duration
+)
+
+func init() {
+	// Inicializa as configurações da package com as variáveis de ambiente. Por
+	// padrão, tokens de acesso valem 15 minutos e tokens de renovação, 30 dias.
+	// Sem a chave configurada, uma chave aleatória é gerada e os tokens emitidos
+	// deixam de ser válidos quando o servidor é reiniciado.
+	chave = []byte(os.Getenv("REDCOINS_SS_CHAVE"))
+	if len(chave) == 0 {
+		log.Printf("sessao: REDCOINS_SS_CHAVE não definida, utilizando chave aleatória")
+		chave = make([]byte, 32)
+		if _, err := rand.Read(chave); err != nil {
+			log.Fatalf("sessao: %s", err)
+		}
+	}
+	duracaoAcesso = duracaoVariavel("REDCOINS_SS_DURACAOACESSO", 15*time.Minute)
+	duracaoRenovacao = duracaoVariavel("REDCOINS_SS_DURACAORENOVACAO", 30*24*time.Hour)
+}
+
+// duracaoVariavel retorna a duração da variável de ambiente passada (por
+// exemplo, "15m") ou 'padrao' se a variável não está definida ou é inválida
+func duracaoVariavel(variavel string, padrao time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(variavel)); err == nil && d > 0 {
+		return d
+	}
+	return padrao
+}
+
+// tokensResposta é a estrutura JSON com os tokens de uma sessão enviada ao
+// cliente. 'ExpiraEm' é a validade do token de acesso em segundos.
+type tokensResposta struct {
+	Acesso    string `json:"acesso"`
+	Renovacao string `json:"renovacao"`
+	Tipo      string `json:"tipo"`
+	ExpiraEm  int64  `json:"expiraEm"`
+}
+
+// CriaSessaoHTTP cria uma sessão para o usuário dos campos "email" e "senha"
+// do request e retorna os bytes da string JSON com os tokens da sessão. Se o
+// usuário possui a autenticação em dois fatores ativa, o campo "codigo" deve
+// conter um código TOTP ou de recuperação válido.
+func CriaSessaoHTTP(r *http.Request) ([]byte, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	email := cadastro.NormalizaEmail(r.FormValue("email"))
+	logado, err := cadastro.VerificaLoginOrigem(email, r.FormValue("senha"), comunicacao.IPRequest(r))
+	if !erros.Vazio(err) {
+		return nil, err
+	} else if !logado {
+		return nil, ErrCredenciaisInvalidos
+	}
+	if err := cadastro.VerificaSegundoFator(email, r.FormValue("codigo")); !erros.Vazio(err) {
+		return nil, err
+	}
+
+	agora := transacao.Agora()
+	id, err2 := aleatorio(16)
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	renovacao, err2 := aleatorio(32)
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	s := database.Sessao{
+		ID:        id,
+		Usuario:   email,
+		Renovacao: hashRenovacao(renovacao),
+		Criada:    agora.Format(formatoData),
+		Expira:    agora.Add(duracaoRenovacao).Format(formatoData),
+	}
+	if err := database.InsereSessao(s); err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	return respostaTokens(id, email, renovacao, agora)
+}
+
+// RenovaSessaoHTTP troca o token de renovação do campo "renovacao" do request
+// por um novo token de acesso e um novo token de renovação. O token de
+// renovação utilizado deixa de ser válido.
+func RenovaSessaoHTTP(r *http.Request) ([]byte, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	atual := hashRenovacao(r.FormValue("renovacao"))
+	s, err := database.AdquireSessaoPorRenovacao(atual)
+	if err == database.ErrSessaoNaoExiste {
+		return nil, ErrRenovacaoInvalida
+	} else if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	agora := transacao.Agora()
+	if s.RevogadaEm != "" || s.Expira <= agora.Format(formatoData) {
+		return nil, ErrRenovacaoInvalida
+	}
+
+	renovacao, err := aleatorio(32)
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	expira := agora.Add(duracaoRenovacao).Format(formatoData)
+	renovada, err := database.RenovaSessao(s.ID, atual, hashRenovacao(renovacao), expira)
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	} else if !renovada {
+		return nil, ErrRenovacaoInvalida
+	}
+	return respostaTokens(s.ID, s.Usuario, renovacao, agora)
+}
+
+// EncerraSessaoHTTP revoga a sessão do token de acesso do request. Os tokens
+// de acesso e de renovação da sessão deixam de ser válidos.
+func EncerraSessaoHTTP(r *http.Request) erros.Erros {
+	token, ok := TokenRequest(r)
+	if !ok {
+		return ErrTokenInvalido
+	}
+	c, err := validaToken(token)
+	if !erros.Vazio(err) {
+		return err
+	}
+	agora := transacao.Agora()
+	if err := database.RevogaSessao(c.Sessao, agora.Format(formatoData)); err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	revogadas.adiciona(c.Sessao, agora.Add(duracaoAcesso))
+	return erros.CriaVazio()
+}
+
+// EncerraSessoesUsuario revoga todas as sessões do usuário, por exemplo após a
+// redefinição de sua senha. Os tokens de acesso e de renovação das sessões
+// deixam de ser válidos.
+func EncerraSessoesUsuario(email string) erros.Erros {
+	agora := transacao.Agora()
+	ids, err := database.RevogaSessoesUsuario(email, agora.Format(formatoData))
+	if err != nil {
+		return erros.CriaInternoPadrao(err)
+	}
+	for _, id := range ids {
+		revogadas.adiciona(id, agora.Add(duracaoAcesso))
+	}
+	return erros.CriaVazio()
+}
+
+// TokenRequest retorna o token de acesso do header "Authorization: Bearer" do
+// request e se o header estava presente
+func TokenRequest(r *http.Request) (string, bool) {
+	autorizacao := r.Header.Get("Authorization")
+	if !strings.HasPrefix(autorizacao, "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(autorizacao, "Bearer ")), true
+}
+
+// ValidaAcesso valida um token de acesso e retorna o e-mail do usuário da
+// sessão. A validação não consulta o banco de dados: apenas a assinatura, a
+// expiração e as sessões revogadas conhecidas pelo servidor são verificadas.
+func ValidaAcesso(token string) (string, erros.Erros) {
+	c, err := validaToken(token)
+	return c.Email, err
+}
+
+// CarregaRevogadas carrega as sessões revogadas recentemente, cujos tokens de
+// acesso ainda podem estar dentro da validade. Deve ser chamada na
+// inicialização do servidor.
+func CarregaRevogadas() error {
+	agora := transacao.Agora()
+	ids, err := database.AdquireSessoesRevogadas(agora.Add(-duracaoAcesso).Format(formatoData))
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		revogadas.adiciona(id, agora.Add(duracaoAcesso))
+	}
+	return nil
+}
+
+// validaToken verifica um token de acesso e se sua sessão não foi revogada
+func validaToken(token string) (conteudoToken, erros.Erros) {
+	agora := transacao.Agora()
+	c, err := verificaToken(token, chave, agora)
+	if err == errTokenExpirado {
+		return conteudoToken{}, ErrTokenExpirado
+	} else if err != nil || revogadas.contem(c.Sessao, agora) {
+		return conteudoToken{}, ErrTokenInvalido
+	}
+	return c, erros.CriaVazio()
+}
+
+// respostaTokens gera um token de acesso para a sessão e retorna os bytes da
+// string JSON com os tokens da sessão
+func respostaTokens(id string, email string, renovacao string, agora time.Time) ([]byte, erros.Erros) {
+	acesso, err := assinaToken(conteudoToken{
+		Sessao: id,
+		Email:  email,
+		Expira: agora.Add(duracaoAcesso).Unix(),
+	}, chave)
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	resposta := tokensResposta{
+		Acesso:    acesso,
+		Renovacao: renovacao,
+		Tipo:      "Bearer",
+		ExpiraEm:  int64(duracaoAcesso / time.Second),
+	}
+	respostaBytes, err := json.Marshal(resposta)
+	if err != nil {
+		return nil, erros.CriaInternoPadrao(err)
+	}
+	return respostaBytes, erros.CriaVazio()
+}
@@ -0,0 +1,120 @@
+package sessao
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+	"github.com/loteny/redcoins/passenc"
+)
+
+// init deleta o banco de dados e cria um novo apenas com um usuário para
+// testes
+func init() {
+	if err := database.DeletaDatabaseTeste(); err != nil {
+		log.Fatalf("erro ao deletar database: %s", err)
+	}
+	if err := database.CriaDatabase(); err != nil {
+		log.Fatalf("erro ao criar database: %s", err)
+	}
+	if err := testPopulaDatabase(); err != nil {
+		log.Fatalf("erro ao popular banco de dados: %s", err)
+	}
+}
+
+func TestSessao(t *testing.T) {
+	// Credenciais incorretos
+	form := url.Values{"email": {"valido1@gmail.com"}, "senha": {"senhaincorreta"}}
+	if _, err := CriaSessaoHTTP(testRequest(t, "POST", form, "")); err.Error() != ErrCredenciaisInvalidos.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Criação da sessão
+	form.Set("senha", "senhavalido1")
+	tokens := testTokens(t, CriaSessaoHTTP, testRequest(t, "POST", form, ""))
+	if email, err := ValidaAcesso(tokens.Acesso); !erros.Vazio(err) || email != "valido1@gmail.com" {
+		t.Errorf("Validação inesperada: %v (%v)", email, err)
+	}
+
+	// Renovação: o token de renovação antigo deixa de ser válido
+	form = url.Values{"renovacao": {tokens.Renovacao}}
+	renovados := testTokens(t, RenovaSessaoHTTP, testRequest(t, "POST", form, ""))
+	if renovados.Renovacao == tokens.Renovacao {
+		t.Errorf("Token de renovação não foi substituído")
+	}
+	if _, err := RenovaSessaoHTTP(testRequest(t, "POST", form, "")); err.Error() != ErrRenovacaoInvalida.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// Encerramento: os tokens de acesso e de renovação deixam de ser válidos
+	if err := EncerraSessaoHTTP(testRequest(t, "DELETE", url.Values{}, renovados.Acesso)); !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if _, err := ValidaAcesso(renovados.Acesso); err.Error() != ErrTokenInvalido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	form.Set("renovacao", renovados.Renovacao)
+	if _, err := RenovaSessaoHTTP(testRequest(t, "POST", form, "")); err.Error() != ErrRenovacaoInvalida.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+
+	// As revogações são recarregadas do banco de dados
+	revogadas.ate = make(map[string]time.Time)
+	if err := CarregaRevogadas(); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if _, err := ValidaAcesso(renovados.Acesso); err.Error() != ErrTokenInvalido.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+// testTokens chama a função 'f' com o request passado e retorna os tokens da
+// resposta
+func testTokens(t *testing.T, f func(*http.Request) ([]byte, erros.Erros), r *http.Request) tokensResposta {
+	resposta, err := f(r)
+	if !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	tokens := tokensResposta{}
+	if err := json.Unmarshal(resposta, &tokens); err != nil {
+		t.Fatalf("Resposta inesperada: %s (%v)", resposta, err)
+	}
+	if tokens.Tipo != "Bearer" || tokens.ExpiraEm != int64(duracaoAcesso.Seconds()) {
+		t.Errorf("Resposta inesperada: %s", resposta)
+	}
+	return tokens
+}
+
+// testRequest cria um request com o formulário passado e, se 'token' não for
+// vazio, com o token de acesso no header Authorization
+func testRequest(t *testing.T, metodo string, form url.Values, token string) *http.Request {
+	r, err := http.NewRequest(metodo, "/", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		r.Header.Add("Authorization", "Bearer "+token)
+	}
+	return r
+}
+
+func testPopulaDatabase() error {
+	senha, err := passenc.GeraHashed([]byte("senhavalido1"))
+	if err != nil {
+		return err
+	}
+	usr := database.Usuario{
+		Email:      "valido1@gmail.com",
+		Senha:      senha,
+		Nome:       "Conta Válida 1",
+		Nascimento: "1994-03-07",
+	}
+	return database.InsereUsuario(&usr)
+}
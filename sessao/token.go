@@ -0,0 +1,90 @@
+package sessao
+
+// Esse arquivo define os tokens de acesso, assinados com HMAC-SHA256 para que
+// possam ser validados sem consultar o banco de dados, e os tokens de
+// renovação, valores aleatórios armazenados apenas como hash
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Erros da validação dos tokens de acesso
+var (
+	errTokenInvalido = errors.New("token inválido")
+	errTokenExpirado = errors.New("token expirado")
+)
+
+// conteudoToken é o conteúdo assinado de um token de acesso: a sessão, o
+// e-mail do usuário e o momento de expiração em segundos desde a época Unix
+type conteudoToken struct {
+	Sessao string `json:"sid"`
+	Email  string `json:"sub"`
+	Expira int64  `json:"exp"`
+}
+
+// assinaToken gera o token de acesso com o conteúdo passado, no formato
+// "{conteúdo}.{assinatura}", ambos em base64 sem padding
+func assinaToken(c conteudoToken, chave []byte) (string, error) {
+	conteudo, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	parte := base64.RawURLEncoding.EncodeToString(conteudo)
+	return parte + "." + base64.RawURLEncoding.EncodeToString(assinatura(parte, chave)), nil
+}
+
+// verificaToken verifica a assinatura e a expiração de um token de acesso e
+// retorna seu conteúdo
+func verificaToken(token string, chave []byte, agora time.Time) (conteudoToken, error) {
+	partes := strings.Split(token, ".")
+	if len(partes) != 2 {
+		return conteudoToken{}, errTokenInvalido
+	}
+	recebida, err := base64.RawURLEncoding.DecodeString(partes[1])
+	if err != nil || !hmac.Equal(recebida, assinatura(partes[0], chave)) {
+		return conteudoToken{}, errTokenInvalido
+	}
+	conteudo, err := base64.RawURLEncoding.DecodeString(partes[0])
+	if err != nil {
+		return conteudoToken{}, errTokenInvalido
+	}
+	c := conteudoToken{}
+	if err := json.Unmarshal(conteudo, &c); err != nil || c.Sessao == "" || c.Email == "" {
+		return conteudoToken{}, errTokenInvalido
+	}
+	if agora.Unix() >= c.Expira {
+		return conteudoToken{}, errTokenExpirado
+	}
+	return c, nil
+}
+
+// assinatura calcula o HMAC-SHA256 do conteúdo de um token
+func assinatura(conteudo string, chave []byte) []byte {
+	mac := hmac.New(sha256.New, chave)
+	mac.Write([]byte(conteudo))
+	return mac.Sum(nil)
+}
+
+// aleatorio gera 'n' bytes aleatórios codificados em hexadecimal
+func aleatorio(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashRenovacao calcula o hash de um token de renovação armazenado no banco de
+// dados
+func hashRenovacao(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,53 @@
+package sessao
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestToken(t *testing.T) {
+	chave := []byte("chave de teste")
+	agora := time.Date(2018, 1, 1, 10, 0, 0, 0, time.UTC)
+	c := conteudoToken{Sessao: "abc", Email: "teste@gmail.com", Expira: agora.Add(time.Minute).Unix()}
+	token, err := assinaToken(c, chave)
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+
+	if verificado, err := verificaToken(token, chave, agora); err != nil || verificado != c {
+		t.Errorf("Token verificado incorretamente: %v (%v)", verificado, err)
+	}
+	if _, err := verificaToken(token, chave, agora.Add(time.Minute)); err != errTokenExpirado {
+		t.Errorf("Erro inesperado para token expirado: %v", err)
+	}
+	if _, err := verificaToken(token, []byte("outra chave"), agora); err != errTokenInvalido {
+		t.Errorf("Erro inesperado para outra chave: %v", err)
+	}
+
+	// Conteúdo alterado sem nova assinatura
+	partes := strings.Split(token, ".")
+	alterado, _ := assinaToken(conteudoToken{Sessao: "abc", Email: "outro@gmail.com", Expira: c.Expira}, chave)
+	invalidos := []string{
+		"",
+		"abc",
+		strings.Split(alterado, ".")[0] + "." + partes[1],
+		partes[0] + ".!!",
+		token + ".a",
+	}
+	for _, invalido := range invalidos {
+		if _, err := verificaToken(invalido, chave, agora); err != errTokenInvalido {
+			t.Errorf("Erro inesperado para %q: %v", invalido, err)
+		}
+	}
+}
+
+func TestHashRenovacao(t *testing.T) {
+	token, err := aleatorio(32)
+	if err != nil || len(token) != 64 {
+		t.Fatalf("Token inesperado: %v (%v)", token, err)
+	}
+	if hash := hashRenovacao(token); len(hash) != 64 || hash == token || hash != hashRenovacao(token) {
+		t.Errorf("Hash inesperado: %v", hash)
+	}
+}
@@ -0,0 +1,105 @@
+package transacao
+
+// Esse arquivo define a política de datas das transações: se a data e horário
+// de uma transação são atribuídos pelo servidor ou enviados pelo cliente
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/loteny/redcoins/erros"
+)
+
+// Políticas possíveis para a data das transações
+const (
+	// politicaServidor faz com que o servidor atribua o momento da execução
+	// como data da transação, ignorando a data enviada pelo cliente
+	politicaServidor = "servidor"
+	// politicaCliente aceita a data enviada pelo cliente, desde que ela esteja
+	// dentro da janela permitida
+	politicaCliente = "cliente"
+)
+
+// formatoData é o formato das datas das transações, idêntico ao formato
+// DATETIME do MySQL
+const formatoData = "2006-01-02 15:04:05"
+
+// toleranciaFutura é o quanto uma data enviada pelo cliente pode estar no
+// futuro, para acomodar pequenas diferenças entre os relógios do cliente e do
+// servidor
+const toleranciaFutura = time.Minute
+
+// Configurações da política de datas
+var (
+	// politicaData é a política utilizada ("servidor" ou "cliente")
+	politicaData string
+	// fuso é o fuso horário em que as datas das transações são armazenadas
+	fuso *time.Location
+	// janela é a idade máxima de uma data enviada pelo cliente
+	janela time.Duration
+)
+
+func init() {
+	// Inicializa as configurações da package com as variáveis de ambiente. Por
+	// padrão, o servidor atribui as datas no horário de Brasília e, se a
+	// política for "cliente", aceita datas de até 10 minutos atrás.
+	politicaData = os.Getenv("REDCOINS_TR_POLITICADATA")
+	if politicaData != politicaCliente {
+		politicaData = politicaServidor
+	}
+
+	nomeFuso := os.Getenv("REDCOINS_TR_FUSO")
+	if nomeFuso == "" {
+		nomeFuso = "America/Sao_Paulo"
+	}
+	var err error
+	if fuso, err = time.LoadLocation(nomeFuso); err != nil {
+		log.Printf("transacao: fuso horário %q indisponível, utilizando UTC-3: %s", nomeFuso, err)
+		fuso = time.FixedZone("BRT", -3*60*60)
+	}
+
+	janela = 10 * time.Minute
+	if d, err := time.ParseDuration(os.Getenv("REDCOINS_TR_JANELA")); err == nil && d > 0 {
+		janela = d
+	}
+}
+
+// Fuso retorna o fuso horário em que as datas das transações são armazenadas
+func Fuso() *time.Location {
+	return fuso
+}
+
+// Janela retorna a idade máxima de uma data de transação enviada pelo cliente
+func Janela() time.Duration {
+	return janela
+}
+
+// Agora retorna o momento atual no fuso horário das transações
+func Agora() time.Time {
+	return time.Now().In(fuso)
+}
+
+// validaDataTransacao retorna a data da transação no formato
+// "YYYY-MM-DD HH:MM:SS" segundo a política configurada. Na política
+// "servidor", a data enviada pelo cliente é ignorada e 'agora' é utilizado. Na
+// política "cliente", a data deve estar no formato "YYYY-MM-DD HH:MM:SS" (no
+// fuso horário configurado) ou RFC 3339 e não pode ser mais antiga do que a
+// janela permitida nem estar no futuro.
+func validaDataTransacao(data string, agora time.Time) (string, erros.Erros) {
+	agora = agora.In(fuso)
+	if politicaData == politicaServidor {
+		return agora.Format(formatoData), erros.CriaVazio()
+	}
+
+	t, err := time.ParseInLocation(formatoData, data, fuso)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339, data); err != nil {
+			return "", ErrDataInvalida
+		}
+	}
+	if t.Before(agora.Add(-janela)) || t.After(agora.Add(toleranciaFutura)) {
+		return "", ErrDataForaDaJanela
+	}
+	return t.In(fuso).Format(formatoData), erros.CriaVazio()
+}
@@ -0,0 +1,44 @@
+package transacao
+
+import (
+	"testing"
+	"time"
+
+	"github.com/loteny/redcoins/erros"
+)
+
+func TestValidaDataTransacao(t *testing.T) {
+	agora := time.Date(2018, 6, 15, 12, 0, 0, 0, fuso)
+	politicaOriginal, janelaOriginal := politicaData, janela
+	defer func() { politicaData, janela = politicaOriginal, janelaOriginal }()
+
+	// Política "servidor": a data enviada é ignorada
+	politicaData = politicaServidor
+	if data, err := validaDataTransacao("2000-01-01", agora); !erros.Vazio(err) || data != "2018-06-15 12:00:00" {
+		t.Errorf("Data inesperada: %v (%v)", data, err)
+	}
+
+	// Política "cliente": a data deve estar dentro da janela
+	politicaData = politicaCliente
+	janela = 10 * time.Minute
+	casos := map[string]erros.Erros{
+		"2018-06-15 11:55:00": erros.CriaVazio(),
+		"2018-06-15 12:00:30": erros.CriaVazio(),
+		"2018-06-15 11:49:59": ErrDataForaDaJanela,
+		"2018-06-15 12:05:00": ErrDataForaDaJanela,
+		"2018-06-15":          ErrDataInvalida,
+		"200001-01":           ErrDataInvalida,
+		"":                    ErrDataInvalida,
+	}
+	for enviada, esperado := range casos {
+		if _, err := validaDataTransacao(enviada, agora); err.Error() != esperado.Error() {
+			t.Errorf("Erro inesperado para %q: %v (esperado %v)", enviada, err, esperado)
+		}
+	}
+
+	// Datas RFC 3339 são convertidas para o fuso horário das transações
+	enviada := agora.Add(-time.Minute).UTC().Format(time.RFC3339)
+	if data, err := validaDataTransacao(enviada, agora); !erros.Vazio(err) || data != "2018-06-15 11:59:00" {
+		t.Errorf("Data inesperada: %v (%v)", data, err)
+	}
+}
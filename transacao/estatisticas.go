@@ -0,0 +1,203 @@
+package transacao
+
+// Esse arquivo define as estatísticas agregadas do mercado por dia ou por hora.
+// As estatísticas de dias já encerrados há mais tempo do que a janela de datas
+// das transações não mudam mais e são mantidas em memória, de forma que apenas
+// os dias ainda não consultados e os dias recentes são buscados no banco de
+// dados.
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+// Lista de possíveis erros das estatísticas
+var (
+	ErrIntervaloInvalido = erros.Cria(false, 400, "intervalo_invalido")
+	ErrPeriodoLongo      = erros.Cria(false, 400, "periodo_muito_longo")
+)
+
+// Quantidade máxima de dias de uma consulta de estatísticas para cada
+// intervalo de agregação
+var diasMaximosIntervalo = map[string]int{
+	database.IntervaloDia:  366,
+	database.IntervaloHora: 31,
+}
+
+// buscaEstatisticas é a assinatura da função que adquire as estatísticas do
+// banco de dados
+type buscaEstatisticas func(inicio, fim, intervalo string) ([]database.Estatisticas, error)
+
+// limiteCacheEstatisticas é a quantidade máxima de dias, somando os dois
+// intervalos de agregação, mantidos no cache de estatísticas
+const limiteCacheEstatisticas = 4096
+
+// cacheEstatisticas armazena as estatísticas dos dias encerrados. A chave do
+// mapa é o intervalo de agregação seguido do dia ("hora|YYYY-MM-DD"). Ao
+// atingir 'limite' dias, dias quaisquer são descartados para dar lugar aos
+// novos.
+type cacheEstatisticas struct {
+	sync.Mutex
+	dias   map[string][]database.Estatisticas
+	limite int
+}
+
+// cache é o cache de estatísticas utilizado pelo servidor
+var cache = novoCacheEstatisticas(limiteCacheEstatisticas)
+
+// novoCacheEstatisticas cria um cache de estatísticas vazio com até 'limite'
+// dias
+func novoCacheEstatisticas(limite int) *cacheEstatisticas {
+	return &cacheEstatisticas{dias: make(map[string][]database.Estatisticas), limite: limite}
+}
+
+// EstatisticasHTTP retorna os bytes da string JSON com as estatísticas do
+// mercado no período dos campos "de" e "ate" ("YYYY-MM-DD", inclusive),
+// agregadas pelo campo "intervalo" ("dia", o padrão, ou "hora")
+func EstatisticasHTTP(r *http.Request) ([]byte, erros.Erros) {
+	de, ate, intervalo, err := validaEstatisticas(r)
+	if !erros.Vazio(err) {
+		return nil, err
+	}
+	estatisticas, err2 := cache.adquire(de, ate, intervalo, Agora(), database.AdquireEstatisticas)
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	respostaBytes, err2 := json.Marshal(estatisticas)
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	return respostaBytes, erros.CriaVazio()
+}
+
+// validaEstatisticas adquire e valida os campos do request de estatísticas
+func validaEstatisticas(r *http.Request) (time.Time, time.Time, string, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return time.Time{}, time.Time{}, "", erros.CriaInternoPadrao(err)
+	}
+	err := erros.CriaVazio()
+
+	intervalo := r.FormValue("intervalo")
+	if intervalo == "" {
+		intervalo = database.IntervaloDia
+	}
+	diasMaximos, ok := diasMaximosIntervalo[intervalo]
+	if !ok {
+		err = erros.JuntaErros(err, ErrIntervaloInvalido)
+	}
+
+	de, errDe := time.Parse("2006-01-02", r.FormValue("de"))
+	ate, errAte := time.Parse("2006-01-02", r.FormValue("ate"))
+	if errDe != nil || errAte != nil {
+		return de, ate, intervalo, erros.JuntaErros(err, ErrDataInvalida)
+	}
+	if ate.Before(de) {
+		err = erros.JuntaErros(err, ErrPeriodoInvalido)
+	} else if ok && ate.Sub(de) >= time.Duration(diasMaximos)*24*time.Hour {
+		err = erros.JuntaErros(err, ErrPeriodoLongo)
+	}
+	return de, ate, intervalo, err
+}
+
+// adquire retorna as estatísticas de cada período entre os dias 'de' e 'ate'
+// (inclusive), incluindo os períodos sem transações. Os dias que não estão no
+// cache são buscados com 'busca' em uma única consulta, feita sem travar o
+// cache, e os dias encerrados antes do início da janela de datas das
+// transações, que ainda podem receber transações com a política "cliente", são
+// então armazenados.
+func (c *cacheEstatisticas) adquire(de, ate time.Time, intervalo string, agora time.Time, busca buscaEstatisticas) ([]database.Estatisticas, error) {
+	encerrado := agora.Add(-janela).Format("2006-01-02")
+	dias := make([]string, 0)
+	for dia := de; !dia.After(ate); dia = dia.AddDate(0, 0, 1) {
+		dias = append(dias, dia.Format("2006-01-02"))
+	}
+
+	// Copia os dias presentes no cache e busca os ausentes entre o primeiro e
+	// o último deles
+	armazenados := make(map[string][]database.Estatisticas)
+	primeiro, ultimo := "", ""
+	c.Lock()
+	for _, dia := range dias {
+		if estatisticas, ok := c.dias[intervalo+"|"+dia]; ok {
+			armazenados[dia] = estatisticas
+		} else {
+			if primeiro == "" {
+				primeiro = dia
+			}
+			ultimo = dia
+		}
+	}
+	c.Unlock()
+	buscados := make(map[string][]database.Estatisticas)
+	if primeiro != "" {
+		fim, _ := time.Parse("2006-01-02", ultimo)
+		estatisticas, err := busca(primeiro+" 00:00:00", fim.AddDate(0, 0, 1).Format(formatoData), intervalo)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range estatisticas {
+			dia := e.Periodo[:10]
+			buscados[dia] = append(buscados[dia], e)
+		}
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	resposta := make([]database.Estatisticas, 0)
+	for _, dia := range dias {
+		estatisticas, ok := armazenados[dia]
+		if !ok {
+			estatisticas = preencheDia(dia, intervalo, buscados[dia])
+			if dia < encerrado {
+				c.armazena(intervalo+"|"+dia, estatisticas)
+			}
+		}
+		resposta = append(resposta, estatisticas...)
+	}
+	return resposta, nil
+}
+
+// armazena adiciona as estatísticas de um dia ao cache, descartando dias
+// quaisquer se o limite foi atingido. O cache deve estar travado.
+func (c *cacheEstatisticas) armazena(chave string, estatisticas []database.Estatisticas) {
+	if _, ok := c.dias[chave]; !ok {
+		for outra := range c.dias {
+			if len(c.dias) < c.limite {
+				break
+			}
+			delete(c.dias, outra)
+		}
+	}
+	c.dias[chave] = estatisticas
+}
+
+// preencheDia retorna as estatísticas de todos os períodos do dia, com
+// estatísticas zeradas para os períodos ausentes de 'estatisticas'
+func preencheDia(dia, intervalo string, estatisticas []database.Estatisticas) []database.Estatisticas {
+	periodos := []string{dia}
+	if intervalo == database.IntervaloHora {
+		periodos = make([]string, 24)
+		for h := range periodos {
+			periodos[h] = dia + " " + time.Date(0, 1, 1, h, 0, 0, 0, time.UTC).Format("15:04:05")
+		}
+	}
+	porPeriodo := make(map[string]database.Estatisticas)
+	for _, e := range estatisticas {
+		porPeriodo[e.Periodo] = e
+	}
+	preenchido := make([]database.Estatisticas, len(periodos))
+	for i, periodo := range periodos {
+		e, ok := porPeriodo[periodo]
+		if !ok {
+			e = database.Estatisticas{Periodo: periodo}
+		}
+		preenchido[i] = e
+	}
+	return preenchido
+}
@@ -0,0 +1,109 @@
+package transacao
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+func TestCacheEstatisticas(t *testing.T) {
+	c := novoCacheEstatisticas(limiteCacheEstatisticas)
+	buscas := make([]string, 0)
+	busca := func(inicio, fim, intervalo string) ([]database.Estatisticas, error) {
+		buscas = append(buscas, inicio+" - "+fim)
+		return []database.Estatisticas{
+			{Periodo: "2018-01-02", Compras: 1, VolumeBitcoins: 0.5, VolumeReais: 5000, PrecoMedio: 10000, Usuarios: 1, MaiorTransacao: 5000},
+		}, nil
+	}
+	de := time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+	ate := time.Date(2018, 1, 3, 0, 0, 0, 0, time.UTC)
+	agora := time.Date(2018, 1, 3, 12, 0, 0, 0, time.UTC)
+
+	estatisticas, err := c.adquire(de, ate, database.IntervaloDia, agora, busca)
+	if err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	esperado := `[{2018-01-01 0 0 0 0 0 0 0} {2018-01-02 1 0 0.5 5000 10000 1 5000} {2018-01-03 0 0 0 0 0 0 0}]`
+	if fmt.Sprintf("%v", estatisticas) != esperado {
+		t.Errorf("Estatísticas inesperadas: %v", estatisticas)
+	}
+
+	// Os dias encerrados estão no cache e apenas o dia atual é buscado novamente
+	if _, err := c.adquire(de, ate, database.IntervaloDia, agora, busca); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	esperado = `[2018-01-01 00:00:00 - 2018-01-04 00:00:00 2018-01-03 00:00:00 - 2018-01-04 00:00:00]`
+	if fmt.Sprintf("%v", buscas) != esperado {
+		t.Errorf("Buscas inesperadas: %v", buscas)
+	}
+
+	// Consultas apenas de dias encerrados não acessam o banco de dados
+	if _, err := c.adquire(de, de, database.IntervaloDia, agora, busca); err != nil || len(buscas) != 2 {
+		t.Errorf("Busca inesperada: %v (%v)", buscas, err)
+	}
+
+	// O dia anterior só é armazenado após o fim da janela de datas, pois ainda
+	// pode receber transações com a política "cliente"
+	c = novoCacheEstatisticas(limiteCacheEstatisticas)
+	agora = time.Date(2018, 1, 4, 0, 0, 0, 0, time.UTC).Add(janela / 2)
+	if _, err := c.adquire(ate, ate, database.IntervaloDia, agora, busca); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if _, ok := c.dias[database.IntervaloDia+"|2018-01-03"]; ok {
+		t.Errorf("Dia dentro da janela armazenado no cache")
+	}
+	agora = agora.Add(janela)
+	if _, err := c.adquire(ate, ate, database.IntervaloDia, agora, busca); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if _, ok := c.dias[database.IntervaloDia+"|2018-01-03"]; !ok {
+		t.Errorf("Dia encerrado não armazenado no cache")
+	}
+
+	// O cache não ultrapassa o limite de dias
+	c = novoCacheEstatisticas(2)
+	if _, err := c.adquire(de, ate, database.IntervaloHora, agora, busca); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	if len(c.dias) != 2 {
+		t.Errorf("Tamanho do cache inesperado: %v", len(c.dias))
+	}
+}
+
+func TestPreencheDia(t *testing.T) {
+	estatisticas := preencheDia("2018-01-01", database.IntervaloHora, []database.Estatisticas{
+		{Periodo: "2018-01-01 10:00:00", Compras: 2},
+	})
+	if len(estatisticas) != 24 {
+		t.Fatalf("Quantidade de períodos inesperada: %v", len(estatisticas))
+	}
+	if estatisticas[0].Periodo != "2018-01-01 00:00:00" || estatisticas[10].Compras != 2 ||
+		estatisticas[23].Periodo != "2018-01-01 23:00:00" {
+		t.Errorf("Períodos inesperados: %v", estatisticas)
+	}
+}
+
+func TestValidaEstatisticas(t *testing.T) {
+	casos := map[string]erros.Erros{
+		"de=2018-01-01&ate=2018-12-31":                erros.CriaVazio(),
+		"de=2018-01-01&ate=2019-01-02":                ErrPeriodoLongo,
+		"de=2018-01-01&ate=2018-01-31&intervalo=hora": erros.CriaVazio(),
+		"de=2018-01-01&ate=2018-02-01&intervalo=hora": ErrPeriodoLongo,
+		"de=2018-01-02&ate=2018-01-01":                ErrPeriodoInvalido,
+		"de=2018-01-01":                               ErrDataInvalida,
+		"de=2018-01-01&ate=2018-01-01&intervalo=mes":  ErrIntervaloInvalido,
+	}
+	for query, esperado := range casos {
+		r, err := http.NewRequest("GET", "/?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, _, err := validaEstatisticas(r); err.Error() != esperado.Error() {
+			t.Errorf("Erro inesperado para %v: %v (esperado %v)", query, err, esperado)
+		}
+	}
+}
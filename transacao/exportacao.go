@@ -0,0 +1,134 @@
+package transacao
+
+// Esse arquivo define a exportação dos relatórios de transações em CSV e em
+// planilhas XLSX. As transações são escritas à medida que são lidas do banco
+// de dados, sem que o relatório completo seja armazenado em memória.
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+// Lista de possíveis erros da exportação
+var (
+	ErrFormatoInvalido = erros.Cria(false, 400, "formato_invalido")
+)
+
+// Formatos possíveis dos relatórios
+const (
+	FormatoJSON = "json"
+	FormatoCSV  = "csv"
+	FormatoXLSX = "xlsx"
+)
+
+// Content-Types dos formatos de exportação
+const (
+	tipoCSV  = "text/csv; charset=utf-8"
+	tipoXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// Exportacao é um relatório pronto para ser enviado ao cliente. 'Escreve'
+// escreve o relatório em 'w' à medida que as transações são lidas do banco de
+// dados; como o envio já foi iniciado, um erro retornado por 'Escreve' não
+// pode mais ser informado ao cliente.
+type Exportacao struct {
+	Tipo        string
+	NomeArquivo string
+	Escreve     func(w io.Writer) error
+}
+
+// escritorRelatorio escreve as linhas de um relatório de transações em um
+// formato de exportação
+type escritorRelatorio interface {
+	cabecalho() error
+	linha(tr database.Transacao) error
+	finaliza() error
+}
+
+// colunasRelatorio são os títulos das colunas dos relatórios exportados
+var colunasRelatorio = []string{"Data", "Usuário", "Tipo", "Bitcoins", "Valor (R$)"}
+
+// FormatoRelatorio adquire o formato de resposta de um relatório do campo
+// "formato" do request ("json", "csv" ou "xlsx") ou, se omitido, do header
+// Accept. O formato padrão é JSON.
+func FormatoRelatorio(r *http.Request) (string, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return "", erros.CriaInternoPadrao(err)
+	}
+	formato := r.FormValue("formato")
+	if formato == "" {
+		accept := r.Header.Get("Accept")
+		switch {
+		case strings.Contains(accept, "text/csv"):
+			formato = FormatoCSV
+		case strings.Contains(accept, tipoXLSX):
+			formato = FormatoXLSX
+		default:
+			formato = FormatoJSON
+		}
+	}
+	if formato != FormatoJSON && formato != FormatoCSV && formato != FormatoXLSX {
+		return "", ErrFormatoInvalido
+	}
+	return formato, erros.CriaVazio()
+}
+
+// ExportaTransacoesDiaHTTP prepara a exportação no formato passado ("csv" ou
+// "xlsx") do relatório de transações de um dia ou período. Os filtros são os
+// mesmos de TransacoesDiaHTTP, mas a exportação não é paginada.
+func ExportaTransacoesDiaHTTP(r *http.Request, formato string) (Exportacao, erros.Erros) {
+	filtro, err := filtroDia(r)
+	if !erros.Vazio(err) {
+		return Exportacao{}, err
+	}
+	return exporta(r, filtro, formato)
+}
+
+// ExportaTransacoesUsuarioHTTP prepara a exportação no formato passado ("csv"
+// ou "xlsx") do relatório de transações de um usuário. Os filtros são os mesmos
+// de TransacoesUsuarioHTTP, mas a exportação não é paginada.
+func ExportaTransacoesUsuarioHTTP(r *http.Request, formato string) (Exportacao, erros.Erros) {
+	filtro, err := filtroUsuario(r)
+	if !erros.Vazio(err) {
+		return Exportacao{}, err
+	}
+	return exporta(r, filtro, formato)
+}
+
+// exporta valida os filtros comuns dos relatórios e prepara a exportação
+func exporta(r *http.Request, filtro database.FiltroTransacoes, formato string) (Exportacao, erros.Erros) {
+	filtro, err := validaFiltroRelatorio(r, filtro)
+	if !erros.Vazio(err) {
+		return Exportacao{}, err
+	}
+	filtro.Limite = 0
+
+	exportacao := Exportacao{NomeArquivo: "transacoes." + formato}
+	var novoEscritor func(io.Writer) escritorRelatorio
+	switch formato {
+	case FormatoCSV:
+		exportacao.Tipo = tipoCSV
+		novoEscritor = novoEscritorCSV
+	case FormatoXLSX:
+		exportacao.Tipo = tipoXLSX
+		novoEscritor = novoEscritorXLSX
+	default:
+		return Exportacao{}, ErrFormatoInvalido
+	}
+	exportacao.Escreve = func(w io.Writer) error {
+		escritor := novoEscritor(w)
+		if err := escritor.cabecalho(); err != nil {
+			return err
+		}
+		if err := database.PercorreTransacoesFiltradas(filtro, escritor.linha); err != nil {
+			return err
+		}
+		return escritor.finaliza()
+	}
+	return exportacao, erros.CriaVazio()
+}
@@ -0,0 +1,79 @@
+package transacao
+
+// Esse arquivo define a exportação dos relatórios em CSV no padrão brasileiro:
+// colunas separadas por ponto e vírgula, vírgula como separador decimal e datas
+// no formato "DD/MM/AAAA HH:MM:SS", para que o arquivo seja aberto
+// corretamente por planilhas configuradas em português
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+)
+
+// bomUTF8 é escrito no início do CSV para que planilhas reconheçam a
+// codificação UTF-8 dos caracteres acentuados
+const bomUTF8 = "\ufeff"
+
+// escritorCSV escreve os relatórios em CSV
+type escritorCSV struct {
+	w   io.Writer
+	csv *csv.Writer
+}
+
+// novoEscritorCSV cria um escritor de relatórios em CSV que escreve em 'w'
+func novoEscritorCSV(w io.Writer) escritorRelatorio {
+	c := csv.NewWriter(w)
+	c.Comma = ';'
+	return &escritorCSV{w: w, csv: c}
+}
+
+func (e *escritorCSV) cabecalho() error {
+	if _, err := io.WriteString(e.w, bomUTF8); err != nil {
+		return err
+	}
+	return e.csv.Write(colunasRelatorio)
+}
+
+func (e *escritorCSV) linha(tr database.Transacao) error {
+	return e.csv.Write([]string{
+		formataDataBR(tr.Dia),
+		tr.Usuario,
+		nomeTipo(tr.Compra),
+		formataNumeroBR(tr.Bitcoins, 8),
+		formataNumeroBR(tr.Creditos, 2),
+	})
+}
+
+func (e *escritorCSV) finaliza() error {
+	e.csv.Flush()
+	return e.csv.Error()
+}
+
+// formataDataBR converte uma data "YYYY-MM-DD HH:MM:SS" para o formato
+// "DD/MM/AAAA HH:MM:SS". Datas em outro formato são mantidas.
+func formataDataBR(data string) string {
+	t, err := time.Parse(formatoData, data)
+	if err != nil {
+		return data
+	}
+	return t.Format("02/01/2006 15:04:05")
+}
+
+// formataNumeroBR formata um número com 'casas' casas decimais e vírgula como
+// separador decimal
+func formataNumeroBR(v float64, casas int) string {
+	return strings.Replace(strconv.FormatFloat(v, 'f', casas, 64), ".", ",", 1)
+}
+
+// nomeTipo retorna o nome do tipo de uma transação
+func nomeTipo(compra bool) string {
+	if compra {
+		return "Compra"
+	}
+	return "Venda"
+}
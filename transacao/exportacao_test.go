@@ -0,0 +1,116 @@
+package transacao
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+// testTransacoesExportacao são as transações utilizadas nos testes dos
+// escritores de relatórios
+var testTransacoesExportacao = []database.Transacao{
+	{Usuario: "valido1@gmail.com", Compra: true, Bitcoins: 0.003, Creditos: 1234.5, Dia: "2018-01-02 10:00:00"},
+	{Usuario: "<valido2>@gmail.com", Compra: false, Bitcoins: 0.0005, Creditos: 15, Dia: "2018-01-03 23:59:59"},
+}
+
+func TestFormatoRelatorio(t *testing.T) {
+	casos := []struct {
+		query, accept, esperado string
+		err                     erros.Erros
+	}{
+		{"", "", FormatoJSON, erros.CriaVazio()},
+		{"", "application/json", FormatoJSON, erros.CriaVazio()},
+		{"", "text/csv", FormatoCSV, erros.CriaVazio()},
+		{"", tipoXLSX, FormatoXLSX, erros.CriaVazio()},
+		{"formato=xlsx", "text/csv", FormatoXLSX, erros.CriaVazio()},
+		{"formato=pdf", "", "", ErrFormatoInvalido},
+	}
+	for _, c := range casos {
+		r, err := http.NewRequest("GET", "/?"+c.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Accept", c.accept)
+		formato, errFormato := FormatoRelatorio(r)
+		if formato != c.esperado || errFormato.Error() != c.err.Error() {
+			t.Errorf("Formato inesperado para %q e %q: %v (%v)", c.query, c.accept, formato, errFormato)
+		}
+	}
+}
+
+func TestEscritorCSV(t *testing.T) {
+	var buf bytes.Buffer
+	testEscreveRelatorio(t, novoEscritorCSV(&buf))
+	esperado := bomUTF8 + "Data;Usuário;Tipo;Bitcoins;Valor (R$)\n" +
+		"02/01/2018 10:00:00;valido1@gmail.com;Compra;0,00300000;1234,50\n" +
+		"03/01/2018 23:59:59;<valido2>@gmail.com;Venda;0,00050000;15,00\n"
+	if buf.String() != esperado {
+		t.Errorf("CSV inesperado:\n%s", buf.String())
+	}
+}
+
+func TestEscritorXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	testEscreveRelatorio(t, novoEscritorXLSX(&buf))
+
+	// A planilha deve ser um arquivo zip válido com todas as partes
+	leitor, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Planilha inválida: %v", err)
+	}
+	partes := make(map[string]string)
+	for _, f := range leitor.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		conteudo, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		partes[f.Name] = string(conteudo)
+	}
+	for _, nome := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml",
+		"xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if _, ok := partes[nome]; !ok {
+			t.Errorf("Parte ausente da planilha: %v", nome)
+		}
+	}
+
+	aba := partes["xl/worksheets/sheet1.xml"]
+	for _, trecho := range []string{
+		`<c t="inlineStr" s="4"><is><t>Usuário</t></is></c>`,
+		`<c s="1"><v>43102.416666666664</v></c>`,
+		`<c t="inlineStr" s="0"><is><t>&lt;valido2&gt;@gmail.com</t></is></c>`,
+		`<c s="3"><v>1234.5</v></c>`,
+	} {
+		if !strings.Contains(aba, trecho) {
+			t.Errorf("Trecho ausente da planilha: %v\n%v", trecho, aba)
+		}
+	}
+	if !strings.HasSuffix(aba, "</sheetData></worksheet>") {
+		t.Errorf("Planilha não finalizada: %v", aba)
+	}
+}
+
+// testEscreveRelatorio escreve as transações de teste com o escritor passado
+func testEscreveRelatorio(t *testing.T, e escritorRelatorio) {
+	if err := e.cabecalho(); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	for _, tr := range testTransacoesExportacao {
+		if err := e.linha(tr); err != nil {
+			t.Fatalf("Erro inesperado: %v", err)
+		}
+	}
+	if err := e.finaliza(); err != nil {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+}
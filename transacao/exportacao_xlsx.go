@@ -0,0 +1,158 @@
+package transacao
+
+// Esse arquivo define a exportação dos relatórios em planilhas XLSX (Office
+// Open XML). A planilha é um arquivo zip cujas partes fixas são escritas no
+// início e cuja única aba é escrita linha a linha. As datas e números são
+// armazenados como valores numéricos com formatação, para que a planilha os
+// exiba segundo a localização do usuário.
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/loteny/redcoins/database"
+)
+
+// Estilos das células, na ordem definida em 'xlsxEstilos'
+const (
+	estiloData     = 1
+	estiloBitcoins = 2
+	estiloReais    = 3
+	estiloTitulo   = 4
+)
+
+// Partes fixas da planilha
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Transações" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`
+	xlsxEstilos = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<numFmts count="2"><numFmt numFmtId="164" formatCode="dd/mm/yyyy hh:mm:ss"/><numFmt numFmtId="165" formatCode="0.00000000"/></numFmts>` +
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="5">` +
+		`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="4" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+		`</cellXfs>` +
+		`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+		`</styleSheet>`
+	xlsxInicioAba = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<cols><col min="1" max="1" width="20" customWidth="1"/><col min="2" max="2" width="30" customWidth="1"/>` +
+		`<col min="3" max="5" width="14" customWidth="1"/></cols>` +
+		`<sheetData>`
+	xlsxFimAba = `</sheetData></worksheet>`
+)
+
+// inicioDatasExcel é a data zero das datas numéricas das planilhas
+var inicioDatasExcel = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// escritorXLSX escreve os relatórios em planilhas XLSX
+type escritorXLSX struct {
+	zip *zip.Writer
+	aba *bufio.Writer
+}
+
+// novoEscritorXLSX cria um escritor de relatórios em XLSX que escreve em 'w'
+func novoEscritorXLSX(w io.Writer) escritorRelatorio {
+	return &escritorXLSX{zip: zip.NewWriter(w)}
+}
+
+func (e *escritorXLSX) cabecalho() error {
+	partes := []struct{ nome, conteudo string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxEstilos},
+	}
+	for _, p := range partes {
+		w, err := e.zip.Create(p.nome)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, p.conteudo); err != nil {
+			return err
+		}
+	}
+
+	aba, err := e.zip.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	e.aba = bufio.NewWriter(aba)
+	e.aba.WriteString(xlsxInicioAba)
+	e.aba.WriteString("<row>")
+	for _, coluna := range colunasRelatorio {
+		e.celulaTexto(coluna, estiloTitulo)
+	}
+	_, err = e.aba.WriteString("</row>")
+	return err
+}
+
+func (e *escritorXLSX) linha(tr database.Transacao) error {
+	e.aba.WriteString("<row>")
+	if t, err := time.Parse(formatoData, tr.Dia); err == nil {
+		e.celulaNumero(t.Sub(inicioDatasExcel).Hours()/24, estiloData)
+	} else {
+		e.celulaTexto(tr.Dia, 0)
+	}
+	e.celulaTexto(tr.Usuario, 0)
+	e.celulaTexto(nomeTipo(tr.Compra), 0)
+	e.celulaNumero(tr.Bitcoins, estiloBitcoins)
+	e.celulaNumero(tr.Creditos, estiloReais)
+	_, err := e.aba.WriteString("</row>")
+	return err
+}
+
+func (e *escritorXLSX) finaliza() error {
+	if _, err := e.aba.WriteString(xlsxFimAba); err != nil {
+		return err
+	}
+	if err := e.aba.Flush(); err != nil {
+		return err
+	}
+	return e.zip.Close()
+}
+
+// celulaTexto escreve uma célula de texto com o estilo passado. Os erros de
+// escrita são retidos pelo bufio.Writer e retornados ao fim da linha.
+func (e *escritorXLSX) celulaTexto(texto string, estilo int) {
+	e.aba.WriteString(`<c t="inlineStr" s="` + strconv.Itoa(estilo) + `"><is><t>`)
+	xml.EscapeText(e.aba, []byte(texto))
+	e.aba.WriteString(`</t></is></c>`)
+}
+
+// celulaNumero escreve uma célula numérica com o estilo passado
+func (e *escritorXLSX) celulaNumero(v float64, estilo int) {
+	e.aba.WriteString(`<c s="` + strconv.Itoa(estilo) + `"><v>` +
+		strconv.FormatFloat(v, 'f', -1, 64) + `</v></c>`)
+}
@@ -0,0 +1,79 @@
+package transacao
+
+// Esse arquivo define a validação das transações segundo as regras de
+// negociação do mercado (tabela 'regra_mercado' do banco de dados)
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+// unidadesPorBitcoin é a quantidade de unidades mínimas (satoshis) em uma
+// Bitcoin, que é a precisão da coluna 'bitcoins' do banco de dados
+const unidadesPorBitcoin = 1e8
+
+// validaQtdRegras verifica se a quantidade de Bitcoins respeita as regras de
+// mercado. 'qtd' é a quantidade como enviada pelo cliente, utilizada para
+// contar as casas decimais sem os erros de arredondamento de 'fQtd'.
+func validaQtdRegras(qtd string, fQtd float64, regras database.RegrasMercado) erros.Erros {
+	if casasDecimais(qtd) > regras.CasasDecimais {
+		return ErrQtdCasasDecimais
+	}
+	if fQtd < regras.QtdMinima {
+		return ErrQtdAbaixoMinimo
+	}
+	if fQtd > regras.QtdMaxima {
+		return ErrQtdAcimaMaximo
+	}
+	if passo := unidades(regras.Passo); passo > 0 && unidades(fQtd)%passo != 0 {
+		return ErrQtdPassoInvalido
+	}
+	return erros.CriaVazio()
+}
+
+// validaValorRegras verifica se o valor em reais de uma transação respeita o
+// valor mínimo das regras de mercado
+func validaValorRegras(preco float64, regras database.RegrasMercado) erros.Erros {
+	if preco < regras.ValorMinimo {
+		return ErrValorAbaixoMinimo
+	}
+	return erros.CriaVazio()
+}
+
+// arredondaPasso arredonda a quantidade de Bitcoins para baixo até o múltiplo
+// mais próximo do passo das regras de mercado
+func arredondaPasso(qtd float64, regras database.RegrasMercado) float64 {
+	passo := unidades(regras.Passo)
+	if passo <= 0 {
+		passo = 1
+	}
+	u := int64(math.Floor(qtd*unidadesPorBitcoin)) / passo * passo
+	return float64(u) / unidadesPorBitcoin
+}
+
+// casasDecimais conta as casas decimais significativas de um número em string,
+// ignorando zeros à direita ("0.10" possui uma casa decimal). Números em
+// notação científica são convertidos para notação decimal antes da contagem.
+func casasDecimais(qtd string) int {
+	if strings.ContainsAny(qtd, "eE") {
+		f, err := strconv.ParseFloat(qtd, 64)
+		if err != nil {
+			return 0
+		}
+		qtd = strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	i := strings.Index(qtd, ".")
+	if i < 0 {
+		return 0
+	}
+	return len(strings.TrimRight(qtd[i+1:], "0"))
+}
+
+// unidades converte uma quantidade de Bitcoins para unidades mínimas
+func unidades(qtd float64) int64 {
+	return int64(math.Round(qtd * unidadesPorBitcoin))
+}
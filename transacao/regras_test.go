@@ -0,0 +1,65 @@
+package transacao
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+// regrasTeste são as regras de mercado padrões do banco de dados, com o passo
+// alterado para facilitar os testes
+var regrasTeste = database.RegrasMercado{
+	QtdMinima:     0.00001,
+	QtdMaxima:     10000,
+	Passo:         0.00001,
+	ValorMinimo:   1,
+	CasasDecimais: 8,
+}
+
+func TestValidaQtdRegras(t *testing.T) {
+	casos := map[string]erros.Erros{
+		"0.001":                  erros.CriaVazio(),
+		"0.00100000":             erros.CriaVazio(),
+		"1e-3":                   erros.CriaVazio(),
+		"10000":                  erros.CriaVazio(),
+		"0.000001":               ErrQtdAbaixoMinimo,
+		"10000.00001":            ErrQtdAcimaMaximo,
+		"0.000015":               ErrQtdPassoInvalido,
+		"0.12345678901234567890": ErrQtdCasasDecimais,
+		"0.000000001":            ErrQtdCasasDecimais,
+	}
+	for qtd, esperado := range casos {
+		fQtd, err := strconv.ParseFloat(qtd, 64)
+		if err != nil {
+			t.Fatalf("Erro inesperado: %v", err)
+		}
+		if err := validaQtdRegras(qtd, fQtd, regrasTeste); err.Error() != esperado.Error() {
+			t.Errorf("Erro inesperado para %v: %v (esperado %v)", qtd, err, esperado)
+		}
+	}
+}
+
+func TestValidaValorRegras(t *testing.T) {
+	if err := validaValorRegras(0.99, regrasTeste); err.Error() != ErrValorAbaixoMinimo.Error() {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+	if err := validaValorRegras(1, regrasTeste); !erros.Vazio(err) {
+		t.Errorf("Erro inesperado: %v", err)
+	}
+}
+
+func TestArredondaPasso(t *testing.T) {
+	casos := map[float64]float64{
+		0.000019:   0.00001,
+		0.00002:    0.00002,
+		1.23456789: 1.23456,
+		0.0000099:  0,
+	}
+	for qtd, esperado := range casos {
+		if arredondado := arredondaPasso(qtd, regrasTeste); arredondado != esperado {
+			t.Errorf("Arredondamento incorreto de %v: %v (esperado %v)", qtd, arredondado, esperado)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package transacao
+
+// Esse arquivo define os filtros e a paginação dos relatórios de transações
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loteny/redcoins/comunicacao"
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+// Lista de possíveis erros dos relatórios
+var (
+	ErrPeriodoInvalido = erros.Cria(false, 400, "periodo_invalido")
+	ErrTipoInvalido    = erros.Cria(false, 400, "tipo_invalido")
+	ErrLimiteInvalido  = erros.Cria(false, 400, "limite_invalido")
+	ErrCursorInvalido  = erros.Cria(false, 400, "cursor_invalido")
+)
+
+// Quantidade de transações por página dos relatórios
+const (
+	limitePadrao = 100
+	limiteMaximo = 1000
+)
+
+// relatorioResposta é a estrutura JSON de uma página de um relatório enviada ao
+// cliente. 'Proximo' é o cursor da próxima página e é omitido na última página.
+type relatorioResposta struct {
+	Transacoes []database.Transacao `json:"transacoes"`
+	Proximo    string               `json:"proximo,omitempty"`
+}
+
+// relatorioHTTP busca uma página de transações com os filtros do request e
+// retorna os bytes da string JSON com a página. 'filtro' já deve conter os
+// filtros específicos de cada relatório.
+func relatorioHTTP(r *http.Request, filtro database.FiltroTransacoes) ([]byte, erros.Erros) {
+	filtro, err := validaFiltroRelatorio(r, filtro)
+	if !erros.Vazio(err) {
+		return nil, err
+	}
+	transacoes, proximo, err2 := database.AdquireTransacoesFiltradas(filtro)
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	resposta := relatorioResposta{Transacoes: transacoes}
+	if !proximo.Vazio() {
+		resposta.Proximo = codificaCursor(proximo)
+	}
+	respostaBytes, err2 := json.Marshal(resposta)
+	if err2 != nil {
+		return nil, erros.CriaInternoPadrao(err2)
+	}
+	return respostaBytes, erros.CriaVazio()
+}
+
+// validaFiltroRelatorio adquire os filtros comuns aos relatórios dos campos do
+// request: "de" e "ate" ("YYYY-MM-DD", inclusive), "tipo" ("compra" ou
+// "venda"), "valorMinimo" e "valorMaximo" (em reais), "limite" (transações por
+// página) e "cursor" (o campo "proximo" da página anterior)
+func validaFiltroRelatorio(r *http.Request, filtro database.FiltroTransacoes) (database.FiltroTransacoes, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return filtro, erros.CriaInternoPadrao(err)
+	}
+	err := erros.CriaVazio()
+
+	// Período
+	var de, ate time.Time
+	var errData error
+	if s := r.FormValue("de"); s != "" {
+		if de, errData = time.Parse("2006-01-02", s); errData != nil {
+			err = erros.JuntaErros(err, ErrDataInvalida)
+		} else {
+			filtro.Inicio = de.Format(formatoData)
+		}
+	}
+	if s := r.FormValue("ate"); s != "" {
+		if ate, errData = time.Parse("2006-01-02", s); errData != nil {
+			err = erros.JuntaErros(err, ErrDataInvalida)
+		} else {
+			filtro.Fim = ate.AddDate(0, 0, 1).Format(formatoData)
+		}
+	}
+	if filtro.Inicio != "" && filtro.Fim != "" && filtro.Fim <= filtro.Inicio {
+		err = erros.JuntaErros(err, ErrPeriodoInvalido)
+	}
+
+	// Tipo e valor das transações
+	filtro.Tipo = r.FormValue("tipo")
+	if filtro.Tipo != "" && filtro.Tipo != "compra" && filtro.Tipo != "venda" {
+		err = erros.JuntaErros(err, ErrTipoInvalido)
+	}
+	valorMinimo, okMinimo := valorFiltro(r.FormValue("valorMinimo"))
+	valorMaximo, okMaximo := valorFiltro(r.FormValue("valorMaximo"))
+	if !okMinimo || !okMaximo {
+		err = erros.JuntaErros(err, ErrValorInvalido)
+	}
+	filtro.ValorMinimo = valorMinimo
+	filtro.ValorMaximo = valorMaximo
+
+	// Paginação
+	filtro.Limite = limitePadrao
+	if s := r.FormValue("limite"); s != "" {
+		limite, errLimite := strconv.Atoi(s)
+		if errLimite != nil || limite <= 0 || limite > limiteMaximo {
+			err = erros.JuntaErros(err, ErrLimiteInvalido)
+		}
+		filtro.Limite = limite
+	}
+	if s := r.FormValue("cursor"); s != "" {
+		cursor, ok := decodificaCursor(s)
+		if !ok {
+			err = erros.JuntaErros(err, ErrCursorInvalido)
+		}
+		filtro.Apos = cursor
+	}
+	return filtro, err
+}
+
+// valorFiltro converte o valor em reais de um filtro. Um campo vazio resulta
+// em zero, que desativa o filtro. Retorna se o valor é válido.
+func valorFiltro(s string) (float64, bool) {
+	if s == "" {
+		return 0, true
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil || v < 0 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return 0, false
+	}
+	return v, true
+}
+
+// codificaCursor converte um cursor para a string opaca enviada ao cliente
+func codificaCursor(c database.Cursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(c.Dia + "|" + strconv.FormatInt(c.ID, 10)))
+}
+
+// decodificaCursor converte a string opaca enviada pelo cliente para um cursor.
+// Retorna se a string é um cursor válido.
+func decodificaCursor(s string) (database.Cursor, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return database.Cursor{}, false
+	}
+	partes := strings.Split(string(b), "|")
+	if len(partes) != 2 {
+		return database.Cursor{}, false
+	}
+	if _, err := time.Parse(formatoData, partes[0]); err != nil {
+		return database.Cursor{}, false
+	}
+	id, err := strconv.ParseInt(partes[1], 10, 64)
+	if err != nil || id <= 0 {
+		return database.Cursor{}, false
+	}
+	return database.Cursor{Dia: partes[0], ID: id}, true
+}
@@ -0,0 +1,59 @@
+package transacao
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/loteny/redcoins/database"
+	"github.com/loteny/redcoins/erros"
+)
+
+func TestCursor(t *testing.T) {
+	cursor := database.Cursor{Dia: "2018-01-02 10:00:00", ID: 42}
+	if decodificado, ok := decodificaCursor(codificaCursor(cursor)); !ok || decodificado != cursor {
+		t.Errorf("Cursor decodificado incorreto: %v", decodificado)
+	}
+	for _, s := range []string{"x", "MjAxOC0wMS0wMg", codificaCursor(database.Cursor{Dia: "ontem", ID: 1})} {
+		if _, ok := decodificaCursor(s); ok {
+			t.Errorf("Cursor inválido aceito: %v", s)
+		}
+	}
+}
+
+func TestValidaFiltroRelatorio(t *testing.T) {
+	casos := map[string]erros.Erros{
+		"":                                     erros.CriaVazio(),
+		"de=2018-01-01&ate=2018-01-01":         erros.CriaVazio(),
+		"tipo=venda&valorMinimo=1&limite=1000": erros.CriaVazio(),
+		"de=2018-01-02&ate=2018-01-01":         ErrPeriodoInvalido,
+		"de=2018-0101":                         ErrDataInvalida,
+		"tipo=troca":                           ErrTipoInvalido,
+		"valorMaximo=-1":                       ErrValorInvalido,
+		"valorMinimo=NaN":                      ErrValorInvalido,
+		"valorMinimo=-1&valorMaximo=abc":       ErrValorInvalido,
+		"tipo=troca&valorMaximo=-1&limite=0":   erros.JuntaErros(erros.JuntaErros(ErrTipoInvalido, ErrValorInvalido), ErrLimiteInvalido),
+		"limite=0":                             ErrLimiteInvalido,
+		"limite=1001":                          ErrLimiteInvalido,
+		"cursor=abc":                           ErrCursorInvalido,
+	}
+	for query, esperado := range casos {
+		r, err := http.NewRequest("GET", "/?"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := validaFiltroRelatorio(r, database.FiltroTransacoes{}); err.Error() != esperado.Error() {
+			t.Errorf("Erro inesperado para %q: %v (esperado %v)", query, err, esperado)
+		}
+	}
+
+	// Período e paginação padrão
+	r, err := http.NewRequest("GET", "/?de=2018-01-01&ate=2018-01-31", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtro, _ := validaFiltroRelatorio(r, database.FiltroTransacoes{Email: "a@b.com"})
+	if filtro.Email != "a@b.com" || filtro.Inicio != "2018-01-01 00:00:00" ||
+		filtro.Fim != "2018-02-01 00:00:00" || filtro.Limite != limitePadrao {
+		t.Errorf("Filtro incorreto: %v", filtro)
+	}
+}
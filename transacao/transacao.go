@@ -4,6 +4,7 @@ package transacao
 
 import (
 	"encoding/json"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -16,11 +17,32 @@ import (
 
 // Lista de possíveis erros do módulo
 var (
-	ErrQtdInvalida       = erros.Cria(false, 400, "qtd_invalida")
-	ErrDataInvalida      = erros.Cria(false, 400, "data_invalida")
-	ErrSaldoInsuficiente = erros.Cria(false, 400, "saldo_insuficiente")
+	ErrQtdInvalida        = erros.Cria(false, 400, "qtd_invalida")
+	ErrDataInvalida       = erros.Cria(false, 400, "data_invalida")
+	ErrDataForaDaJanela   = erros.Cria(false, 400, "data_fora_da_janela")
+	ErrSaldoInsuficiente  = erros.Cria(false, 400, "saldo_insuficiente")
+	ErrValorInvalido      = erros.Cria(false, 400, "valor_invalido")
+	ErrPrecoIndisponivel  = erros.Cria(false, 503, "preco_indisponivel")
+	ErrLimiteExcedido     = erros.Cria(false, 400, "limite_excedido")
+	ErrQtdAbaixoMinimo    = erros.Cria(false, 400, "qtd_abaixo_minimo")
+	ErrQtdAcimaMaximo     = erros.Cria(false, 400, "qtd_acima_maximo")
+	ErrQtdPassoInvalido   = erros.Cria(false, 400, "qtd_passo_invalido")
+	ErrQtdCasasDecimais   = erros.Cria(false, 400, "qtd_casas_decimais")
+	ErrValorAbaixoMinimo  = erros.Cria(false, 400, "valor_abaixo_minimo")
+	ErrEmailNaoVerificado = erros.Cria(false, 403, "email_nao_verificado")
+	ErrEmailInvalido      = erros.Cria(false, 400, "email_invalido")
 )
 
+// limitesResposta é a estrutura JSON dos limites de um usuário enviada ao
+// cliente. Além dos limites e do volume utilizado, contém o volume restante no
+// dia e no mês e o valor máximo da próxima transação.
+type limitesResposta struct {
+	database.Limites
+	RestanteDiario float64 `json:"restanteDiario"`
+	RestanteMensal float64 `json:"restanteMensal"`
+	Disponivel     float64 `json:"disponivel"`
+}
+
 // CompraHTTP realiza uma compra de Bitcoins a partir de um request HTTP
 func CompraHTTP(r *http.Request, email string) erros.Erros {
 	return transacaoHTTP(r, email, true)
@@ -31,52 +53,125 @@ func VendaHTTP(r *http.Request, email string) erros.Erros {
 	return transacaoHTTP(r, email, false)
 }
 
-// TransacoesDiaHTTP adquire todas as transações em um dia "YYYY-MM-DD" no campo
-// "data", retornando os bytes da string JSON com as transações para o cliente
+// TransacoesDiaHTTP adquire as transações de todos os usuários em um dia
+// "YYYY-MM-DD" no campo "data" ou em um período nos campos "de" e "ate",
+// retornando os bytes da string JSON com as transações para o cliente. Aceita
+// também os filtros e a paginação comuns aos relatórios.
 func TransacoesDiaHTTP(r *http.Request) ([]byte, erros.Erros) {
-	// Adquire o e-mail do request
-	if err := comunicacao.RealizaParseForm(r); err != nil {
-		return nil, erros.CriaInternoPadrao(err)
+	filtro, err := filtroDia(r)
+	if !erros.Vazio(err) {
+		return nil, err
 	}
-	data := r.FormValue("data")
+	return relatorioHTTP(r, filtro)
+}
 
-	// Adquire as transações
-	transacoes, err := database.AdquireTransacoesEmDia(data)
-	if err != nil {
-		return nil, erros.CriaInternoPadrao(err)
+// TransacoesUsuarioHTTP adquire as transações de um usuário a partir de seu
+// e-mail no campo "email", retornando os bytes da string JSON com as
+// transações para o cliente. Aceita também os filtros e a paginação comuns aos
+// relatórios.
+func TransacoesUsuarioHTTP(r *http.Request) ([]byte, erros.Erros) {
+	filtro, err := filtroUsuario(r)
+	if !erros.Vazio(err) {
+		return nil, err
 	}
-	trBytes, err := json.Marshal(map[string][]database.Transacao{"transacoes": transacoes})
-	if err != nil {
-		return nil, erros.CriaInternoPadrao(err)
+	return relatorioHTTP(r, filtro)
+}
+
+// filtroDia adquire o filtro específico do relatório de transações de um dia
+// ou período
+func filtroDia(r *http.Request) (database.FiltroTransacoes, erros.Erros) {
+	if err := comunicacao.RealizaParseForm(r); err != nil {
+		return database.FiltroTransacoes{}, erros.CriaInternoPadrao(err)
 	}
-	return trBytes, erros.CriaVazio()
+	filtro := database.FiltroTransacoes{}
+	if data := r.FormValue("data"); data != "" {
+		dia, err := time.Parse("2006-01-02", data)
+		if err != nil {
+			return filtro, ErrDataInvalida
+		}
+		filtro.Inicio = dia.Format(formatoData)
+		filtro.Fim = dia.AddDate(0, 0, 1).Format(formatoData)
+	} else if r.FormValue("de") == "" || r.FormValue("ate") == "" {
+		return filtro, ErrDataInvalida
+	}
+	return filtro, erros.CriaVazio()
 }
 
-// TransacoesUsuarioHTTP adquire todas as transações de um usuário a partir de
-// seu e-mail no campo "email", retornando os bytes da string JSON com as
-// transações para o cliente
-func TransacoesUsuarioHTTP(r *http.Request) ([]byte, erros.Erros) {
-	// Adquire o e-mail do request
+// filtroUsuario adquire o filtro específico do relatório de transações de um
+// usuário. O campo "email" é obrigatório: sem ele, o filtro abrangeria as
+// transações de todos os usuários.
+func filtroUsuario(r *http.Request) (database.FiltroTransacoes, erros.Erros) {
 	if err := comunicacao.RealizaParseForm(r); err != nil {
-		return nil, erros.CriaInternoPadrao(err)
+		return database.FiltroTransacoes{}, erros.CriaInternoPadrao(err)
 	}
 	email := r.FormValue("email")
+	if email == "" {
+		return database.FiltroTransacoes{}, ErrEmailInvalido
+	}
+	return database.FiltroTransacoes{Email: email}, erros.CriaVazio()
+}
 
-	// Adquire as transações
-	transacoes, err := database.AdquireTransacoesDeUsuario(email)
+// CompraValor realiza uma compra de Bitcoins gastando até 'valor' reais. A data
+// da transação é sempre atribuída pelo servidor. A quantidade de Bitcoins
+// comprada é arredondada para baixo até um múltiplo do passo das regras de
+// mercado e deve respeitar as demais regras. Retorna a quantidade de Bitcoins
+// comprada e o valor pago em reais. Se o preço da Bitcoin não pode ser
+// adquirido, retorna ErrPrecoIndisponivel.
+func CompraValor(email string, valor float64) (float64, float64, erros.Erros) {
+	if valor <= 0 {
+		return 0, 0, ErrValorInvalido
+	}
+	regras, err := database.AdquireRegrasMercado()
+	if err != nil {
+		return 0, 0, erros.CriaInternoPadrao(err)
+	}
+	precoUnidade, err := precobtc.PrecoUnidade()
+	if err != nil || precoUnidade <= 0 {
+		return 0, 0, ErrPrecoIndisponivel
+	}
+	qtd := arredondaPasso(valor/precoUnidade, regras)
+	if err := validaQtdRegras(strconv.FormatFloat(qtd, 'f', -1, 64), qtd, regras); !erros.Vazio(err) {
+		return 0, 0, err
+	}
+	preco := qtd * precoUnidade
+	if err := validaValorRegras(preco, regras); !erros.Vazio(err) {
+		return 0, 0, err
+	}
+	if err := insereTransacao(email, true, qtd, preco, Agora().Format(formatoData)); !erros.Vazio(err) {
+		return 0, 0, err
+	}
+	return qtd, preco, erros.CriaVazio()
+}
+
+// LimitesUsuarioHTTP retorna os bytes da string JSON com os limites de volume
+// em reais do nível de verificação do usuário e quanto ainda pode ser
+// transacionado no dia e no mês atuais
+func LimitesUsuarioHTTP(email string) ([]byte, erros.Erros) {
+	limites, err := database.AdquireLimitesUsuario(email, Agora().Format("2006-01-02"))
 	if err != nil {
 		return nil, erros.CriaInternoPadrao(err)
 	}
-	trBytes, err := json.Marshal(map[string][]database.Transacao{"transacoes": transacoes})
+	resposta := limitesResposta{
+		Limites:        limites,
+		RestanteDiario: math.Max(0, limites.Diario-limites.UtilizadoDiario),
+		RestanteMensal: math.Max(0, limites.Mensal-limites.UtilizadoMensal),
+	}
+	resposta.Disponivel = math.Min(limites.PorTransacao,
+		math.Min(resposta.RestanteDiario, resposta.RestanteMensal))
+	limitesBytes, err := json.Marshal(resposta)
 	if err != nil {
 		return nil, erros.CriaInternoPadrao(err)
 	}
-	return trBytes, erros.CriaVazio()
+	return limitesBytes, erros.CriaVazio()
 }
 
 func transacaoHTTP(r *http.Request, email string, compra bool) erros.Erros {
+	regras, err2 := database.AdquireRegrasMercado()
+	if err2 != nil {
+		return erros.CriaInternoPadrao(err2)
+	}
 	// Adquire os dados da compra
-	qtd, data, err := validaDadosTransacao(r)
+	qtd, data, err := validaDadosTransacao(r, regras)
 	if !erros.Vazio(err) {
 		return err
 	}
@@ -84,9 +179,25 @@ func transacaoHTTP(r *http.Request, email string, compra bool) erros.Erros {
 	if err2 != nil {
 		return erros.CriaInternoPadrao(err2)
 	}
-	// Insere no banco de dados
+	if err := validaValorRegras(preco, regras); !erros.Vazio(err) {
+		return err
+	}
+	return insereTransacao(email, compra, qtd, preco, data)
+}
+
+// insereTransacao insere a transação no banco de dados, convertendo os erros do
+// banco de dados para os erros do módulo. Usuários que ainda não verificaram
+// seu e-mail não podem realizar transações.
+func insereTransacao(email string, compra bool, qtd float64, preco float64, data string) erros.Erros {
+	if usr, err := database.AdquireUsuario(email); err != nil {
+		return erros.CriaInternoPadrao(err)
+	} else if !usr.EmailVerificado {
+		return ErrEmailNaoVerificado
+	}
 	if err := database.InsereTransacao(email, compra, qtd, preco, data); err == database.ErrSaldoInsuficiente {
 		return ErrSaldoInsuficiente
+	} else if err == database.ErrLimiteExcedido {
+		return ErrLimiteExcedido
 	} else if err != nil {
 		return erros.CriaInternoPadrao(err)
 	}
@@ -94,9 +205,10 @@ func transacaoHTTP(r *http.Request, email string, compra bool) erros.Erros {
 }
 
 // validaDadosTransacao verifica se a quantidade de Bitcoins a ser comprada ou
-// vendida é válida e retorna a quantidade de Bitcoins para transação e a data
-// da transação.
-func validaDadosTransacao(r *http.Request) (float64, string, erros.Erros) {
+// vendida é válida segundo as regras de mercado e retorna a quantidade de
+// Bitcoins para transação e a data da transação ("YYYY-MM-DD HH:MM:SS") segundo
+// a política de datas.
+func validaDadosTransacao(r *http.Request, regras database.RegrasMercado) (float64, string, erros.Erros) {
 	// Adquire os dados do request
 	if err := comunicacao.RealizaParseForm(r); err != nil {
 		return 0, "", erros.CriaInternoPadrao(err)
@@ -108,12 +220,16 @@ func validaDadosTransacao(r *http.Request) (float64, string, erros.Erros) {
 	// será encontrado no banco de dados e nem o servidor nem o banco de dados
 	// passaram a malfuncionar.
 	fQtd, err := strconv.ParseFloat(qtd, 64)
-	if err != nil || fQtd < 0 {
+	if err != nil || fQtd <= 0 || math.IsInf(fQtd, 0) || math.IsNaN(fQtd) {
 		return 0, "", ErrQtdInvalida
 	}
-	// Data da transação
-	if _, err := time.Parse("2006-01-02", data); err != nil {
-		return 0, "", ErrDataInvalida
+	if err := validaQtdRegras(qtd, fQtd, regras); !erros.Vazio(err) {
+		return 0, "", err
+	}
+	// Data da transação segundo a política de datas
+	data, errData := validaDataTransacao(data, time.Now())
+	if !erros.Vazio(errData) {
+		return 0, "", errData
 	}
 
 	return fQtd, data, erros.CriaVazio()
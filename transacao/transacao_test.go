@@ -1,6 +1,7 @@
 package transacao
 
 import (
+	"encoding/json"
 	"log"
 	"net/http"
 	"net/http/httptest"
@@ -33,13 +34,14 @@ func TestCompraHTTP(t *testing.T) {
 		Usuario:  "valido4@gmail.com",
 		Compra:   true,
 		Bitcoins: 0.03,
-		Dia:      "2015-01-01",
 	}
+	// A data enviada é ignorada: o servidor atribui o momento da transação
+	dataEnviada := "2015-01-01"
 
 	// Formulário válido
 	form := url.Values{}
 	form.Set("qtd", "0.03")
-	form.Set("data", esperado.Dia)
+	form.Set("data", dataEnviada)
 	// Função que vai chamar a função a ser testada e tratar seu retorno
 	rotaHTTP := func(w http.ResponseWriter, r *http.Request) {
 		err := CompraHTTP(r, esperado.Usuario)
@@ -57,7 +59,7 @@ func TestCompraHTTP(t *testing.T) {
 		if tr.Usuario != esperado.Usuario ||
 			tr.Compra != esperado.Compra ||
 			tr.Bitcoins != esperado.Bitcoins ||
-			tr.Dia != esperado.Dia {
+			!strings.HasPrefix(tr.Dia, Agora().Format("2006-01-02 ")) {
 			t.Errorf("Dados da transação incorretos: %v", tr)
 		}
 	}
@@ -73,6 +75,33 @@ func TestCompraHTTP(t *testing.T) {
 		}
 	}
 	testRealizaRequestHTTPPostForm(t, form, rotaHTTP)
+	form.Set("qtd", "NaN")
+	testRealizaRequestHTTPPostForm(t, form, rotaHTTP)
+
+	// Quantidade zero
+	form.Set("qtd", "0")
+	testRealizaRequestHTTPPostForm(t, form, rotaHTTP)
+
+	// Quantidade com mais casas decimais do que o permitido pelas regras de
+	// mercado
+	form.Set("qtd", "0.12345678901234567890")
+	rotaHTTP = func(w http.ResponseWriter, r *http.Request) {
+		err := CompraHTTP(r, esperado.Usuario)
+		if err.Error() != ErrQtdCasasDecimais.Error() {
+			t.Fatalf("Erro inesperado na transação: %v", err)
+		}
+	}
+	testRealizaRequestHTTPPostForm(t, form, rotaHTTP)
+
+	// Quantidade abaixo do mínimo das regras de mercado
+	form.Set("qtd", "0.000001")
+	rotaHTTP = func(w http.ResponseWriter, r *http.Request) {
+		err := CompraHTTP(r, esperado.Usuario)
+		if err.Error() != ErrQtdAbaixoMinimo.Error() {
+			t.Fatalf("Erro inesperado na transação: %v", err)
+		}
+	}
+	testRealizaRequestHTTPPostForm(t, form, rotaHTTP)
 }
 
 func TestVendaHTTP(t *testing.T) {
@@ -81,13 +110,14 @@ func TestVendaHTTP(t *testing.T) {
 		Usuario:  "valido3@gmail.com",
 		Compra:   false,
 		Bitcoins: 0.0001,
-		Dia:      "2012-01-01",
 	}
+	// A data enviada é ignorada: o servidor atribui o momento da transação
+	dataEnviada := "2012-01-01"
 
 	// Formulário válido
 	form := url.Values{}
 	form.Set("qtd", "0.0001")
-	form.Set("data", esperado.Dia)
+	form.Set("data", dataEnviada)
 	// Função que vai chamar a função a ser testada e tratar seu retorno
 	rotaHTTP := func(w http.ResponseWriter, r *http.Request) {
 		err := VendaHTTP(r, esperado.Usuario)
@@ -105,7 +135,7 @@ func TestVendaHTTP(t *testing.T) {
 		if tr.Usuario != esperado.Usuario ||
 			tr.Compra != esperado.Compra ||
 			tr.Bitcoins != esperado.Bitcoins ||
-			tr.Dia != esperado.Dia {
+			!strings.HasPrefix(tr.Dia, Agora().Format("2006-01-02 ")) {
 			t.Errorf("Dados da transação incorretos: %v", tr)
 		}
 	}
@@ -121,6 +151,8 @@ func TestVendaHTTP(t *testing.T) {
 		}
 	}
 	testRealizaRequestHTTPPostForm(t, form, rotaHTTP)
+	form.Set("qtd", "NaN")
+	testRealizaRequestHTTPPostForm(t, form, rotaHTTP)
 
 	// Saldo insuficiente
 	form.Set("qtd", "1000")
@@ -134,6 +166,34 @@ func TestVendaHTTP(t *testing.T) {
 	testRealizaRequestHTTPPostForm(t, form, rotaHTTP)
 }
 
+func TestLimiteExcedido(t *testing.T) {
+	// Uma compra de 100 Bitcoins ultrapassa o limite por transação de um
+	// usuário não verificado
+	form := url.Values{}
+	form.Set("qtd", "100")
+	form.Set("data", "2015-01-01")
+	rotaHTTP := func(w http.ResponseWriter, r *http.Request) {
+		err := CompraHTTP(r, "valido1@gmail.com")
+		if err.Error() != ErrLimiteExcedido.Error() {
+			t.Fatalf("Erro inesperado na transação: %v", err)
+		}
+	}
+	testRealizaRequestHTTPPostForm(t, form, rotaHTTP)
+}
+
+func TestLimitesUsuarioHTTP(t *testing.T) {
+	resp, err := LimitesUsuarioHTTP("valido1@gmail.com")
+	if !erros.Vazio(err) {
+		t.Fatalf("Erro inesperado: %v", err)
+	}
+	// O usuário não possui transações no dia e mês atuais
+	respostaEsperada := `{"nivel":0,"porTransacao":1000,"diario":2000,"mensal":10000,` +
+		`"utilizadoDiario":0,"utilizadoMensal":0,"restanteDiario":2000,"restanteMensal":10000,"disponivel":1000}`
+	if string(resp) != respostaEsperada {
+		t.Errorf("Limites incorretos: %v", string(resp))
+	}
+}
+
 func TestTransacoesDiaHTTP(t *testing.T) {
 	// Usamos o dia 2018-01-02 para verificar as transações que conhecemos
 	dados := map[string]string{"data": "2018-01-02"}
@@ -143,7 +203,7 @@ func TestTransacoesDiaHTTP(t *testing.T) {
 		if !erros.Vazio(err) {
 			t.Fatalf("Erro inesperado na transação: %v", err)
 		}
-		respostaEsperada := `{"transacoes":[{"usuario":"valido1@gmail.com","compra":true,"creditos":30,"bitcoins":0.003,"dia":"2018-01-02"},{"usuario":"valido2@gmail.com","compra":true,"creditos":40,"bitcoins":0.004,"dia":"2018-01-02"},{"usuario":"valido2@gmail.com","compra":false,"creditos":15,"bitcoins":0.0005,"dia":"2018-01-02"}]}`
+		respostaEsperada := `{"transacoes":[{"usuario":"valido1@gmail.com","compra":true,"creditos":30,"bitcoins":0.003,"dia":"2018-01-02 10:00:00"},{"usuario":"valido2@gmail.com","compra":true,"creditos":40,"bitcoins":0.004,"dia":"2018-01-02 10:00:00"},{"usuario":"valido2@gmail.com","compra":false,"creditos":15,"bitcoins":0.0005,"dia":"2018-01-02 10:00:00"}]}`
 		if string(resp) != respostaEsperada {
 			t.Errorf("Lista de transações incorreta: %v", string(resp))
 		}
@@ -151,6 +211,43 @@ func TestTransacoesDiaHTTP(t *testing.T) {
 	testRealizaRequestHTTPGetForm(t, dados, rotaHTTP)
 }
 
+func TestTransacoesDiaHTTPPaginacao(t *testing.T) {
+	// As compras de 2018-01-01 e 2018-01-02 em páginas de duas transações
+	dados := map[string]string{"de": "2018-01-01", "ate": "2018-01-02", "tipo": "compra", "limite": "2"}
+	var pagina relatorioResposta
+	rotaHTTP := func(w http.ResponseWriter, r *http.Request) {
+		resp, err := TransacoesDiaHTTP(r)
+		if !erros.Vazio(err) {
+			t.Fatalf("Erro inesperado no relatório: %v", err)
+		}
+		pagina = relatorioResposta{}
+		if err := json.Unmarshal(resp, &pagina); err != nil {
+			t.Fatalf("Erro inesperado no relatório: %v", err)
+		}
+	}
+	testRealizaRequestHTTPGetForm(t, dados, rotaHTTP)
+	if len(pagina.Transacoes) != 2 || pagina.Transacoes[0].Creditos != 10 ||
+		pagina.Transacoes[1].Creditos != 20 || pagina.Proximo == "" {
+		t.Fatalf("Primeira página incorreta: %v", pagina)
+	}
+
+	// A segunda página é a última
+	dados["cursor"] = pagina.Proximo
+	testRealizaRequestHTTPGetForm(t, dados, rotaHTTP)
+	if len(pagina.Transacoes) != 2 || pagina.Transacoes[0].Creditos != 30 ||
+		pagina.Transacoes[1].Creditos != 40 || pagina.Proximo != "" {
+		t.Errorf("Segunda página incorreta: %v", pagina)
+	}
+
+	// Sem data nem período
+	rotaHTTP = func(w http.ResponseWriter, r *http.Request) {
+		if _, err := TransacoesDiaHTTP(r); err.Error() != ErrDataInvalida.Error() {
+			t.Errorf("Erro inesperado no relatório: %v", err)
+		}
+	}
+	testRealizaRequestHTTPGetForm(t, map[string]string{"de": "2018-01-01"}, rotaHTTP)
+}
+
 func TestTransacoesUsuarioHTTP(t *testing.T) {
 	// Usamos o usuário valido1@gmail.com para verificar as transações que conhecemos
 	dados := map[string]string{"email": "valido1@gmail.com"}
@@ -160,12 +257,23 @@ func TestTransacoesUsuarioHTTP(t *testing.T) {
 		if !erros.Vazio(err) {
 			t.Fatalf("Erro inesperado na transação: %v", err)
 		}
-		respostaEsperada := `{"transacoes":[{"usuario":"valido1@gmail.com","compra":true,"creditos":10,"bitcoins":0.001,"dia":"2018-01-01"},{"usuario":"valido1@gmail.com","compra":true,"creditos":20,"bitcoins":0.002,"dia":"2018-01-01"},{"usuario":"valido1@gmail.com","compra":true,"creditos":30,"bitcoins":0.003,"dia":"2018-01-02"}]}`
+		respostaEsperada := `{"transacoes":[{"usuario":"valido1@gmail.com","compra":true,"creditos":10,"bitcoins":0.001,"dia":"2018-01-01 10:00:00"},{"usuario":"valido1@gmail.com","compra":true,"creditos":20,"bitcoins":0.002,"dia":"2018-01-01 10:00:00"},{"usuario":"valido1@gmail.com","compra":true,"creditos":30,"bitcoins":0.003,"dia":"2018-01-02 10:00:00"}]}`
 		if string(resp) != respostaEsperada {
 			t.Errorf("Lista de transações incorreta: %v", string(resp))
 		}
 	}
 	testRealizaRequestHTTPGetForm(t, dados, rotaHTTP)
+
+	// Sem o campo "email", nenhuma transação é retornada
+	rotaHTTP = func(w http.ResponseWriter, r *http.Request) {
+		if resp, err := TransacoesUsuarioHTTP(r); err.Error() != ErrEmailInvalido.Error() {
+			t.Errorf("Resposta inesperada: %v (%v)", string(resp), err)
+		}
+		if _, err := ExportaTransacoesUsuarioHTTP(r, "csv"); err.Error() != ErrEmailInvalido.Error() {
+			t.Errorf("Erro inesperado na exportação: %v", err)
+		}
+	}
+	testRealizaRequestHTTPGetForm(t, map[string]string{}, rotaHTTP)
 }
 
 // testRealizaRequestHTTPPostForm é uma função auxiliar para geração de requests
@@ -218,6 +326,7 @@ func testRealizaRequestHTTPGetForm(t *testing.T, dados map[string]string,
 // - 1 compra no mesmo dia que a anterior para o segundo usuário
 // - 1 venda no mesmo dia que as duas compras anteriores para o primeiro usuário
 // - 1 compra em um dia "irrelevante" para o terceiro usuário de 1 BTC
+// O quarto usuário possui o nível máximo de verificação.
 func testPopulaDatabase() error {
 	// Usuário 1
 	senha, err := passenc.GeraHashed([]byte("senhavalido1"))
@@ -225,10 +334,11 @@ func testPopulaDatabase() error {
 		return err
 	}
 	usr := database.Usuario{
-		Email:      "valido1@gmail.com",
-		Senha:      senha,
-		Nome:       "Conta Válida 1",
-		Nascimento: "1994-03-07",
+		Email:           "valido1@gmail.com",
+		Senha:           senha,
+		Nome:            "Conta Válida 1",
+		Nascimento:      "1994-03-07",
+		EmailVerificado: true,
 	}
 	if err := database.InsereUsuario(&usr); err != nil {
 		return err
@@ -240,10 +350,11 @@ func testPopulaDatabase() error {
 		return err
 	}
 	usr = database.Usuario{
-		Email:      "valido2@gmail.com",
-		Senha:      senha,
-		Nome:       "Conta Válida 2",
-		Nascimento: "1994-03-08",
+		Email:           "valido2@gmail.com",
+		Senha:           senha,
+		Nome:            "Conta Válida 2",
+		Nascimento:      "1994-03-08",
+		EmailVerificado: true,
 	}
 	if err := database.InsereUsuario(&usr); err != nil {
 		return err
@@ -255,10 +366,11 @@ func testPopulaDatabase() error {
 		return err
 	}
 	usr = database.Usuario{
-		Email:      "valido3@gmail.com",
-		Senha:      senha,
-		Nome:       "Conta Válida 3",
-		Nascimento: "1994-03-09",
+		Email:           "valido3@gmail.com",
+		Senha:           senha,
+		Nome:            "Conta Válida 3",
+		Nascimento:      "1994-03-09",
+		EmailVerificado: true,
 	}
 	if err := database.InsereUsuario(&usr); err != nil {
 		return err
@@ -270,33 +382,35 @@ func testPopulaDatabase() error {
 		return err
 	}
 	usr = database.Usuario{
-		Email:      "valido4@gmail.com",
-		Senha:      senha,
-		Nome:       "Conta Válida 4",
-		Nascimento: "1994-03-10",
+		Email:           "valido4@gmail.com",
+		Senha:           senha,
+		Nome:            "Conta Válida 4",
+		Nascimento:      "1994-03-10",
+		Nivel:           2,
+		EmailVerificado: true,
 	}
 	if err := database.InsereUsuario(&usr); err != nil {
 		return err
 	}
 
 	// Compras
-	if err := database.InsereTransacao("valido1@gmail.com", true, 0.001, 10, "2018-01-01"); err != nil {
+	if err := database.InsereTransacao("valido1@gmail.com", true, 0.001, 10, "2018-01-01 10:00:00"); err != nil {
 		return err
 	}
-	if err := database.InsereTransacao("valido1@gmail.com", true, 0.002, 20, "2018-01-01"); err != nil {
+	if err := database.InsereTransacao("valido1@gmail.com", true, 0.002, 20, "2018-01-01 10:00:00"); err != nil {
 		return err
 	}
-	if err := database.InsereTransacao("valido1@gmail.com", true, 0.003, 30, "2018-01-02"); err != nil {
+	if err := database.InsereTransacao("valido1@gmail.com", true, 0.003, 30, "2018-01-02 10:00:00"); err != nil {
 		return err
 	}
-	if err := database.InsereTransacao("valido2@gmail.com", true, 0.004, 40, "2018-01-02"); err != nil {
+	if err := database.InsereTransacao("valido2@gmail.com", true, 0.004, 40, "2018-01-02 10:00:00"); err != nil {
 		return err
 	}
-	if err := database.InsereTransacao("valido3@gmail.com", true, 1, 400, "2012-01-02"); err != nil {
+	if err := database.InsereTransacao("valido3@gmail.com", true, 1, 400, "2012-01-02 10:00:00"); err != nil {
 		return err
 	}
 	// Venda
-	if err := database.InsereTransacao("valido2@gmail.com", false, 0.0005, 15, "2018-01-02"); err != nil {
+	if err := database.InsereTransacao("valido2@gmail.com", false, 0.0005, 15, "2018-01-02 10:00:00"); err != nil {
 		return err
 	}
 